@@ -0,0 +1,319 @@
+package main
+
+import (
+  "fmt"
+  "errors"
+  "sync"
+  "time"
+  "context"
+  "github.com/spf13/cobra"
+  "wallet-go/pkg/db"
+  "wallet-go/pkg/mq"
+  "wallet-go/pkg/configure"
+  "wallet-go/pkg/blockchain"
+  "github.com/streadway/amqp"
+  "github.com/ethereum/go-ethereum/common"
+  "github.com/ethereum/go-ethereum/ethclient"
+  "github.com/ethereum/go-ethereum/core/types"
+)
+
+// ethereumTrackDepth blocks rechecked for reorganization on every new block, at least chain confirmations
+const ethereumTrackDepth = 12
+
+// ethereumTraceAttempts tries of tracing a block before scanning stops at it until the next block
+const ethereumTraceAttempts = 3
+
+// errEthereumReorg parent of scanned block isn't the scanned block below it, chain reorganized while scanning
+var errEthereumReorg = errors.New("Ethereum parent block is reorganized")
+
+var (
+  ethereumChain blockchain.EthereumChain
+  // ethereumScan serializes block scanning of catching up and mq messages
+  ethereumScan sync.Mutex
+  // ethereumTraceFallback node can't trace calls, internal transfers are missed until restart
+  ethereumTraceFallback bool
+)
+
+// Deposit command
+var Deposit = &cobra.Command {
+  Use:   "deposit",
+  Short: "ledger consumer, record deposits to sub addresses",
+  Run: func (cmd *cobra.Command, args []string) {
+    switch chain {
+    case "ethereum":
+      ethereumClient, err := ethclient.Dial(configure.Config.EthRPC)
+      if err != nil {
+        configure.Sugar.Fatal("Ethereum client error: ", err.Error())
+      }
+      defer ethereumClient.Close()
+      sqldb, err = db.NewMySQL()
+      if err != nil {
+        configure.Sugar.Fatal(err.Error())
+      }
+      defer sqldb.Close()
+      ethereumChain = blockchain.EthereumChain{Client: ethereumClient}
+
+      if err := scanEthereum(); err != nil {
+        configure.Sugar.Fatal(err.Error())
+      }
+
+      var wg sync.WaitGroup
+      wg.Add(1)
+      go ethereumMQ(&wg)
+      wg.Wait()
+    default:
+      configure.Sugar.Fatal("Unsupport chain: ", chain)
+    }
+  },
+}
+
+func ethereumMQ(wg *sync.WaitGroup) {
+  defer wg.Done()
+  forever := make(chan bool)
+  messageClient = &mq.MessagingClient{}
+  messageClient.ConnectToBroker(configure.Config.MQ)
+  if err := messageClient.Subscribe("ethereum_bestblock", "fanout", "ethereum_best_block_queue", "ethereum", "", onEthereumMessage); err != nil {
+    configure.Sugar.Fatal("monitor address mq subscribe error: ", err.Error())
+  }
+  <-forever
+}
+
+// onEthereumMessage new block head of ledger_monitor triggers scanning, blocks are queried from node
+// so missed or duplicated messages don't leave gaps
+func onEthereumMessage(d amqp.Delivery) {
+  if err := scanEthereum(); err != nil {
+    configure.Sugar.Error(err.Error())
+  }
+}
+
+// scanEthereum step back from reorganized blocks, scan blocks up to the best height,
+// then count confirmations of deposits until chain confirmations
+func scanEthereum() error {
+  ethereumScan.Lock()
+  defer ethereumScan.Unlock()
+
+  head, err := ethereumBestHeight(context.Background())
+  if err != nil {
+    return err
+  }
+  confirmations := ethereumConfirmations()
+
+  latest, err := sqldb.LatestEthereumBlock()
+  if err != nil {
+    return err
+  }
+  var next uint64
+  if latest == nil {
+    // first run starts from blocks which are about to be confirmed
+    if head + 1 > confirmations {
+      next = head + 1 - confirmations
+    }
+  }else {
+    if next, err = trackEthereum(latest); err != nil {
+      return err
+    }
+  }
+  for height, reorgs := next, 0; height <= head; height++ {
+    err = scanEthereumBlock(height)
+    if err == errEthereumReorg && reorgs < ethereumTrackDepth {
+      // walk back from the block below, which left the best chain, and rescan from the fork
+      reorgs++
+      if latest, err = sqldb.LatestEthereumBlock(); err != nil {
+        return err
+      }
+      if next, err = trackEthereum(latest); err != nil {
+        return err
+      }
+      height = next - 1
+      continue
+    }
+    if err != nil {
+      return err
+    }
+  }
+
+  confirmed, err := sqldb.ConfirmEthereumDeposits(head, confirmations)
+  if err != nil {
+    return fmt.Errorf("Confirm ethereum deposits %s", err)
+  }
+  for _, deposit := range confirmed {
+    configure.Sugar.Info("deposit confirmed: ", deposit.Amount, " ", deposit.Asset, " to ", deposit.ToAddress, " txid: ", deposit.Txid)
+  }
+  return nil
+}
+
+// ethereumConfirmations confirmations of ethereum deposit, at least 1
+func ethereumConfirmations() uint64 {
+  if confirmations := configure.ChainsInfo[blockchain.Ethereum].Confirmations; confirmations > 0 {
+    return uint64(confirmations)
+  }
+  return 1
+}
+
+// ethereumBestHeight best block height of node
+func ethereumBestHeight(ctx context.Context) (uint64, error) {
+  header, err := ethereumChain.Client.HeaderByNumber(ctx, nil)
+  if err != nil {
+    return 0, fmt.Errorf("Query ethereum best block %s", err)
+  }
+  return header.Number.Uint64(), nil
+}
+
+// trackEthereum compare recent scanned blocks with node, blocks no longer on the best chain are marked reorganized.
+// returns height to scan from
+func trackEthereum(latest *db.EthereumBlock) (uint64, error) {
+  maxDepth := uint64(ethereumTrackDepth)
+  if confirmations := ethereumConfirmations(); confirmations > maxDepth {
+    maxDepth = confirmations
+  }
+  block := latest
+  for depth := uint64(0); depth < maxDepth; depth++ {
+    head, err := ethereumChain.BlockHead(block.Height)
+    if err != nil {
+      return 0, err
+    }
+    if head != nil && head.Hash == block.Hash {
+      return block.Height + 1, nil
+    }
+    configure.Sugar.Warn("reorg: ", block.Height, " ", block.Hash)
+    if err = sqldb.ReorgEthereumBlock(block); err != nil {
+      return 0, fmt.Errorf("Reorg ethereum block %s %s", block.Hash, err)
+    }
+    if block, err = sqldb.LatestEthereumBlock(); err != nil {
+      return 0, err
+    }
+    // every scanned block is reorganized, rescan their heights
+    if block == nil {
+      return latest.Height - depth, nil
+    }
+  }
+  return 0, fmt.Errorf("Ethereum reorg deeper than %d blocks from %d", maxDepth, latest.Height)
+}
+
+// scanEthereumBlock record ether and token transfers of block at height which pay to sub addresses,
+// ether transfer of failed tx is skipped, logs of token transfer only exist when tx succeeds.
+// errEthereumReorg is returned when block doesn't extend the scanned block below it
+func scanEthereumBlock(height uint64) error {
+  ctx := context.Background()
+  head, err := ethereumChain.BlockHead(height)
+  if err != nil {
+    return err
+  }
+  if head == nil {
+    return fmt.Errorf("Ethereum block %d not found", height)
+  }
+  if height > 0 {
+    parent, err := sqldb.EthereumBlockAt(height - 1)
+    if err != nil {
+      return err
+    }
+    if parent != nil && parent.Hash != head.ParentHash {
+      configure.Sugar.Warn("parent of ", height, " ", head.Hash, " is ", head.ParentHash, ", not scanned ", parent.Hash)
+      return errEthereumReorg
+    }
+  }
+  etherTransfers, err := ethereumChain.EtherTransfers(head)
+  if err != nil {
+    return err
+  }
+  internalTransfers, err := ethereumInternalTransfers(head)
+  if err != nil {
+    return err
+  }
+  var tos []string
+  for _, transfer := range append(etherTransfers, internalTransfers...) {
+    tos = append(tos, transfer.To)
+  }
+  subAddresses, err := sqldb.SubAddressIDs(tos, blockchain.Ethereum)
+  if err != nil {
+    return err
+  }
+  var transfers []blockchain.EthereumTransfer
+  for _, transfer := range etherTransfers {
+    if _, ok := subAddresses[transfer.To]; !ok {
+      continue
+    }
+    receipt, err := ethereumChain.Client.TransactionReceipt(ctx, common.HexToHash(transfer.Txid))
+    if err != nil {
+      return fmt.Errorf("Receipt of %s %s", transfer.Txid, err)
+    }
+    if receipt.Status != types.ReceiptStatusSuccessful {
+      configure.Sugar.Info("skip failed tx ", transfer.Txid, " to ", transfer.To)
+      continue
+    }
+    transfers = append(transfers, transfer)
+  }
+  // internal calls of failed tx are reverted, tracer reports them with error
+  for _, transfer := range internalTransfers {
+    if _, ok := subAddresses[transfer.To]; ok {
+      transfers = append(transfers, transfer)
+    }
+  }
+  tokenTransfers, err := ethereumChain.TokenTransfers(head)
+  if err != nil {
+    return err
+  }
+  transfers = append(transfers, tokenTransfers...)
+  // gas top-ups and sweeps recorded by wallet_gateway move funds between own addresses, they aren't deposits,
+  // while other withdrawals from sweep_address to sub addresses still are
+  var txids []string
+  for _, transfer := range transfers {
+    txids = append(txids, transfer.Txid)
+  }
+  sweepTxids, err := sqldb.EthereumSweepTxids(txids, blockchain.Ethereum)
+  if err != nil {
+    return err
+  }
+  var candidates []db.EthereumDeposit
+  for _, transfer := range transfers {
+    if sweepTxids[transfer.Txid] {
+      continue
+    }
+    candidates = append(candidates, db.EthereumDeposit{
+      Txid: transfer.Txid,
+      BlockHash: transfer.BlockHash,
+      LogIndex: transfer.LogIndex,
+      Height: transfer.Height,
+      Asset: transfer.Asset,
+      Token: transfer.Token,
+      FromAddress: transfer.From,
+      ToAddress: transfer.To,
+      Amount: transfer.Amount,
+      TraceAddress: transfer.TraceAddress,
+    })
+  }
+  deposits, err := sqldb.SaveEthereumBlock(&db.EthereumBlock{Hash: head.Hash, Height: head.Height}, candidates, blockchain.Ethereum)
+  if err != nil {
+    return err
+  }
+  for _, deposit := range deposits {
+    configure.Sugar.Info("deposit: ", deposit.Amount, " ", deposit.Asset, " to ", deposit.ToAddress, " txid: ", deposit.Txid, " log: ", deposit.LogIndex, " trace: ", deposit.TraceAddress)
+  }
+  configure.Sugar.Info("Saved ethereum block to database, height: ", head.Height, " hash: ", head.Hash)
+  return nil
+}
+
+// ethereumInternalTransfers internal ether transfers of block when trace_internal is enabled,
+// falls back to top level txs only once node turns out not to serve tracing. other errors are retried,
+// then fail the block so scanning doesn't pass it until its traces are read
+func ethereumInternalTransfers(head *blockchain.EthereumBlockHead) ([]blockchain.EthereumTransfer, error) {
+  if !configure.ChainsInfo[blockchain.Ethereum].TraceInternal || ethereumTraceFallback {
+    return nil, nil
+  }
+  var err error
+  for attempt := 1; attempt <= ethereumTraceAttempts; attempt++ {
+    var transfers []blockchain.EthereumTransfer
+    transfers, err = ethereumChain.InternalTransfers(head)
+    if err == nil {
+      return transfers, nil
+    }
+    if err == blockchain.ErrTraceUnavailable {
+      configure.Sugar.Warn(err.Error(), ", deposits sent by contracts are missed, enable debug api of node and restart")
+      ethereumTraceFallback = true
+      return nil, nil
+    }
+    configure.Sugar.Warn("trace ethereum block ", head.Height, " attempt ", attempt, " error: ", err.Error())
+    time.Sleep(time.Duration(attempt) * time.Second)
+  }
+  return nil, err
+}
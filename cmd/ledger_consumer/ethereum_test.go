@@ -0,0 +1,122 @@
+package main
+
+import (
+  "testing"
+  "wallet-go/pkg/db"
+  "wallet-go/pkg/blockchain"
+  "github.com/jinzhu/gorm"
+  "github.com/ybbus/jsonrpc"
+  "github.com/ethereum/go-ethereum/common/hexutil"
+  // sqlite driven
+  _ "github.com/jinzhu/gorm/dialects/sqlite"
+)
+
+// testHeads json-rpc client answering eth_getBlockByNumber with hash of the node's best chain at height
+type testHeads struct {
+  jsonrpc.RPCClient
+  hashes map[uint64]string
+}
+
+func (c testHeads) Call(method string, params ...interface{}) (*jsonrpc.RPCResponse, error) {
+  height, err := hexutil.DecodeUint64(params[0].(string))
+  if err != nil {
+    return nil, err
+  }
+  hash, ok := c.hashes[height]
+  if !ok {
+    return &jsonrpc.RPCResponse{}, nil
+  }
+  return &jsonrpc.RPCResponse{Result: map[string]interface{}{"number": params[0], "hash": hash, "parentHash": c.hashes[height - 1]}}, nil
+}
+
+// testScanned sqldb of scanned blocks with one deposit each, replaced until test ends
+func testScanned(t *testing.T, hashes map[uint64]string) {
+  gdb, err := gorm.Open("sqlite3", ":memory:")
+  if err != nil {
+    t.Fatal(err)
+  }
+  gdb.DB().SetMaxOpenConns(1)
+  if err = gdb.AutoMigrate(&db.EthereumBlock{}, &db.EthereumDeposit{}).Error; err != nil {
+    t.Fatal(err)
+  }
+  for height, hash := range hashes {
+    if err = gdb.Create(&db.EthereumBlock{Hash: hash, Height: height}).Error; err != nil {
+      t.Fatal(err)
+    }
+    if err = gdb.Create(&db.EthereumDeposit{Txid: hash, BlockHash: hash, Height: height, Asset: "eth", FromAddress: "0x1", ToAddress: "0x2", Amount: "1"}).Error; err != nil {
+      t.Fatal(err)
+    }
+  }
+  previous := sqldb
+  sqldb = &db.GormDB{DB: gdb}
+  t.Cleanup(func() {
+    sqldb = previous
+    gdb.Close()
+  })
+}
+
+func TestTrackEthereum(t *testing.T) {
+  previous := ethereumChain
+  t.Cleanup(func() {
+    ethereumChain = previous
+  })
+  scanned := map[uint64]string{98: "0xa98", 99: "0xa99", 100: "0xa100"}
+  cases := []struct {
+    name     string
+    node     map[uint64]string
+    next     uint64
+    reorged  []uint64
+  }{
+    {"best chain", map[uint64]string{98: "0xa98", 99: "0xa99", 100: "0xa100", 101: "0xa101"}, 101, nil},
+    // walk back to the fork, blocks above it left the best chain
+    {"reorg", map[uint64]string{98: "0xa98", 99: "0xb99", 100: "0xb100"}, 99, []uint64{99, 100}},
+    // node rolled back below the scanned tip
+    {"shorter chain", map[uint64]string{98: "0xa98", 99: "0xa99"}, 100, []uint64{100}},
+    // every scanned block is replaced, their heights are scanned again
+    {"all replaced", map[uint64]string{98: "0xb98", 99: "0xb99", 100: "0xb100"}, 98, []uint64{98, 99, 100}},
+  }
+  for _, c := range cases {
+    testScanned(t, scanned)
+    ethereumChain = blockchain.EthereumChain{RPC: testHeads{hashes: c.node}}
+    latest, err := sqldb.LatestEthereumBlock()
+    if err != nil {
+      t.Fatal(err)
+    }
+    next, err := trackEthereum(latest)
+    if err != nil {
+      t.Fatalf("%s: %v", c.name, err)
+    }
+    if next != c.next {
+      t.Fatalf("%s: next %d", c.name, next)
+    }
+    var reorged []uint64
+    if err = sqldb.Model(&db.EthereumBlock{}).Where("re_org = ?", true).Order("height").Pluck("height", &reorged).Error; err != nil {
+      t.Fatal(err)
+    }
+    var deposits int
+    sqldb.Model(&db.EthereumDeposit{}).Where("re_org = ?", true).Count(&deposits)
+    if len(reorged) != len(c.reorged) || deposits != len(c.reorged) {
+      t.Fatalf("%s: reorganized blocks %v deposits %d", c.name, reorged, deposits)
+    }
+    for i := range reorged {
+      if reorged[i] != c.reorged[i] {
+        t.Fatalf("%s: reorganized blocks %v", c.name, reorged)
+      }
+    }
+  }
+
+  // reorg deeper than track depth isn't walked back
+  deep := make(map[uint64]string)
+  for height := uint64(1); height <= ethereumTrackDepth + 1; height++ {
+    deep[height] = hexutil.EncodeUint64(height)
+  }
+  testScanned(t, deep)
+  ethereumChain = blockchain.EthereumChain{RPC: testHeads{hashes: map[uint64]string{}}}
+  latest, err := sqldb.LatestEthereumBlock()
+  if err != nil {
+    t.Fatal(err)
+  }
+  if _, err = trackEthereum(latest); err == nil {
+    t.Fatal("deep reorg is walked back")
+  }
+}
@@ -25,4 +25,7 @@ func init()  {
   rootCmd.AddCommand(UTXO)
   UTXO.Flags().StringVarP(&chain, "chain", "c", "", "Support bitcoincore")
   UTXO.MarkFlagRequired("chain")
+  rootCmd.AddCommand(Deposit)
+  Deposit.Flags().StringVarP(&chain, "chain", "c", "", "Support ethereum")
+  Deposit.MarkFlagRequired("chain")
 }
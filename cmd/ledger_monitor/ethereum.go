@@ -2,30 +2,32 @@ package main
 
 import(
   "fmt"
-  "context"
   "math/big"
   "encoding/json"
   "wallet-go/pkg/configure"
+  "wallet-go/pkg/blockchain"
   "github.com/ethereum/go-ethereum/ethclient"
   "github.com/ethereum/go-ethereum/core/types"
 )
 
+// subHandle publish head of every block from order height to the subscribed one,
+// go-ethereum in use can't decode London blocks so heads are queried by raw json rpc
 func subHandle(orderHeight *big.Int, head *types.Header, nodeClient *ethclient.Client) (*big.Int, error) {
-	ctx := context.Background()
+	chain := blockchain.EthereumChain{Client: nodeClient}
 	number := head.Number
-	originBlock, err := nodeClient.BlockByNumber(ctx, head.Number)
-	if err != nil {
-		return nil, fmt.Errorf("Get origin block error, height: %s , %s", number.String(), err)
+	originBlock, err := chain.BlockHead(number.Uint64())
+	if err != nil || originBlock == nil {
+		return orderHeight, fmt.Errorf("Get origin block error, height: %s , %v", number.String(), err)
 	}
 
 	if orderHeight.Cmp(big.NewInt(0)) == 0 {
-		orderHeight = originBlock.Number()
+		orderHeight = new(big.Int).SetUint64(originBlock.Height)
 	}
 
-	configure.Sugar.Info("sub message coming from ethereum,", "order height:", orderHeight.Int64(), " sub block height:", originBlock.Number().Int64())
-	for blockNumber := orderHeight.Int64(); blockNumber <= originBlock.Number().Int64(); blockNumber++ {
-		block, err := nodeClient.BlockByNumber(ctx, big.NewInt(blockNumber))
-		if err != nil {
+	configure.Sugar.Info("sub message coming from ethereum,", "order height:", orderHeight.Int64(), " sub block height:", originBlock.Height)
+	for blockNumber := orderHeight.Uint64(); blockNumber <= originBlock.Height; blockNumber++ {
+		block, err := chain.BlockHead(blockNumber)
+		if err != nil || block == nil {
 			configure.Sugar.Warn("Get block error, height:", blockNumber)
 			continue
 		}
@@ -33,7 +35,8 @@ func subHandle(orderHeight *big.Int, head *types.Header, nodeClient *ethclient.C
     if err != nil {
       configure.Sugar.Warn("json Marshal raw ethereum block error", err.Error())
     }
-		messageClient.Publish(body, "bestblock", "fanout", "ethereum", "ethereum_best_block_queue")
+		// bestblock fanout exchange delivers to bitcoin consumer as well, ethereum heads have their own exchange
+		messageClient.Publish(body, "ethereum_bestblock", "fanout", "ethereum", "ethereum_best_block_queue")
 		orderHeight.Add(orderHeight, big.NewInt(1))
 	}
 	return orderHeight, nil
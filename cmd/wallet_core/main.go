@@ -7,8 +7,13 @@ import (
 	"google.golang.org/grpc"
 	pb "wallet-go/pkg/pb"
 	"wallet-go/pkg/rpc"
+	"wallet-go/pkg/db"
+	"wallet-go/pkg/keystore"
+	"wallet-go/pkg/util"
+	"wallet-go/pkg/blockchain"
 	"wallet-go/pkg/configure"
 	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/credentials"
 )
 
 func main() {
@@ -21,15 +26,65 @@ func main() {
 		configure.Sugar.Fatal("rpc server error: ", err.Error())
 	}
 
+	tlsConfig, err := util.ServerTLSConfig(configure.Config.WalletCoreTLS)
+	if err != nil {
+		configure.Sugar.Fatal("wallet_core_tls error: ", err.Error())
+	}
+	if len(configure.Config.WalletCoreTLS.Signers) == 0 {
+		configure.Sugar.Warn("wallet_core_tls signers is empty, Signature* methods are denied")
+	}
+
+	// wallet_core has no node client to query token decimals
+	if assets := blockchain.EthereumTokensWithoutDecimals(); len(assets) > 0 {
+		configure.Sugar.Fatal("decimals of ethereum tokens ", assets, " must be configured as {address, decimals}")
+	}
+
 	lis, err := net.Listen("tcp", strings.Join([]string{":", port}, ""))
 	if err != nil {
 		configure.Sugar.Fatal("failed to listen: %v", err)
 	}
 
-	rpcServer := grpc.NewServer()
-	pb.RegisterWalletCoreServer(rpcServer, &rpc.WalletCoreServerRPC{})
+	passphrase, err := util.PromptPassphrase("Wallet passphrase", false)
+	if err != nil {
+		configure.Sugar.Fatal("read passphrase error: ", err.Error())
+	}
+	hd, err := blockchain.UnlockHDWallet(passphrase)
+	if err != nil {
+		configure.Sugar.Fatal("unlock hd wallet error: ", err.Error())
+	}
+	kek, err := db.UnlockKEK(passphrase)
+	if err != nil {
+		hd.Close()
+		configure.Sugar.Fatal("unlock key store error: ", err.Error())
+	}
+	server, err := rpc.NewWalletCoreServerRPC(hd, &keystore.Secret{KEK: kek, Passphrase: passphrase})
+	if err != nil {
+		configure.Sugar.Fatal("open key store error: ", err.Error())
+	}
+
+	rpcServer := grpc.NewServer(
+		grpc.Creds(credentials.NewTLS(tlsConfig)),
+		grpc.UnaryInterceptor(rpc.ChainUnaryInterceptors(server.AuditInterceptor(), rpc.AuthInterceptor(configure.Config.WalletCoreTLS))))
+	pb.RegisterWalletCoreServer(rpcServer, server)
 	reflection.Register(rpcServer)
+
+	// finish in-flight signature before releasing key stores, key stores are closed once by main goroutine
+	stopped := make(chan struct{})
+	closed := make(chan struct{})
+	util.HandleSigterm(func() {
+		rpcServer.GracefulStop()
+		close(stopped)
+		<-closed
+	})
+	// Serve returns nil as soon as GracefulStop starts, wait until it finishes
 	if err := rpcServer.Serve(lis); err != nil {
 		configure.Sugar.Info("failed to serve: ", err.Error())
+	}else {
+		<-stopped
+	}
+	if err := server.Close(); err != nil {
+		configure.Sugar.Warn("close wallet core error: ", err.Error())
 	}
+	configure.Sugar.Info("wallet core stopped")
+	close(closed)
 }
@@ -0,0 +1,302 @@
+package main
+
+import (
+  "fmt"
+  "time"
+  "context"
+  "strings"
+  "strconv"
+  "net/http"
+  "crypto/rand"
+  "encoding/hex"
+  "encoding/json"
+  "github.com/gin-gonic/gin"
+  "wallet-go/pkg/configure"
+  "wallet-go/pkg/blockchain"
+  "wallet-go/pkg/db"
+  "wallet-go/pkg/util"
+  "github.com/btcsuite/btcutil"
+  "google.golang.org/grpc/codes"
+  "google.golang.org/grpc/status"
+  "google.golang.org/genproto/googleapis/rpc/errdetails"
+)
+
+const (
+  defaultBatchWindow = 60
+  defaultBatchSize   = 50
+)
+
+// batchFlush flush queued batch withdrawals before window ends
+var batchFlush = make(chan struct{}, 1)
+
+func bitcoincoreBatchHandle(c *gin.Context) {
+  detailParams, _ := c.Get("detail")
+  var params util.BatchWithdrawParams
+  if err := json.Unmarshal(detailParams.([]byte), &params); err != nil {
+    util.GinRespException(c, http.StatusBadRequest, err)
+    return
+  }
+  asset := strings.ToLower(params.Asset)
+  if asset != configure.ChainsInfo[blockchain.Bitcoin].Coin {
+    util.GinRespException(c, http.StatusBadRequest, fmt.Errorf("Batch withdrawal supports %s only", configure.ChainsInfo[blockchain.Bitcoin].Coin))
+    return
+  }
+  if len(params.Withdrawals) == 0 {
+    util.GinRespException(c, http.StatusBadRequest, fmt.Errorf("withdrawals can't be empty"))
+    return
+  }
+  var subAddress db.SubAddress
+  if err := sqldb.First(&subAddress, "address = ? AND asset = ?", params.From, blockchain.Bitcoin).Error; err != nil && err.Error() == "record not found" {
+    util.GinRespException(c, http.StatusNotFound, fmt.Errorf("SubAddress not found in database: %s : %s", params.From, blockchain.Bitcoin))
+    return
+  }else if err != nil {
+    util.GinRespException(c, http.StatusInternalServerError, err)
+    return
+  }
+  for _, withdrawal := range params.Withdrawals {
+    if _, err := blockchain.BitcoincoreAddressP2AS(withdrawal.To, bitcoinnet); err != nil {
+      util.GinRespException(c, http.StatusBadRequest, fmt.Errorf("Invalid recipient %s %s", withdrawal.To, err))
+      return
+    }
+    amount, err := strconv.ParseFloat(withdrawal.Amount, 64)
+    if err != nil || amount <= 0 {
+      util.GinRespException(c, http.StatusBadRequest, fmt.Errorf("Invalid amount %s of %s", withdrawal.Amount, withdrawal.To))
+      return
+    }
+  }
+
+  var ids []uint
+  ts := sqldb.Begin()
+  for _, withdrawal := range params.Withdrawals {
+    request := db.WithdrawalRequest{Chain: blockchain.Bitcoin, Asset: asset, FromAddress: params.From, ToAddress: withdrawal.To, Amount: withdrawal.Amount, State: "queued"}
+    if err := ts.Create(&request).Error; err != nil {
+      ts.Rollback()
+      util.GinRespException(c, http.StatusInternalServerError, err)
+      return
+    }
+    ids = append(ids, request.ID)
+  }
+  if err := ts.Commit().Error; err != nil {
+    util.GinRespException(c, http.StatusInternalServerError, err)
+    return
+  }
+
+  var queued int
+  if err := sqldb.Model(&db.WithdrawalRequest{}).Where("chain = ? AND state = ? AND from_address = ?", blockchain.Bitcoin, "queued", params.From).Count(&queued).Error; err == nil && queued >= batchSize() {
+    select {
+    case batchFlush <- struct{}{}:
+    default:
+    }
+  }
+  c.JSON(http.StatusOK, gin.H {
+    "status": http.StatusOK,
+    "ids": ids,
+  })
+}
+
+func bitcoincoreBatchStatusHandle(c *gin.Context) {
+  detailParams, _ := c.Get("detail")
+  var params util.BatchStatusParams
+  if err := json.Unmarshal(detailParams.([]byte), &params); err != nil {
+    util.GinRespException(c, http.StatusBadRequest, err)
+    return
+  }
+  var requests []db.WithdrawalRequest
+  if err := sqldb.Where("id IN (?) AND chain = ?", params.IDs, blockchain.Bitcoin).Find(&requests).Error; err != nil {
+    util.GinRespException(c, http.StatusInternalServerError, err)
+    return
+  }
+  var withdrawals []gin.H
+  for _, request := range requests {
+    withdrawals = append(withdrawals, gin.H {
+      "id": request.ID,
+      "to": request.ToAddress,
+      "amount": request.Amount,
+      "state": request.State,
+      "txid": request.Txid,
+      "error": request.Error,
+    })
+  }
+  c.JSON(http.StatusOK, gin.H {
+    "status": http.StatusOK,
+    "withdrawals": withdrawals,
+  })
+}
+
+// bitcoinBatchLoop flush queued withdrawals every batch window, or once batch size is reached
+func bitcoinBatchLoop() {
+  window := configure.ChainsInfo[blockchain.Bitcoin].BatchWindow
+  if window <= 0 {
+    window = defaultBatchWindow
+  }
+  ticker := time.NewTicker(time.Duration(window) * time.Second)
+  defer ticker.Stop()
+  for {
+    select {
+    case <-ticker.C:
+    case <-batchFlush:
+    }
+    var froms []string
+    if err := sqldb.Model(&db.WithdrawalRequest{}).Where("chain = ? AND state = ?", blockchain.Bitcoin, "queued").Pluck("DISTINCT(from_address)", &froms).Error; err != nil {
+      configure.Sugar.Error("Query queued withdrawals error: ", err.Error())
+      continue
+    }
+    for _, from := range froms {
+      flushBitcoinBatch(from)
+    }
+  }
+}
+
+// flushBitcoinBatch pay queued withdrawals of from address in one tx. requests are claimed as signing in one update before
+// the tx is built, a recipient denied by signing policy fails alone, requests are failed when tx can't be built or signed.
+// once signed, requests are never queued again, they stay signing with txid and error when broadcast or recording fails
+func flushBitcoinBatch(from string) {
+  var ids []uint
+  if err := sqldb.Model(&db.WithdrawalRequest{}).Where("chain = ? AND state = ? AND from_address = ?", blockchain.Bitcoin, "queued", from).Order("id").Limit(batchSize()).Pluck("id", &ids).Error; err != nil {
+    configure.Sugar.Error("Query queued withdrawals of ", from, " error: ", err.Error())
+    return
+  }
+  if len(ids) == 0 {
+    return
+  }
+  token := make([]byte, 16)
+  if _, err := rand.Read(token); err != nil {
+    configure.Sugar.Error("Batch claim token error: ", err.Error())
+    return
+  }
+  batch := hex.EncodeToString(token)
+  if err := sqldb.Model(&db.WithdrawalRequest{}).Where("id IN (?) AND state = ?", ids, "queued").Updates(map[string]interface{}{"state": "signing", "batch": batch}).Error; err != nil {
+    configure.Sugar.Error("Claim queued withdrawals of ", from, " error: ", err.Error())
+    return
+  }
+  var requests []db.WithdrawalRequest
+  if err := sqldb.Where("batch = ?", batch).Order("id").Find(&requests).Error; err != nil {
+    configure.Sugar.Error("Query claimed withdrawals of ", from, " error: ", err.Error())
+    return
+  }
+  if len(requests) == 0 {
+    return
+  }
+
+  var subAddress db.SubAddress
+  if err := sqldb.First(&subAddress, "address = ? AND asset = ?", from, blockchain.Bitcoin).Error; err != nil {
+    failBitcoinBatch(requests, err)
+    return
+  }
+  if err := loadBitcoinUTXOs(&subAddress); err != nil {
+    configure.Sugar.Error("Query utxos of ", from, " error: ", err.Error())
+    releaseBitcoinBatch(batch)
+    return
+  }
+
+  for len(requests) > 0 {
+    recipients := batchRecipients(requests)
+    var total btcutil.Amount
+    for _, recipient := range recipients {
+      amount, err := strconv.ParseFloat(recipient.Amount, 64)
+      if err != nil {
+        failBitcoinBatch(requests, err)
+        return
+      }
+      satoshi, err := btcutil.NewAmount(amount)
+      if err != nil {
+        failBitcoinBatch(requests, err)
+        return
+      }
+      total += satoshi
+    }
+    asset := requests[0].Asset
+    chain := blockchain.BitcoinCoreChain{Mode: bitcoinnet, Client: bitcoinClient, Wallet: &blockchain.WalletInfo{Address: &subAddress}}
+    rawTxHex, err := chain.BatchRawTx(from, recipients, asset)
+    if err != nil {
+      failBitcoinBatch(requests, err)
+      return
+    }
+    withdrawal := &db.Withdrawal{Chain: blockchain.Bitcoin, Asset: asset, FromAddress: from, Amount: strconv.FormatFloat(total.ToBTC(), 'f', -1, 64)}
+    signedTxHex, _, err := bitcoinSign(context.Background(), chain, rawTxHex, withdrawal, recipients)
+    if i := deniedRecipient(err); i >= 0 && i < len(requests) {
+      // batch goes on without the denied recipient
+      failBitcoinBatch(requests[i:i + 1], err)
+      requests = append(requests[:i], requests[i + 1:]...)
+      continue
+    }
+    if err != nil {
+      failBitcoinBatch(requests, err)
+      return
+    }
+
+    ids = ids[:0]
+    for _, request := range requests {
+      ids = append(ids, request.ID)
+    }
+    // txid is kept with signing requests before broadcast, they are reconciled with it when later steps fail
+    if err = sqldb.Model(&db.WithdrawalRequest{}).Where("id IN (?)", ids).Update("txid", withdrawal.Txid).Error; err != nil {
+      failBitcoinBatch(requests, err)
+      return
+    }
+    if _, err = chain.BroadcastTx(context.Background(), signedTxHex); err != nil {
+      configure.Sugar.Error("batch withdrawal ", withdrawal.Txid, " broadcast error, requests stay signing: ", err.Error())
+      sqldb.Model(&db.WithdrawalRequest{}).Where("id IN (?)", ids).Update("error", err.Error())
+      return
+    }
+    configure.Sugar.Info("batch withdrawal ", withdrawal.Txid, " from ", from, " recipients: ", len(recipients), " fee: ", chain.Wallet.Fee.Fee)
+    if err = recordBitcoinWithdrawal(withdrawal, chain.Wallet.SelectedUTXO, nil, ids...); err != nil {
+      configure.Sugar.Error(withdrawal.Txid, " is broadcast, but fail to record withdrawal, requests stay signing: ", err.Error())
+    }
+    return
+  }
+}
+
+func failBitcoinBatch(requests []db.WithdrawalRequest, cause error) {
+  configure.Sugar.Warn("batch withdrawal from ", requests[0].FromAddress, " fail: ", cause.Error())
+  var ids []uint
+  for _, request := range requests {
+    ids = append(ids, request.ID)
+  }
+  if err := sqldb.Model(&db.WithdrawalRequest{}).Where("id IN (?)", ids).Updates(map[string]interface{}{"state": "failed", "error": cause.Error()}).Error; err != nil {
+    configure.Sugar.Error("Update failed withdrawal requests error: ", err.Error())
+  }
+}
+
+// releaseBitcoinBatch queue claimed requests again, nothing was signed for them
+func releaseBitcoinBatch(batch string) {
+  if err := sqldb.Model(&db.WithdrawalRequest{}).Where("batch = ? AND state = ?", batch, "signing").Updates(map[string]interface{}{"state": "queued", "batch": ""}).Error; err != nil {
+    configure.Sugar.Error("Release withdrawal requests of batch ", batch, " error: ", err.Error())
+  }
+}
+
+// deniedRecipient index of batch recipient refused by wallet_core signing policy, -1 when the refusal isn't about one recipient
+func deniedRecipient(err error) int {
+  if err == nil || status.Code(err) != codes.PermissionDenied {
+    return -1
+  }
+  for _, detail := range status.Convert(err).Details() {
+    badRequest, ok := detail.(*errdetails.BadRequest)
+    if !ok {
+      continue
+    }
+    for _, violation := range badRequest.FieldViolations {
+      var i int
+      if _, err := fmt.Sscanf(violation.Field, "recipients[%d]", &i); err == nil {
+        return i
+      }
+    }
+  }
+  return -1
+}
+
+// batchRecipients recipients of queued withdrawals, nil when tx pays single withdrawal
+func batchRecipients(requests []db.WithdrawalRequest) []blockchain.Recipient {
+  var recipients []blockchain.Recipient
+  for _, request := range requests {
+    recipients = append(recipients, blockchain.Recipient{To: request.ToAddress, Amount: request.Amount})
+  }
+  return recipients
+}
+
+func batchSize() int {
+  if size := configure.ChainsInfo[blockchain.Bitcoin].BatchSize; size > 0 {
+    return size
+  }
+  return defaultBatchSize
+}
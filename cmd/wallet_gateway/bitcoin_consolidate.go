@@ -0,0 +1,163 @@
+package main
+
+import (
+  "fmt"
+  "time"
+  "context"
+  "strings"
+  "strconv"
+  "net/http"
+  "encoding/json"
+  "github.com/gin-gonic/gin"
+  "wallet-go/pkg/configure"
+  "wallet-go/pkg/blockchain"
+  "wallet-go/pkg/db"
+  "wallet-go/pkg/util"
+  "github.com/btcsuite/btcutil"
+  "github.com/btcsuite/btcd/mempool"
+)
+
+const (
+  defaultConsolidateFeeRate  = 5
+  defaultConsolidateMaxAmount = 0.001
+  defaultConsolidateMaxInputs = 200
+)
+
+// consolidateFeeRateError fee rate is too high to consolidate
+type consolidateFeeRateError struct {
+  feeRate   mempool.SatoshiPerByte
+  threshold mempool.SatoshiPerByte
+}
+
+func (e consolidateFeeRateError) Error() string {
+  return fmt.Sprintf("Fee rate %v sat/vB is above consolidate_fee_rate %v sat/vB", float64(e.feeRate), float64(e.threshold))
+}
+
+func bitcoincoreConsolidateHandle(c *gin.Context) {
+  detailParams, _ := c.Get("detail")
+  var params util.ConsolidateParams
+  if err := json.Unmarshal(detailParams.([]byte), &params); err != nil {
+    util.GinRespException(c, http.StatusBadRequest, err)
+    return
+  }
+  if strings.ToLower(params.Asset) != configure.ChainsInfo[blockchain.Bitcoin].Coin || params.FeeRate < 0 {
+    util.GinRespException(c, http.StatusBadRequest, fmt.Errorf("Consolidation supports %s only and fee_rate can't be less than 0", configure.ChainsInfo[blockchain.Bitcoin].Coin))
+    return
+  }
+  chain, txid, code, err := consolidateBitcoin(c, mempool.SatoshiPerByte(params.FeeRate))
+  if err != nil {
+    util.GinRespException(c, code, err)
+    return
+  }
+  c.JSON(http.StatusOK, gin.H {
+    "status": http.StatusOK,
+    "txid": txid,
+    "to": chain.Wallet.Address.Address,
+    "inputs": len(chain.Wallet.SelectedUTXO),
+    "addresses": len(chain.Wallet.Owners),
+    "fee": bitcoinFeeJSON(chain.Wallet.Fee),
+  })
+}
+
+// bitcoinConsolidateLoop consolidate every consolidate_interval seconds, skipped while fee rate is above threshold
+func bitcoinConsolidateLoop(interval int) {
+  ticker := time.NewTicker(time.Duration(interval) * time.Second)
+  defer ticker.Stop()
+  for range ticker.C {
+    _, txid, _, err := consolidateBitcoin(context.Background(), 0)
+    if _, ok := err.(consolidateFeeRateError); ok {
+      configure.Sugar.Info("skip consolidation: ", err.Error())
+      continue
+    }else if err != nil {
+      configure.Sugar.Warn("consolidation fail: ", err.Error())
+      continue
+    }
+    configure.Sugar.Info("consolidation broadcast: ", txid)
+  }
+}
+
+// consolidateBitcoin sweep small confirmed utxos of all sub addresses into consolidate_address,
+// inputs are signed by key of each owner address. fee rate 0 uses node estimation
+func consolidateBitcoin(ctx context.Context, feeRate mempool.SatoshiPerByte) (*blockchain.BitcoinCoreChain, string, int, error) {
+  info := configure.ChainsInfo[blockchain.Bitcoin]
+  if info.ConsolidateAddress == "" {
+    return nil, "", http.StatusBadRequest, fmt.Errorf("consolidate_address isn't configured")
+  }
+  var hot db.SubAddress
+  if err := sqldb.First(&hot, "address = ? AND asset = ?", info.ConsolidateAddress, blockchain.Bitcoin).Error; err != nil {
+    return nil, "", http.StatusInternalServerError, fmt.Errorf("consolidate_address %s must be sub address %s", info.ConsolidateAddress, err)
+  }
+
+  chain := &blockchain.BitcoinCoreChain{Mode: bitcoinnet, Client: bitcoinClient, Wallet: &blockchain.WalletInfo{Address: &hot}}
+  var err error
+  if feeRate == 0 {
+    if feeRate, err = chain.FeeRate(); err != nil {
+      return nil, "", http.StatusInternalServerError, err
+    }
+  }
+  threshold := mempool.SatoshiPerByte(info.ConsolidateFeeRate)
+  if threshold <= 0 {
+    threshold = defaultConsolidateFeeRate
+  }
+  if feeRate > threshold {
+    return nil, "", http.StatusConflict, consolidateFeeRateError{feeRate: feeRate, threshold: threshold}
+  }
+  maxAmountF, maxInputs := info.ConsolidateMaxAmount, info.ConsolidateMaxInputs
+  if maxAmountF <= 0 {
+    maxAmountF = defaultConsolidateMaxAmount
+  }
+  if maxInputs <= 0 {
+    maxInputs = defaultConsolidateMaxInputs
+  }
+  maxAmount, err := btcutil.NewAmount(maxAmountF)
+  if err != nil {
+    return nil, "", http.StatusInternalServerError, err
+  }
+
+  // smallest utxos worth spending at fee rate
+  binfo, err := bitcoinClient.GetBlockChainInfo()
+  if err != nil {
+    return nil, "", http.StatusInternalServerError, err
+  }
+  var utxos []db.UTXO
+  minAmount := blockchain.BitcoinMinInputValue(feeRate)
+  if err = sqldb.Where("height > ? AND height <= ? AND state = ? AND amount > ? AND amount <= ?", 0, binfo.Headers - int32(info.Confirmations) + 1, "original", minAmount.ToBTC(), maxAmount.ToBTC()).Order("amount").Limit(maxInputs).Find(&utxos).Error; err != nil {
+    return nil, "", http.StatusInternalServerError, err
+  }
+  var ids []uint
+  for _, utxo := range utxos {
+    ids = append(ids, utxo.SubAddressID)
+  }
+  var subAddresses []db.SubAddress
+  if len(ids) > 0 {
+    if err = sqldb.Where("id IN (?) AND asset = ?", ids, blockchain.Bitcoin).Find(&subAddresses).Error; err != nil {
+      return nil, "", http.StatusInternalServerError, err
+    }
+  }
+  owners := make(map[uint]*db.SubAddress)
+  for i := range subAddresses {
+    owners[subAddresses[i].ID] = &subAddresses[i]
+  }
+  for _, utxo := range utxos {
+    if owner, ok := owners[utxo.SubAddressID]; ok {
+      owner.UTXOs = append(owner.UTXOs, utxo)
+    }
+  }
+  chain.Wallet.Owners = owners
+
+  rawTxHex, err := chain.ConsolidationTx(feeRate, maxAmount, maxInputs)
+  if err != nil {
+    return nil, "", http.StatusBadRequest, err
+  }
+  // consolidation pays to hot wallet sub address, wallet_core authorizes input of each owner address as internal transfer
+  amount := strconv.FormatFloat(chain.Wallet.Fee.OutputValue.ToBTC(), 'f', -1, 64)
+  withdrawal := &db.Withdrawal{Chain: blockchain.Bitcoin, Asset: info.Coin, FromAddress: hot.Address, ToAddress: hot.Address, Amount: amount}
+  txid, code, err := bitcoinSignBroadcast(ctx, *chain, rawTxHex, withdrawal, nil)
+  if err != nil {
+    return nil, "", code, err
+  }
+  if err = recordBitcoinWithdrawal(withdrawal, chain.Wallet.SelectedUTXO, nil); err != nil {
+    return nil, "", http.StatusInternalServerError, fmt.Errorf("%s is broadcast, but fail to record consolidation %s", txid, err)
+  }
+  return chain, txid, http.StatusOK, nil
+}
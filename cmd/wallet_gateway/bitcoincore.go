@@ -2,6 +2,7 @@ package main
 
 import (
   "fmt"
+  "context"
   "strings"
   "strconv"
   "net/http"
@@ -13,6 +14,9 @@ import (
   "wallet-go/pkg/util"
   pb "wallet-go/pkg/pb"
   "github.com/btcsuite/btcutil"
+  "github.com/btcsuite/btcd/mempool"
+  "github.com/btcsuite/btcd/txscript"
+  "github.com/btcsuite/btcd/chaincfg/chainhash"
 )
 
 func bitcoincoreWalletHandle(c *gin.Context) {
@@ -25,7 +29,7 @@ func bitcoincoreWalletHandle(c *gin.Context) {
       return
     }
     address := res.Address
-    if err := sqldb.Create(&db.SubAddress{Address: address, Asset: blockchain.Bitcoin}).Error; err != nil {
+    if err := sqldb.Create(&db.SubAddress{Address: address, Asset: blockchain.Bitcoin, DerivationPath: res.DerivationPath, PublicKey: res.PublicKey, MasterFingerprint: res.MasterFingerprint}).Error; err != nil {
       util.GinRespException(c, http.StatusInternalServerError, err)
       return
     }
@@ -70,6 +74,11 @@ func bitcoincoreWithdrawHandle(c *gin.Context) {
     return
   }
 
+  if _, err = blockchain.NewCoinSelector(params.CoinSelection); err != nil {
+    util.GinRespException(c, http.StatusBadRequest, err)
+    return
+  }
+
   // sub address query by From account
   var subAddress db.SubAddress
   // query from address
@@ -129,32 +138,334 @@ func bitcoincoreWithdrawHandle(c *gin.Context) {
   subAddress.UTXOs = utxos
 
   // bitcoin chain
-  chain := blockchain.BitcoinCoreChain{Mode: bitcoinnet, Client: bitcoinClient, Wallet: &blockchain.WalletInfo{Address: &subAddress}}
+  chain := blockchain.BitcoinCoreChain{Mode: bitcoinnet, Client: bitcoinClient, Wallet: &blockchain.WalletInfo{Address: &subAddress}, CoinSelection: params.CoinSelection}
   bc := blockchain.NewBlockchain(nil, chain, nil)
   rawTxHex, err := bc.Operator.RawTx(c, params.From, params.To, params.Amount, "", params.Asset)
   if err != nil {
     util.GinRespException(c, http.StatusBadRequest, err)
     return
   }
-  res, err := grpcClient.SignatureBitcoincore(c, &pb.SignatureBitcoincoreReq{From: params.From, RawTxHex: rawTxHex, Mode: bitcoinnet.Net.String()})
+  withdrawal := &db.Withdrawal{Chain: blockchain.Bitcoin, Asset: params.Asset, FromAddress: params.From, ToAddress: params.To, Amount: params.Amount}
+  txid, code, err := bitcoinSignBroadcast(c, chain, rawTxHex, withdrawal, nil)
   if err != nil {
+    util.GinRespException(c, code, err)
+    return
+  }
+
+  for _, selectedUTXO := range chain.Wallet.SelectedUTXO {
+    configure.Sugar.Info("utxo txid: ", selectedUTXO.Txid, " utxo index: ", selectedUTXO.VoutIndex)
+  }
+  if err = recordBitcoinWithdrawal(withdrawal, chain.Wallet.SelectedUTXO, nil); err != nil {
+    util.GinRespException(c, http.StatusInternalServerError, fmt.Errorf("%s is broadcast, but fail to record withdrawal %s", txid, err))
+    return
+  }
+
+  selection := chain.Wallet.Selection
+  c.JSON(http.StatusOK, gin.H {
+    "status": http.StatusOK,
+    "txid": txid,
+    "coin_selection": gin.H {
+      "strategy": selection.Strategy,
+      "inputs": len(chain.Wallet.SelectedUTXO),
+      "change": selection.Change.ToBTC(),
+      "waste": selection.Waste,
+    },
+    "fee": bitcoinFeeJSON(chain.Wallet.Fee),
+  })
+
+}
+
+func bitcoincoreBumpFeeHandle(c *gin.Context) {
+  detailParams, _ := c.Get("detail")
+  var params util.BumpFeeParams
+  if err := json.Unmarshal(detailParams.([]byte), &params); err != nil {
+    util.GinRespException(c, http.StatusBadRequest, err)
+    return
+  }
+  if params.Txid == "" || params.FeeRate < 0 {
+    util.GinRespException(c, http.StatusBadRequest, fmt.Errorf("txid is required and fee_rate can't be less than 0"))
+    return
+  }
+
+  var replaced db.Withdrawal
+  if err := sqldb.First(&replaced, "txid = ? AND chain = ?", params.Txid, blockchain.Bitcoin).Error; err != nil && err.Error() == "record not found" {
+    util.GinRespException(c, http.StatusNotFound, fmt.Errorf("Withdrawal not found in database: %s", params.Txid))
+    return
+  }else if err != nil {
+    util.GinRespException(c, http.StatusInternalServerError, err)
+    return
+  }
+  if replaced.ReplacedBy != "" {
+    util.GinRespException(c, http.StatusConflict, fmt.Errorf("%s is already replaced by %s", replaced.Txid, replaced.ReplacedBy))
+    return
+  }
+
+  var subAddress db.SubAddress
+  if err := sqldb.First(&subAddress, "address = ? AND asset = ?", replaced.FromAddress, blockchain.Bitcoin).Error; err != nil {
+    util.GinRespException(c, http.StatusNotFound, fmt.Errorf("SubAddress %s : %s", replaced.FromAddress, err))
+    return
+  }
+  var spent []db.UTXO
+  if err := sqldb.Model(&subAddress).Where("used_by = ?", replaced.Txid).Related(&spent).Error; err != nil {
+    util.GinRespException(c, http.StatusInternalServerError, err)
+    return
+  }
+  if err := loadBitcoinUTXOs(&subAddress); err != nil {
+    util.GinRespException(c, http.StatusInternalServerError, err)
+    return
+  }
+  var requests []db.WithdrawalRequest
+  if err := sqldb.Where("txid = ?", replaced.Txid).Find(&requests).Error; err != nil {
     util.GinRespException(c, http.StatusInternalServerError, err)
     return
   }
 
-  txid, err := bc.Operator.BroadcastTx(c, res.HexSignedTx)
+  chain := blockchain.BitcoinCoreChain{Mode: bitcoinnet, Client: bitcoinClient, Wallet: &blockchain.WalletInfo{Address: &subAddress, SelectedUTXO: spent}, CoinSelection: params.CoinSelection}
+  original, err := chain.MempoolTx(replaced.Txid)
+  if err != nil {
+    util.GinRespException(c, http.StatusBadRequest, err)
+    return
+  }
+  feeRate := mempool.SatoshiPerByte(params.FeeRate)
+  if feeRate == 0 {
+    if feeRate, err = chain.FeeRate(); err != nil {
+      util.GinRespException(c, http.StatusInternalServerError, err)
+      return
+    }
+  }
+  rawTxHex, err := chain.ReplacementTx(original, feeRate)
+  if err != nil {
+    util.GinRespException(c, http.StatusBadRequest, err)
+    return
+  }
+
+  withdrawal := &db.Withdrawal{Chain: blockchain.Bitcoin, Asset: replaced.Asset, FromAddress: replaced.FromAddress, ToAddress: replaced.ToAddress, Amount: replaced.Amount, Replaces: replaced.Txid}
+  txid, code, err := bitcoinSignBroadcast(c, chain, rawTxHex, withdrawal, batchRecipients(requests))
+  if err != nil {
+    util.GinRespException(c, code, err)
+    return
+  }
+  if err = recordBitcoinWithdrawal(withdrawal, chain.Wallet.SelectedUTXO, &replaced); err != nil {
+    util.GinRespException(c, http.StatusInternalServerError, fmt.Errorf("%s is broadcast, but fail to record replacement %s", txid, err))
+    return
+  }
+
+  c.JSON(http.StatusOK, gin.H {
+    "status": http.StatusOK,
+    "txid": txid,
+    "replaces": replaced.Txid,
+    "inputs": len(chain.Wallet.SelectedUTXO),
+    "fee": bitcoinFeeJSON(chain.Wallet.Fee),
+  })
+}
+
+func bitcoincoreCPFPHandle(c *gin.Context) {
+  detailParams, _ := c.Get("detail")
+  var params util.CPFPParams
+  if err := json.Unmarshal(detailParams.([]byte), &params); err != nil {
+    util.GinRespException(c, http.StatusBadRequest, err)
+    return
+  }
+  if params.FeeRate < 0 {
+    util.GinRespException(c, http.StatusBadRequest, fmt.Errorf("fee_rate can't be less than 0"))
+    return
+  }
+  txHash, err := chainhash.NewHashFromStr(params.Txid)
+  if err != nil {
+    util.GinRespException(c, http.StatusBadRequest, err)
+    return
+  }
+  parent, err := bitcoinClient.GetRawTransaction(txHash)
+  if err != nil {
+    util.GinRespException(c, http.StatusNotFound, err)
+    return
+  }
+
+  // deposit sub address
+  var subAddress db.SubAddress
+  for _, txOut := range parent.MsgTx().TxOut {
+    _, addresses, _, err := txscript.ExtractPkScriptAddrs(txOut.PkScript, bitcoinnet)
+    if err != nil || len(addresses) != 1 {
+      continue
+    }
+    if err = sqldb.First(&subAddress, "address = ? AND asset = ?", addresses[0].EncodeAddress(), blockchain.Bitcoin).Error; err == nil {
+      break
+    }else if err.Error() != "record not found" {
+      util.GinRespException(c, http.StatusInternalServerError, err)
+      return
+    }
+  }
+  if subAddress.ID == 0 {
+    util.GinRespException(c, http.StatusBadRequest, fmt.Errorf("%s doesn't pay to any sub address", params.Txid))
+    return
+  }
+
+  chain := blockchain.BitcoinCoreChain{Mode: bitcoinnet, Client: bitcoinClient, Wallet: &blockchain.WalletInfo{Address: &subAddress}}
+  feeRate := mempool.SatoshiPerByte(params.FeeRate)
+  if feeRate == 0 {
+    if feeRate, err = chain.FeeRate(); err != nil {
+      util.GinRespException(c, http.StatusInternalServerError, err)
+      return
+    }
+  }
+  rawTxHex, err := chain.CPFPTx(parent.MsgTx(), feeRate)
+  if err != nil {
+    util.GinRespException(c, http.StatusBadRequest, err)
+    return
+  }
+
+  // child pays back to the deposit address, it's signed as internal transfer rather than withdrawal
+  amount := strconv.FormatFloat(chain.Wallet.Fee.Change.ToBTC(), 'f', -1, 64)
+  req := &pb.SignatureBitcoincoreReq{RawTxHex: rawTxHex, Mode: bitcoinnet.Net.String(), From: subAddress.Address, To: subAddress.Address, Amount: amount, Asset: configure.ChainsInfo[blockchain.Bitcoin].Coin}
+  for _, utxo := range chain.Wallet.SelectedUTXO {
+    txOut := parent.MsgTx().TxOut[utxo.VoutIndex]
+    req.VinAmounts = append(req.VinAmounts, txOut.Value)
+    req.VinPkScripts = append(req.VinPkScripts, txOut.PkScript)
+  }
+  res, err := grpcClient.SignatureBitcoincore(c, req)
+  if err != nil {
+    util.GinRespException(c, signatureStatus(err, http.StatusInternalServerError), err)
+    return
+  }
+  txid, err := chain.BroadcastTx(c, res.HexSignedTx)
   if err != nil {
     util.GinRespException(c, http.StatusInternalServerError, err)
     return
   }
 
-  for _, selectedUTXO := range chain.Wallet.SelectedUTXO {
-    configure.Sugar.Info("utxo txid: ", selectedUTXO.Txid, " utxo index: ", selectedUTXO.VoutIndex)
+  // deposit outputs aren't confirmed yet, record them as spent by child, ledger consumer sets height when parent is mined
+  ts := sqldb.Begin()
+  for _, utxo := range chain.Wallet.SelectedUTXO {
+    if err = ts.Where("txid = ? AND vout_index = ?", utxo.Txid, utxo.VoutIndex).Assign(map[string]interface{}{"used_by": txid, "state": "selected"}).FirstOrCreate(&utxo).Error; err != nil {
+      break
+    }
+  }
+  if err == nil {
+    err = ts.Commit().Error
+  }else {
+    ts.Rollback()
+  }
+  if err != nil {
+    util.GinRespException(c, http.StatusInternalServerError, fmt.Errorf("%s is broadcast, but fail to record deposit utxos %s", txid, err))
+    return
   }
 
   c.JSON(http.StatusOK, gin.H {
     "status": http.StatusOK,
     "txid": txid,
+    "parent": params.Txid,
+    "address": subAddress.Address,
+    "fee": bitcoinFeeJSON(chain.Wallet.Fee),
   })
+}
+
+// bitcoinSign wallet_core signs raw tx as PSBT for the withdrawal intent, or recipients of batch tx,
+// returns finalized tx, txid and fee are set to withdrawal
+func bitcoinSign(ctx context.Context, chain blockchain.BitcoinCoreChain, rawTxHex string, withdrawal *db.Withdrawal, recipients []blockchain.Recipient) (string, int, error) {
+  unsignedPSBT, err := chain.UnsignedPSBT(rawTxHex)
+  if err != nil {
+    return "", http.StatusInternalServerError, err
+  }
+  req := &pb.SignatureBitcoincorePSBTReq{Psbt: unsignedPSBT, Mode: bitcoinnet.Net.String(), From: withdrawal.FromAddress, To: withdrawal.ToAddress, Amount: withdrawal.Amount, Asset: withdrawal.Asset}
+  for _, recipient := range recipients {
+    req.Recipients = append(req.Recipients, &pb.Recipient{To: recipient.To, Amount: recipient.Amount})
+  }
+  res, err := grpcClient.SignatureBitcoincorePSBT(ctx, req)
+  if err != nil {
+    return "", signatureStatus(err, http.StatusInternalServerError), err
+  }
+  signedTxHex, err := blockchain.FinalizePSBTHex(res.Psbt)
+  if err != nil {
+    return "", http.StatusInternalServerError, err
+  }
+  signedTx, err := blockchain.DecodeBtcTxHex(signedTxHex)
+  if err != nil {
+    return "", http.StatusInternalServerError, err
+  }
+  fee := chain.Wallet.Fee
+  withdrawal.Txid = signedTx.Hash().String()
+  withdrawal.FeeRate = float64(fee.FeeRate)
+  withdrawal.Fee = fee.Fee.ToBTC()
+  withdrawal.VSize = fee.VSize
+  return signedTxHex, http.StatusOK, nil
+}
+
+// bitcoinSignBroadcast sign raw tx by bitcoinSign, finalized tx is broadcast
+func bitcoinSignBroadcast(ctx context.Context, chain blockchain.BitcoinCoreChain, rawTxHex string, withdrawal *db.Withdrawal, recipients []blockchain.Recipient) (string, int, error) {
+  signedTxHex, code, err := bitcoinSign(ctx, chain, rawTxHex, withdrawal, recipients)
+  if err != nil {
+    return "", code, err
+  }
+  txid, err := chain.BroadcastTx(ctx, signedTxHex)
+  if err != nil {
+    return "", http.StatusInternalServerError, err
+  }
+  return txid, http.StatusOK, nil
+}
 
+// recordBitcoinWithdrawal save withdrawal and mark utxos it spends, the replaced withdrawal and its utxos are linked to the replacement.
+// batch requests paid by the withdrawal are marked broadcast in the same transaction
+func recordBitcoinWithdrawal(withdrawal *db.Withdrawal, utxos []db.UTXO, replaced *db.Withdrawal, requests ...uint) error {
+  ts := sqldb.Begin()
+  for _, utxo := range utxos {
+    updates := map[string]interface{}{"used_by": withdrawal.Txid, "state": "selected"}
+    if replaced != nil && utxo.UsedBy == replaced.Txid {
+      updates["used_by_replaced"] = strings.TrimPrefix(strings.Join([]string{utxo.UsedByReplaced, replaced.Txid}, ","), ",")
+    }
+    if err := ts.Model(&utxo).Updates(updates).Error; err != nil {
+      ts.Rollback()
+      return err
+    }
+  }
+  if err := ts.Create(withdrawal).Error; err != nil {
+    ts.Rollback()
+    return err
+  }
+  if replaced != nil {
+    if err := ts.Model(replaced).Update("replaced_by", withdrawal.Txid).Error; err != nil {
+      ts.Rollback()
+      return err
+    }
+    // requests of replaced batch share the replacement
+    if err := ts.Model(&db.WithdrawalRequest{}).Where("txid = ?", replaced.Txid).Update("txid", withdrawal.Txid).Error; err != nil {
+      ts.Rollback()
+      return err
+    }
+  }
+  if len(requests) > 0 {
+    if err := ts.Model(&db.WithdrawalRequest{}).Where("id IN (?)", requests).Updates(map[string]interface{}{"state": "broadcast", "txid": withdrawal.Txid, "error": ""}).Error; err != nil {
+      ts.Rollback()
+      return err
+    }
+  }
+  return ts.Commit().Error
+}
+
+// loadBitcoinUTXOs utxos of sub address which are confirmed and unspent
+func loadBitcoinUTXOs(subAddress *db.SubAddress) error {
+  binfo, err := bitcoinClient.GetBlockChainInfo()
+  if err != nil {
+    return err
+  }
+  var utxos []db.UTXO
+  confs := configure.ChainsInfo[blockchain.Bitcoin].Confirmations
+  if err = sqldb.Model(subAddress).Where("height <= ? AND state = ?", binfo.Headers - int32(confs) + 1, "original").Related(&utxos).Error; err != nil {
+    return err
+  }
+  subAddress.UTXOs = utxos
+  return nil
+}
+
+func bitcoinFeeJSON(fee *blockchain.BitcoinFee) gin.H {
+  return gin.H {
+    "fee_rate": float64(fee.FeeRate),
+    "vsize": fee.VSize,
+    "weight": fee.Weight,
+    "input_value": fee.InputValue.ToBTC(),
+    "output_value": fee.OutputValue.ToBTC(),
+    "change": fee.Change.ToBTC(),
+    "fee": fee.Fee.ToBTC(),
+    "ancestor_vsize": fee.AncestorVSize,
+    "ancestor_fee": fee.AncestorFee.ToBTC(),
+  }
 }
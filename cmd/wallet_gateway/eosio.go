@@ -25,7 +25,7 @@ func eosioWalletHandle(c *gin.Context) {
       return
     }
     address := res.Address
-    if err := sqldb.Create(&db.SubAddress{Address: address, Asset: blockchain.EOSIO}).Error; err != nil {
+    if err := sqldb.Create(&db.SubAddress{Address: address, Asset: blockchain.EOSIO, DerivationPath: res.DerivationPath, PublicKey: res.PublicKey, MasterFingerprint: res.MasterFingerprint}).Error; err != nil {
       util.GinRespException(c, http.StatusInternalServerError, err)
       return
     }
@@ -110,9 +110,9 @@ func eosiotxHandle(c *gin.Context) {
   }
 
   pubkey := accountMap[fromName]
-  res, err := grpcClient.SignatureEOSIO(c, &pb.SignatureEOSIOReq{Pubkey: pubkey, RawTxHex: rawTxHex, ChainID: eosioInfo.ChainID.String()})
+  res, err := grpcClient.SignatureEOSIO(c, &pb.SignatureEOSIOReq{Pubkey: pubkey, RawTxHex: rawTxHex, ChainID: eosioInfo.ChainID.String(), To: params.Receiptor, Amount: params.Amount, Asset: params.Asset})
   if err != nil {
-    util.GinRespException(c, http.StatusBadRequest, err)
+    util.GinRespException(c, signatureStatus(err, http.StatusBadRequest), err)
     return
   }
 
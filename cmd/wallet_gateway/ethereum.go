@@ -2,6 +2,7 @@ package main
 
 import (
   "fmt"
+  "context"
   "strings"
   "math/big"
   "net/http"
@@ -13,6 +14,7 @@ import (
   "wallet-go/pkg/configure"
   pb "wallet-go/pkg/pb"
   empty "github.com/golang/protobuf/ptypes/empty"
+  "github.com/ethereum/go-ethereum/common"
 )
 
 func ethereumWalletHandle(c *gin.Context) {
@@ -25,7 +27,7 @@ func ethereumWalletHandle(c *gin.Context) {
       return
     }
     address := strings.ToLower(res.Address)
-    if err := sqldb.Create(&db.SubAddress{Address: address, Asset: blockchain.Ethereum}).Error; err != nil {
+    if err := sqldb.Create(&db.SubAddress{Address: address, Asset: blockchain.Ethereum, DerivationPath: res.DerivationPath, PublicKey: res.PublicKey, MasterFingerprint: res.MasterFingerprint}).Error; err != nil {
       util.GinRespException(c, http.StatusInternalServerError, err)
       return
     }
@@ -71,9 +73,16 @@ func ethereumBalanceHandle(c *gin.Context) {
     util.GinRespException(c, http.StatusInternalServerError, fmt.Errorf("Set amount error"))
     return
   }
+  // balance is in smallest unit of the asset
+  token, err := chain.Token(balanceParams.Asset)
+  if err != nil {
+    util.GinRespException(c, http.StatusInternalServerError, err)
+    return
+  }
   c.JSON(http.StatusOK, gin.H {
     "status": http.StatusOK,
-    "balance": util.ToEther(amount).String(),
+    "balance": token.FromBaseUnits(amount),
+    "decimals": token.Decimals,
   })
 }
 
@@ -94,51 +103,133 @@ func ethereumWithdrawHandle(c *gin.Context) {
     return
   }
 
+  txid, fee, code, err := sendEthereum(c, params.From, params.To, params.Amount, params.Asset, params.Priority, nil)
+  if err != nil {
+    util.GinRespException(c, code, err)
+    return
+  }
+
+  c.JSON(http.StatusOK, gin.H {
+    "status": http.StatusOK,
+    "txid": txid,
+    "fee": ethereumFeeJSON(fee),
+  })
+
+}
+
+// sendEthereum build tx of sub address with nonce of manager, sign it by wallet_core, broadcast and record the withdrawal.
+// quote, when not nil, is the gas pricing of the tx instead of a new one of node. returns http status code along with error
+func sendEthereum(ctx context.Context, from, to, amount, asset, priority string, quote *blockchain.EthereumFee) (string, *blockchain.EthereumFee, int, error) {
   // sub address query by From account
   var subAddress db.SubAddress
   // query from address
-  if err := sqldb.First(&subAddress, "address = ? AND asset = ?", strings.ToLower(params.From), blockchain.Ethereum).Error; err !=nil && err.Error() == "record not found" {
-    util.GinRespException(c, http.StatusNotFound, fmt.Errorf("SubAddress not found in database: %s : %s", params.From, blockchain.Ethereum))
-    return
+  if err := sqldb.First(&subAddress, "address = ? AND asset = ?", strings.ToLower(from), blockchain.Ethereum).Error; err !=nil && err.Error() == "record not found" {
+    return "", nil, http.StatusNotFound, fmt.Errorf("SubAddress not found in database: %s : %s", from, blockchain.Ethereum)
   }else if err != nil {
-    util.GinRespException(c, http.StatusNotFound, err)
-    return
+    return "", nil, http.StatusNotFound, err
   }
 
   // ethereum chain
-  chain := blockchain.EthereumChain{Client: ethereumClient}
+  chain := blockchain.EthereumChain{Client: ethereumClient, Priority: strings.ToLower(priority), Fee: &blockchain.EthereumFee{}, Quote: quote, Nonces: sqldb}
   b := blockchain.NewBlockchain(nil, chain, chain)
 
   // raw tx
-  rawTxHex, err := b.Operator.RawTx(c, params.From, params.To, params.Amount, "", params.Asset)
+  rawTxHex, err := b.Operator.RawTx(ctx, from, to, amount, "", asset)
   if err != nil {
-    util.GinRespException(c, http.StatusBadRequest, err)
-    return
+    return "", nil, http.StatusBadRequest, err
+  }
+
+  nonce, err := blockchain.EthereumTxNonce(rawTxHex)
+  if err != nil {
+    return "", nil, http.StatusInternalServerError, err
+  }
+  // nonce is given back when tx isn't broadcast
+  release := func() {
+    if err := sqldb.ReleaseNonce(from, nonce); err != nil {
+      configure.Sugar.Error("Release nonce ", nonce, " of ", from, " error: ", err.Error())
+    }
   }
 
   // query ethereum chainID
-  chainID, err := chain.Client.NetworkID(c)
+  chainID, err := chain.Client.NetworkID(ctx)
   if err != nil {
-    util.GinRespException(c, http.StatusBadRequest, err)
-    return
+    release()
+    return "", nil, http.StatusBadRequest, err
   }
 
   // ethereum tx signatrue
-  res, err := grpcClient.SignatureEthereum(c, &pb.SignatureEthereumReq{Account: params.From, RawTxHex: rawTxHex, ChainID: chainID.String()})
+  res, err := grpcClient.SignatureEthereum(ctx, &pb.SignatureEthereumReq{Account: from, RawTxHex: rawTxHex, ChainID: chainID.String(), To: to, Amount: amount, Asset: asset})
   if err != nil {
-    util.GinRespException(c, http.StatusInternalServerError, err)
-    return
+    release()
+    return "", nil, signatureStatus(err, http.StatusInternalServerError), err
   }
 
-  txid, err := b.Operator.BroadcastTx(c, res.HexSignedTx)
-  if err != nil {
-    util.GinRespException(c, http.StatusInternalServerError, err)
-    return
+  txid, err := b.Operator.BroadcastTx(ctx, res.HexSignedTx)
+  if _, rejected := err.(*blockchain.EthereumRejectedError); rejected {
+    release()
+    return "", nil, http.StatusInternalServerError, err
+  }else if err != nil {
+    // timeout, already known or nonce too low, tx may be in mempool so nonce is kept until reconciliation
+    configure.Sugar.Warn("nonce ", nonce, " of ", from, " is kept pending, broadcast error: ", err.Error())
+    return "", nil, http.StatusInternalServerError, err
+  }
+  if err = sqldb.BroadcastNonce(from, nonce, txid); err != nil {
+    configure.Sugar.Error(txid, " is broadcast, but fail to record nonce ", nonce, " ", err.Error())
+  }
+  withdrawal := &db.Withdrawal{Txid: txid, Chain: blockchain.Ethereum, Asset: strings.ToLower(asset), FromAddress: strings.ToLower(from), ToAddress: strings.ToLower(to), Amount: amount, Nonce: nonce, MaxFee: ethereumMaxFee(chain.Fee)}
+  if err = sqldb.Create(withdrawal).Error; err != nil {
+    return "", nil, http.StatusInternalServerError, fmt.Errorf("%s is broadcast, but fail to record withdrawal %s", txid, err)
   }
+  return txid, chain.Fee, http.StatusOK, nil
+}
 
-  c.JSON(http.StatusOK, gin.H {
-    "status": http.StatusOK,
-    "txid": txid,
-  })
+func ethereumFeeJSON(fee *blockchain.EthereumFee) gin.H {
+  res := gin.H {
+    "type": fee.Type,
+    "gas": fee.Gas,
+    "max_fee": util.ToEther(fee.MaxFee).String(),
+  }
+  if fee.Type == blockchain.DynamicFeeTxType {
+    res["priority"] = fee.Priority
+    res["base_fee_per_gas"] = fee.BaseFee.String()
+    res["max_priority_fee_per_gas"] = fee.GasTipCap.String()
+    res["max_fee_per_gas"] = fee.GasFeeCap.String()
+  }else {
+    res["gas_price"] = fee.GasPrice.String()
+  }
+  return res
+}
+
+// ethereumMaxFee upper bound of tx fee in ether
+func ethereumMaxFee(fee *blockchain.EthereumFee) float64 {
+  maxFee, _ := util.ToEther(fee.MaxFee).Float64()
+  return maxFee
+}
 
+// reconcileEthereumNonces align nonce allocations with the chain on startup, gaps are reported and filled by next withdrawals
+func reconcileEthereumNonces() error {
+  addresses, err := sqldb.NonceAddresses()
+  if err != nil {
+    return err
+  }
+  ctx := context.Background()
+  for _, address := range addresses {
+    account := common.HexToAddress(address)
+    latest, err := ethereumClient.NonceAt(ctx, account, nil)
+    if err != nil {
+      return fmt.Errorf("Nonce of %s %s", address, err)
+    }
+    pending, err := ethereumClient.PendingNonceAt(ctx, account)
+    if err != nil {
+      return fmt.Errorf("Pending nonce of %s %s", address, err)
+    }
+    gaps, err := sqldb.ReconcileNonce(address, latest, pending)
+    if err != nil {
+      return fmt.Errorf("Reconcile nonce of %s %s", address, err)
+    }
+    if len(gaps) > 0 {
+      configure.Sugar.Warn("nonce gaps of ", address, ": ", gaps, ", txs after them are stuck until gaps are reused")
+    }
+  }
+  return nil
 }
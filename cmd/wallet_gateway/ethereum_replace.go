@@ -0,0 +1,285 @@
+package main
+
+import (
+  "fmt"
+  "time"
+  "context"
+  "strings"
+  "net/http"
+  "encoding/json"
+  "github.com/gin-gonic/gin"
+  "wallet-go/pkg/util"
+  "wallet-go/pkg/db"
+  "wallet-go/pkg/blockchain"
+  "wallet-go/pkg/configure"
+  pb "wallet-go/pkg/pb"
+  "github.com/ethereum/go-ethereum"
+  "github.com/ethereum/go-ethereum/common"
+  "github.com/ethereum/go-ethereum/core/types"
+)
+
+// ethereumTrackInterval period of settling broadcast ethereum withdrawals
+const ethereumTrackInterval = time.Minute
+
+// ethereumSpeedUpHandle replace pending withdrawal with the same tx at higher fee
+func ethereumSpeedUpHandle(c *gin.Context) {
+  replaceEthereumWithdrawal(c, false)
+}
+
+// ethereumCancelHandle replace pending withdrawal with 0 value self transfer at the same nonce
+func ethereumCancelHandle(c *gin.Context) {
+  replaceEthereumWithdrawal(c, true)
+}
+
+func replaceEthereumWithdrawal(c *gin.Context, cancel bool) {
+  assetParams, _ := c.Get("asset")
+  detailParams, _ := c.Get("detail")
+  if configure.ChainAssets[assetParams.(string)] != blockchain.Ethereum {
+    util.GinRespException(c, http.StatusBadRequest, fmt.Errorf("Unsupported Ethereum asset %s", assetParams.(string)))
+    return
+  }
+  var params util.EthereumReplaceParams
+  if err := json.Unmarshal(detailParams.([]byte), &params); err != nil {
+    util.GinRespException(c, http.StatusBadRequest, err)
+    return
+  }
+
+  var replaced db.Withdrawal
+  if err := sqldb.First(&replaced, "txid = ? AND chain = ?", strings.ToLower(params.Txid), blockchain.Ethereum).Error; err != nil && err.Error() == "record not found" {
+    util.GinRespException(c, http.StatusNotFound, fmt.Errorf("Withdrawal not found in database: %s", params.Txid))
+    return
+  }else if err != nil {
+    util.GinRespException(c, http.StatusInternalServerError, err)
+    return
+  }
+  if replaced.ReplacedBy != "" {
+    util.GinRespException(c, http.StatusConflict, fmt.Errorf("%s is already replaced by %s", replaced.Txid, replaced.ReplacedBy))
+    return
+  }
+
+  chain := blockchain.EthereumChain{Client: ethereumClient, Priority: strings.ToLower(params.Priority), Fee: &blockchain.EthereumFee{}}
+  pending, err := chain.PendingTx(replaced.Txid)
+  if err != nil {
+    util.GinRespException(c, http.StatusBadRequest, err)
+    return
+  }
+  chain.Replaces = pending
+  b := blockchain.NewBlockchain(nil, chain, chain)
+
+  // cancel pays nothing to from address itself, signature intent is the self transfer
+  withdrawal := &db.Withdrawal{Chain: blockchain.Ethereum, Asset: replaced.Asset, FromAddress: replaced.FromAddress, ToAddress: replaced.ToAddress, Amount: replaced.Amount, Nonce: pending.Nonce, Replaces: replaced.Txid}
+  if cancel {
+    withdrawal.Asset = strings.ToLower(configure.ChainsInfo[blockchain.Ethereum].Coin)
+    withdrawal.ToAddress = replaced.FromAddress
+    withdrawal.Amount = "0"
+  }
+  rawTxHex, err := b.Operator.RawTx(c, withdrawal.FromAddress, withdrawal.ToAddress, withdrawal.Amount, "", withdrawal.Asset)
+  if err != nil {
+    util.GinRespException(c, http.StatusBadRequest, err)
+    return
+  }
+  chainID, err := chain.Client.NetworkID(c)
+  if err != nil {
+    util.GinRespException(c, http.StatusBadRequest, err)
+    return
+  }
+  res, err := grpcClient.SignatureEthereum(c, &pb.SignatureEthereumReq{Account: withdrawal.FromAddress, RawTxHex: rawTxHex, ChainID: chainID.String(), To: withdrawal.ToAddress, Amount: withdrawal.Amount, Asset: withdrawal.Asset})
+  if err != nil {
+    util.GinRespException(c, signatureStatus(err, http.StatusInternalServerError), err)
+    return
+  }
+  txid, err := b.Operator.BroadcastTx(c, res.HexSignedTx)
+  if err != nil {
+    util.GinRespException(c, http.StatusInternalServerError, err)
+    return
+  }
+  withdrawal.Txid = strings.ToLower(txid)
+  withdrawal.MaxFee = ethereumMaxFee(chain.Fee)
+
+  if err = recordEthereumReplacement(withdrawal, &replaced); err != nil {
+    util.GinRespException(c, http.StatusInternalServerError, fmt.Errorf("%s is broadcast, but fail to record replacement %s", txid, err))
+    return
+  }
+
+  c.JSON(http.StatusOK, gin.H {
+    "status": http.StatusOK,
+    "txid": txid,
+    "replaces": replaced.Txid,
+    "nonce": pending.Nonce,
+    "cancel": cancel,
+    "fee": ethereumFeeJSON(chain.Fee),
+  })
+}
+
+// recordEthereumReplacement save replacement withdrawal, link the replaced one to it and point nonce allocation at it
+func recordEthereumReplacement(withdrawal, replaced *db.Withdrawal) error {
+  ts := sqldb.Begin()
+  if err := ts.Create(withdrawal).Error; err != nil {
+    ts.Rollback()
+    return err
+  }
+  if err := ts.Model(replaced).Update("replaced_by", withdrawal.Txid).Error; err != nil {
+    ts.Rollback()
+    return err
+  }
+  if err := ts.Model(&db.NonceAllocation{}).Where("address = ? AND nonce = ?", withdrawal.FromAddress, withdrawal.Nonce).Update("txid", withdrawal.Txid).Error; err != nil {
+    ts.Rollback()
+    return err
+  }
+  return ts.Commit().Error
+}
+
+// ethereumWithdrawalHandle state of withdrawal and its replacements
+func ethereumWithdrawalHandle(c *gin.Context) {
+  detailParams, _ := c.Get("detail")
+  var params util.TxParams
+  if err := json.Unmarshal(detailParams.([]byte), &params); err != nil {
+    util.GinRespException(c, http.StatusBadRequest, err)
+    return
+  }
+
+  var withdrawal db.Withdrawal
+  if err := sqldb.First(&withdrawal, "txid = ? AND chain = ?", strings.ToLower(params.Txid), blockchain.Ethereum).Error; err != nil && err.Error() == "record not found" {
+    util.GinRespException(c, http.StatusNotFound, fmt.Errorf("Withdrawal not found in database: %s", params.Txid))
+    return
+  }else if err != nil {
+    util.GinRespException(c, http.StatusInternalServerError, err)
+    return
+  }
+  family, err := trackEthereumWithdrawal(c, &withdrawal)
+  if err != nil {
+    util.GinRespException(c, http.StatusInternalServerError, err)
+    return
+  }
+
+  res := gin.H {
+    "status": http.StatusOK,
+    "nonce": withdrawal.Nonce,
+    "latest": family.latest,
+    "txids": family.txids,
+    "state": family.state,
+  }
+  if family.mined != nil {
+    res["mined"] = family.mined.Txid
+    res["succeeded"] = family.receipt.Status == types.ReceiptStatusSuccessful
+    res["cancelled"] = family.mined.ToAddress == family.mined.FromAddress && family.mined.Amount == "0" && family.mined.Replaces != ""
+  }
+  c.JSON(http.StatusOK, res)
+}
+
+// ethereumWithdrawalFamily withdrawal and its replacements sharing nonce, state is mined, dropped or pending
+type ethereumWithdrawalFamily struct {
+  txids   []string
+  latest  string
+  state   string
+  mined   *db.Withdrawal
+  receipt *types.Receipt
+}
+
+// trackEthereumWithdrawal state of withdrawal and its replacements, which share nonce so at most one of them is mined.
+// state is mined when any of them is, dropped when nonce is taken by other tx, otherwise pending. nothing is written,
+// ethereumWithdrawalLoop settles the nonce
+func trackEthereumWithdrawal(ctx context.Context, withdrawal *db.Withdrawal) (*ethereumWithdrawalFamily, error) {
+  var withdrawals []db.Withdrawal
+  if err := sqldb.Where("chain = ? AND from_address = ? AND nonce = ?", blockchain.Ethereum, withdrawal.FromAddress, withdrawal.Nonce).Order("id").Find(&withdrawals).Error; err != nil {
+    return nil, err
+  }
+
+  family := &ethereumWithdrawalFamily{}
+  for i, tx := range withdrawals {
+    family.txids = append(family.txids, tx.Txid)
+    if tx.ReplacedBy == "" {
+      family.latest = tx.Txid
+    }
+    if family.mined != nil {
+      continue
+    }
+    r, err := ethereumClient.TransactionReceipt(ctx, common.HexToHash(tx.Txid))
+    if err == ethereum.NotFound {
+      continue
+    }else if err != nil {
+      return nil, fmt.Errorf("Receipt of %s %s", tx.Txid, err)
+    }
+    family.mined, family.receipt = &withdrawals[i], r
+  }
+
+  if family.mined != nil {
+    family.state = "mined"
+    return family, nil
+  }
+
+  nonce, err := ethereumClient.NonceAt(ctx, common.HexToAddress(withdrawal.FromAddress), nil)
+  if err != nil {
+    return nil, err
+  }
+  family.state = "pending"
+  if nonce > withdrawal.Nonce {
+    family.state = "dropped"
+  }
+  return family, nil
+}
+
+// ethereumWithdrawalLoop settle broadcast withdrawals every ethereumTrackInterval
+func ethereumWithdrawalLoop() {
+  ticker := time.NewTicker(ethereumTrackInterval)
+  defer ticker.Stop()
+  for range ticker.C {
+    if err := settleEthereumWithdrawals(context.Background()); err != nil {
+      configure.Sugar.Warn("settle ethereum withdrawals fail: ", err.Error())
+    }
+  }
+}
+
+// settleEthereumWithdrawals follow broadcast nonce allocations until a tx of their nonce is mined: monitoring follows the mined tx
+// whichever replacement it is, the nonce points at it and its paid fee is recorded. nonce taken by other tx is dropped
+func settleEthereumWithdrawals(ctx context.Context) error {
+  var allocations []db.NonceAllocation
+  if err := sqldb.Where("state = ?", "broadcast").Order("id").Find(&allocations).Error; err != nil {
+    return err
+  }
+  chain := blockchain.EthereumChain{Client: ethereumClient}
+  for i := range allocations {
+    allocation := &allocations[i]
+    var withdrawal db.Withdrawal
+    if err := sqldb.First(&withdrawal, "txid = ? AND chain = ?", allocation.Txid, blockchain.Ethereum).Error; err != nil && err.Error() == "record not found" {
+      // nonce is recorded right before its withdrawal
+      continue
+    }else if err != nil {
+      return err
+    }
+    family, err := trackEthereumWithdrawal(ctx, &withdrawal)
+    if err != nil {
+      configure.Sugar.Warn("Track ", withdrawal.Txid, " error: ", err.Error())
+      continue
+    }
+    switch family.state {
+    case "dropped":
+      err = sqldb.Model(allocation).Update("state", "dropped").Error
+    case "mined":
+      err = settleEthereumMined(chain, allocation, family.mined)
+    }
+    if err != nil {
+      configure.Sugar.Warn("Settle nonce ", allocation.Nonce, " of ", allocation.Address, " error: ", err.Error())
+    }
+  }
+  return nil
+}
+
+// settleEthereumMined record fee paid by mined withdrawal and point its nonce at it
+func settleEthereumMined(chain blockchain.EthereumChain, allocation *db.NonceAllocation, mined *db.Withdrawal) error {
+  fee, err := chain.PaidFee(mined.Txid)
+  if err != nil {
+    return err
+  }
+  paid, _ := util.ToEther(fee).Float64()
+  ts := sqldb.Begin()
+  if err = ts.Model(mined).Update("fee", paid).Error; err != nil {
+    ts.Rollback()
+    return err
+  }
+  if err = ts.Model(allocation).Updates(map[string]interface{}{"state": "mined", "txid": mined.Txid}).Error; err != nil {
+    ts.Rollback()
+    return err
+  }
+  return ts.Commit().Error
+}
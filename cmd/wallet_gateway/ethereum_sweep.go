@@ -0,0 +1,340 @@
+package main
+
+import (
+  "fmt"
+  "sort"
+  "sync"
+  "time"
+  "context"
+  "strings"
+  "math/big"
+  "net/http"
+  "encoding/json"
+  "github.com/gin-gonic/gin"
+  "github.com/shopspring/decimal"
+  "wallet-go/pkg/configure"
+  "wallet-go/pkg/blockchain"
+  "wallet-go/pkg/db"
+  "wallet-go/pkg/util"
+  "github.com/ethereum/go-ethereum/core/types"
+)
+
+const (
+  sweepFunding  = "funding"
+  sweepSweeping = "sweeping"
+  sweepDone     = "done"
+  sweepFailed   = "failed"
+)
+
+// ethereumSweepLock serializes sweeping of the endpoint and the schedule
+var ethereumSweepLock sync.Mutex
+
+func ethereumSweepHandle(c *gin.Context) {
+  assetParams, _ := c.Get("asset")
+  detailParams, _ := c.Get("detail")
+  if configure.ChainAssets[assetParams.(string)] != blockchain.Ethereum {
+    util.GinRespException(c, http.StatusBadRequest, fmt.Errorf("Unsupported Ethereum asset %s", assetParams.(string)))
+    return
+  }
+  var params util.EthereumSweepParams
+  if err := json.Unmarshal(detailParams.([]byte), &params); err != nil {
+    util.GinRespException(c, http.StatusBadRequest, err)
+    return
+  }
+  sweeps, code, err := sweepEthereum(c, strings.ToLower(params.Priority))
+  if err != nil {
+    util.GinRespException(c, code, err)
+    return
+  }
+  var res []gin.H
+  for _, sweep := range sweeps {
+    res = append(res, ethereumSweepJSON(sweep))
+  }
+  c.JSON(http.StatusOK, gin.H {
+    "status": http.StatusOK,
+    "to": configure.ChainsInfo[blockchain.Ethereum].SweepAddress,
+    "sweeps": res,
+  })
+}
+
+func ethereumSweepJSON(sweep db.EthereumSweep) gin.H {
+  return gin.H {
+    "id": sweep.ID,
+    "address": sweep.Address,
+    "asset": sweep.Asset,
+    "amount": sweep.Amount,
+    "state": sweep.State,
+    "fund_txid": sweep.FundTxid,
+    "fund_amount": sweep.FundAmount,
+    "txid": sweep.Txid,
+    "error": sweep.Error,
+  }
+}
+
+// ethereumSweepLoop sweep every sweep_interval seconds
+func ethereumSweepLoop(interval int) {
+  ticker := time.NewTicker(time.Duration(interval) * time.Second)
+  defer ticker.Stop()
+  for range ticker.C {
+    sweeps, _, err := sweepEthereum(context.Background(), "")
+    if err != nil {
+      configure.Sugar.Warn("sweep fail: ", err.Error())
+      continue
+    }
+    for _, sweep := range sweeps {
+      configure.Sugar.Info("sweep ", sweep.ID, " ", sweep.Amount, " ", sweep.Asset, " of ", sweep.Address, ": ", sweep.State, " ", sweep.Txid, sweep.Error)
+    }
+  }
+}
+
+// sweepEthereum advance ongoing sweeps, then sweep balances above sweep_thresholds of sub addresses with confirmed deposits
+// into sweep_address. an address has one ongoing sweep at a time, tokens go before ether which pays their gas.
+// returns sweeps advanced or started with http status code
+func sweepEthereum(ctx context.Context, priority string) ([]db.EthereumSweep, int, error) {
+  ethereumSweepLock.Lock()
+  defer ethereumSweepLock.Unlock()
+
+  info := configure.ChainsInfo[blockchain.Ethereum]
+  if info.SweepAddress == "" {
+    return nil, http.StatusBadRequest, fmt.Errorf("sweep_address isn't configured")
+  }
+  var hot db.SubAddress
+  if err := sqldb.First(&hot, "address = ? AND asset = ?", info.SweepAddress, blockchain.Ethereum).Error; err != nil {
+    return nil, http.StatusInternalServerError, fmt.Errorf("sweep_address %s must be sub address %s", info.SweepAddress, err)
+  }
+
+  var ongoing []db.EthereumSweep
+  if err := sqldb.Where("state IN (?)", []string{sweepFunding, sweepSweeping}).Order("id").Find(&ongoing).Error; err != nil {
+    return nil, http.StatusInternalServerError, err
+  }
+  busy := make(map[string]bool)
+  var sweeps []db.EthereumSweep
+  for i := range ongoing {
+    sweep := &ongoing[i]
+    if err := advanceEthereumSweep(ctx, sweep, hot.Address, priority); err != nil {
+      configure.Sugar.Warn("Advance sweep ", sweep.ID, " of ", sweep.Address, " error: ", err.Error())
+    }
+    if sweep.State == sweepFunding || sweep.State == sweepSweeping {
+      busy[sweep.Address] = true
+    }
+    sweeps = append(sweeps, *sweep)
+  }
+
+  addresses, err := sqldb.EthereumDepositAddresses()
+  if err != nil {
+    return nil, http.StatusInternalServerError, err
+  }
+  chain := blockchain.EthereumChain{Client: ethereumClient, Priority: priority}
+  for _, address := range addresses {
+    if address == hot.Address || busy[address] {
+      continue
+    }
+    sweep, err := startEthereumSweep(ctx, chain, address, hot.Address)
+    if err != nil {
+      configure.Sugar.Warn("Sweep ", address, " error: ", err.Error())
+    }
+    if sweep != nil {
+      sweeps = append(sweeps, *sweep)
+    }
+  }
+  return sweeps, http.StatusOK, nil
+}
+
+// startEthereumSweep sweep the first asset of address above its threshold, token of address short of gas
+// is funded by sweep_address and swept once the top-up is mined. nil when nothing is above threshold
+func startEthereumSweep(ctx context.Context, chain blockchain.EthereumChain, address, hot string) (*db.EthereumSweep, error) {
+  info := configure.ChainsInfo[blockchain.Ethereum]
+  coin := strings.ToLower(info.Coin)
+  var assets []string
+  for asset := range info.SweepThresholds {
+    if asset != coin {
+      assets = append(assets, asset)
+    }
+  }
+  sort.Strings(assets)
+  if _, ok := info.SweepThresholds[coin]; ok {
+    assets = append(assets, coin)
+  }
+
+  for _, asset := range assets {
+    threshold, err := decimal.NewFromString(info.SweepThresholds[asset])
+    if err != nil {
+      return nil, fmt.Errorf("Invalid sweep threshold of %s %s", asset, err)
+    }
+    token, err := chain.Token(asset)
+    if err != nil {
+      return nil, err
+    }
+    balance, err := ethereumBalance(ctx, chain, address, asset)
+    if err != nil {
+      return nil, err
+    }
+    if balance.Sign() == 0 || decimal.NewFromBigInt(balance, -token.Decimals).LessThan(threshold) {
+      continue
+    }
+    if asset == coin {
+      return sweepEther(ctx, chain, address, hot, balance)
+    }
+    return sweepToken(ctx, chain, address, hot, asset, token.FromBaseUnits(balance))
+  }
+  return nil, nil
+}
+
+// sweepEther sweep ether balance of address except the max fee of the sweep tx
+func sweepEther(ctx context.Context, chain blockchain.EthereumChain, address, hot string, balance *big.Int) (*db.EthereumSweep, error) {
+  coin := strings.ToLower(configure.ChainsInfo[blockchain.Ethereum].Coin)
+  ether, err := chain.Token(coin)
+  if err != nil {
+    return nil, err
+  }
+  fee, err := chain.TransferFee(ctx, address, hot, ether.FromBaseUnits(balance), coin)
+  if err != nil {
+    return nil, err
+  }
+  value := new(big.Int).Sub(balance, fee.MaxFee)
+  if value.Sign() <= 0 {
+    return nil, nil
+  }
+  amount := ether.FromBaseUnits(value)
+  // the same quote pays max fee kept out of the amount
+  txid, _, _, err := sendEthereum(ctx, address, hot, amount, coin, chain.Priority, fee)
+  if err != nil {
+    return nil, err
+  }
+  sweep := &db.EthereumSweep{Address: address, Asset: coin, Amount: amount, State: sweepSweeping, Txid: txid}
+  if err = sqldb.Create(sweep).Error; err != nil {
+    return nil, fmt.Errorf("%s is broadcast, but fail to record sweep %s", txid, err)
+  }
+  return sweep, nil
+}
+
+// sweepToken sweep token amount of address, ether short of the max fee of the token transfer is sent from sweep_address first
+func sweepToken(ctx context.Context, chain blockchain.EthereumChain, address, hot, asset, amount string) (*db.EthereumSweep, error) {
+  coin := strings.ToLower(configure.ChainsInfo[blockchain.Ethereum].Coin)
+  fee, err := chain.TransferFee(ctx, address, hot, amount, asset)
+  if err != nil {
+    return nil, err
+  }
+  etherBalance, err := ethereumBalance(ctx, chain, address, coin)
+  if err != nil {
+    return nil, err
+  }
+
+  sweep := &db.EthereumSweep{Address: address, Asset: asset, Amount: amount}
+  if etherBalance.Cmp(fee.MaxFee) < 0 {
+    ether, err := chain.Token(coin)
+    if err != nil {
+      return nil, err
+    }
+    topUp := ether.FromBaseUnits(new(big.Int).Sub(fee.MaxFee, etherBalance))
+    txid, _, _, err := sendEthereum(ctx, hot, address, topUp, coin, chain.Priority, nil)
+    if err != nil {
+      return nil, fmt.Errorf("Fund gas of %s %s", address, err)
+    }
+    sweep.State, sweep.FundTxid, sweep.FundAmount = sweepFunding, txid, topUp
+    setSweepQuote(sweep, fee)
+  }else {
+    txid, _, _, err := sendEthereum(ctx, address, hot, amount, asset, chain.Priority, fee)
+    if err != nil {
+      return nil, err
+    }
+    sweep.State, sweep.Txid = sweepSweeping, txid
+  }
+  if err = sqldb.Create(sweep).Error; err != nil {
+    return nil, fmt.Errorf("%s is broadcast, but fail to record sweep %s", sweep.FundTxid + sweep.Txid, err)
+  }
+  return sweep, nil
+}
+
+// advanceEthereumSweep follow the tx of current step, which may have been replaced by speed up.
+// mined top-up sends the token transfer, mined sweep is done, failed, dropped or unrecorded tx fails the sweep
+func advanceEthereumSweep(ctx context.Context, sweep *db.EthereumSweep, hot, priority string) error {
+  txid := sweep.Txid
+  if sweep.State == sweepFunding {
+    txid = sweep.FundTxid
+  }
+  var withdrawal db.Withdrawal
+  if err := sqldb.First(&withdrawal, "txid = ? AND chain = ?", txid, blockchain.Ethereum).Error; err != nil && err.Error() == "record not found" {
+    // tx can't be followed without its withdrawal, address is released for the next sweep
+    sweep.State, sweep.Error = sweepFailed, fmt.Sprintf("withdrawal of %s isn't recorded", txid)
+    return sqldb.Save(sweep).Error
+  }else if err != nil {
+    return fmt.Errorf("Withdrawal %s %s", txid, err)
+  }
+  family, err := trackEthereumWithdrawal(ctx, &withdrawal)
+  if err != nil {
+    return err
+  }
+  switch {
+  case family.state == "pending":
+    return nil
+  case family.state == "dropped":
+    sweep.State, sweep.Error = sweepFailed, fmt.Sprintf("%s is dropped", txid)
+  case family.receipt.Status != types.ReceiptStatusSuccessful:
+    sweep.State, sweep.Error = sweepFailed, fmt.Sprintf("%s failed", family.mined.Txid)
+  case sweep.State == sweepSweeping:
+    sweep.State, sweep.Txid = sweepDone, family.mined.Txid
+  default:
+    sweep.FundTxid = family.mined.Txid
+    quote, err := sweepQuote(sweep)
+    if err != nil {
+      return err
+    }
+    // the funded quote is kept even if base fee has risen, the transfer can be sped up
+    sweepTxid, _, _, err := sendEthereum(ctx, sweep.Address, hot, sweep.Amount, sweep.Asset, priority, quote)
+    if err != nil {
+      sweep.State, sweep.Error = sweepFailed, err.Error()
+    }else {
+      sweep.State, sweep.Txid = sweepSweeping, sweepTxid
+    }
+  }
+  return sqldb.Save(sweep).Error
+}
+
+// setSweepQuote record fee quote of token transfer funded by the top-up
+func setSweepQuote(sweep *db.EthereumSweep, fee *blockchain.EthereumFee) {
+  sweep.FeeType, sweep.Gas = fee.Type, fee.Gas
+  sweep.GasPrice, sweep.GasTipCap, sweep.GasFeeCap = bigString(fee.GasPrice), bigString(fee.GasTipCap), bigString(fee.GasFeeCap)
+}
+
+// sweepQuote fee quote of funded token transfer, nil for sweep recorded without quote which is quoted again
+func sweepQuote(sweep *db.EthereumSweep) (*blockchain.EthereumFee, error) {
+  if sweep.Gas == 0 {
+    return nil, nil
+  }
+  fee := &blockchain.EthereumFee{Type: sweep.FeeType, Gas: sweep.Gas}
+  for _, field := range []struct {
+    value string
+    to    **big.Int
+  }{{sweep.GasPrice, &fee.GasPrice}, {sweep.GasTipCap, &fee.GasTipCap}, {sweep.GasFeeCap, &fee.GasFeeCap}} {
+    if field.value == "" {
+      continue
+    }
+    value, ok := new(big.Int).SetString(field.value, 10)
+    if !ok {
+      return nil, fmt.Errorf("Invalid fee quote %s of sweep %d", field.value, sweep.ID)
+    }
+    *field.to = value
+  }
+  return fee, nil
+}
+
+func bigString(value *big.Int) string {
+  if value == nil {
+    return ""
+  }
+  return value.String()
+}
+
+// ethereumBalance balance of address in smallest unit of asset
+func ethereumBalance(ctx context.Context, chain blockchain.EthereumChain, address, asset string) (*big.Int, error) {
+  balance, err := chain.Balance(ctx, address, asset, "")
+  if err != nil {
+    return nil, err
+  }
+  units, ok := new(big.Int).SetString(balance, 10)
+  if !ok {
+    return nil, fmt.Errorf("Invalid balance %s of %s", balance, address)
+  }
+  return units, nil
+}
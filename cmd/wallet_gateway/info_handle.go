@@ -7,7 +7,10 @@ import (
   "net/http"
   "encoding/json"
   "github.com/gin-gonic/gin"
+  "google.golang.org/grpc/codes"
+  "google.golang.org/grpc/status"
   "wallet-go/pkg/util"
+  "wallet-go/pkg/blockchain"
   "github.com/ethereum/go-ethereum/common"
 	"github.com/btcsuite/btcutil"
   "github.com/btcsuite/btcd/chaincfg/chainhash"
@@ -81,14 +84,22 @@ func addressValidator(c *gin.Context) {
     util.GinRespException(c, http.StatusBadRequest, err)
     return
   }
+  var addressType string
   switch asset.(string) {
   case "btc":
-    _, err := btcutil.DecodeAddress(*addressHex, bitcoinnet)
+    address, err := btcutil.DecodeAddress(*addressHex, bitcoinnet)
     if err != nil {
       e := errors.New(strings.Join([]string{"To address illegal", err.Error()}, ":"))
       util.GinRespException(c, http.StatusBadRequest, e)
       return
     }
+    if !address.IsForNet(bitcoinnet) {
+      e := errors.New(strings.Join([]string{"To: ", *addressHex, " isn't ", bitcoinnet.Name, " address"}, ""))
+      util.GinRespException(c, http.StatusBadRequest, e)
+      return
+    }
+    // wallet address types are classified, other valid destinations such as P2WSH have no address type
+    addressType, _ = blockchain.BitcoinAddressTypeOf(address)
   case "eth":
     if !common.IsHexAddress(*addressHex) {
       err := errors.New(strings.Join([]string{"To: ", *addressHex, " isn't valid ethereum address"}, ""))
@@ -103,6 +114,7 @@ func addressValidator(c *gin.Context) {
   c.JSON(http.StatusOK, gin.H {
     "status": http.StatusOK,
     "valid": true,
+    "address_type": addressType,
   })
 }
 
@@ -136,3 +148,15 @@ func addressWithAssetParams(params []byte) (*string, error) {
   }
   return &addressAsset.Address, nil
 }
+
+// signatureStatus http status of wallet_core signature error, policy violation is forbidden
+func signatureStatus(err error, fallback int) int {
+  switch status.Code(err) {
+  case codes.PermissionDenied:
+    return http.StatusForbidden
+  case codes.InvalidArgument:
+    return http.StatusBadRequest
+  default:
+    return fallback
+  }
+}
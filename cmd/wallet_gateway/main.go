@@ -3,6 +3,7 @@ package main
 import (
   "flag"
   "google.golang.org/grpc"
+  "google.golang.org/grpc/credentials"
   "wallet-go/pkg/db"
   "wallet-go/pkg/util"
   "wallet-go/pkg/configure"
@@ -45,7 +46,11 @@ func main() {
   }
   defer sqldb.Close()
 
-  rpcConn, err = grpc.Dial(configure.Config.WalletCoreRPCURL, grpc.WithInsecure())
+  tlsConfig, err := util.ClientTLSConfig(configure.Config.WalletCoreTLS)
+  if err != nil {
+    configure.Sugar.Fatal("wallet_core_tls error: ", err.Error())
+  }
+  rpcConn, err = grpc.Dial(configure.Config.WalletCoreRPCURL, grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig)))
   if err != nil {
     configure.Sugar.Fatal("fail to connect grpc server")
   }
@@ -65,6 +70,9 @@ func main() {
   if err != nil {
     configure.Sugar.Fatal("Ethereum client error: ", err.Error())
   }
+  if err = reconcileEthereumNonces(); err != nil {
+    configure.Sugar.Fatal("Reconcile ethereum nonce error: ", err.Error())
+  }
 
   eosClient = eos.New(configure.Config.EOSIORPC)
 
@@ -76,10 +84,19 @@ func main() {
 
   r.POST("/bitcoincore/wallet", bitcoincoreWalletHandle)
   r.POST("/bitcoincore/tx", bitcoincoreWithdrawHandle)
+  r.POST("/bitcoincore/bumpfee", bitcoincoreBumpFeeHandle)
+  r.POST("/bitcoincore/cpfp", bitcoincoreCPFPHandle)
+  r.POST("/bitcoincore/batch", bitcoincoreBatchHandle)
+  r.GET("/bitcoincore/batch", bitcoincoreBatchStatusHandle)
+  r.POST("/bitcoincore/consolidate", bitcoincoreConsolidateHandle)
 
   r.POST("/ethereum/wallet", ethereumWalletHandle)
   r.GET("/ethereum/balance", ethereumBalanceHandle)
   r.POST("/ethereum/tx", ethereumWithdrawHandle)
+  r.POST("/ethereum/speedup", ethereumSpeedUpHandle)
+  r.POST("/ethereum/cancel", ethereumCancelHandle)
+  r.GET("/ethereum/withdrawal", ethereumWithdrawalHandle)
+  r.POST("/ethereum/sweep", ethereumSweepHandle)
 
   r.GET("/omnicore/balance", omniBalanceHandle)
 
@@ -87,6 +104,15 @@ func main() {
   r.GET("/block", blockHandle)
   r.GET("/address_validator", addressValidator)
   r.GET("/best_block", bestBlock)
+
+  go bitcoinBatchLoop()
+  if interval := configure.ChainsInfo[blockchain.Bitcoin].ConsolidateInterval; interval > 0 {
+    go bitcoinConsolidateLoop(interval)
+  }
+  go ethereumWithdrawalLoop()
+  if interval := configure.ChainsInfo[blockchain.Ethereum].SweepInterval; interval > 0 {
+    go ethereumSweepLoop(interval)
+  }
   if err := r.Run(":8000"); err != nil {
     configure.Sugar.Fatal(err.Error())
   }
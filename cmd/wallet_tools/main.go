@@ -1,7 +1,13 @@
 package main
 
 import (
+	"os"
+	"fmt"
+	"time"
+	"path/filepath"
 	"github.com/spf13/cobra"
+	"github.com/manifoldco/promptui"
+	"wallet-go/pkg/audit"
 	"wallet-go/pkg/blockchain"
 	"wallet-go/pkg/configure"
 	"wallet-go/pkg/db"
@@ -12,6 +18,18 @@ var (
 	asset	string
 	local	bool
 	utxo bool
+	importMnemonic bool
+	certDir string
+	serverName string
+	serverHosts []string
+	clientNames []string
+	auditFrom string
+	auditTo string
+	auditOut string
+	gatewayURL string
+	bumpTxid string
+	bumpFeeRate float64
+	ethPriority string
 )
 
 var rootCmd = &cobra.Command {
@@ -98,12 +116,266 @@ var importPrivateKey = &cobra.Command {
 	},
 }
 
+var initSeed = &cobra.Command {
+	Use:   "seed",
+	Short: "Init wallet_core BIP39 mnemonic master seed, encrypted by passphrase",
+	Run: func(cmd *cobra.Command, args []string) {
+		var (
+			mnemonic string
+			err error
+		)
+		if importMnemonic {
+			prompt := promptui.Prompt {
+				Label: "BIP39 mnemonic",
+				Mask:  '*',
+			}
+			if mnemonic, err = prompt.Run(); err != nil {
+				configure.Sugar.Fatal(err.Error())
+			}
+		}else {
+			if mnemonic, err = blockchain.NewMnemonic(); err != nil {
+				configure.Sugar.Fatal(err.Error())
+			}
+		}
+
+		passphrase, err := util.PromptPassphrase("Master seed passphrase", true)
+		if err != nil {
+			configure.Sugar.Fatal(err.Error())
+		}
+		// wallet_core unlocks master seed and key store with the same passphrase, existing key store must accept it
+		if _, err = db.UnlockKEK(passphrase); err == db.ErrKEKNotInitialized {
+			_, err = db.InitKEK(passphrase)
+		}
+		if err != nil {
+			configure.Sugar.Fatal(err.Error())
+		}
+		if err = blockchain.InitHDWallet(mnemonic, passphrase); err != nil {
+			configure.Sugar.Fatal(err.Error())
+		}
+		if !importMnemonic {
+			fmt.Println("Write down the mnemonic and keep it offline, it is the only way to recover the wallet:")
+			fmt.Println(mnemonic)
+		}
+		configure.Sugar.Info("Init master seed successfully")
+	},
+}
+
+var encryptKeyStore = &cobra.Command {
+	Use:   "encrypt",
+	Short: "Encrypt plaintext private keys of levelDB key store in place, with the wallet passphrase",
+	Run: func(cmd *cobra.Command, args []string) {
+		var folder string
+		switch asset {
+		case "btc":
+			folder = db.BitcoinCoreLD
+		case "eth":
+			folder = db.EthereumLD
+		case "eos":
+			folder = db.EOSLD
+		default:
+			configure.Sugar.Fatal("Only support btc, eth, eos")
+			return
+		}
+
+		passphrase, err := util.PromptPassphrase("Wallet passphrase", true)
+		if err != nil {
+			configure.Sugar.Fatal(err.Error())
+		}
+		// key store created before the master seed is initialized here, passphrase is confirmed above
+		kek, err := db.UnlockKEK(passphrase)
+		if err == db.ErrKEKNotInitialized {
+			kek, err = db.InitKEK(passphrase)
+		}
+		if err != nil {
+			configure.Sugar.Fatal(err.Error())
+		}
+		ldb, err := db.NewEncryptedLDB(folder, kek)
+		if err != nil {
+			configure.Sugar.Fatal(err.Error())
+		}
+		defer ldb.Close()
+		count, err := ldb.EncryptPlaintext()
+		if err != nil {
+			configure.Sugar.Fatal(err.Error())
+		}
+		configure.Sugar.Info("Encrypt ", asset, " key store successfully, encrypted keys: ", count)
+	},
+}
+
+var issueCerts = &cobra.Command {
+	Use:   "certs",
+	Short: "Issue CA, wallet_core server and client certificates for gRPC mutual TLS, existing CA in dir is reused",
+	Run: func(cmd *cobra.Command, args []string) {
+		if certDir == "" {
+			certDir = filepath.Join(configure.HomeDir(), ".wallet_certs")
+		}
+		if err := util.IssueCertificates(certDir, serverName, serverHosts, clientNames); err != nil {
+			configure.Sugar.Fatal(err.Error())
+		}
+		configure.Sugar.Info("Issue certificates to ", certDir, " successfully")
+	},
+}
+
+var auditLog = &cobra.Command {
+	Use:   "audit",
+	Short: "Verify or export wallet_core audit log, wallet_core must be stopped",
+}
+
+var verifyAudit = &cobra.Command {
+	Use:   "verify",
+	Short: "Verify hash chain of wallet_core audit log",
+	Run: func(cmd *cobra.Command, args []string) {
+		log, err := audit.Open()
+		if err != nil {
+			configure.Sugar.Fatal(err.Error())
+		}
+		defer log.Close()
+		count, err := log.Verify()
+		if err != nil {
+			configure.Sugar.Fatal("Audit log is tampered: ", err.Error(), " verified entries: ", count)
+		}
+		seq, hash := log.Head()
+		configure.Sugar.Info("Audit log is intact, entries: ", count, " head seq: ", seq, " head hash: ", hash)
+	},
+}
+
+var exportAudit = &cobra.Command {
+	Use:   "export",
+	Short: "Export wallet_core audit log entries of UTC date range [from, to] as json lines",
+	Run: func(cmd *cobra.Command, args []string) {
+		from, err := time.Parse("2006-01-02", auditFrom)
+		if err != nil {
+			configure.Sugar.Fatal("from date error: ", err.Error())
+		}
+		to, err := time.Parse("2006-01-02", auditTo)
+		if err != nil {
+			configure.Sugar.Fatal("to date error: ", err.Error())
+		}
+		out := os.Stdout
+		if auditOut != "" {
+			if out, err = os.OpenFile(auditOut, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600); err != nil {
+				configure.Sugar.Fatal(err.Error())
+			}
+			defer out.Close()
+		}
+		log, err := audit.Open()
+		if err != nil {
+			configure.Sugar.Fatal(err.Error())
+		}
+		defer log.Close()
+		count, err := log.Export(from, to.AddDate(0, 0, 1), out)
+		if err != nil {
+			configure.Sugar.Fatal(err.Error())
+		}
+		if auditOut != "" {
+			configure.Sugar.Info("Export audit entries: ", count, " to ", auditOut)
+		}
+	},
+}
+
+var bumpFee = &cobra.Command {
+	Use:   "bumpfee",
+	Short: "Replace stuck bitcoin withdrawal with higher fee rate (BIP125), wallet_gateway rebuilds and broadcasts the replacement",
+	Run: func(cmd *cobra.Command, args []string) {
+		params := util.BumpFeeParams{Asset: configure.ChainsInfo[blockchain.Bitcoin].Coin, Txid: bumpTxid, FeeRate: bumpFeeRate}
+		code, body, err := util.GatewayRequest("POST", gatewayURL + "/bitcoincore/bumpfee", params)
+		if err != nil {
+			configure.Sugar.Fatal(err.Error())
+		}
+		if code != 200 {
+			configure.Sugar.Fatal("Bump fee of ", bumpTxid, " fail: ", string(body))
+		}
+		fmt.Println(string(body))
+	},
+}
+
+var cpfp = &cobra.Command {
+	Use:   "cpfp",
+	Short: "Accelerate unconfirmed bitcoin deposit by child-pays-for-parent, wallet_gateway spends the deposit back to its sub address",
+	Run: func(cmd *cobra.Command, args []string) {
+		params := util.CPFPParams{Asset: configure.ChainsInfo[blockchain.Bitcoin].Coin, Txid: bumpTxid, FeeRate: bumpFeeRate}
+		code, body, err := util.GatewayRequest("POST", gatewayURL + "/bitcoincore/cpfp", params)
+		if err != nil {
+			configure.Sugar.Fatal(err.Error())
+		}
+		if code != 200 {
+			configure.Sugar.Fatal("CPFP of ", bumpTxid, " fail: ", string(body))
+		}
+		fmt.Println(string(body))
+	},
+}
+
+var consolidate = &cobra.Command {
+	Use:   "consolidate",
+	Short: "Sweep small bitcoin utxos of sub addresses into consolidate_address when fee rate isn't above consolidate_fee_rate",
+	Run: func(cmd *cobra.Command, args []string) {
+		params := util.ConsolidateParams{Asset: configure.ChainsInfo[blockchain.Bitcoin].Coin, FeeRate: bumpFeeRate}
+		code, body, err := util.GatewayRequest("POST", gatewayURL + "/bitcoincore/consolidate", params)
+		if err != nil {
+			configure.Sugar.Fatal(err.Error())
+		}
+		if code != 200 {
+			configure.Sugar.Fatal("Consolidate fail: ", string(body))
+		}
+		fmt.Println(string(body))
+	},
+}
+
+var ethSpeedUp = &cobra.Command {
+	Use:   "speedup",
+	Short: "Replace pending ethereum withdrawal with the same tx at higher fee, tip and fee cap are at least 10% above the pending tx",
+	Run: func(cmd *cobra.Command, args []string) {
+		params := util.EthereumReplaceParams{Asset: configure.ChainsInfo[blockchain.Ethereum].Coin, Txid: bumpTxid, Priority: ethPriority}
+		code, body, err := util.GatewayRequest("POST", gatewayURL + "/ethereum/speedup", params)
+		if err != nil {
+			configure.Sugar.Fatal(err.Error())
+		}
+		if code != 200 {
+			configure.Sugar.Fatal("Speed up ", bumpTxid, " fail: ", string(body))
+		}
+		fmt.Println(string(body))
+	},
+}
+
+var ethCancel = &cobra.Command {
+	Use:   "cancel",
+	Short: "Cancel pending ethereum withdrawal by 0 value self transfer at the same nonce and higher fee",
+	Run: func(cmd *cobra.Command, args []string) {
+		params := util.EthereumReplaceParams{Asset: configure.ChainsInfo[blockchain.Ethereum].Coin, Txid: bumpTxid, Priority: ethPriority}
+		code, body, err := util.GatewayRequest("POST", gatewayURL + "/ethereum/cancel", params)
+		if err != nil {
+			configure.Sugar.Fatal(err.Error())
+		}
+		if code != 200 {
+			configure.Sugar.Fatal("Cancel ", bumpTxid, " fail: ", string(body))
+		}
+		fmt.Println(string(body))
+	},
+}
+
+var ethSweep = &cobra.Command {
+	Use:   "sweep",
+	Short: "Sweep ethereum sub address balances above sweep_thresholds into sweep_address, token gas is funded by sweep_address",
+	Run: func(cmd *cobra.Command, args []string) {
+		params := util.EthereumSweepParams{Asset: configure.ChainsInfo[blockchain.Ethereum].Coin, Priority: ethPriority}
+		code, body, err := util.GatewayRequest("POST", gatewayURL + "/ethereum/sweep", params)
+		if err != nil {
+			configure.Sugar.Fatal(err.Error())
+		}
+		if code != 200 {
+			configure.Sugar.Fatal("Sweep fail: ", string(body))
+		}
+		fmt.Println(string(body))
+	},
+}
+
 func main() {
 	execute()
 }
 
 func init() {
-	rootCmd.AddCommand(dumpWallet, migrateWallet, rsaGenerate, importPrivateKey)
+	rootCmd.AddCommand(dumpWallet, migrateWallet, rsaGenerate, importPrivateKey, initSeed, encryptKeyStore, issueCerts, auditLog, bumpFee, cpfp, consolidate, ethSpeedUp, ethCancel, ethSweep)
+	auditLog.AddCommand(verifyAudit, exportAudit)
 	dumpWallet.Flags().StringVarP(&asset, "asset", "a", "btc", "asset type, support btc, eth")
 	dumpWallet.MarkFlagRequired("asset")
 	dumpWallet.Flags().BoolVarP(&local, "local", "l", false, "copy dump wallet file to local machine. default copy to remote server, which is set in configure")
@@ -111,4 +383,43 @@ func init() {
 
 	migrateWallet.Flags().StringVarP(&asset, "asset", "a", "", "asset type, support btc, eth")
 	migrateWallet.MarkFlagRequired("asset")
+
+	encryptKeyStore.Flags().StringVarP(&asset, "asset", "a", "", "asset type, support btc, eth, eos")
+	encryptKeyStore.MarkFlagRequired("asset")
+
+	issueCerts.Flags().StringVarP(&certDir, "dir", "d", "", "certificates output dir, default ~/.wallet_certs")
+	issueCerts.Flags().StringVarP(&serverName, "server-name", "n", "wallet_core", "wallet_core certificate name, must match wallet_core_tls server_name of wallet_gateway")
+	issueCerts.Flags().StringSliceVarP(&serverHosts, "host", "H", nil, "extra wallet_core host names or IPs in server certificate")
+	issueCerts.Flags().StringSliceVarP(&clientNames, "client", "c", []string{"wallet_gateway"}, "client certificate common names")
+
+	exportAudit.Flags().StringVarP(&auditFrom, "from", "f", "", "start date, YYYY-MM-DD")
+	exportAudit.MarkFlagRequired("from")
+	exportAudit.Flags().StringVarP(&auditTo, "to", "t", "", "end date inclusive, YYYY-MM-DD")
+	exportAudit.MarkFlagRequired("to")
+	exportAudit.Flags().StringVarP(&auditOut, "out", "o", "", "output file, default stdout")
+
+	bumpFee.Flags().StringVarP(&gatewayURL, "gateway", "g", "http://127.0.0.1:8000", "wallet_gateway url")
+	bumpFee.Flags().StringVarP(&bumpTxid, "txid", "t", "", "txid of the withdrawal to replace")
+	bumpFee.MarkFlagRequired("txid")
+	bumpFee.Flags().Float64VarP(&bumpFeeRate, "fee-rate", "r", 0, "fee rate of replacement in satoshi per vbyte, default node estimation")
+
+	cpfp.Flags().StringVarP(&gatewayURL, "gateway", "g", "http://127.0.0.1:8000", "wallet_gateway url")
+	cpfp.Flags().StringVarP(&bumpTxid, "txid", "t", "", "txid of the unconfirmed deposit")
+	cpfp.MarkFlagRequired("txid")
+	cpfp.Flags().Float64VarP(&bumpFeeRate, "fee-rate", "r", 0, "target fee rate of deposit and child in satoshi per vbyte, default node estimation")
+
+	consolidate.Flags().StringVarP(&gatewayURL, "gateway", "g", "http://127.0.0.1:8000", "wallet_gateway url")
+	consolidate.Flags().Float64VarP(&bumpFeeRate, "fee-rate", "r", 0, "fee rate of consolidation in satoshi per vbyte, default node estimation")
+
+	for _, command := range []*cobra.Command{ethSpeedUp, ethCancel} {
+		command.Flags().StringVarP(&gatewayURL, "gateway", "g", "http://127.0.0.1:8000", "wallet_gateway url")
+		command.Flags().StringVarP(&bumpTxid, "txid", "t", "", "txid of the pending ethereum withdrawal")
+		command.MarkFlagRequired("txid")
+		command.Flags().StringVarP(&ethPriority, "priority", "p", "", "slow, normal or fast tip of replacement, default normal")
+	}
+
+	ethSweep.Flags().StringVarP(&gatewayURL, "gateway", "g", "http://127.0.0.1:8000", "wallet_gateway url")
+	ethSweep.Flags().StringVarP(&ethPriority, "priority", "p", "", "slow, normal or fast tip of sweep and top-up txs, default normal")
+
+	initSeed.Flags().BoolVarP(&importMnemonic, "import", "i", false, "import existing mnemonic instead of generating a new one")
 }
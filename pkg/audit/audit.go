@@ -0,0 +1,180 @@
+package audit
+
+import (
+  "io"
+  "fmt"
+  "time"
+  "bytes"
+  "crypto/sha256"
+  "encoding/hex"
+  "encoding/json"
+  "encoding/binary"
+  "wallet-go/pkg/db"
+)
+
+// genesisHash previous hash of the first entry
+var genesisHash = make([]byte, sha256.Size)
+
+// Open open audit leveldb, chain head is the last entry
+func Open() (*Log, error) {
+  ldb, err := db.NewLDB(db.AuditLD)
+  if err != nil {
+    return nil, err
+  }
+  l := &Log{ldb: ldb, head: genesisHash}
+  iter := ldb.NewIterator(nil, nil)
+  defer iter.Release()
+  if iter.Last() {
+    entry, err := decodeEntry(iter.Value())
+    if err != nil {
+      ldb.Close()
+      return nil, err
+    }
+    if l.head, err = hex.DecodeString(entry.Hash); err != nil {
+      ldb.Close()
+      return nil, fmt.Errorf("Corrupted audit entry %d %s", entry.Seq, err)
+    }
+    l.seq = entry.Seq
+  }
+  if err = iter.Error(); err != nil {
+    ldb.Close()
+    return nil, err
+  }
+  return l, nil
+}
+
+// Append chain a new entry to the head, request is the serialized call request
+func (l *Log) Append(method, caller string, request []byte, result, errMsg string) (*Entry, error) {
+  requestDigest := sha256.Sum256(request)
+  l.mu.Lock()
+  defer l.mu.Unlock()
+  entry := &Entry{
+    Seq:           l.seq + 1,
+    Time:          time.Now().UTC(),
+    Method:        method,
+    Caller:        caller,
+    RequestDigest: hex.EncodeToString(requestDigest[:]),
+    Result:        result,
+    Error:         errMsg,
+    PrevHash:      hex.EncodeToString(l.head),
+  }
+  hash := entry.digest(l.head)
+  entry.Hash = hex.EncodeToString(hash)
+  value, err := json.Marshal(entry)
+  if err != nil {
+    return nil, err
+  }
+  if err = l.ldb.Put(seqKey(entry.Seq), value, nil); err != nil {
+    return nil, fmt.Errorf("Append audit entry %s", err)
+  }
+  l.seq, l.head = entry.Seq, hash
+  return entry, nil
+}
+
+// Verify recompute the chain from the first entry, return number of verified entries
+func (l *Log) Verify() (uint64, error) {
+  l.mu.Lock()
+  defer l.mu.Unlock()
+  prev := genesisHash
+  var count uint64
+  iter := l.ldb.NewIterator(nil, nil)
+  defer iter.Release()
+  for iter.Next() {
+    entry, err := decodeEntry(iter.Value())
+    if err != nil {
+      return count, err
+    }
+    expected := count + 1
+    if binary.BigEndian.Uint64(iter.Key()) != expected || entry.Seq != expected {
+      return count, fmt.Errorf("Audit entry %d is missing or reordered", expected)
+    }
+    if entry.PrevHash != hex.EncodeToString(prev) {
+      return count, fmt.Errorf("Audit entry %d previous hash mismatch", entry.Seq)
+    }
+    hash := entry.digest(prev)
+    if entry.Hash != hex.EncodeToString(hash) {
+      return count, fmt.Errorf("Audit entry %d hash mismatch, entry was modified", entry.Seq)
+    }
+    prev = hash
+    count++
+  }
+  if err := iter.Error(); err != nil {
+    return count, err
+  }
+  if !bytes.Equal(prev, l.head) {
+    return count, fmt.Errorf("Audit chain head mismatch after %d entries", count)
+  }
+  return count, nil
+}
+
+// Export write entries of [from, to) as json lines
+func (l *Log) Export(from, to time.Time, w io.Writer) (int, error) {
+  l.mu.Lock()
+  defer l.mu.Unlock()
+  var count int
+  encoder := json.NewEncoder(w)
+  iter := l.ldb.NewIterator(nil, nil)
+  defer iter.Release()
+  for iter.Next() {
+    entry, err := decodeEntry(iter.Value())
+    if err != nil {
+      return count, err
+    }
+    if entry.Time.Before(from) {
+      continue
+    }
+    // entries are appended in time order
+    if !entry.Time.Before(to) {
+      break
+    }
+    if err = encoder.Encode(entry); err != nil {
+      return count, err
+    }
+    count++
+  }
+  return count, iter.Error()
+}
+
+// Head sequence and hash of the last entry, keep it outside to detect truncation of the tail
+func (l *Log) Head() (uint64, string) {
+  l.mu.Lock()
+  defer l.mu.Unlock()
+  return l.seq, hex.EncodeToString(l.head)
+}
+
+// Close close audit leveldb
+func (l *Log) Close() error {
+  return l.ldb.Close()
+}
+
+// digest sha256 of prev hash | seq | unix nano | length prefixed fields
+func (e *Entry) digest(prev []byte) []byte {
+  var buf bytes.Buffer
+  buf.Write(prev)
+  num := make([]byte, 8)
+  binary.BigEndian.PutUint64(num, e.Seq)
+  buf.Write(num)
+  binary.BigEndian.PutUint64(num, uint64(e.Time.UnixNano()))
+  buf.Write(num)
+  for _, field := range []string{e.Method, e.Caller, e.RequestDigest, e.Result, e.Error} {
+    binary.BigEndian.PutUint64(num, uint64(len(field)))
+    buf.Write(num)
+    buf.WriteString(field)
+  }
+  hash := sha256.Sum256(buf.Bytes())
+  return hash[:]
+}
+
+func decodeEntry(value []byte) (*Entry, error) {
+  var entry Entry
+  if err := json.Unmarshal(value, &entry); err != nil {
+    return nil, fmt.Errorf("Corrupted audit entry %s", err)
+  }
+  return &entry, nil
+}
+
+func seqKey(seq uint64) []byte {
+  key := make([]byte, 8)
+  binary.BigEndian.PutUint64(key, seq)
+  return key
+}
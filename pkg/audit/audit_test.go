@@ -0,0 +1,119 @@
+package audit
+
+import (
+  "bytes"
+  "strings"
+  "testing"
+  "time"
+  "encoding/json"
+  "wallet-go/pkg/configure"
+  "github.com/mitchellh/go-homedir"
+)
+
+// testOpen open audit log under a temporary home, home dir is cached once configure is loaded
+func testOpen(t *testing.T) *Log {
+  t.Setenv("HOME", t.TempDir())
+  homedir.Reset()
+  t.Cleanup(homedir.Reset)
+  configure.Config = &configure.Configure{DBWalletPath: "wallet"}
+  l, err := Open()
+  if err != nil {
+    t.Fatal(err)
+  }
+  return l
+}
+
+func TestAuditChain(t *testing.T) {
+  l := testOpen(t)
+  first, err := l.Append("/proto.WalletCore/SignatureEthereum", "wallet_gateway", []byte("request"), "txid:0x01 sha256:02", "")
+  if err != nil {
+    t.Fatal(err)
+  }
+  if first.Seq != 1 || first.PrevHash != strings.Repeat("00", 32) {
+    t.Fatalf("first entry %+v", first)
+  }
+  second, err := l.Append("/proto.WalletCore/SignatureEthereum", "wallet_gateway", []byte("request"), "", "Refuse to sign")
+  if err != nil {
+    t.Fatal(err)
+  }
+  if second.Seq != 2 || second.PrevHash != first.Hash || second.Hash == first.Hash {
+    t.Fatalf("second entry %+v", second)
+  }
+  if count, err := l.Verify(); err != nil || count != 2 {
+    t.Fatalf("Verify %d %v", count, err)
+  }
+
+  // chain continues from the last entry after reopen
+  if err = l.Close(); err != nil {
+    t.Fatal(err)
+  }
+  if l, err = Open(); err != nil {
+    t.Fatal(err)
+  }
+  defer l.Close()
+  if seq, head := l.Head(); seq != 2 || head != second.Hash {
+    t.Fatalf("Head %d %s", seq, head)
+  }
+  third, err := l.Append("/proto.WalletCore/GetAddress", "wallet_gateway", nil, "address", "")
+  if err != nil {
+    t.Fatal(err)
+  }
+  if third.PrevHash != second.Hash {
+    t.Fatalf("third entry isn't chained to second")
+  }
+  if count, err := l.Verify(); err != nil || count != 3 {
+    t.Fatalf("Verify %d %v", count, err)
+  }
+
+  var buf bytes.Buffer
+  if count, err := l.Export(first.Time, third.Time.Add(time.Nanosecond), &buf); err != nil || count != 3 {
+    t.Fatalf("Export %d %v", count, err)
+  }
+}
+
+func TestAuditTamper(t *testing.T) {
+  l := testOpen(t)
+  defer l.Close()
+  for i := 0; i < 3; i++ {
+    if _, err := l.Append("/proto.WalletCore/SignatureBitcoincore", "wallet_gateway", []byte{byte(i)}, "txid:00 sha256:00", ""); err != nil {
+      t.Fatal(err)
+    }
+  }
+  value, err := l.ldb.Get(seqKey(2), nil)
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  // modified result
+  var entry Entry
+  if err = json.Unmarshal(value, &entry); err != nil {
+    t.Fatal(err)
+  }
+  entry.Result = "txid:ff sha256:00"
+  modified, _ := json.Marshal(&entry)
+  if err = l.ldb.Put(seqKey(2), modified, nil); err != nil {
+    t.Fatal(err)
+  }
+  if count, err := l.Verify(); err == nil || count != 1 {
+    t.Fatalf("modified entry verified %d %v", count, err)
+  }
+
+  // deleted entry
+  if err = l.ldb.Delete(seqKey(2), nil); err != nil {
+    t.Fatal(err)
+  }
+  if count, err := l.Verify(); err == nil || count != 1 {
+    t.Fatalf("missing entry verified %d %v", count, err)
+  }
+
+  // truncated tail is detected against chain head
+  if err = l.ldb.Put(seqKey(2), value, nil); err != nil {
+    t.Fatal(err)
+  }
+  if err = l.ldb.Delete(seqKey(3), nil); err != nil {
+    t.Fatal(err)
+  }
+  if count, err := l.Verify(); err == nil || count != 2 {
+    t.Fatalf("truncated chain verified %d %v", count, err)
+  }
+}
@@ -0,0 +1,29 @@
+package audit
+
+import (
+  "sync"
+  "time"
+  "wallet-go/pkg/db"
+)
+
+// Log hash chained audit log of wallet_core calls, entries are keyed by sequence in leveldb
+type Log struct {
+  ldb  *db.LDB
+  mu   sync.Mutex
+  seq  uint64
+  head []byte
+}
+
+// Entry audit record, Hash covers every other field and the hash of the previous entry
+type Entry struct {
+  Seq            uint64    `json:"seq"`
+  Time           time.Time `json:"time"`
+  Method         string    `json:"method"`
+  Caller         string    `json:"caller"`
+  RequestDigest  string    `json:"request_digest"`
+  // Result created address, or txid and sha256 of signed tx or PSBT
+  Result         string    `json:"result"`
+  Error          string    `json:"error,omitempty"`
+  PrevHash       string    `json:"prev_hash"`
+  Hash           string    `json:"hash"`
+}
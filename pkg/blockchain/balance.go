@@ -50,7 +50,7 @@ func (c BitcoinCoreChain) Balance(ctx context.Context, account, symbol, code str
   return omniBalance.Balance, nil
 }
 
-// Balance get specify token balance of an Ethereum EOA account
+// Balance get specify token balance of an Ethereum EOA account, in wei or smallest unit of the token
 func (c EthereumChain) Balance(ctx context.Context, account, symbol, code string) (string, error) {
   accountAddress := common.HexToAddress(account)
   if strings.ToLower(symbol) == strings.ToLower(configure.ChainsInfo[Ethereum].Coin) {
@@ -60,12 +60,11 @@ func (c EthereumChain) Balance(ctx context.Context, account, symbol, code string
     }
     return bal.String(), nil
   }
-  token := configure.ChainsInfo[Ethereum].Tokens[strings.ToLower(symbol)]
-  if token == "" {
-    return "", fmt.Errorf("Token not implement yet: %s", symbol)
+  token, err := c.Token(symbol)
+  if err != nil {
+    return "", err
   }
-  tokenAddress := common.HexToAddress(token)
-  contractInstance, err := NewEthToken(tokenAddress, c.Client)
+  contractInstance, err := NewEthToken(token.Address, c.Client)
   if err != nil {
     return "", fmt.Errorf("Get token instance %s", err)
   }
@@ -0,0 +1,151 @@
+package blockchain
+
+import (
+  "fmt"
+  "math/big"
+  "wallet-go/pkg/keystore"
+  "github.com/btcsuite/btcd/wire"
+  "github.com/btcsuite/btcd/btcec"
+  "github.com/btcsuite/btcd/chaincfg"
+  "github.com/btcsuite/btcd/txscript"
+  "github.com/btcsuite/btcutil"
+)
+
+// BitcoinAddressType address type for the bitcoin chain, empty means legacy
+func BitcoinAddressType(addressType string) (string, error) {
+  switch addressType {
+  case "", BitcoinAddressLegacy:
+    return BitcoinAddressLegacy, nil
+  case BitcoinAddressNestedSegwit, BitcoinAddressBech32:
+    return addressType, nil
+  default:
+    return "", fmt.Errorf("address_type only supports %s, %s or %s", BitcoinAddressLegacy, BitcoinAddressNestedSegwit, BitcoinAddressBech32)
+  }
+}
+
+// BitcoinPubKeyAddress derive address of specify type from public key
+func BitcoinPubKeyAddress(pubKey *btcec.PublicKey, addressType string, net *chaincfg.Params) (btcutil.Address, error) {
+  pubKeyHash := btcutil.Hash160(pubKey.SerializeCompressed())
+  switch addressType {
+  case "", BitcoinAddressLegacy:
+    return btcutil.NewAddressPubKeyHash(pubKeyHash, net)
+  case BitcoinAddressBech32:
+    return btcutil.NewAddressWitnessPubKeyHash(pubKeyHash, net)
+  case BitcoinAddressNestedSegwit:
+    witnessProgram, err := bitcoinWitnessProgram(pubKeyHash, net)
+    if err != nil {
+      return nil, err
+    }
+    return btcutil.NewAddressScriptHash(witnessProgram, net)
+  default:
+    return nil, fmt.Errorf("Unsupport bitcoin address type %s", addressType)
+  }
+}
+
+// BitcoinAddressTypeOf address type of a decoded bitcoin address, P2SH is treated as nested segwit
+func BitcoinAddressTypeOf(address btcutil.Address) (string, error) {
+  switch address.(type) {
+  case *btcutil.AddressPubKeyHash:
+    return BitcoinAddressLegacy, nil
+  case *btcutil.AddressScriptHash:
+    return BitcoinAddressNestedSegwit, nil
+  case *btcutil.AddressWitnessPubKeyHash:
+    return BitcoinAddressBech32, nil
+  default:
+    return "", fmt.Errorf("Unsupport bitcoin address %s", address.EncodeAddress())
+  }
+}
+
+// bitcoinWitnessProgram P2WPKH script, which is the redeem script of nested segwit address
+func bitcoinWitnessProgram(pubKeyHash []byte, net *chaincfg.Params) ([]byte, error) {
+  address, err := btcutil.NewAddressWitnessPubKeyHash(pubKeyHash, net)
+  if err != nil {
+    return nil, err
+  }
+  return txscript.PayToAddrScript(address)
+}
+
+// bitcoinSignature DER signature with SIGHASH_ALL type of the sighash, signed in key store
+func bitcoinSignature(keys keystore.KeyStore, address string, hash []byte) ([]byte, error) {
+  sig, err := keys.Sign(address, hash)
+  if err != nil {
+    return nil, err
+  }
+  signature := &btcec.Signature{R: new(big.Int).SetBytes(sig[:32]), S: new(big.Int).SetBytes(sig[32:64])}
+  return append(signature.Serialize(), byte(txscript.SigHashAll)), nil
+}
+
+const (
+  // bitcoinSigSize low-S DER signature with sighash byte, upper bound
+  bitcoinSigSize    = 72
+  bitcoinPubKeySize = 33
+  // bitcoinWitnessScale weight of non witness byte
+  bitcoinWitnessScale = 4
+)
+
+// bitcoinInputWeight weight of a signed input spending the address type, outpoint 36, sequence 4
+// https://github.com/bitcoin/bips/blob/master/bip-0141.mediawiki#transaction-size-calculations
+func bitcoinInputWeight(addressType string) int {
+  // witness item count, signature and compressed public key
+  witness := 1 + 1 + bitcoinSigSize + 1 + bitcoinPubKeySize
+  switch addressType {
+  case BitcoinAddressBech32:
+    return (36 + 1 + 4) * bitcoinWitnessScale + witness
+  case BitcoinAddressNestedSegwit:
+    // scriptSig pushes the 22 bytes witness program
+    return (36 + 1 + 1 + 22 + 4) * bitcoinWitnessScale + witness
+  default:
+    scriptSig := 1 + bitcoinSigSize + 1 + bitcoinPubKeySize
+    return (36 + wire.VarIntSerializeSize(uint64(scriptSig)) + scriptSig + 4) * bitcoinWitnessScale
+  }
+}
+
+// bitcoinInputVSize virtual size of a signed input spending the address type
+func bitcoinInputVSize(addressType string) int {
+  return (bitcoinInputWeight(addressType) + bitcoinWitnessScale - 1) / bitcoinWitnessScale
+}
+
+// bitcoinOutputVSize size of output paying to pkScript
+func bitcoinOutputVSize(pkScript []byte) int {
+  return 8 + wire.VarIntSerializeSize(uint64(len(pkScript))) + len(pkScript)
+}
+
+// estimateBitcoinWeight weight of the signed tx, inputs spend the address type
+func estimateBitcoinWeight(addressType string, inputs int, pkScripts ...[]byte) int {
+  // version, locktime, input and output count
+  weight := (4 + 4 + wire.VarIntSerializeSize(uint64(inputs)) + wire.VarIntSerializeSize(uint64(len(pkScripts)))) * bitcoinWitnessScale
+  if addressType != BitcoinAddressLegacy {
+    // segwit marker and flag
+    weight += 2
+  }
+  weight += inputs * bitcoinInputWeight(addressType)
+  for _, pkScript := range pkScripts {
+    weight += bitcoinOutputVSize(pkScript) * bitcoinWitnessScale
+  }
+  return weight
+}
+
+// estimateBitcoinVSize virtual size of the signed tx, inputs spend the address type
+func estimateBitcoinVSize(addressType string, inputs int, pkScripts ...[]byte) int {
+  return (estimateBitcoinWeight(addressType, inputs, pkScripts...) + bitcoinWitnessScale - 1) / bitcoinWitnessScale
+}
+
+// estimateBitcoinMixedWeight weight of the signed tx whose inputs spend different address types
+func estimateBitcoinMixedWeight(inputTypes []string, pkScripts ...[]byte) int {
+  weight := (4 + 4 + wire.VarIntSerializeSize(uint64(len(inputTypes))) + wire.VarIntSerializeSize(uint64(len(pkScripts)))) * bitcoinWitnessScale
+  var legacy int
+  for _, addressType := range inputTypes {
+    if addressType == BitcoinAddressLegacy {
+      legacy++
+    }
+    weight += bitcoinInputWeight(addressType)
+  }
+  if legacy < len(inputTypes) {
+    // segwit marker and flag, legacy inputs carry empty witness
+    weight += 2 + legacy
+  }
+  for _, pkScript := range pkScripts {
+    weight += bitcoinOutputVSize(pkScript) * bitcoinWitnessScale
+  }
+  return weight
+}
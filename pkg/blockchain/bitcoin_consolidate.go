@@ -0,0 +1,108 @@
+package blockchain
+
+import (
+  "fmt"
+  "sort"
+  "bytes"
+  "encoding/hex"
+  "wallet-go/pkg/db"
+  "wallet-go/pkg/configure"
+  "github.com/btcsuite/btcutil"
+  "github.com/btcsuite/btcd/wire"
+  "github.com/btcsuite/btcd/mempool"
+  "github.com/btcsuite/btcd/txscript"
+  "github.com/btcsuite/btcd/chaincfg/chainhash"
+)
+
+// BitcoinMinInputValue least value of utxo paying own input fee at fee rate, of the cheapest address type to spend
+func BitcoinMinInputValue(feeRate mempool.SatoshiPerByte) btcutil.Amount {
+  return feeRate.Fee(uint32(bitcoinInputVSize(BitcoinAddressBech32)))
+}
+
+// ConsolidationTx raw tx sweeping small utxos of c.Wallet.Owners into c.Wallet.Address with a single output,
+// utxos not greater than maxAmount are swept smallest first, those can't pay own input fee at fee rate are skipped
+func (c BitcoinCoreChain) ConsolidationTx(feeRate mempool.SatoshiPerByte, maxAmount btcutil.Amount, maxInputs int) (string, error) {
+  toAddress, err := btcutil.DecodeAddress(c.Wallet.Address.Address, c.Mode)
+  if err != nil {
+    return "", err
+  }
+  toPkScript, err := txscript.PayToAddrScript(toAddress)
+  if err != nil {
+    return "", err
+  }
+
+  type candidate struct {
+    utxo        db.UTXO
+    amount      btcutil.Amount
+    addressType string
+  }
+  var candidates []candidate
+  for _, owner := range c.Wallet.Owners {
+    address, err := btcutil.DecodeAddress(owner.Address, c.Mode)
+    if err != nil {
+      return "", err
+    }
+    addressType, err := BitcoinAddressTypeOf(address)
+    if err != nil {
+      return "", err
+    }
+    inputFee := feeRate.Fee(uint32(bitcoinInputVSize(addressType)))
+    for _, utxo := range owner.UTXOs {
+      amount, err := btcutil.NewAmount(utxo.Amount)
+      if err != nil {
+        return "", err
+      }
+      if amount > maxAmount || amount <= inputFee {
+        continue
+      }
+      candidates = append(candidates, candidate{utxo: utxo, amount: amount, addressType: addressType})
+    }
+  }
+  sort.SliceStable(candidates, func(i, j int) bool {
+    return candidates[i].amount < candidates[j].amount
+  })
+  if len(candidates) > maxInputs {
+    candidates = candidates[:maxInputs]
+  }
+  if len(candidates) < 2 {
+    return "", fmt.Errorf("%d utxo worth consolidating at %v sat/vB", len(candidates), float64(feeRate))
+  }
+
+  var (
+    utxos      []db.UTXO
+    inputTypes []string
+    inputValue btcutil.Amount
+  )
+  msgTx := wire.NewMsgTx(wire.TxVersion)
+  for _, candidate := range candidates {
+    hash, err := chainhash.NewHashFromStr(candidate.utxo.Txid)
+    if err != nil {
+      return "", err
+    }
+    txIn := wire.NewTxIn(wire.NewOutPoint(hash, candidate.utxo.VoutIndex), nil, nil)
+    txIn.Sequence = BIP125Sequence
+    msgTx.AddTxIn(txIn)
+    utxos = append(utxos, candidate.utxo)
+    inputTypes = append(inputTypes, candidate.addressType)
+    inputValue += candidate.amount
+  }
+
+  fee := &BitcoinFee{FeeRate: feeRate, InputValue: inputValue}
+  fee.Weight = estimateBitcoinMixedWeight(inputTypes, toPkScript)
+  fee.VSize = (fee.Weight + bitcoinWitnessScale - 1) / bitcoinWitnessScale
+  fee.RequiredFee = feeRate.Fee(uint32(fee.VSize))
+  outValue := inputValue - fee.RequiredFee
+  if int64(outValue) < bitcoinDustLimit {
+    return "", fmt.Errorf("Consolidated %s can't cover fee %s", inputValue, fee.RequiredFee)
+  }
+  msgTx.AddTxOut(wire.NewTxOut(int64(outValue), toPkScript))
+  fee.OutputValue = outValue
+  fee.Fee = fee.RequiredFee
+  configure.Sugar.Info("consolidate ", len(utxos), " utxos to ", c.Wallet.Address.Address, " value: ", inputValue, " vsize: ", fee.VSize, " fee: ", fee.Fee)
+
+  buf := bytes.NewBuffer(make([]byte, 0, msgTx.SerializeSize()))
+  msgTx.Serialize(buf)
+  c.Wallet.SelectedUTXO = utxos
+  c.Wallet.Fee = fee
+  return hex.EncodeToString(buf.Bytes()), nil
+}
@@ -0,0 +1,139 @@
+package blockchain
+
+import (
+  "fmt"
+  "errors"
+  "bytes"
+  "encoding/hex"
+  "encoding/json"
+  "wallet-go/pkg/db"
+  "wallet-go/pkg/configure"
+  "github.com/btcsuite/btcutil"
+  "github.com/btcsuite/btcd/wire"
+  "github.com/btcsuite/btcd/mempool"
+  "github.com/btcsuite/btcd/txscript"
+)
+
+// bitcoinFeesVersion bitcoin-core version whose getmempoolentry reports fees object
+const bitcoinFeesVersion = 170000
+
+// CPFPTx raw child spending outputs of unconfirmed parent paying to wallet address back to it,
+// child fee lifts parent and its unconfirmed ancestors to fee rate
+func (c BitcoinCoreChain) CPFPTx(parent *wire.MsgTx, feeRate mempool.SatoshiPerByte) (string, error) {
+  parentTxid := parent.TxHash()
+  packageVSize, packageFee, err := c.AncestorPackage(parentTxid.String())
+  if err != nil {
+    return "", err
+  }
+  fromAddress, err := btcutil.DecodeAddress(c.Wallet.Address.Address, c.Mode)
+  if err != nil {
+    return "", err
+  }
+  fromAddressType, err := BitcoinAddressTypeOf(fromAddress)
+  if err != nil {
+    return "", err
+  }
+  fromPkScript, err := txscript.PayToAddrScript(fromAddress)
+  if err != nil {
+    return "", err
+  }
+
+  var (
+    utxos      []db.UTXO
+    inputValue btcutil.Amount
+  )
+  msgTx := wire.NewMsgTx(wire.TxVersion)
+  for i, txOut := range parent.TxOut {
+    if !bytes.Equal(txOut.PkScript, fromPkScript) {
+      continue
+    }
+    txIn := wire.NewTxIn(wire.NewOutPoint(&parentTxid, uint32(i)), nil, nil)
+    txIn.Sequence = BIP125Sequence
+    msgTx.AddTxIn(txIn)
+    utxos = append(utxos, db.UTXO{Txid: parentTxid.String(), VoutIndex: uint32(i), Amount: btcutil.Amount(txOut.Value).ToBTC(), SubAddressID: c.Wallet.Address.ID})
+    inputValue += btcutil.Amount(txOut.Value)
+  }
+  if len(msgTx.TxIn) == 0 {
+    return "", fmt.Errorf("%s doesn't pay to %s", parentTxid.String(), c.Wallet.Address.Address)
+  }
+  change := wire.NewTxOut(0, fromPkScript)
+  msgTx.AddTxOut(change)
+
+  if float64(feeRate) * float64(packageVSize) <= float64(packageFee) {
+    return "", fmt.Errorf("%s package already pays %v sat/vB, not less than %v sat/vB", parentTxid.String(), float64(packageFee) / float64(packageVSize), float64(feeRate))
+  }
+
+  fee := bitcoinTxFee(msgTx, fromAddressType, inputValue, feeRate)
+  fee.RequiredFee = cpfpChildFee(feeRate, packageVSize, packageFee, fee.VSize)
+  changeValue := inputValue - fee.RequiredFee
+  if int64(changeValue) < bitcoinDustLimit {
+    return "", fmt.Errorf("%s pays %s to %s, which can't cover child fee %s", parentTxid.String(), inputValue, c.Wallet.Address.Address, fee.RequiredFee)
+  }
+  change.Value = int64(changeValue)
+  fee.OutputValue, fee.Change = changeValue, changeValue
+  fee.Fee = fee.RequiredFee
+  fee.AncestorVSize, fee.AncestorFee = packageVSize, packageFee
+  configure.Sugar.Info("cpfp ", parentTxid.String(), " package vsize: ", packageVSize, " package fee: ", packageFee, " child vsize: ", fee.VSize, " child fee: ", fee.Fee)
+
+  buf := bytes.NewBuffer(make([]byte, 0, msgTx.SerializeSize()))
+  msgTx.Serialize(buf)
+  c.Wallet.SelectedUTXO = utxos
+  c.Wallet.Fee = fee
+  return hex.EncodeToString(buf.Bytes()), nil
+}
+
+// AncestorPackage vsize and fee of unconfirmed tx with its unconfirmed ancestors in node mempool
+func (c BitcoinCoreChain) AncestorPackage(txid string) (int, btcutil.Amount, error) {
+  info, err := c.Client.RawRequest("getnetworkinfo", nil)
+  if err != nil {
+    return 0, 0, fmt.Errorf("Query node version %s", err)
+  }
+  var network struct {
+    Version int `json:"version"`
+  }
+  if err = json.Unmarshal(info, &network); err != nil {
+    return 0, 0, err
+  }
+
+  param, err := json.Marshal(txid)
+  if err != nil {
+    return 0, 0, err
+  }
+  result, err := c.Client.RawRequest("getmempoolentry", []json.RawMessage{param})
+  if err != nil {
+    return 0, 0, fmt.Errorf("%s isn't in mempool %s", txid, err)
+  }
+  var entry bitcoinMempoolEntry
+  if err = json.Unmarshal(result, &entry); err != nil {
+    return 0, 0, err
+  }
+  return ancestorPackage(&entry, network.Version)
+}
+
+// ancestorPackage package of mempool entry, node since 0.17 reports fees in BTC and deprecates ancestorfees in satoshi
+func ancestorPackage(entry *bitcoinMempoolEntry, version int) (int, btcutil.Amount, error) {
+  vsize := int(entry.AncestorSize)
+  if vsize <= 0 {
+    return 0, 0, errors.New("Mempool entry lacks ancestorsize")
+  }
+  if version < bitcoinFeesVersion {
+    return vsize, btcutil.Amount(entry.AncestorFees), nil
+  }
+  if entry.Fees == nil {
+    return 0, 0, fmt.Errorf("Mempool entry of node %d lacks fees", version)
+  }
+  fee, err := btcutil.NewAmount(entry.Fees.Ancestor)
+  if err != nil {
+    return 0, 0, err
+  }
+  return vsize, fee, nil
+}
+
+// cpfpChildFee child fee lifting package and child to fee rate, not less than relay fee of child itself
+func cpfpChildFee(feeRate mempool.SatoshiPerByte, packageVSize int, packageFee btcutil.Amount, childVSize int) btcutil.Amount {
+  fee := feeRate.Fee(uint32(packageVSize + childVSize)) - packageFee
+  if relayFee := minRelayFeeRate.Fee(uint32(childVSize)); fee < relayFee {
+    return relayFee
+  }
+  return fee
+}
@@ -0,0 +1,47 @@
+package blockchain
+
+import (
+  "testing"
+  "encoding/json"
+  "github.com/btcsuite/btcutil"
+  "github.com/btcsuite/btcd/mempool"
+)
+
+func TestAncestorPackage(t *testing.T) {
+  cases := []struct {
+    entry   string
+    version int
+    vsize   int
+    fee     btcutil.Amount
+    ok      bool
+  }{
+    // bitcoin-core 0.16 reports ancestorfees in satoshi
+    {`{"size": 141, "fee": 0.00000141, "ancestorsize": 367, "ancestorfees": 593}`, 160300, 367, 593, true},
+    // fees.ancestor in BTC, ancestorfees is deprecated
+    {`{"vsize": 141, "ancestorsize": 367, "ancestorfees": 1, "fees": {"base": 0.00000141, "ancestor": 0.00000593}}`, 170100, 367, 593, true},
+    {`{"vsize": 141, "ancestorsize": 367, "fees": {"base": 0.00000141, "ancestor": 0.00000593}}`, 250000, 367, 593, true},
+    {`{"vsize": 141, "ancestorsize": 367, "ancestorfees": 593}`, 190100, 0, 0, false},
+    {`{"vsize": 141, "fees": {"base": 0.00000141, "ancestor": 0.00000141}}`, 250000, 0, 0, false},
+  }
+  for i, c := range cases {
+    var entry bitcoinMempoolEntry
+    if err := json.Unmarshal([]byte(c.entry), &entry); err != nil {
+      t.Fatal(err)
+    }
+    vsize, fee, err := ancestorPackage(&entry, c.version)
+    if (err == nil) != c.ok || vsize != c.vsize || fee != c.fee {
+      t.Fatalf("case %d: %d %s %v", i, vsize, fee, err)
+    }
+  }
+}
+
+func TestCPFPChildFee(t *testing.T) {
+  // parent 200 vB pays 200 satoshi, child of 110 vB lifts both to 10 sat/vB
+  if fee := cpfpChildFee(mempool.SatoshiPerByte(10), 200, 200, 110); fee != 10 * (200 + 110) - 200 {
+    t.Fatalf("child fee %s", fee)
+  }
+  // package already pays nearly the rate, child still pays its own relay fee
+  if fee := cpfpChildFee(mempool.SatoshiPerByte(2), 200, 610, 110); fee != 110 {
+    t.Fatalf("child relay fee %s", fee)
+  }
+}
@@ -0,0 +1,216 @@
+package blockchain
+
+import (
+  "fmt"
+  "bytes"
+  "encoding/hex"
+  "wallet-go/pkg/db"
+  "wallet-go/pkg/keystore"
+  "github.com/btcsuite/btcutil"
+  "github.com/btcsuite/btcd/wire"
+  "github.com/btcsuite/btcd/txscript"
+  "github.com/btcsuite/btcd/chaincfg/chainhash"
+)
+
+// UnsignedPSBT PSBT of raw tx built by RawTx, inputs carry previous output of the selected utxo and key origin of its owner address
+func (c BitcoinCoreChain) UnsignedPSBT(rawTxHex string) (string, error) {
+  tx, err := DecodeBtcTxHex(rawTxHex)
+  if err != nil {
+    return "", fmt.Errorf("Fail to decode raw tx %s", err)
+  }
+  packet, err := NewPSBT(tx.MsgTx())
+  if err != nil {
+    return "", err
+  }
+
+  utxos := make(map[wire.OutPoint]db.UTXO)
+  for _, utxo := range c.Wallet.SelectedUTXO {
+    hash, err := chainhash.NewHashFromStr(utxo.Txid)
+    if err != nil {
+      return "", err
+    }
+    utxos[*wire.NewOutPoint(hash, utxo.VoutIndex)] = utxo
+  }
+
+  owners := make(map[uint]*psbtOwner)
+  for i, txIn := range packet.UnsignedTx.TxIn {
+    utxo, ok := utxos[txIn.PreviousOutPoint]
+    if !ok {
+      return "", fmt.Errorf("Input %d %s isn't selected utxo", i, txIn.PreviousOutPoint.String())
+    }
+    owner, ok := owners[utxo.SubAddressID]
+    if !ok {
+      subAddress := c.Wallet.Address
+      if other, found := c.Wallet.Owners[utxo.SubAddressID]; found {
+        subAddress = other
+      }else if c.Wallet.Owners != nil && utxo.SubAddressID != subAddress.ID {
+        return "", fmt.Errorf("Input %d %s owner %d is unknown", i, txIn.PreviousOutPoint.String(), utxo.SubAddressID)
+      }
+      if owner, err = c.psbtOwnerOf(subAddress); err != nil {
+        return "", err
+      }
+      owners[utxo.SubAddressID] = owner
+    }
+    amount, err := btcutil.NewAmount(utxo.Amount)
+    if err != nil {
+      return "", err
+    }
+    in := &packet.Inputs[i]
+    if owner.addressType == BitcoinAddressLegacy {
+      // legacy signature doesn't commit to the amount, signer checks the whole previous tx
+      prevTx, err := c.Client.GetRawTransaction(&txIn.PreviousOutPoint.Hash)
+      if err != nil {
+        return "", fmt.Errorf("Previous tx of input %d %s", i, err)
+      }
+      in.NonWitnessUtxo = prevTx.MsgTx()
+    }else {
+      in.WitnessUtxo = wire.NewTxOut(int64(amount), owner.pkScript)
+    }
+    in.SighashType = txscript.SigHashAll
+    if owner.derivation != nil {
+      in.Bip32Derivation = []PSBTDerivation{*owner.derivation}
+      if owner.addressType == BitcoinAddressNestedSegwit {
+        if in.RedeemScript, err = bitcoinWitnessProgram(btcutil.Hash160(owner.derivation.PubKey), c.Mode); err != nil {
+          return "", err
+        }
+      }
+    }
+  }
+
+  // change output
+  change, err := c.psbtOwnerOf(c.Wallet.Address)
+  if err != nil {
+    return "", err
+  }
+  for i, txOut := range packet.UnsignedTx.TxOut {
+    if change.derivation != nil && bytes.Equal(txOut.PkScript, change.pkScript) {
+      packet.Outputs[i].Bip32Derivation = []PSBTDerivation{*change.derivation}
+    }
+  }
+  return packet.B64Encode()
+}
+
+// psbtOwner script and key origin of sub address
+type psbtOwner struct {
+  addressType string
+  pkScript    []byte
+  derivation  *PSBTDerivation
+}
+
+// psbtOwnerOf psbt owner of sub address
+func (c BitcoinCoreChain) psbtOwnerOf(subAddress *db.SubAddress) (*psbtOwner, error) {
+  address, err := btcutil.DecodeAddress(subAddress.Address, c.Mode)
+  if err != nil {
+    return nil, err
+  }
+  addressType, err := BitcoinAddressTypeOf(address)
+  if err != nil {
+    return nil, err
+  }
+  pkScript, err := txscript.PayToAddrScript(address)
+  if err != nil {
+    return nil, err
+  }
+  derivation, err := subAddressDerivation(subAddress)
+  if err != nil {
+    return nil, err
+  }
+  return &psbtOwner{addressType: addressType, pkScript: pkScript, derivation: derivation}, nil
+}
+
+// SignPSBT add SIGHASH_ALL partial signature of every input, previous output of each input must pay to key store address
+func (c BitcoinCoreChain) SignPSBT(packet *PSBT) error {
+  tx := packet.UnsignedTx
+  sigHashes := txscript.NewTxSigHashes(tx)
+  for i := range tx.TxIn {
+    in := &packet.Inputs[i]
+    if in.SighashType != 0 && in.SighashType != txscript.SigHashAll {
+      return fmt.Errorf("Input %d sighash type %d, only SIGHASH_ALL is supported", i, in.SighashType)
+    }
+    utxo, err := packet.InputUtxo(i)
+    if err != nil {
+      return err
+    }
+    _, addresses, _, err := txscript.ExtractPkScriptAddrs(utxo.PkScript, c.Mode)
+    if err != nil || len(addresses) != 1 {
+      return fmt.Errorf("Input %d spends unknown script", i)
+    }
+    address := addresses[0].EncodeAddress()
+    addressType, err := BitcoinAddressTypeOf(addresses[0])
+    if err != nil {
+      return err
+    }
+    pubKey, err := c.Keys.PublicKey(address)
+    if err == keystore.ErrKeyNotFound {
+      return fmt.Errorf("Input %d spends %s, which isn't wallet address", i, address)
+    }else if err != nil {
+      return fmt.Errorf("Public key of %s %s", address, err)
+    }
+    keyAddress, err := BitcoinPubKeyAddress(pubKey, addressType, c.Mode)
+    if err != nil {
+      return err
+    }
+    if keyAddress.EncodeAddress() != address {
+      return fmt.Errorf("Private key doesn't match address %s", address)
+    }
+
+    var hash []byte
+    switch addressType {
+    case BitcoinAddressBech32:
+      hash, err = txscript.CalcWitnessSigHash(utxo.PkScript, sigHashes, txscript.SigHashAll, tx, i, utxo.Value)
+    case BitcoinAddressNestedSegwit:
+      var witnessProgram []byte
+      if witnessProgram, err = bitcoinWitnessProgram(btcutil.Hash160(pubKey.SerializeCompressed()), c.Mode); err != nil {
+        return fmt.Errorf("Witness program %s", err)
+      }
+      if in.RedeemScript != nil && !bytes.Equal(in.RedeemScript, witnessProgram) {
+        return fmt.Errorf("Input %d redeem script doesn't match key of %s", i, address)
+      }
+      in.RedeemScript = witnessProgram
+      hash, err = txscript.CalcWitnessSigHash(witnessProgram, sigHashes, txscript.SigHashAll, tx, i, utxo.Value)
+    default:
+      if in.NonWitnessUtxo == nil {
+        return fmt.Errorf("Legacy input %d requires non witness utxo", i)
+      }
+      hash, err = txscript.CalcSignatureHash(utxo.PkScript, txscript.SigHashAll, tx, i)
+    }
+    if err != nil {
+      return fmt.Errorf("Signature hash of input %d %s", i, err)
+    }
+
+    sig, err := bitcoinSignature(c.Keys, address, hash)
+    if err != nil {
+      return fmt.Errorf("Sign input %d %s", i, err)
+    }
+    pubKeyBytes := pubKey.SerializeCompressed()
+    partialSigs := in.PartialSigs[:0]
+    for _, partialSig := range in.PartialSigs {
+      if !bytes.Equal(partialSig.PubKey, pubKeyBytes) {
+        partialSigs = append(partialSigs, partialSig)
+      }
+    }
+    in.PartialSigs = append(partialSigs, PSBTPartialSig{PubKey: pubKeyBytes, Signature: sig})
+    in.SighashType = txscript.SigHashAll
+  }
+  return nil
+}
+
+// subAddressDerivation key origin of sub address, nil when wallet_core didn't report it
+func subAddressDerivation(subAddress *db.SubAddress) (*PSBTDerivation, error) {
+  if subAddress.DerivationPath == "" || subAddress.PublicKey == "" || subAddress.MasterFingerprint == "" {
+    return nil, nil
+  }
+  path, err := ParseDerivationPath(subAddress.DerivationPath)
+  if err != nil {
+    return nil, err
+  }
+  pubKey, err := hex.DecodeString(subAddress.PublicKey)
+  if err != nil {
+    return nil, fmt.Errorf("Public key of %s %s", subAddress.Address, err)
+  }
+  fingerprint, err := hex.DecodeString(subAddress.MasterFingerprint)
+  if err != nil || len(fingerprint) != 4 {
+    return nil, fmt.Errorf("Invalid master fingerprint of %s", subAddress.Address)
+  }
+  return &PSBTDerivation{PubKey: pubKey, Fingerprint: fingerprint, Path: path}, nil
+}
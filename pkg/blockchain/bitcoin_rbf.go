@@ -0,0 +1,211 @@
+package blockchain
+
+import (
+  "fmt"
+  "bytes"
+  "encoding/hex"
+  "wallet-go/pkg/db"
+  "wallet-go/pkg/configure"
+  "github.com/btcsuite/btcutil"
+  "github.com/btcsuite/btcd/wire"
+  "github.com/btcsuite/btcd/mempool"
+  "github.com/btcsuite/btcd/txscript"
+  "github.com/btcsuite/btcd/chaincfg/chainhash"
+)
+
+// BIP125Sequence input sequence of opt-in replace-by-fee
+// https://github.com/bitcoin/bips/blob/master/bip-0125.mediawiki
+const BIP125Sequence = wire.MaxTxInSequenceNum - 2
+
+// SignalsRBF whether tx opts in BIP125 replacement
+func SignalsRBF(msgTx *wire.MsgTx) bool {
+  for _, txIn := range msgTx.TxIn {
+    if txIn.Sequence <= BIP125Sequence {
+      return true
+    }
+  }
+  return false
+}
+
+// bitcoinVSize virtual size of signed tx
+func bitcoinVSize(msgTx *wire.MsgTx) int {
+  weight := msgTx.SerializeSizeStripped() * (bitcoinWitnessScale - 1) + msgTx.SerializeSize()
+  return (weight + bitcoinWitnessScale - 1) / bitcoinWitnessScale
+}
+
+// MempoolTx unconfirmed tx of txid in node mempool
+func (c BitcoinCoreChain) MempoolTx(txid string) (*wire.MsgTx, error) {
+  txHash, err := chainhash.NewHashFromStr(txid)
+  if err != nil {
+    return nil, err
+  }
+  entry, err := c.Client.GetMempoolEntry(txid)
+  if err != nil {
+    return nil, fmt.Errorf("%s isn't in mempool %s", txid, err)
+  }
+  // descendant count includes the tx itself
+  if entry.DescendantCount > 1 {
+    return nil, fmt.Errorf("%s has %d descendants in mempool, replacing it evicts them", txid, entry.DescendantCount - 1)
+  }
+  tx, err := c.Client.GetRawTransaction(txHash)
+  if err != nil {
+    return nil, fmt.Errorf("Query %s %s", txid, err)
+  }
+  return tx.MsgTx(), nil
+}
+
+// ReplacementTx raw BIP125 replacement of original at fee rate, payments are kept and change to from address pays the fee bump.
+// c.Wallet.SelectedUTXO must be utxos spent by original, inputs of c.Wallet.Address.UTXOs are added when change can't cover the fee
+func (c BitcoinCoreChain) ReplacementTx(original *wire.MsgTx, feeRate mempool.SatoshiPerByte) (string, error) {
+  if !SignalsRBF(original) {
+    return "", fmt.Errorf("%s doesn't signal BIP125 replacement", original.TxHash().String())
+  }
+  fromAddress, err := btcutil.DecodeAddress(c.Wallet.Address.Address, c.Mode)
+  if err != nil {
+    return "", err
+  }
+  fromAddressType, err := BitcoinAddressTypeOf(fromAddress)
+  if err != nil {
+    return "", err
+  }
+  fromPkScript, err := txscript.PayToAddrScript(fromAddress)
+  if err != nil {
+    return "", err
+  }
+
+  spent := make(map[wire.OutPoint]db.UTXO)
+  for _, utxo := range c.Wallet.SelectedUTXO {
+    hash, err := chainhash.NewHashFromStr(utxo.Txid)
+    if err != nil {
+      return "", err
+    }
+    spent[*wire.NewOutPoint(hash, utxo.VoutIndex)] = utxo
+  }
+  var (
+    inputs     []db.UTXO
+    inputValue btcutil.Amount
+    outValue   btcutil.Amount
+    payments   []*wire.TxOut
+    payValue   btcutil.Amount
+  )
+  for i, txIn := range original.TxIn {
+    utxo, ok := spent[txIn.PreviousOutPoint]
+    if !ok {
+      return "", fmt.Errorf("Input %d %s isn't utxo of %s", i, txIn.PreviousOutPoint.String(), c.Wallet.Address.Address)
+    }
+    amount, err := btcutil.NewAmount(utxo.Amount)
+    if err != nil {
+      return "", err
+    }
+    inputs = append(inputs, utxo)
+    inputValue += amount
+  }
+  for _, txOut := range original.TxOut {
+    outValue += btcutil.Amount(txOut.Value)
+    if bytes.Equal(txOut.PkScript, fromPkScript) {
+      // change
+      continue
+    }
+    payments = append(payments, txOut)
+    payValue += btcutil.Amount(txOut.Value)
+  }
+  originalFee := inputValue - outValue
+  originalVSize := bitcoinVSize(original)
+  if float64(feeRate) * float64(originalVSize) <= float64(originalFee) {
+    return "", fmt.Errorf("Fee rate %v sat/vB isn't higher than %v sat/vB of %s", float64(feeRate), float64(originalFee) / float64(originalVSize), original.TxHash().String())
+  }
+  // BIP125 rule 3 and 4: pay more than original and for relay of the replacement itself
+  replacementFee := func(vsize int) btcutil.Amount {
+    fee := feeRate.Fee(uint32(vsize))
+    if bump := originalFee + minRelayFeeRate.Fee(uint32(vsize)); bump > fee {
+      return bump
+    }
+    return fee
+  }
+
+  var spare []db.UTXO
+  for _, utxo := range c.Wallet.Address.UTXOs {
+    hash, err := chainhash.NewHashFromStr(utxo.Txid)
+    if err != nil {
+      return "", err
+    }
+    if _, ok := spent[*wire.NewOutPoint(hash, utxo.VoutIndex)]; !ok {
+      spare = append(spare, utxo)
+    }
+  }
+  selector, err := NewCoinSelector(c.CoinSelection)
+  if err != nil {
+    return "", err
+  }
+  params := bitcoinCoinSelectParams(feeRate, fromAddressType, fromPkScript)
+
+  var (
+    msgTx *wire.MsgTx
+    fee   *BitcoinFee
+  )
+  for i := 0; ; i++ {
+    if i == maxFeeIterations {
+      return "", fmt.Errorf("Inputs don't cover replacement fee %s after %d selections", fee.RequiredFee, i)
+    }
+    msgTx = wire.NewMsgTx(original.Version)
+    msgTx.LockTime = original.LockTime
+    for _, utxo := range inputs {
+      hash, err := chainhash.NewHashFromStr(utxo.Txid)
+      if err != nil {
+        return "", err
+      }
+      txIn := wire.NewTxIn(wire.NewOutPoint(hash, utxo.VoutIndex), nil, nil)
+      txIn.Sequence = BIP125Sequence
+      msgTx.AddTxIn(txIn)
+    }
+    for _, txOut := range payments {
+      msgTx.AddTxOut(wire.NewTxOut(txOut.Value, txOut.PkScript))
+    }
+
+    // recharge
+    change := wire.NewTxOut(0, fromPkScript)
+    msgTx.AddTxOut(change)
+    fee = bitcoinTxFee(msgTx, fromAddressType, inputValue, feeRate)
+    fee.RequiredFee = replacementFee(fee.VSize)
+    if changeValue := inputValue - payValue - fee.RequiredFee; changeValue >= params.MinChange {
+      change.Value = int64(changeValue)
+      fee.Change = changeValue
+      fee.OutputValue += changeValue
+      fee.Fee = fee.InputValue - fee.OutputValue
+      break
+    }
+
+    // changeless, excess goes to fee
+    msgTx.TxOut = msgTx.TxOut[:len(msgTx.TxOut) - 1]
+    fee = bitcoinTxFee(msgTx, fromAddressType, inputValue, feeRate)
+    fee.RequiredFee = replacementFee(fee.VSize)
+    shortfall := fee.RequiredFee - fee.Fee
+    if shortfall <= 0 {
+      break
+    }
+
+    chaininfo, err := c.Client.GetBlockChainInfo()
+    if err != nil {
+      return "", err
+    }
+    added, unselected, _, err := CoinSelect(int64(chaininfo.Headers), shortfall, spare, selector, params)
+    if err != nil {
+      return "", fmt.Errorf("Select UTXO for replacement fee %s", err)
+    }
+    for _, utxo := range added {
+      amount, err := btcutil.NewAmount(utxo.Amount)
+      if err != nil {
+        return "", err
+      }
+      inputValue += amount
+    }
+    inputs, spare = append(inputs, added...), unselected
+  }
+  configure.Sugar.Info("replace ", original.TxHash().String(), " inputs: ", len(msgTx.TxIn), " vsize: ", fee.VSize, " fee: ", fee.Fee, " original fee: ", originalFee)
+
+  buf := bytes.NewBuffer(make([]byte, 0, msgTx.SerializeSize()))
+  msgTx.Serialize(buf)
+  c.Wallet.SelectedUTXO = inputs
+  c.Wallet.Fee = fee
+  return hex.EncodeToString(buf.Bytes()), nil
+}
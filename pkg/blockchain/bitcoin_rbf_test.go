@@ -0,0 +1,73 @@
+package blockchain
+
+import (
+  "bytes"
+  "testing"
+  "encoding/hex"
+  "wallet-go/pkg/db"
+  "wallet-go/pkg/configure"
+  "github.com/btcsuite/btcd/wire"
+  "github.com/btcsuite/btcd/mempool"
+  "github.com/btcsuite/btcd/chaincfg"
+  "github.com/btcsuite/btcd/chaincfg/chainhash"
+)
+
+func TestReplacementTx(t *testing.T) {
+  testChainInfo(t, Bitcoin, configure.ChainInfo{Coin: "btc"})
+  const (
+    from = "1EHNa6Q4Jz2uvNExL497mE43ikXhwF6kZm"
+    to   = "1BoatSLRHtKNngkdXEeobR76b53LETtpyT"
+  )
+  fromPkScript, _ := BitcoincoreAddressP2AS(from, &chaincfg.MainNetParams)
+  toPkScript, _ := BitcoincoreAddressP2AS(to, &chaincfg.MainNetParams)
+  utxo := db.UTXO{Txid: (&chainhash.Hash{1}).String(), VoutIndex: 0, Amount: 1}
+  // pays 0.5 btc, original fee is 1000 satoshi
+  original := wire.NewMsgTx(wire.TxVersion)
+  txIn := wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{1}, 0), nil, nil)
+  txIn.Sequence = BIP125Sequence
+  original.AddTxIn(txIn)
+  original.AddTxOut(wire.NewTxOut(50000000, toPkScript))
+  original.AddTxOut(wire.NewTxOut(49999000, fromPkScript))
+  if !SignalsRBF(original) {
+    t.Fatal("original doesn't signal replacement")
+  }
+
+  chain := BitcoinCoreChain{Mode: &chaincfg.MainNetParams, CoinSelection: CoinSelectLargestFirst, Wallet: &WalletInfo{
+    Address:      &db.SubAddress{Address: from, UTXOs: []db.UTXO{utxo}},
+    SelectedUTXO: []db.UTXO{utxo},
+  }}
+  rawTxHex, err := chain.ReplacementTx(original, mempool.SatoshiPerByte(20))
+  if err != nil {
+    t.Fatal(err)
+  }
+  raw, _ := hex.DecodeString(rawTxHex)
+  replacement := wire.NewMsgTx(wire.TxVersion)
+  if err = replacement.Deserialize(bytes.NewReader(raw)); err != nil {
+    t.Fatal(err)
+  }
+  if len(replacement.TxIn) != 1 || replacement.TxIn[0].PreviousOutPoint != original.TxIn[0].PreviousOutPoint || !SignalsRBF(replacement) {
+    t.Fatalf("replacement inputs %v", replacement.TxIn)
+  }
+  if len(replacement.TxOut) != 2 || replacement.TxOut[0].Value != 50000000 || !bytes.Equal(replacement.TxOut[0].PkScript, toPkScript) {
+    t.Fatalf("replacement doesn't keep payment %v", replacement.TxOut)
+  }
+  // change pays 20 sat/vB of the signed legacy tx
+  fee := chain.Wallet.Fee
+  if fee.VSize != 226 || fee.Fee != 20 * 226 || replacement.TxOut[1].Value != 100000000 - 50000000 - 20 * 226 {
+    t.Fatalf("replacement fee %+v", fee)
+  }
+
+  // fee rate must beat the original
+  if _, err = chain.ReplacementTx(original, mempool.SatoshiPerByte(1)); err == nil {
+    t.Fatal("replacement of lower fee rate is built")
+  }
+  final := original.Copy()
+  final.TxIn[0].Sequence = wire.MaxTxInSequenceNum
+  if _, err = chain.ReplacementTx(final, mempool.SatoshiPerByte(20)); err == nil {
+    t.Fatal("replacement of tx not signaling BIP125 is built")
+  }
+  chain.Wallet.SelectedUTXO = nil
+  if _, err = chain.ReplacementTx(original, mempool.SatoshiPerByte(20)); err == nil {
+    t.Fatal("replacement spends input of unknown utxo")
+  }
+}
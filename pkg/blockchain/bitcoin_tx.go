@@ -2,6 +2,7 @@ package blockchain
 
 import (
   "fmt"
+  "errors"
   "bytes"
   "strings"
   "context"
@@ -9,6 +10,7 @@ import (
   "encoding/hex"
   "wallet-go/pkg/db"
   "wallet-go/pkg/util"
+  "wallet-go/pkg/keystore"
   "github.com/btcsuite/btcutil"
   "wallet-go/pkg/configure"
   "github.com/btcsuite/btcd/wire"
@@ -17,25 +19,58 @@ import (
   "github.com/btcsuite/btcutil/coinset"
 )
 
+const (
+  // minRelayFeeRate default minrelaytxfee of bitcoin-core
+  minRelayFeeRate = mempool.SatoshiPerByte(1)
+  maxFeeIterations = 5
+)
+
 // RawTx bitcoin raw tx
 func (c BitcoinCoreChain) RawTx(cxt context.Context, from, to, amount, memo, asset string) (string, error) {
+  return c.BatchRawTx(from, []Recipient{{To: to, Amount: amount}}, asset)
+}
+
+// BatchRawTx bitcoin raw tx paying every recipient with one change output, omni token transfer supports one recipient only
+func (c BitcoinCoreChain) BatchRawTx(from string, recipients []Recipient, asset string) (string, error) {
   if configure.ChainAssets[asset] != Bitcoin {
     return "", fmt.Errorf("Unsupport %s in bitcoincore", asset)
   }
-  amountF, err := strconv.ParseFloat(amount, 64)
-  if err != nil {
-    return "", err
+  if len(recipients) == 0 {
+    return "", errors.New("Recipients can't be empty")
+  }
+  var (
+    toPkScripts [][]byte
+    txAmounts   []btcutil.Amount
+  )
+  for _, recipient := range recipients {
+    amountF, err := strconv.ParseFloat(recipient.Amount, 64)
+    if err != nil {
+      return "", err
+    }
+    txAmountSatoshi, err := btcutil.NewAmount(amountF)
+    if err != nil {
+      return "", err
+    }
+    if txAmountSatoshi <= 0 {
+      return "", fmt.Errorf("Amount of %s must be greater than 0", recipient.To)
+    }
+    toPkScript, err := BitcoincoreAddressP2AS(recipient.To, c.Mode)
+    if err != nil {
+      return "", err
+    }
+    toPkScripts = append(toPkScripts, toPkScript)
+    txAmounts = append(txAmounts, txAmountSatoshi)
   }
-  txAmountSatoshi, err := btcutil.NewAmount(amountF)
+
+  fromAddress, err := btcutil.DecodeAddress(from, c.Mode)
   if err != nil {
     return "", err
   }
-
-  fromPkScript, err := BitcoincoreAddressP2AS(from, c.Mode)
+  fromAddressType, err := BitcoinAddressTypeOf(fromAddress)
   if err != nil {
     return "", err
   }
-  toPkScript, err := BitcoincoreAddressP2AS(to, c.Mode)
+  fromPkScript, err := txscript.PayToAddrScript(fromAddress)
   if err != nil {
     return "", err
   }
@@ -45,46 +80,18 @@ func (c BitcoinCoreChain) RawTx(cxt context.Context, from, to, amount, memo, ass
   if err != nil {
     return "", err
   }
-  // feeKB, err := c.Client.EstimateFee(int64(6))
-  feeKB, err := c.Client.EstimateSmartFee(int64(6))
+  feeRate, err := c.FeeRate()
   if err != nil {
     return "", err
   }
-  feeRate := mempool.SatoshiPerByte(feeKB.FeeRate)
-
-  if feeKB.FeeRate <= 0 {
-    feeRate = mempool.SatoshiPerByte(100)
-  }
-
-  var (
-    selectedutxos, unselectedutxos []db.UTXO
-    selectedCoins coinset.Coins
-  )
-
-  // Coin Select
-  if strings.ToLower(configure.ChainsInfo[Bitcoin].Coin) == strings.ToLower(asset) {
-    // select coins for BTC transfer
-    if selectedutxos, unselectedutxos, selectedCoins, err = CoinSelect(int64(chaininfo.Headers), txAmountSatoshi, c.Wallet.Address.UTXOs); err != nil {
-      return "", fmt.Errorf("Select UTXO for tx %s", err)
-    }
-  }else {
-    // select coins for Token transfer
-    // 300: https://bitcoin.stackexchange.com/questions/1195/how-to-calculate-transaction-size-before-sending-legacy-non-segwit-p2pkh-p2sh
-    inputAmount := feeRate.Fee(uint32(300))
-    if selectedutxos, unselectedutxos, selectedCoins, err = CoinSelect(int64(chaininfo.Headers), inputAmount, c.Wallet.Address.UTXOs); err != nil {
-      return "", fmt.Errorf("Select UTXO for tx %s", err)
-    }
-  }
-
-  var vinAmount int64
-  for _, coin := range selectedCoins.Coins() {
-    vinAmount += int64(coin.Value())
-  }
-  msgTx := coinset.NewMsgTxWithInputCoins(wire.TxVersion, selectedCoins)
 
+  var txOuts []*wire.TxOut
   token := configure.ChainsInfo[Bitcoin].Tokens[strings.ToLower(asset)]
   if token != "" && strings.ToLower(asset) != strings.ToLower(configure.ChainsInfo[Bitcoin].Coin) {
     // OmniToken transfer
+    if len(recipients) > 1 {
+      return "", errors.New("Omni simple send supports one recipient only")
+    }
     b := txscript.NewScriptBuilder()
     b.AddOp(txscript.OP_RETURN)
 
@@ -97,7 +104,7 @@ func (c BitcoinCoreChain) RawTx(cxt context.Context, from, to, amount, memo, ass
     }
     // tokenPropertyid := configure.Config.OmniToken["omni_first_token"].(int)
     tokenIdentifier := util.Int2byte(uint64(tokenPropertyid), 4)	// omni token identifier
-    tokenAmount := util.Int2byte(uint64(txAmountSatoshi), 8)	// omni token transfer amount
+    tokenAmount := util.Int2byte(uint64(txAmounts[0]), 8)	// omni token transfer amount
 
     b.AddData([]byte("omni"))	// transaction maker
     b.AddData(omniVersion)
@@ -108,78 +115,283 @@ func (c BitcoinCoreChain) RawTx(cxt context.Context, from, to, amount, memo, ass
     if err != nil {
       return "", fmt.Errorf("Bitcoin Token pkScript %s", err)
     }
-    msgTx.AddTxOut(wire.NewTxOut(0, pkScript))
-    txOutReference := wire.NewTxOut(0, toPkScript)
-    msgTx.AddTxOut(txOutReference)
+    txOuts = append(txOuts, wire.NewTxOut(0, pkScript), wire.NewTxOut(0, toPkScripts[0]))
   }else {
     // BTC transfer
-    txOutTo := wire.NewTxOut(int64(txAmountSatoshi), toPkScript)
-    msgTx.AddTxOut(txOutTo)
+    for i, toPkScript := range toPkScripts {
+      txOuts = append(txOuts, wire.NewTxOut(int64(txAmounts[i]), toPkScript))
+    }
+  }
+
+  // Coin Select: target is outputs value plus fee of the tx without inputs and change
+  var (
+    outValue  btcutil.Amount
+    pkScripts [][]byte
+  )
+  for _, txOut := range txOuts {
+    outValue += btcutil.Amount(txOut.Value)
+    pkScripts = append(pkScripts, txOut.PkScript)
+  }
+  target := outValue + feeRate.Fee(uint32(estimateBitcoinVSize(fromAddressType, 0, pkScripts...)))
+  selector, err := NewCoinSelector(c.CoinSelection)
+  if err != nil {
+    return "", err
+  }
+  params := bitcoinCoinSelectParams(feeRate, fromAddressType, fromPkScript)
 
+  var (
+    selectedutxos []db.UTXO
+    selection     *CoinSelection
+    msgTx         *wire.MsgTx
+    fee           *BitcoinFee
+  )
+  // per input and output fee are rounded separately, select again until inputs cover fee of the whole tx
+  for i := 0; ; i++ {
+    if i == maxFeeIterations {
+      return "", fmt.Errorf("Inputs don't cover fee %s after %d selections", fee.RequiredFee, i)
+    }
+    if selectedutxos, _, selection, err = CoinSelect(int64(chaininfo.Headers), target, c.Wallet.Address.UTXOs, selector, params); err != nil {
+      return "", fmt.Errorf("Select UTXO for tx %s", err)
+    }
+    msgTx = coinset.NewMsgTxWithInputCoins(wire.TxVersion, selection.Coins)
+    // opt in replace-by-fee, stuck withdrawal can be bumped
+    for _, txIn := range msgTx.TxIn {
+      txIn.Sequence = BIP125Sequence
+    }
+    for _, txOut := range txOuts {
+      msgTx.AddTxOut(txOut)
+    }
     // recharge
-    // 181, 34: https://bitcoin.stackexchange.com/questions/1195/how-to-calculate-transaction-size-before-sending-legacy-non-segwit-p2pkh-p2sh
-    fee := feeRate.Fee(uint32(msgTx.SerializeSize() + 181 + 34))
-    if (vinAmount - int64(txAmountSatoshi) - int64(fee)) > 0 {
-      txOutReCharge := wire.NewTxOut((vinAmount-int64(txAmountSatoshi) - int64(fee)), fromPkScript)
-      msgTx.AddTxOut(txOutReCharge)
-    }else {
-      selectedutxoForFee, _, selectedCoinsForFee, err := CoinSelect(int64(chaininfo.Headers), fee, unselectedutxos)
-      if err != nil {
-        return "", fmt.Errorf("Select UTXO for fee %s", err)
-      }
-      for _, coin := range selectedCoinsForFee.Coins() {
-        vinAmount += int64(coin.Value())
-      }
-      txOutReCharge := wire.NewTxOut((vinAmount - int64(txAmountSatoshi) - int64(fee)), fromPkScript)
-      msgTx.AddTxOut(txOutReCharge)
-      selectedutxos = append(selectedutxos, selectedutxoForFee...)
+    if selection.Change > 0 {
+      msgTx.AddTxOut(wire.NewTxOut(int64(selection.Change), fromPkScript))
+    }
+    fee = bitcoinTxFee(msgTx, fromAddressType, selection.Value, feeRate)
+    shortfall := fee.RequiredFee - fee.Fee
+    if shortfall <= 0 {
+      break
+    }
+    if selection.Change - shortfall >= params.MinChange {
+      msgTx.TxOut[len(msgTx.TxOut) - 1].Value -= int64(shortfall)
+      selection.Change -= shortfall
+      fee = bitcoinTxFee(msgTx, fromAddressType, selection.Value, feeRate)
+      break
     }
+    target += shortfall
   }
+  fee.Change = selection.Change
+  configure.Sugar.Info("coin selection: ", selection.Strategy, " inputs: ", len(selectedutxos), " change: ", selection.Change, " waste: ", selection.Waste, " vsize: ", fee.VSize, " fee: ", fee.Fee)
 
   buf := bytes.NewBuffer(make([]byte, 0, msgTx.SerializeSize()))
   msgTx.Serialize(buf)
   rawTxHex := hex.EncodeToString(buf.Bytes())
   c.Wallet.SelectedUTXO = selectedutxos
+  c.Wallet.Selection = selection
+  c.Wallet.Fee = fee
   return rawTxHex, nil
 }
 
-// SignedTx bitcoin tx signature
-func (c BitcoinCoreChain) SignedTx(rawTxHex, wif string, options *ChainsOptions) (string, error) {
+// FeeRate satoshi per vbyte estimated by node for confirmation in 6 blocks, fallback_fee_rate of configure when node can't estimate
+func (c BitcoinCoreChain) FeeRate() (mempool.SatoshiPerByte, error) {
+  estimate, err := c.Client.EstimateSmartFee(int64(6))
+  if err == nil && estimate != nil && estimate.FeeRate > 0 {
+    // estimatesmartfee returns BTC/kvB
+    feeRate := mempool.SatoshiPerByte(estimate.FeeRate * btcutil.SatoshiPerBitcoin / 1000)
+    if feeRate < minRelayFeeRate {
+      feeRate = minRelayFeeRate
+    }
+    return feeRate, nil
+  }
+  fallback := configure.ChainsInfo[Bitcoin].FallbackFeeRate
+  if fallback <= 0 {
+    return 0, fmt.Errorf("Node can't estimate fee rate %v, and fallback_fee_rate isn't configured", err)
+  }
+  configure.Sugar.Warn("Node can't estimate fee rate ", err, ", use fallback_fee_rate ", fallback)
+  return mempool.SatoshiPerByte(fallback), nil
+}
+
+// bitcoinTxFee fee breakdown of unsigned tx whose inputs spend the address type
+func bitcoinTxFee(msgTx *wire.MsgTx, addressType string, inputValue btcutil.Amount, feeRate mempool.SatoshiPerByte) *BitcoinFee {
+  var pkScripts [][]byte
+  fee := &BitcoinFee{FeeRate: feeRate, InputValue: inputValue}
+  for _, txOut := range msgTx.TxOut {
+    fee.OutputValue += btcutil.Amount(txOut.Value)
+    pkScripts = append(pkScripts, txOut.PkScript)
+  }
+  fee.Weight = estimateBitcoinWeight(addressType, len(msgTx.TxIn), pkScripts...)
+  fee.VSize = (fee.Weight + bitcoinWitnessScale - 1) / bitcoinWitnessScale
+  fee.Fee = fee.InputValue - fee.OutputValue
+  fee.RequiredFee = feeRate.Fee(uint32(fee.VSize))
+  return fee
+}
+
+// bitcoinCoinSelectParams coin selection parameters of from address type at fee rate
+func bitcoinCoinSelectParams(feeRate mempool.SatoshiPerByte, addressType string, changePkScript []byte) CoinSelectParams {
+  longTermFeeRate := mempool.SatoshiPerByte(configure.ChainsInfo[Bitcoin].LongTermFeeRate)
+  if longTermFeeRate <= 0 {
+    longTermFeeRate = mempool.SatoshiPerByte(10)
+  }
+  inputVSize := bitcoinInputVSize(addressType)
+  changeFee := feeRate.Fee(uint32(bitcoinOutputVSize(changePkScript)))
+  return CoinSelectParams{
+    FeeRate:         feeRate,
+    LongTermFeeRate: longTermFeeRate,
+    InputVSize:      inputVSize,
+    ChangeFee:       changeFee,
+    ChangeCost:      changeFee + longTermFeeRate.Fee(uint32(inputVSize)),
+    MinChange:       btcutil.Amount(10000),
+    MaxInputs:       50,
+  }
+}
+
+// SignedTx bitcoin tx signature, every input is signed by key of its previous output address,
+// inputs spend options.From when previous output scripts aren't given
+func (c BitcoinCoreChain) SignedTx(rawTxHex string, options *ChainsOptions) (string, error) {
   // https://www.experts-exchange.com/questions/29108851/How-to-correctly-create-and-sign-a-Bitcoin-raw-transaction-using-Btcutil-library.html
   tx, err := DecodeBtcTxHex(rawTxHex)
   if err != nil {
     return "", fmt.Errorf("Fail to decode raw tx %s", err)
   }
-
-  ecPriv, err := btcutil.DecodeWIF(wif)
+  msgTx := tx.MsgTx()
+  if len(options.VinPkScripts) > 0 && len(options.VinPkScripts) != len(msgTx.TxIn) {
+    return "", fmt.Errorf("Previous output script of each vin is required: %d : %d", len(options.VinPkScripts), len(msgTx.TxIn))
+  }
+  fromAddress, err := btcutil.DecodeAddress(options.From, c.Mode)
   if err != nil {
-    return "", fmt.Errorf("Fail to decode wif %s", err)
+    return "", fmt.Errorf("Fail to decode from address %s", err)
+  }
+  fromPkScript, err := txscript.PayToAddrScript(fromAddress)
+  if err != nil {
+    return "", err
   }
-  fromAddress, _ := btcutil.DecodeAddress(options.From, c.Mode)
-  subscript, _ := txscript.PayToAddrScript(fromAddress)
-  for i, txIn := range tx.MsgTx().TxIn {
-    if txIn.SignatureScript, err = txscript.SignatureScript(tx.MsgTx(), i, subscript, txscript.SigHashAll, ecPriv.PrivKey, true); err != nil{
-      return "", fmt.Errorf("SignatureScript %s", err)
+  vinPkScript := func(i int) []byte {
+    if len(options.VinPkScripts) > 0 {
+      return options.VinPkScripts[i]
     }
+    return fromPkScript
+  }
+  vinAmount := func(i int) int64 {
+    if i < len(options.VinAmounts) {
+      return options.VinAmounts[i]
+    }
+    return 0
   }
 
-  //Validate signature
-  flags := txscript.StandardVerifyFlags
-  vm, err := txscript.NewEngine(subscript, tx.MsgTx(), 0, flags, nil, nil, options.VinAmount)
-  if err != nil {
-    return "", fmt.Errorf("Txscript.NewEngine %s", err)
+  // owning key of each input
+  signers := make(map[string]*bitcoinSigner)
+  vinSigners := make([]*bitcoinSigner, len(msgTx.TxIn))
+  for i := range msgTx.TxIn {
+    _, addresses, _, err := txscript.ExtractPkScriptAddrs(vinPkScript(i), c.Mode)
+    if err != nil || len(addresses) != 1 {
+      return "", fmt.Errorf("Input %d spends unknown script", i)
+    }
+    address := addresses[0].EncodeAddress()
+    signer, ok := signers[address]
+    if !ok {
+      if signer, err = c.bitcoinSignerOf(addresses[0]); err != nil {
+        return "", fmt.Errorf("Input %d %s", i, err)
+      }
+      signers[address] = signer
+    }
+    if signer.addressType != BitcoinAddressLegacy && len(options.VinAmounts) != len(msgTx.TxIn) {
+      return "", fmt.Errorf("Segwit signature requires amount of each vin: %d : %d", len(options.VinAmounts), len(msgTx.TxIn))
+    }
+    vinSigners[i] = signer
   }
-  if err := vm.Execute(); err != nil {
-    return "", fmt.Errorf("Fail to sign tx %s", err)
+
+  sigHashes := txscript.NewTxSigHashes(msgTx)
+  for i, txIn := range msgTx.TxIn {
+    signer := vinSigners[i]
+    var hash []byte
+    switch signer.addressType {
+    case BitcoinAddressBech32:
+      hash, err = txscript.CalcWitnessSigHash(signer.pkScript, sigHashes, txscript.SigHashAll, msgTx, i, vinAmount(i))
+    case BitcoinAddressNestedSegwit:
+      hash, err = txscript.CalcWitnessSigHash(signer.witnessProgram, sigHashes, txscript.SigHashAll, msgTx, i, vinAmount(i))
+    default:
+      hash, err = txscript.CalcSignatureHash(signer.pkScript, txscript.SigHashAll, msgTx, i)
+    }
+    if err != nil {
+      return "", fmt.Errorf("Signature hash of input %d %s", i, err)
+    }
+
+    sig, err := bitcoinSignature(c.Keys, signer.address, hash)
+    if err != nil {
+      return "", fmt.Errorf("Sign input %d %s", i, err)
+    }
+
+    switch signer.addressType {
+    case BitcoinAddressBech32:
+      txIn.Witness = wire.TxWitness{sig, signer.pubKey}
+    case BitcoinAddressNestedSegwit:
+      txIn.Witness = wire.TxWitness{sig, signer.pubKey}
+      if txIn.SignatureScript, err = txscript.NewScriptBuilder().AddData(signer.witnessProgram).Script(); err != nil {
+        return "", fmt.Errorf("SignatureScript %s", err)
+      }
+    default:
+      if txIn.SignatureScript, err = txscript.NewScriptBuilder().AddData(sig).AddData(signer.pubKey).Script(); err != nil {
+        return "", fmt.Errorf("SignatureScript %s", err)
+      }
+    }
+  }
+
+  //Validate signature of each input against its own previous output and amount
+  flags := txscript.StandardVerifyFlags
+  for i := range msgTx.TxIn {
+    vm, err := txscript.NewEngine(vinSigners[i].pkScript, msgTx, i, flags, nil, sigHashes, vinAmount(i))
+    if err != nil {
+      return "", fmt.Errorf("Txscript.NewEngine %s", err)
+    }
+    if err := vm.Execute(); err != nil {
+      return "", fmt.Errorf("Fail to sign tx input %d %s", i, err)
+    }
   }
 
   // txToHex
-  buf := bytes.NewBuffer(make([]byte, 0, tx.MsgTx().SerializeSize()))
-  tx.MsgTx().Serialize(buf)
+  buf := bytes.NewBuffer(make([]byte, 0, msgTx.SerializeSize()))
+  msgTx.Serialize(buf)
   txHex := hex.EncodeToString(buf.Bytes())
   return txHex, nil
 }
 
+// bitcoinSigner key store address signing inputs which spend it
+type bitcoinSigner struct {
+  address        string
+  addressType    string
+  pkScript       []byte
+  pubKey         []byte
+  witnessProgram []byte
+}
+
+// bitcoinSignerOf signer of address, its key must be in key store and derive the address
+func (c BitcoinCoreChain) bitcoinSignerOf(address btcutil.Address) (*bitcoinSigner, error) {
+  addressType, err := BitcoinAddressTypeOf(address)
+  if err != nil {
+    return nil, err
+  }
+  pubKey, err := c.Keys.PublicKey(address.EncodeAddress())
+  if err == keystore.ErrKeyNotFound {
+    return nil, fmt.Errorf("spends %s, which isn't wallet address", address.EncodeAddress())
+  }else if err != nil {
+    return nil, fmt.Errorf("Public key of %s %s", address.EncodeAddress(), err)
+  }
+  keyAddress, err := BitcoinPubKeyAddress(pubKey, addressType, c.Mode)
+  if err != nil {
+    return nil, err
+  }
+  if keyAddress.EncodeAddress() != address.EncodeAddress() {
+    return nil, fmt.Errorf("Private key doesn't match address %s", address.EncodeAddress())
+  }
+  pkScript, err := txscript.PayToAddrScript(address)
+  if err != nil {
+    return nil, err
+  }
+  witnessProgram, err := bitcoinWitnessProgram(btcutil.Hash160(pubKey.SerializeCompressed()), c.Mode)
+  if err != nil {
+    return nil, fmt.Errorf("Witness program %s", err)
+  }
+  return &bitcoinSigner{address: address.EncodeAddress(), addressType: addressType, pkScript: pkScript, pubKey: pubKey.SerializeCompressed(), witnessProgram: witnessProgram}, nil
+}
+
 // BroadcastTx bitcoin tx broadcast
 func (c BitcoinCoreChain) BroadcastTx(ctx context.Context, signedTxHex string) (string, error) {
   tx, err := DecodeBtcTxHex(signedTxHex)
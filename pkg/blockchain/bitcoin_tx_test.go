@@ -0,0 +1,39 @@
+package blockchain
+
+import (
+  "testing"
+  "github.com/btcsuite/btcd/wire"
+  "github.com/btcsuite/btcd/mempool"
+  "github.com/btcsuite/btcd/chaincfg/chainhash"
+)
+
+func TestBitcoinVSize(t *testing.T) {
+  inputs := map[string]int{BitcoinAddressLegacy: 148, BitcoinAddressNestedSegwit: 91, BitcoinAddressBech32: 68}
+  for addressType, vsize := range inputs {
+    if got := bitcoinInputVSize(addressType); got != vsize {
+      t.Fatalf("%s input vsize %d, want %d", addressType, got, vsize)
+    }
+  }
+
+  p2pkh := append(append([]byte{0x76, 0xa9, 0x14}, make([]byte, 20)...), 0x88, 0xac)
+  p2wpkh := append([]byte{0x00, 0x14}, make([]byte, 20)...)
+  if vsize := estimateBitcoinVSize(BitcoinAddressLegacy, 1, p2pkh, p2pkh); vsize != 226 {
+    t.Fatalf("legacy 1 input 2 outputs vsize %d", vsize)
+  }
+  // 562 weight units round up
+  if weight := estimateBitcoinWeight(BitcoinAddressBech32, 1, p2wpkh, p2wpkh); weight != 562 {
+    t.Fatalf("bech32 1 input 2 outputs weight %d", weight)
+  }
+  if vsize := estimateBitcoinVSize(BitcoinAddressBech32, 1, p2wpkh, p2wpkh); vsize != 141 {
+    t.Fatalf("bech32 1 input 2 outputs vsize %d", vsize)
+  }
+
+  msgTx := wire.NewMsgTx(wire.TxVersion)
+  msgTx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{1}, 0), nil, nil))
+  msgTx.AddTxOut(wire.NewTxOut(60000, p2wpkh))
+  msgTx.AddTxOut(wire.NewTxOut(38000, p2wpkh))
+  fee := bitcoinTxFee(msgTx, BitcoinAddressBech32, 100000, mempool.SatoshiPerByte(10))
+  if fee.VSize != 141 || fee.Fee != 2000 || fee.RequiredFee != 1410 || fee.OutputValue != 98000 {
+    t.Fatalf("fee %+v", fee)
+  }
+}
@@ -1,13 +1,33 @@
 package blockchain
 
 import (
-  "fmt"
-  "wallet-go/pkg/db"
-  "github.com/btcsuite/btcutil"
-  "github.com/btcsuite/btcutil/coinset"
-  "github.com/btcsuite/btcd/chaincfg/chainhash"
+	"fmt"
+	"sort"
+	"errors"
+	"wallet-go/pkg/db"
+	"wallet-go/pkg/configure"
+	"github.com/btcsuite/btcutil"
+	"github.com/btcsuite/btcutil/coinset"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
 )
 
+const (
+	// CoinSelectBnB changeless branch and bound
+	CoinSelectBnB           = "bnb"
+	// CoinSelectLargestFirst largest coins first
+	CoinSelectLargestFirst  = "largest_first"
+	// CoinSelectSmallestFirst smallest coins first, consolidating
+	CoinSelectSmallestFirst = "smallest_first"
+	// CoinSelectPrivacy privacy oriented
+	CoinSelectPrivacy       = "privacy"
+	// CoinSelectCheapest least waste of all strategies
+	CoinSelectCheapest      = "cheapest"
+
+	bnbMaxTries = 100000
+)
+
+var errInsufficientCoins = errors.New("Insufficient effective value of utxos")
+
 // Hash implements coinset Coin interface
 func (c *SimpleCoin) Hash() *chainhash.Hash { return c.TxHash }
 // Index implements coinset Coin interface
@@ -21,41 +41,262 @@ func (c *SimpleCoin) NumConfs() int64       { return c.TxNumConfs }
 // ValueAge implements coinset Coin interface
 func (c *SimpleCoin) ValueAge() int64       { return int64(c.TxValue) * c.TxNumConfs }
 
-// CoinSelect btc tx inputs
-func CoinSelect(chainHeader int64, txAmount btcutil.Amount, utxos []db.UTXO) ([]db.UTXO, []db.UTXO, coinset.Coins, error) {
+// NewCoinSelector selector of strategy name, empty name uses chains bitcoin coin_selection of configure
+func NewCoinSelector(name string) (CoinSelector, error) {
+	if name == "" {
+		name = configure.ChainsInfo[Bitcoin].CoinSelection
+	}
+	switch name {
+	case CoinSelectBnB:
+		return BnBSelector{MaxTries: bnbMaxTries}, nil
+	case CoinSelectLargestFirst:
+		return LargestFirstSelector{}, nil
+	case CoinSelectSmallestFirst:
+		return SmallestFirstSelector{}, nil
+	case CoinSelectPrivacy:
+		return PrivacySelector{}, nil
+	case "", CoinSelectCheapest:
+		return CheapestSelector{Selectors: []CoinSelector{
+			BnBSelector{MaxTries: bnbMaxTries},
+			LargestFirstSelector{},
+			SmallestFirstSelector{},
+			PrivacySelector{},
+		}}, nil
+	default:
+		return nil, fmt.Errorf("Unsupport coin selection %s, support %s, %s, %s, %s or %s", name, CoinSelectBnB, CoinSelectLargestFirst, CoinSelectSmallestFirst, CoinSelectPrivacy, CoinSelectCheapest)
+	}
+}
+
+// CoinSelect select utxos with the selector, return selected and unselected utxos
+func CoinSelect(chainHeader int64, target btcutil.Amount, utxos []db.UTXO, selector CoinSelector, params CoinSelectParams) ([]db.UTXO, []db.UTXO, *CoinSelection, error) {
 	var coins []coinset.Coin
 	for _, utxo := range utxos {
 		txHash, err := chainhash.NewHashFromStr(utxo.Txid)
 		if err != nil {
-      return nil, nil, nil, fmt.Errorf("Convert utxo hexTxid to txHash %s", err)
+			return nil, nil, nil, fmt.Errorf("Convert utxo hexTxid to txHash %s", err)
 		}
 		amount, err := btcutil.NewAmount(utxo.Amount)
 		if err != nil {
-      return nil, nil, nil, fmt.Errorf("Convert utxo amount(float64) to btc amount(int64 as Satoshi) %s", err)
+			return nil, nil, nil, fmt.Errorf("Convert utxo amount(float64) to btc amount(int64 as Satoshi) %s", err)
 		}
 		coins = append(coins, coinset.Coin(&SimpleCoin{TxHash: txHash, TxIndex: utxo.VoutIndex, TxValue: amount, TxNumConfs: chainHeader - utxo.Height + 1}))
 	}
 
-	selector := &coinset.MaxValueAgeCoinSelector{
-		MaxInputs: 50,
-		MinChangeAmount: 10000,
+	selection, err := selector.Select(target, coins, params)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("CoinSelect %s error: %s", selector.Name(), err)
+	}
+
+	selected := make(map[string]bool)
+	for _, coin := range selection.Coins.Coins() {
+		selected[fmt.Sprintf("%s:%d", coin.Hash().String(), coin.Index())] = true
+	}
+	var selectedUTXOs, unSelectedUTXOs []db.UTXO
+	for _, utxo := range utxos {
+		if selected[fmt.Sprintf("%s:%d", utxo.Txid, utxo.VoutIndex)] {
+			selectedUTXOs = append(selectedUTXOs, utxo)
+		} else {
+			unSelectedUTXOs = append(unSelectedUTXOs, utxo)
+		}
+	}
+	return selectedUTXOs, unSelectedUTXOs, selection, nil
+}
+
+// Name implements CoinSelector
+func (s BnBSelector) Name() string { return CoinSelectBnB }
+
+// Select depth first search over coins sorted by effective value, inputs whose excess is within change cost
+func (s BnBSelector) Select(target btcutil.Amount, coins []coinset.Coin, params CoinSelectParams) (*CoinSelection, error) {
+	pool := spendableCoins(coins, params)
+	sort.SliceStable(pool, func(i, j int) bool { return effectiveValue(pool[i], params) > effectiveValue(pool[j], params) })
+	var remaining btcutil.Amount
+	for _, coin := range pool {
+		remaining += effectiveValue(coin, params)
+	}
+	if remaining < target {
+		return nil, errInsufficientCoins
 	}
 
-	selectedCoins, err := selector.CoinSelect(txAmount, coins)
+	upper := target + params.ChangeCost
+	inputWaste := params.FeeRate.Fee(uint32(params.InputVSize)) - params.LongTermFeeRate.Fee(uint32(params.InputVSize))
+	var (
+		tries     int
+		best      []coinset.Coin
+		bestWaste int64
+		current   []coinset.Coin
+		search    func(i int, value, remaining btcutil.Amount)
+	)
+	search = func(i int, value, remaining btcutil.Amount) {
+		tries++
+		if tries > s.MaxTries || value > upper || value + remaining < target {
+			return
+		}
+		if value >= target {
+			waste := int64(inputWaste) * int64(len(current)) + int64(value - target)
+			if best == nil || waste < bestWaste {
+				best, bestWaste = append([]coinset.Coin(nil), current...), waste
+			}
+			return
+		}
+		if i == len(pool) || (params.MaxInputs > 0 && len(current) >= params.MaxInputs) {
+			return
+		}
+		ev := effectiveValue(pool[i], params)
+		current = append(current, pool[i])
+		search(i + 1, value + ev, remaining - ev)
+		current = current[:len(current) - 1]
+		search(i + 1, value, remaining - ev)
+	}
+	search(0, 0, remaining)
+
+	if best == nil {
+		return nil, errors.New("No changeless input set found")
+	}
+	return newCoinSelection(s.Name(), best, target, params, false), nil
+}
+
+// Name implements CoinSelector
+func (s LargestFirstSelector) Name() string { return CoinSelectLargestFirst }
+
+// Select accumulate coins by value descending
+func (s LargestFirstSelector) Select(target btcutil.Amount, coins []coinset.Coin, params CoinSelectParams) (*CoinSelection, error) {
+	pool := spendableCoins(coins, params)
+	sort.SliceStable(pool, func(i, j int) bool { return pool[i].Value() > pool[j].Value() })
+	selected, err := accumulateCoins(pool, target, params)
 	if err != nil {
-    return nil, nil, nil, fmt.Errorf("CoinSelect error: %s", err)
+		return nil, err
 	}
-	scoins := selectedCoins.Coins()
+	return newCoinSelection(s.Name(), selected, target, params, true), nil
+}
 
-	var selectedUTXOs, unSelectedUTXOs []db.UTXO
-	for _, coin := range scoins {
-		for _, utxo := range utxos {
-			if coin.Hash().String() == utxo.Txid && coin.Index() == utxo.VoutIndex {
-				selectedUTXOs = append(selectedUTXOs, utxo)
-			} else {
-        unSelectedUTXOs = append(unSelectedUTXOs, utxo)
-      }
+// Name implements CoinSelector
+func (s SmallestFirstSelector) Name() string { return CoinSelectSmallestFirst }
+
+// Select accumulate coins by value ascending, keep consolidating up to max inputs while fee rate is below long term
+func (s SmallestFirstSelector) Select(target btcutil.Amount, coins []coinset.Coin, params CoinSelectParams) (*CoinSelection, error) {
+	pool := spendableCoins(coins, params)
+	sort.SliceStable(pool, func(i, j int) bool { return pool[i].Value() < pool[j].Value() })
+	selected, err := accumulateCoins(pool, target, params)
+	if err != nil {
+		return nil, err
+	}
+	if params.FeeRate < params.LongTermFeeRate {
+		for _, coin := range pool[len(selected):] {
+			if params.MaxInputs > 0 && len(selected) >= params.MaxInputs {
+				break
+			}
+			selected = append(selected, coin)
 		}
 	}
-	return selectedUTXOs, unSelectedUTXOs, selectedCoins, nil
+	return newCoinSelection(s.Name(), selected, target, params, true), nil
+}
+
+// Name implements CoinSelector
+func (s PrivacySelector) Name() string { return CoinSelectPrivacy }
+
+// Select changeless set first, then the smallest single coin, then fewest inputs
+func (s PrivacySelector) Select(target btcutil.Amount, coins []coinset.Coin, params CoinSelectParams) (*CoinSelection, error) {
+	if selection, err := (BnBSelector{MaxTries: bnbMaxTries}).Select(target, coins, params); err == nil {
+		selection.Strategy = s.Name()
+		return selection, nil
+	}
+	var single coinset.Coin
+	for _, coin := range spendableCoins(coins, params) {
+		if effectiveValue(coin, params) >= target && (single == nil || coin.Value() < single.Value()) {
+			single = coin
+		}
+	}
+	if single != nil {
+		return newCoinSelection(s.Name(), []coinset.Coin{single}, target, params, true), nil
+	}
+	selection, err := LargestFirstSelector{}.Select(target, coins, params)
+	if err != nil {
+		return nil, err
+	}
+	selection.Strategy = s.Name()
+	return selection, nil
+}
+
+// Name implements CoinSelector
+func (s CheapestSelector) Name() string { return CoinSelectCheapest }
+
+// Select selection of least waste, ties keep the earlier selector
+func (s CheapestSelector) Select(target btcutil.Amount, coins []coinset.Coin, params CoinSelectParams) (*CoinSelection, error) {
+	var (
+		best *CoinSelection
+		errs []string
+	)
+	for _, selector := range s.Selectors {
+		selection, err := selector.Select(target, coins, params)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %s", selector.Name(), err))
+			continue
+		}
+		configure.Sugar.Debug("coin selection: ", selection.Strategy, " inputs: ", len(selection.Coins.Coins()), " waste: ", selection.Waste)
+		if best == nil || selection.Waste < best.Waste {
+			best = selection
+		}
+	}
+	if best == nil {
+		return nil, fmt.Errorf("%v", errs)
+	}
+	return best, nil
+}
+
+// effectiveValue coin value minus fee of spending it at fee rate
+func effectiveValue(coin coinset.Coin, params CoinSelectParams) btcutil.Amount {
+	return coin.Value() - params.FeeRate.Fee(uint32(params.InputVSize))
+}
+
+// spendableCoins coins worth more than fee of spending them
+func spendableCoins(coins []coinset.Coin, params CoinSelectParams) []coinset.Coin {
+	var pool []coinset.Coin
+	for _, coin := range coins {
+		if effectiveValue(coin, params) > 0 {
+			pool = append(pool, coin)
+		}
+	}
+	return pool
+}
+
+// accumulateCoins take coins in order until effective value covers target
+func accumulateCoins(pool []coinset.Coin, target btcutil.Amount, params CoinSelectParams) ([]coinset.Coin, error) {
+	var (
+		selected []coinset.Coin
+		value btcutil.Amount
+	)
+	for _, coin := range pool {
+		if value >= target {
+			break
+		}
+		if params.MaxInputs > 0 && len(selected) >= params.MaxInputs {
+			return nil, fmt.Errorf("Target requires more than %d inputs", params.MaxInputs)
+		}
+		selected = append(selected, coin)
+		value += effectiveValue(coin, params)
+	}
+	if value < target {
+		return nil, errInsufficientCoins
+	}
+	return selected, nil
+}
+
+// newCoinSelection change is created when excess covers change fee and minimum change, otherwise excess is dropped to fee
+func newCoinSelection(strategy string, coins []coinset.Coin, target btcutil.Amount, params CoinSelectParams, allowChange bool) *CoinSelection {
+	selection := &CoinSelection{Strategy: strategy, Coins: coinset.NewCoinSet(coins)}
+	var effective btcutil.Amount
+	for _, coin := range coins {
+		selection.Value += coin.Value()
+		effective += effectiveValue(coin, params)
+	}
+	selection.Excess = effective - target
+	inputWaste := params.FeeRate.Fee(uint32(params.InputVSize)) - params.LongTermFeeRate.Fee(uint32(params.InputVSize))
+	selection.Waste = int64(inputWaste) * int64(len(coins))
+	if allowChange && selection.Excess - params.ChangeFee >= params.MinChange {
+		selection.Change = selection.Excess - params.ChangeFee
+		selection.Waste += int64(params.ChangeCost)
+	} else {
+		selection.Waste += int64(selection.Excess)
+	}
+	return selection
 }
@@ -0,0 +1,147 @@
+package blockchain
+
+import (
+  "testing"
+  "wallet-go/pkg/db"
+  "github.com/btcsuite/btcutil"
+  "github.com/btcsuite/btcutil/coinset"
+  "github.com/btcsuite/btcd/chaincfg/chainhash"
+)
+
+// testCoinParams 10 sat/vB now, 5 sat/vB long term, P2WPKH input of 68 vB spends 680 sat
+var testCoinParams = CoinSelectParams{
+  FeeRate:         10,
+  LongTermFeeRate: 5,
+  InputVSize:      68,
+  ChangeFee:       310,
+  ChangeCost:      310 + 340,
+  MinChange:       10000,
+}
+
+func testCoins(values ...int64) []coinset.Coin {
+  var coins []coinset.Coin
+  for i, value := range values {
+    coins = append(coins, &SimpleCoin{TxHash: &chainhash.Hash{byte(i + 1)}, TxValue: btcutil.Amount(value), TxNumConfs: 1})
+  }
+  return coins
+}
+
+func coinValues(selection *CoinSelection) []int64 {
+  var values []int64
+  for _, coin := range selection.Coins.Coins() {
+    values = append(values, int64(coin.Value()))
+  }
+  return values
+}
+
+func TestBnBSelector(t *testing.T) {
+  selector := BnBSelector{MaxTries: bnbMaxTries}
+  // two coins of 50000 effective value match target exactly
+  selection, err := selector.Select(100000, testCoins(300000, 50680, 20000, 50680), testCoinParams)
+  if err != nil {
+    t.Fatal(err)
+  }
+  if values := coinValues(selection); len(values) != 2 || values[0] != 50680 || values[1] != 50680 {
+    t.Fatalf("selected %v", values)
+  }
+  if selection.Change != 0 || selection.Excess != 0 || selection.Waste != 2 * 340 {
+    t.Fatalf("selection %+v", selection)
+  }
+
+  if _, err = selector.Select(100000, testCoins(300000), testCoinParams); err == nil {
+    t.Fatal("changeless set is found")
+  }
+  if _, err = selector.Select(100000, testCoins(50680, 49000), testCoinParams); err != errInsufficientCoins {
+    t.Fatalf("insufficient coins %v", err)
+  }
+}
+
+func TestAccumulateSelectors(t *testing.T) {
+  coins := testCoins(30000, 300000, 20000, 60000)
+  selection, err := LargestFirstSelector{}.Select(100000, coins, testCoinParams)
+  if err != nil {
+    t.Fatal(err)
+  }
+  if values := coinValues(selection); len(values) != 1 || values[0] != 300000 {
+    t.Fatalf("largest first selected %v", values)
+  }
+  if selection.Excess != 300000 - 680 - 100000 || selection.Change != selection.Excess - 310 {
+    t.Fatalf("largest first selection %+v", selection)
+  }
+
+  selection, err = SmallestFirstSelector{}.Select(100000, coins, testCoinParams)
+  if err != nil {
+    t.Fatal(err)
+  }
+  if values := coinValues(selection); len(values) != 3 || values[2] != 60000 {
+    t.Fatalf("smallest first selected %v", values)
+  }
+
+  // coins of small value are consolidated while fee rate is below long term
+  params := testCoinParams
+  params.FeeRate = 2
+  selection, err = SmallestFirstSelector{}.Select(10000, coins, params)
+  if err != nil {
+    t.Fatal(err)
+  }
+  if values := coinValues(selection); len(values) != 4 {
+    t.Fatalf("smallest first didn't consolidate %v", values)
+  }
+
+  params = testCoinParams
+  params.MaxInputs = 2
+  if _, err = (SmallestFirstSelector{}).Select(100000, coins, params); err == nil {
+    t.Fatal("max inputs exceeded")
+  }
+  // coins whose value doesn't cover their fee are skipped
+  if _, err = (LargestFirstSelector{}).Select(100, testCoins(680), testCoinParams); err != errInsufficientCoins {
+    t.Fatalf("uneconomic coin %v", err)
+  }
+}
+
+func TestPrivacySelector(t *testing.T) {
+  selection, err := PrivacySelector{}.Select(100000, testCoins(300000, 150000, 20000), testCoinParams)
+  if err != nil {
+    t.Fatal(err)
+  }
+  if values := coinValues(selection); len(values) != 1 || values[0] != 150000 || selection.Strategy != CoinSelectPrivacy {
+    t.Fatalf("privacy selection %s %v", selection.Strategy, values)
+  }
+}
+
+func TestCheapestSelector(t *testing.T) {
+  selector, err := NewCoinSelector(CoinSelectCheapest)
+  if err != nil {
+    t.Fatal(err)
+  }
+  // changeless pair wastes 680, largest coin with change wastes 340 + 650
+  selection, err := selector.Select(100000, testCoins(300000, 50680, 50680), testCoinParams)
+  if err != nil {
+    t.Fatal(err)
+  }
+  if selection.Strategy != CoinSelectBnB || selection.Waste != 680 {
+    t.Fatalf("cheapest selection %s waste %d", selection.Strategy, selection.Waste)
+  }
+
+  if _, err = NewCoinSelector("random"); err == nil {
+    t.Fatal("unknown coin selection is created")
+  }
+}
+
+func TestCoinSelect(t *testing.T) {
+  utxos := []db.UTXO{
+    {Txid: (&chainhash.Hash{1}).String(), VoutIndex: 0, Amount: 0.003, Height: 100},
+    {Txid: (&chainhash.Hash{1}).String(), VoutIndex: 1, Amount: 0.0005068, Height: 100},
+    {Txid: (&chainhash.Hash{2}).String(), VoutIndex: 0, Amount: 0.0005068, Height: 101},
+  }
+  selected, unselected, selection, err := CoinSelect(110, 100000, utxos, BnBSelector{MaxTries: bnbMaxTries}, testCoinParams)
+  if err != nil {
+    t.Fatal(err)
+  }
+  if len(selected) != 2 || len(unselected) != 1 || unselected[0].Amount != 0.003 {
+    t.Fatalf("selected %v, unselected %v", selected, unselected)
+  }
+  if selection.Value != 2 * 50680 {
+    t.Fatalf("selected value %s", selection.Value)
+  }
+}
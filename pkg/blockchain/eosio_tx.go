@@ -36,7 +36,7 @@ func (c EOSChain) RawTx(cxt context.Context, from, to, amount, memo, asset strin
 }
 
 // SignedTx EOSIO tx signature
-func (c EOSChain) SignedTx(rawTxHex, wif string, options *ChainsOptions) (string, error) {
+func (c EOSChain) SignedTx(rawTxHex string, options *ChainsOptions) (string, error) {
   txB, err := hex.DecodeString(rawTxHex)
   if err != nil {
     return "", err
@@ -47,26 +47,30 @@ func (c EOSChain) SignedTx(rawTxHex, wif string, options *ChainsOptions) (string
     return "", err
   }
 
-  keyBag := eos.NewKeyBag()
-  keyBag.ImportPrivateKey(wif)
-
   signTx := eos.NewSignedTransaction(&tx)
-  privateKey, err := ecc.NewPrivateKey(wif)
+  chainID, err := hex.DecodeString(options.ChainID)
   if err != nil {
     return "", err
   }
-  requiredKey := privateKey.PublicKey()
-  chainID, err := hex.DecodeString(options.ChainID)
+  txdata, cfd, err := signTx.PackedTransactionAndCFD()
   if err != nil {
     return "", err
   }
+  digest := eos.SigDigest(chainID, txdata, cfd)
 
-  signedTx, err := keyBag.Sign(signTx, chainID, requiredKey)
+  sig, err := c.Keys.Sign(options.From, digest)
   if err != nil {
     return "", err
   }
+  // EOSIO compact signature, header is 27 + 4 (compressed) + recovery id
+  signature := ecc.Signature{Curve: ecc.CurveK1, Content: append([]byte{27 + 4 + sig[64]}, sig[:64]...)}
+  pubKey, err := signature.PublicKey(digest)
+  if err != nil || pubKey.String() != options.From {
+    return "", fmt.Errorf("Private key doesn't match public key %s", options.From)
+  }
+  signTx.Signatures = append(signTx.Signatures, signature)
 
-  signedTxB, err := json.Marshal(signedTx)
+  signedTxB, err := json.Marshal(signTx)
   if err != nil {
     return "", err
   }
@@ -0,0 +1,295 @@
+package blockchain
+
+import (
+  "fmt"
+  "sort"
+  "bytes"
+  "errors"
+  "strings"
+  "math/big"
+  "wallet-go/pkg/configure"
+  "github.com/ethereum/go-ethereum/rlp"
+  "github.com/ethereum/go-ethereum/common"
+  "github.com/ethereum/go-ethereum/crypto"
+  "github.com/ethereum/go-ethereum/common/hexutil"
+  "github.com/ethereum/go-ethereum/crypto/sha3"
+)
+
+// DynamicFeeTxType EIP-2718 type of EIP-1559 transaction
+// https://github.com/ethereum/EIPs/blob/master/EIPS/eip-1559.md
+const DynamicFeeTxType = 0x02
+
+const (
+  // EthereumPrioritySlow, EthereumPriorityNormal and EthereumPriorityFast tip percentile of recent blocks
+  EthereumPrioritySlow   = "slow"
+  EthereumPriorityNormal = "normal"
+  EthereumPriorityFast   = "fast"
+
+  feeHistoryBlocks = 20
+)
+
+var (
+  ethereumPriorityPercentiles = []float64{10, 50, 90}
+  // defaultPriorityFee tip when recent blocks carry no reward, 1 gwei
+  defaultPriorityFee = big.NewInt(1000000000)
+)
+
+// AccessTuple EIP-2930 access list entry
+type AccessTuple struct {
+  Address     common.Address
+  StorageKeys []common.Hash
+}
+
+// DynamicFeeTx EIP-1559 transaction, go-ethereum in use predates London so the envelope is encoded here,
+// V, R and S are zero before signing
+type DynamicFeeTx struct {
+  ChainID    *big.Int
+  Nonce      uint64
+  GasTipCap  *big.Int
+  GasFeeCap  *big.Int
+  Gas        uint64
+  To         *common.Address `rlp:"nil"`
+  Value      *big.Int
+  Data       []byte
+  AccessList []AccessTuple
+  V, R, S    *big.Int
+}
+
+// dynamicFeeTxPayload fields covered by London signature
+type dynamicFeeTxPayload struct {
+  ChainID    *big.Int
+  Nonce      uint64
+  GasTipCap  *big.Int
+  GasFeeCap  *big.Int
+  Gas        uint64
+  To         *common.Address `rlp:"nil"`
+  Value      *big.Int
+  Data       []byte
+  AccessList []AccessTuple
+}
+
+// EthereumFee gas pricing of ethereum tx, GasPrice of legacy tx, fee caps of dynamic fee tx
+type EthereumFee struct {
+  Type      int
+  Priority  string
+  Gas       uint64
+  GasPrice  *big.Int
+  BaseFee   *big.Int
+  GasTipCap *big.Int
+  GasFeeCap *big.Int
+  // MaxFee upper bound of tx fee in wei
+  MaxFee    *big.Int
+}
+
+// IsDynamicFeeTx whether raw tx hex is EIP-1559 envelope
+func IsDynamicFeeTx(txHex string) bool {
+  return strings.HasPrefix(strings.ToLower(txHex), "0x02")
+}
+
+// EncodeDynamicFeeTx EIP-2718 envelope hex of dynamic fee tx
+func EncodeDynamicFeeTx(tx *DynamicFeeTx) (string, error) {
+  b, err := tx.envelope()
+  if err != nil {
+    return "", err
+  }
+  return hexutil.Encode(b), nil
+}
+
+// DecodeDynamicFeeTx dynamic fee tx of EIP-2718 envelope hex
+func DecodeDynamicFeeTx(txHex string) (*DynamicFeeTx, error) {
+  b, err := hexutil.Decode(txHex)
+  if err != nil {
+    return nil, err
+  }
+  if len(b) == 0 || b[0] != DynamicFeeTxType {
+    return nil, errors.New("Not EIP-1559 transaction")
+  }
+  var tx DynamicFeeTx
+  if err = rlp.Decode(bytes.NewReader(b[1:]), &tx); err != nil {
+    return nil, err
+  }
+  return &tx, nil
+}
+
+func (tx *DynamicFeeTx) envelope() ([]byte, error) {
+  signed := *tx
+  for _, v := range []**big.Int{&signed.V, &signed.R, &signed.S} {
+    if *v == nil {
+      *v = new(big.Int)
+    }
+  }
+  b, err := rlp.EncodeToBytes(&signed)
+  if err != nil {
+    return nil, err
+  }
+  return append([]byte{DynamicFeeTxType}, b...), nil
+}
+
+// SigHash London signing hash, keccak256(0x02 || rlp(payload))
+func (tx *DynamicFeeTx) SigHash() (common.Hash, error) {
+  b, err := rlp.EncodeToBytes(&dynamicFeeTxPayload{tx.ChainID, tx.Nonce, tx.GasTipCap, tx.GasFeeCap, tx.Gas, tx.To, tx.Value, tx.Data, tx.AccessList})
+  if err != nil {
+    return common.Hash{}, err
+  }
+  return keccak256Hash(append([]byte{DynamicFeeTxType}, b...)), nil
+}
+
+// Hash txid of signed tx
+func (tx *DynamicFeeTx) Hash() (common.Hash, error) {
+  b, err := tx.envelope()
+  if err != nil {
+    return common.Hash{}, err
+  }
+  return keccak256Hash(b), nil
+}
+
+// WithSignature set [R || S || V] signature, V is y parity
+func (tx *DynamicFeeTx) WithSignature(sig []byte) error {
+  if len(sig) != 65 || sig[64] > 1 {
+    return errors.New("Invalid [R || S || V] signature")
+  }
+  tx.R = new(big.Int).SetBytes(sig[:32])
+  tx.S = new(big.Int).SetBytes(sig[32:64])
+  tx.V = new(big.Int).SetUint64(uint64(sig[64]))
+  return nil
+}
+
+// Sender address recovered from signature
+func (tx *DynamicFeeTx) Sender() (common.Address, error) {
+  if tx.V == nil || tx.R == nil || tx.S == nil || tx.V.Cmp(big.NewInt(1)) > 0 {
+    return common.Address{}, errors.New("Invalid signature values")
+  }
+  if !crypto.ValidateSignatureValues(byte(tx.V.Uint64()), tx.R, tx.S, true) {
+    return common.Address{}, errors.New("Invalid signature values")
+  }
+  hash, err := tx.SigHash()
+  if err != nil {
+    return common.Address{}, err
+  }
+  sig := make([]byte, 65)
+  copy(sig[32 - len(tx.R.Bytes()):32], tx.R.Bytes())
+  copy(sig[64 - len(tx.S.Bytes()):64], tx.S.Bytes())
+  sig[64] = byte(tx.V.Uint64())
+  pub, err := crypto.Ecrecover(hash.Bytes(), sig)
+  if err != nil {
+    return common.Address{}, err
+  }
+  return common.BytesToAddress(keccak256Hash(pub[1:]).Bytes()[12:]), nil
+}
+
+func keccak256Hash(b []byte) common.Hash {
+  hash := sha3.NewKeccak256()
+  hash.Write(b)
+  var h common.Hash
+  hash.Sum(h[:0])
+  return h
+}
+
+// feeHistory eth_feeHistory result
+type feeHistory struct {
+  BaseFeePerGas []*hexutil.Big   `json:"baseFeePerGas"`
+  Reward        [][]*hexutil.Big `json:"reward"`
+}
+
+// DynamicFee fee caps of priority from base fees and tips of recent blocks: tip is the median of the priority percentile reward,
+// fee cap is twice the next block base fee plus tip, which covers six full blocks of base fee growth.
+// nil is returned when node isn't London enabled, i.e. doesn't serve eth_feeHistory
+func (c EthereumChain) DynamicFee(priority string) (*EthereumFee, error) {
+  if priority == "" {
+    priority = EthereumPriorityNormal
+  }
+  var percentile int
+  switch priority {
+  case EthereumPrioritySlow:
+    percentile = 0
+  case EthereumPriorityNormal:
+    percentile = 1
+  case EthereumPriorityFast:
+    percentile = 2
+  default:
+    return nil, fmt.Errorf("priority only supports %s, %s or %s", EthereumPrioritySlow, EthereumPriorityNormal, EthereumPriorityFast)
+  }
+
+  rpcClient := c.rpcClient()
+  response, err := rpcClient.Call("eth_feeHistory", hexutil.EncodeUint64(feeHistoryBlocks), "latest", ethereumPriorityPercentiles)
+  if err != nil {
+    return nil, err
+  }
+  if isMethodNotFound(response.Error) {
+    // pre-London node doesn't know eth_feeHistory
+    configure.Sugar.Warn("eth_feeHistory ", response.Error.Error(), ", fall back to legacy gas price")
+    return nil, nil
+  }
+  if response.Error != nil {
+    return nil, fmt.Errorf("eth_feeHistory %s", response.Error)
+  }
+  var history feeHistory
+  if err = response.GetObject(&history); err != nil {
+    return nil, err
+  }
+  // base fee of next block is the last one
+  if len(history.BaseFeePerGas) == 0 || history.BaseFeePerGas[len(history.BaseFeePerGas) - 1] == nil || history.BaseFeePerGas[len(history.BaseFeePerGas) - 1].ToInt().Sign() == 0 {
+    return nil, nil
+  }
+  baseFee := history.BaseFeePerGas[len(history.BaseFeePerGas) - 1].ToInt()
+
+  var tips []*big.Int
+  for _, rewards := range history.Reward {
+    if percentile < len(rewards) && rewards[percentile] != nil {
+      tips = append(tips, rewards[percentile].ToInt())
+    }
+  }
+  tip := new(big.Int).Set(defaultPriorityFee)
+  if len(tips) > 0 {
+    sort.Slice(tips, func(i, j int) bool {
+      return tips[i].Cmp(tips[j]) < 0
+    })
+    tip.Set(tips[len(tips) / 2])
+  }
+  feeCap := new(big.Int).Add(new(big.Int).Mul(baseFee, big.NewInt(2)), tip)
+  return &EthereumFee{Type: DynamicFeeTxType, Priority: priority, BaseFee: baseFee, GasTipCap: tip, GasFeeCap: feeCap}, nil
+}
+
+// ethereumTxFields fields of legacy or dynamic fee raw tx checked against intent, ChainID is nil for legacy tx
+type ethereumTxFields struct {
+  To      *common.Address
+  Value   *big.Int
+  Data    []byte
+  ChainID *big.Int
+  // MaxFee gas limit times gas price or fee cap, wei
+  MaxFee  *big.Int
+}
+
+// decodeEthereumTxFields intent fields of legacy or dynamic fee raw tx
+func decodeEthereumTxFields(txHex string) (*ethereumTxFields, error) {
+  if IsDynamicFeeTx(txHex) {
+    tx, err := DecodeDynamicFeeTx(txHex)
+    if err != nil {
+      return nil, err
+    }
+    maxFee := new(big.Int).Mul(new(big.Int).SetUint64(tx.Gas), tx.GasFeeCap)
+    return &ethereumTxFields{To: tx.To, Value: tx.Value, Data: tx.Data, ChainID: tx.ChainID, MaxFee: maxFee}, nil
+  }
+  tx, err := DecodeETHTx(txHex)
+  if err != nil {
+    return nil, err
+  }
+  maxFee := new(big.Int).Mul(new(big.Int).SetUint64(tx.Gas()), tx.GasPrice())
+  return &ethereumTxFields{To: tx.To(), Value: tx.Value(), Data: tx.Data(), MaxFee: maxFee}, nil
+}
+
+// EthereumTxNonce nonce of legacy or dynamic fee raw tx
+func EthereumTxNonce(txHex string) (uint64, error) {
+  if IsDynamicFeeTx(txHex) {
+    tx, err := DecodeDynamicFeeTx(txHex)
+    if err != nil {
+      return 0, err
+    }
+    return tx.Nonce, nil
+  }
+  tx, err := DecodeETHTx(txHex)
+  if err != nil {
+    return 0, err
+  }
+  return tx.Nonce(), nil
+}
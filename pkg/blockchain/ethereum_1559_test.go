@@ -0,0 +1,194 @@
+package blockchain
+
+import (
+  "testing"
+  "context"
+  "math/big"
+  "github.com/ybbus/jsonrpc"
+  "github.com/ethereum/go-ethereum/common"
+  "github.com/ethereum/go-ethereum/crypto"
+)
+
+// London tx signed by LondonSigner of go-ethereum 1.17
+const (
+  testDynamicFeeKey     = "4c0883a69102937d6231471b5dbb6204fe5129617082792ae468d01a3f362318"
+  testDynamicFeeSender  = "0x2c7536E3605D9C16a7a3D7b1898e529396a65c23"
+  testDynamicFeeSigHash = "0xef0610f6b7b48d1af997a6df5a916b2f3ffbe6190f36afa96a48545ebafcfc30"
+  testDynamicFeeTxid    = "0xf31c785a6f2c15efed24acd47ef335ac1eb52bc5929dc3595cff7954756b0c87"
+  testDynamicFeeTxHex   = "0x02f8ac010984773594008506fc23ac00825208943535353535353535353535353535353535353535880de0b6b3a764000080f838f7943535353535353535353535353535353535353535e1a0000000000000000000000000000000000000000000000000000000000000000101a044e81634d0bc6ea477736803dadbe00ad64046b0ec9596485d133af25d0591d5a074bc31af0a8b25e0648f254f7125c3fbc2a12ca007e11684c78408cf14b8b02a"
+)
+
+func testDynamicFeeTx() *DynamicFeeTx {
+  to := common.HexToAddress("0x3535353535353535353535353535353535353535")
+  value, _ := new(big.Int).SetString("1000000000000000000", 10)
+  return &DynamicFeeTx{
+    ChainID:    big.NewInt(1),
+    Nonce:      9,
+    GasTipCap:  big.NewInt(2000000000),
+    GasFeeCap:  big.NewInt(30000000000),
+    Gas:        21000,
+    To:         &to,
+    Value:      value,
+    AccessList: []AccessTuple{{Address: to, StorageKeys: []common.Hash{common.HexToHash("0x01")}}},
+  }
+}
+
+func TestDynamicFeeTxSign(t *testing.T) {
+  tx := testDynamicFeeTx()
+  hash, err := tx.SigHash()
+  if err != nil {
+    t.Fatal(err)
+  }
+  if hash.Hex() != testDynamicFeeSigHash {
+    t.Fatalf("SigHash %s", hash.Hex())
+  }
+  key, err := crypto.HexToECDSA(testDynamicFeeKey)
+  if err != nil {
+    t.Fatal(err)
+  }
+  sig, err := crypto.Sign(hash.Bytes(), key)
+  if err != nil {
+    t.Fatal(err)
+  }
+  if err = tx.WithSignature(sig); err != nil {
+    t.Fatal(err)
+  }
+  txHex, err := EncodeDynamicFeeTx(tx)
+  if err != nil {
+    t.Fatal(err)
+  }
+  if txHex != testDynamicFeeTxHex {
+    t.Fatalf("signed tx %s", txHex)
+  }
+  txid, err := tx.Hash()
+  if err != nil {
+    t.Fatal(err)
+  }
+  if txid.Hex() != testDynamicFeeTxid {
+    t.Fatalf("txid %s", txid.Hex())
+  }
+
+  if err = tx.WithSignature(append(sig[:64:64], 27)); err == nil {
+    t.Fatal("legacy V is accepted")
+  }
+}
+
+func TestDynamicFeeTxDecode(t *testing.T) {
+  tx, err := DecodeDynamicFeeTx(testDynamicFeeTxHex)
+  if err != nil {
+    t.Fatal(err)
+  }
+  if tx.Nonce != 9 || tx.GasFeeCap.Cmp(big.NewInt(30000000000)) != 0 || len(tx.AccessList) != 1 || len(tx.AccessList[0].StorageKeys) != 1 {
+    t.Fatalf("decoded tx %+v", tx)
+  }
+  if txHex, err := EncodeDynamicFeeTx(tx); err != nil || txHex != testDynamicFeeTxHex {
+    t.Fatalf("reencoded tx %s %v", txHex, err)
+  }
+  sender, err := tx.Sender()
+  if err != nil {
+    t.Fatal(err)
+  }
+  if sender.Hex() != testDynamicFeeSender {
+    t.Fatalf("sender %s", sender.Hex())
+  }
+
+  // high S is malleable
+  secp256k1N, _ := new(big.Int).SetString("fffffffffffffffffffffffffffffffebaaedce6af48a03bbfd25e8cd0364141", 16)
+  tx.S = new(big.Int).Sub(secp256k1N, tx.S)
+  if _, err = tx.Sender(); err == nil {
+    t.Fatal("high S signature is recovered")
+  }
+  if _, err = DecodeDynamicFeeTx("0xf86c098504a817c800825208943535353535353535353535353535353535353535880de0b6b3a76400008025a028ef61340bd939bc2195fe537567866003e1a15d3c71ff63e1590620aa636276a067cbe9d8997f761aecb703304b3800ccf555c9f3dc64214b297fb1966a3b6d83"); err == nil {
+    t.Fatal("legacy tx is decoded")
+  }
+}
+
+func TestDynamicFeeTxCreation(t *testing.T) {
+  // contract creation encodes empty to
+  tx := &DynamicFeeTx{ChainID: big.NewInt(5), GasTipCap: big.NewInt(1), GasFeeCap: big.NewInt(2), Gas: 53000, Value: big.NewInt(0), Data: []byte{0x60, 0x00}}
+  hash, err := tx.SigHash()
+  if err != nil {
+    t.Fatal(err)
+  }
+  if hash.Hex() != "0x1b438de2bc0b30ac20747d5a531c384e81cc1b78011f004417d33dec695ec556" {
+    t.Fatalf("SigHash %s", hash.Hex())
+  }
+}
+
+// testRPC json-rpc client answering calls by method
+type testRPC struct {
+  jsonrpc.RPCClient
+  responses map[string]*jsonrpc.RPCResponse
+}
+
+func (c testRPC) Call(method string, params ...interface{}) (*jsonrpc.RPCResponse, error) {
+  response, ok := c.responses[method]
+  if !ok {
+    return &jsonrpc.RPCResponse{Error: &jsonrpc.RPCError{Code: -32601, Message: "the method " + method + " does not exist/is not available"}}, nil
+  }
+  return response, nil
+}
+
+func TestDynamicFee(t *testing.T) {
+  chain := EthereumChain{RPC: testRPC{responses: map[string]*jsonrpc.RPCResponse{"eth_feeHistory": {Result: map[string]interface{}{
+    "baseFeePerGas": []string{"0x3b9aca00", "0x77359400"},
+    "reward":        [][]string{{"0x1", "0x3b9aca00", "0x77359400"}},
+  }}}}}
+  fee, err := chain.DynamicFee(EthereumPriorityFast)
+  if err != nil {
+    t.Fatal(err)
+  }
+  if fee.BaseFee.Cmp(big.NewInt(2000000000)) != 0 || fee.GasTipCap.Cmp(big.NewInt(2000000000)) != 0 || fee.GasFeeCap.Cmp(big.NewInt(6000000000)) != 0 {
+    t.Fatalf("fee %+v", fee)
+  }
+
+  // pre-London node falls back to legacy gas price
+  chain.RPC = testRPC{}
+  if fee, err = chain.DynamicFee(""); err != nil || fee != nil {
+    t.Fatalf("method not found %+v %v", fee, err)
+  }
+  chain.RPC = testRPC{responses: map[string]*jsonrpc.RPCResponse{"eth_feeHistory": {Error: &jsonrpc.RPCError{Code: -32000, Message: "request timed out"}}}}
+  if _, err = chain.DynamicFee(""); err == nil {
+    t.Fatal("node error falls back to legacy gas price")
+  }
+}
+
+func TestGasFeeQuote(t *testing.T) {
+  // funded quote keeps its gas limit over the estimate
+  chain := EthereumChain{Quote: &EthereumFee{Type: DynamicFeeTxType, Gas: 60000, GasTipCap: big.NewInt(1), GasFeeCap: big.NewInt(10)}}
+  fee, err := chain.gasFee(context.Background(), 65000)
+  if err != nil {
+    t.Fatal(err)
+  }
+  if fee.Gas != 60000 || fee.MaxFee.Cmp(big.NewInt(600000)) != 0 || chain.Quote.MaxFee != nil {
+    t.Fatalf("fee %+v", fee)
+  }
+  chain.Quote = &EthereumFee{GasPrice: big.NewInt(10)}
+  if fee, err = chain.gasFee(context.Background(), 21000); err != nil || fee.Gas != 21000 || fee.MaxFee.Cmp(big.NewInt(210000)) != 0 {
+    t.Fatalf("fee %+v %v", fee, err)
+  }
+}
+
+func TestBroadcastTxRejected(t *testing.T) {
+  cases := []struct {
+    message  string
+    rejected bool
+  }{
+    {"insufficient funds for gas * price + value", true},
+    {"max fee per gas less than block base fee", true},
+    {"already known", false},
+    {"nonce too low", false},
+    {"replacement transaction underpriced", false},
+  }
+  for _, c := range cases {
+    chain := EthereumChain{RPC: testRPC{responses: map[string]*jsonrpc.RPCResponse{"eth_sendRawTransaction": {Error: &jsonrpc.RPCError{Code: -32000, Message: c.message}}}}}
+    _, err := chain.BroadcastTx(context.Background(), testDynamicFeeTxHex)
+    if _, rejected := err.(*EthereumRejectedError); err == nil || rejected != c.rejected {
+      t.Fatalf("%s: %v", c.message, err)
+    }
+  }
+  chain := EthereumChain{RPC: testRPC{responses: map[string]*jsonrpc.RPCResponse{"eth_sendRawTransaction": {Result: testDynamicFeeTxid}}}}
+  if txid, err := chain.BroadcastTx(context.Background(), testDynamicFeeTxHex); err != nil || txid != testDynamicFeeTxid {
+    t.Fatalf("broadcast %s %v", txid, err)
+  }
+}
@@ -0,0 +1,177 @@
+package blockchain
+
+import (
+  "fmt"
+  "strings"
+  "math/big"
+  "wallet-go/pkg/configure"
+  "github.com/ethereum/go-ethereum/common"
+  "github.com/ethereum/go-ethereum/core/types"
+  "github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// erc20TransferTopic topic of Transfer(address,address,uint256) event
+var erc20TransferTopic = keccak256Hash([]byte("Transfer(address,address,uint256)"))
+
+// EthereumBlockHead height and hashes of ethereum block, queried by raw json rpc since
+// go-ethereum in use computes wrong hash of London headers
+type EthereumBlockHead struct {
+  Height     uint64 `json:"height"`
+  Hash       string `json:"hash"`
+  ParentHash string `json:"parent_hash"`
+}
+
+// EthereumTransfer ether or token transfer to an address in a block, Token is empty for ether
+type EthereumTransfer struct {
+  Asset     string
+  Token     string
+  From      string
+  To        string
+  Amount    string
+  Txid      string
+  // LogIndex log index of token transfer, transaction index of ether transfer
+  LogIndex  uint
+  // TraceAddress call path of internal ether transfer, empty for top level tx and token transfer
+  TraceAddress string
+  BlockHash string
+  Height    uint64
+}
+
+// BlockHead head of block at height, nil when the block doesn't exist yet
+func (c EthereumChain) BlockHead(height uint64) (*EthereumBlockHead, error) {
+  rpcClient := c.rpcClient()
+  response, err := rpcClient.Call("eth_getBlockByNumber", hexutil.EncodeUint64(height), false)
+  if err != nil {
+    return nil, fmt.Errorf("Query ethereum block %d %s", height, err)
+  }
+  if response.Error != nil {
+    return nil, fmt.Errorf("Query ethereum block %d %s", height, response.Error)
+  }
+  var head *struct {
+    Number     hexutil.Uint64 `json:"number"`
+    Hash       string         `json:"hash"`
+    ParentHash string         `json:"parentHash"`
+  }
+  if err = response.GetObject(&head); err != nil {
+    return nil, fmt.Errorf("Query ethereum block %d %s", height, err)
+  }
+  if head == nil {
+    return nil, nil
+  }
+  return &EthereumBlockHead{Height: uint64(head.Number), Hash: strings.ToLower(head.Hash), ParentHash: strings.ToLower(head.ParentHash)}, nil
+}
+
+// TokenTransfers Transfer events of configured ERC20 contracts in block of hash, amount is scaled by token decimals.
+// logs are queried by block hash so they can't come from a competing block at the same height
+func (c EthereumChain) TokenTransfers(head *EthereumBlockHead) ([]EthereumTransfer, error) {
+  var contracts []string
+  for _, address := range configure.ChainsInfo[Ethereum].Tokens {
+    if common.IsHexAddress(address) {
+      contracts = append(contracts, strings.ToLower(address))
+    }
+  }
+  if len(contracts) == 0 {
+    return nil, nil
+  }
+  rpcClient := c.rpcClient()
+  response, err := rpcClient.Call("eth_getLogs", map[string]interface{}{"blockHash": head.Hash, "address": contracts, "topics": [][]string{{erc20TransferTopic.Hex()}}})
+  if err != nil {
+    return nil, fmt.Errorf("Query Transfer logs of block %s %s", head.Hash, err)
+  }
+  if response.Error != nil {
+    return nil, fmt.Errorf("Query Transfer logs of block %s %s", head.Hash, response.Error)
+  }
+  var logs []types.Log
+  if err = response.GetObject(&logs); err != nil {
+    return nil, fmt.Errorf("Query Transfer logs of block %s %s", head.Hash, err)
+  }
+
+  var transfers []EthereumTransfer
+  for _, log := range logs {
+    // ERC721 Transfer shares the topic with tokenId indexed, ERC20 amount is in data
+    if log.Removed || len(log.Topics) != 3 || len(log.Data) != 32 {
+      continue
+    }
+    asset := EthereumTokenAsset(log.Address)
+    if asset == "" {
+      continue
+    }
+    token, err := c.Token(asset)
+    if err != nil {
+      return nil, err
+    }
+    transfers = append(transfers, EthereumTransfer{
+      Asset: asset,
+      Token: strings.ToLower(log.Address.Hex()),
+      From: strings.ToLower(common.BytesToAddress(log.Topics[1].Bytes()).Hex()),
+      To: strings.ToLower(common.BytesToAddress(log.Topics[2].Bytes()).Hex()),
+      Amount: token.FromBaseUnits(new(big.Int).SetBytes(log.Data)),
+      Txid: log.TxHash.Hex(),
+      LogIndex: log.Index,
+      BlockHash: head.Hash,
+      Height: head.Height,
+    })
+  }
+  return transfers, nil
+}
+
+// ethereumBlockTx transaction of eth_getBlockByHash with full txs
+type ethereumBlockTx struct {
+  Hash             string         `json:"hash"`
+  From             string         `json:"from"`
+  To               *string        `json:"to"`
+  Value            *hexutil.Big   `json:"value"`
+  TransactionIndex hexutil.Uint64 `json:"transactionIndex"`
+}
+
+// blockTxs transactions of block of head in block order
+func (c EthereumChain) blockTxs(head *EthereumBlockHead) ([]ethereumBlockTx, error) {
+  rpcClient := c.rpcClient()
+  response, err := rpcClient.Call("eth_getBlockByHash", head.Hash, true)
+  if err != nil {
+    return nil, fmt.Errorf("Query ethereum block %s %s", head.Hash, err)
+  }
+  if response.Error != nil {
+    return nil, fmt.Errorf("Query ethereum block %s %s", head.Hash, response.Error)
+  }
+  var block *struct {
+    Transactions []ethereumBlockTx `json:"transactions"`
+  }
+  if err = response.GetObject(&block); err != nil {
+    return nil, fmt.Errorf("Query ethereum block %s %s", head.Hash, err)
+  }
+  if block == nil {
+    return nil, fmt.Errorf("Ethereum block %s not found", head.Hash)
+  }
+  return block.Transactions, nil
+}
+
+// EtherTransfers ether paid by txs of block of head, contract creation and zero value txs are skipped.
+// LogIndex of ether transfer is its transaction index, receipts aren't checked here
+func (c EthereumChain) EtherTransfers(head *EthereumBlockHead) ([]EthereumTransfer, error) {
+  txs, err := c.blockTxs(head)
+  if err != nil {
+    return nil, err
+  }
+  ether, err := c.Token(configure.ChainsInfo[Ethereum].Coin)
+  if err != nil {
+    return nil, err
+  }
+  var transfers []EthereumTransfer
+  for _, tx := range txs {
+    if tx.To == nil || tx.Value == nil || tx.Value.ToInt().Sign() == 0 {
+      continue
+    }
+    transfers = append(transfers, EthereumTransfer{
+      Asset: ether.Asset,
+      From: strings.ToLower(tx.From),
+      To: strings.ToLower(*tx.To),
+      Amount: ether.FromBaseUnits(tx.Value.ToInt()),
+      Txid: strings.ToLower(tx.Hash),
+      LogIndex: uint(tx.TransactionIndex),
+      BlockHash: head.Hash,
+      Height: head.Height,
+    })
+  }
+  return transfers, nil
+}
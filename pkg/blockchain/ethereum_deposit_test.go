@@ -0,0 +1,139 @@
+package blockchain
+
+import (
+  "testing"
+  "wallet-go/pkg/configure"
+  "github.com/ybbus/jsonrpc"
+)
+
+const (
+  testTokenContract = "0xdac17f958d2ee523a2206206994597c13d831ec7"
+  testDepositFrom   = "0x2c7536e3605d9c16a7a3d7b1898e529396a65c23"
+  testDepositTo     = "0x3535353535353535353535353535353535353535"
+  testBlockHash     = "0x8f5bab218b6bb34476f51ca588e9f4553a3a7ce5e13a66c660a5283e97e9a85a"
+)
+
+// testTopic address as indexed topic
+func testTopic(address string) string {
+  return "0x000000000000000000000000" + address[2:]
+}
+
+// testLog eth_getLogs entry of Transfer event
+func testLog(contract string, topics []string, data string, index string, removed bool) map[string]interface{} {
+  return map[string]interface{}{
+    "address":          contract,
+    "topics":           topics,
+    "data":             data,
+    "blockNumber":      "0x64",
+    "blockHash":        testBlockHash,
+    "transactionHash":  "0xf31c785a6f2c15efed24acd47ef335ac1eb52bc5929dc3595cff7954756b0c87",
+    "transactionIndex": "0x0",
+    "logIndex":         index,
+    "removed":          removed,
+  }
+}
+
+func TestTokenTransfers(t *testing.T) {
+  testChainInfo(t, Ethereum, configure.ChainInfo{Coin: "eth", Tokens: map[string]string{"usdt": testTokenContract}, TokenDecimals: map[string]int32{"usdt": 6}})
+  head := &EthereumBlockHead{Height: 100, Hash: testBlockHash}
+  transfer := erc20TransferTopic.Hex()
+  amount := "0x00000000000000000000000000000000000000000000000000000000004c4b40"
+
+  cases := []struct {
+    name   string
+    log    map[string]interface{}
+    amount string
+  }{
+    {"erc20", testLog(testTokenContract, []string{transfer, testTopic(testDepositFrom), testTopic(testDepositTo)}, amount, "0x10", false), "5"},
+    // tokenId of ERC721 is the 4th topic and data is empty
+    {"erc721", testLog(testTokenContract, []string{transfer, testTopic(testDepositFrom), testTopic(testDepositTo), amount}, "0x", "0x11", false), ""},
+    {"removed", testLog(testTokenContract, []string{transfer, testTopic(testDepositFrom), testTopic(testDepositTo)}, amount, "0x12", true), ""},
+    {"unconfigured token", testLog(testDepositTo, []string{transfer, testTopic(testDepositFrom), testTopic(testDepositTo)}, amount, "0x13", false), ""},
+  }
+  for _, c := range cases {
+    chain := EthereumChain{RPC: testRPC{responses: map[string]*jsonrpc.RPCResponse{"eth_getLogs": {Result: []interface{}{c.log}}}}}
+    transfers, err := chain.TokenTransfers(head)
+    if err != nil {
+      t.Fatalf("%s: %v", c.name, err)
+    }
+    if c.amount == "" {
+      if len(transfers) != 0 {
+        t.Fatalf("%s: transfers %+v", c.name, transfers)
+      }
+      continue
+    }
+    if len(transfers) != 1 {
+      t.Fatalf("%s: transfers %+v", c.name, transfers)
+    }
+    got := transfers[0]
+    if got.Asset != "usdt" || got.Token != testTokenContract || got.From != testDepositFrom || got.To != testDepositTo || got.Amount != c.amount || got.Txid != "0xf31c785a6f2c15efed24acd47ef335ac1eb52bc5929dc3595cff7954756b0c87" || got.LogIndex != 16 || got.BlockHash != testBlockHash || got.Height != 100 {
+      t.Fatalf("%s: transfer %+v", c.name, got)
+    }
+  }
+
+  chain := EthereumChain{RPC: testRPC{responses: map[string]*jsonrpc.RPCResponse{"eth_getLogs": {Error: &jsonrpc.RPCError{Code: -32000, Message: "request timed out"}}}}}
+  if _, err := chain.TokenTransfers(head); err == nil {
+    t.Fatal("node error is ignored")
+  }
+}
+
+func TestEtherTransfers(t *testing.T) {
+  testChainInfo(t, Ethereum, configure.ChainInfo{Coin: "eth"})
+  head := &EthereumBlockHead{Height: 100, Hash: testBlockHash}
+  txid := "0xF31C785A6F2C15EFED24ACD47EF335AC1EB52BC5929DC3595CFF7954756B0C87"
+  tx := func(to interface{}, value string, index string) map[string]interface{} {
+    return map[string]interface{}{"hash": txid, "from": "0x2C7536E3605D9C16a7a3D7b1898e529396a65c23", "to": to, "value": value, "transactionIndex": index}
+  }
+
+  cases := []struct {
+    name   string
+    tx     map[string]interface{}
+    amount string
+  }{
+    {"transfer", tx(testDepositTo, "0xde0b6b3a7640000", "0x2"), "1"},
+    {"contract creation", tx(nil, "0xde0b6b3a7640000", "0x2"), ""},
+    {"zero value", tx(testDepositTo, "0x0", "0x2"), ""},
+  }
+  for _, c := range cases {
+    chain := EthereumChain{RPC: testRPC{responses: map[string]*jsonrpc.RPCResponse{"eth_getBlockByHash": {Result: map[string]interface{}{"transactions": []interface{}{c.tx}}}}}}
+    transfers, err := chain.EtherTransfers(head)
+    if err != nil {
+      t.Fatalf("%s: %v", c.name, err)
+    }
+    if c.amount == "" {
+      if len(transfers) != 0 {
+        t.Fatalf("%s: transfers %+v", c.name, transfers)
+      }
+      continue
+    }
+    if len(transfers) != 1 {
+      t.Fatalf("%s: transfers %+v", c.name, transfers)
+    }
+    got := transfers[0]
+    if got.Asset != "eth" || got.Token != "" || got.From != testDepositFrom || got.To != testDepositTo || got.Amount != c.amount || got.Txid != "0xf31c785a6f2c15efed24acd47ef335ac1eb52bc5929dc3595cff7954756b0c87" || got.LogIndex != 2 || got.Height != 100 {
+      t.Fatalf("%s: transfer %+v", c.name, got)
+    }
+  }
+
+  // block replaced after its head is queried
+  chain := EthereumChain{RPC: testRPC{responses: map[string]*jsonrpc.RPCResponse{"eth_getBlockByHash": {}}}}
+  if _, err := chain.EtherTransfers(head); err == nil {
+    t.Fatal("missing block is ignored")
+  }
+}
+
+func TestBlockHead(t *testing.T) {
+  chain := EthereumChain{RPC: testRPC{responses: map[string]*jsonrpc.RPCResponse{"eth_getBlockByNumber": {Result: map[string]interface{}{"number": "0x64", "hash": "0x8F5BAB218B6BB34476F51CA588E9F4553A3A7CE5E13A66C660A5283E97E9A85A", "parentHash": "0x01"}}}}}
+  head, err := chain.BlockHead(100)
+  if err != nil {
+    t.Fatal(err)
+  }
+  if head.Height != 100 || head.Hash != testBlockHash || head.ParentHash != "0x01" {
+    t.Fatalf("head %+v", head)
+  }
+  // block above best height
+  chain.RPC = testRPC{responses: map[string]*jsonrpc.RPCResponse{"eth_getBlockByNumber": {}}}
+  if head, err = chain.BlockHead(101); err != nil || head != nil {
+    t.Fatalf("future block %+v %v", head, err)
+  }
+}
@@ -0,0 +1,156 @@
+package blockchain
+
+import (
+  "fmt"
+  "strings"
+  "math/big"
+  "github.com/ethereum/go-ethereum/common"
+  "github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// ethereumReplacementBump percent of the replaced tip and fee cap a replacement must pay, geth txpool price bump is 10%
+const ethereumReplacementBump = 110
+
+// EthereumPendingTx unconfirmed tx in node txpool, Fee holds its gas price or fee caps
+type EthereumPendingTx struct {
+  Hash  string
+  From  string
+  Nonce uint64
+  Fee   *EthereumFee
+}
+
+// ethereumRPCTx eth_getTransactionByHash result
+type ethereumRPCTx struct {
+  Hash                 string          `json:"hash"`
+  From                 string          `json:"from"`
+  Nonce                hexutil.Uint64  `json:"nonce"`
+  Type                 *hexutil.Uint64 `json:"type"`
+  Gas                  hexutil.Uint64  `json:"gas"`
+  GasPrice             *hexutil.Big    `json:"gasPrice"`
+  MaxFeePerGas         *hexutil.Big    `json:"maxFeePerGas"`
+  MaxPriorityFeePerGas *hexutil.Big    `json:"maxPriorityFeePerGas"`
+  BlockNumber          *hexutil.Big    `json:"blockNumber"`
+}
+
+// PendingTx unconfirmed tx of txid, queried by raw json rpc since ethclient can't decode dynamic fee tx
+func (c EthereumChain) PendingTx(txid string) (*EthereumPendingTx, error) {
+  rpcClient := c.rpcClient()
+  response, err := rpcClient.Call("eth_getTransactionByHash", txid)
+  if err != nil {
+    return nil, fmt.Errorf("Query %s %s", txid, err)
+  }
+  if response.Error != nil {
+    return nil, fmt.Errorf("Query %s %s", txid, response.Error)
+  }
+  var tx *ethereumRPCTx
+  if err = response.GetObject(&tx); err != nil {
+    return nil, fmt.Errorf("Query %s %s", txid, err)
+  }
+  if tx == nil {
+    return nil, fmt.Errorf("%s isn't in txpool", txid)
+  }
+  if tx.BlockNumber != nil {
+    return nil, fmt.Errorf("%s is already mined in block %s", txid, tx.BlockNumber.ToInt().String())
+  }
+
+  fee := &EthereumFee{Gas: uint64(tx.Gas)}
+  if tx.Type != nil && uint64(*tx.Type) == DynamicFeeTxType {
+    if tx.MaxFeePerGas == nil || tx.MaxPriorityFeePerGas == nil {
+      return nil, fmt.Errorf("%s lacks fee caps", txid)
+    }
+    fee.Type = DynamicFeeTxType
+    fee.GasTipCap = tx.MaxPriorityFeePerGas.ToInt()
+    fee.GasFeeCap = tx.MaxFeePerGas.ToInt()
+  }else {
+    if tx.GasPrice == nil {
+      return nil, fmt.Errorf("%s lacks gas price", txid)
+    }
+    fee.GasPrice = tx.GasPrice.ToInt()
+  }
+  return &EthereumPendingTx{Hash: tx.Hash, From: strings.ToLower(tx.From), Nonce: uint64(tx.Nonce), Fee: fee}, nil
+}
+
+// ethereumRPCReceipt eth_getTransactionReceipt fields of paid fee, effectiveGasPrice is missing before London
+type ethereumRPCReceipt struct {
+  GasUsed           hexutil.Uint64 `json:"gasUsed"`
+  EffectiveGasPrice *hexutil.Big   `json:"effectiveGasPrice"`
+}
+
+// PaidFee fee in wei paid by mined tx, gas used times effective gas price, which is the gas price of tx mined before London
+func (c EthereumChain) PaidFee(txid string) (*big.Int, error) {
+  rpcClient := c.rpcClient()
+  response, err := rpcClient.Call("eth_getTransactionReceipt", txid)
+  if err != nil {
+    return nil, fmt.Errorf("Receipt of %s %s", txid, err)
+  }
+  if response.Error != nil {
+    return nil, fmt.Errorf("Receipt of %s %s", txid, response.Error)
+  }
+  var receipt *ethereumRPCReceipt
+  if err = response.GetObject(&receipt); err != nil {
+    return nil, fmt.Errorf("Receipt of %s %s", txid, err)
+  }
+  if receipt == nil {
+    return nil, fmt.Errorf("%s isn't mined", txid)
+  }
+  price := receipt.EffectiveGasPrice
+  if price == nil {
+    response, err = rpcClient.Call("eth_getTransactionByHash", txid)
+    if err != nil {
+      return nil, fmt.Errorf("Query %s %s", txid, err)
+    }
+    if response.Error != nil {
+      return nil, fmt.Errorf("Query %s %s", txid, response.Error)
+    }
+    var tx *ethereumRPCTx
+    if err = response.GetObject(&tx); err != nil {
+      return nil, fmt.Errorf("Query %s %s", txid, err)
+    }
+    if tx == nil || tx.GasPrice == nil {
+      return nil, fmt.Errorf("%s lacks gas price", txid)
+    }
+    price = tx.GasPrice
+  }
+  return new(big.Int).Mul(new(big.Int).SetUint64(uint64(receipt.GasUsed)), price.ToInt()), nil
+}
+
+// bumpEthereumFee raise fee to replace pending tx of replaced fee: tip and fee cap are at least 10% above the replaced ones,
+// gas price of legacy tx counts as both
+func bumpEthereumFee(fee, replaced *EthereumFee) {
+  replacedTip, replacedCap := replaced.GasPrice, replaced.GasPrice
+  if replaced.Type == DynamicFeeTxType {
+    replacedTip, replacedCap = replaced.GasTipCap, replaced.GasFeeCap
+  }
+  minTip, minCap := bumpedPrice(replacedTip), bumpedPrice(replacedCap)
+
+  if fee.Type == DynamicFeeTxType {
+    if fee.GasTipCap.Cmp(minTip) < 0 {
+      fee.GasTipCap = minTip
+    }
+    if fee.GasFeeCap.Cmp(minCap) < 0 {
+      fee.GasFeeCap = minCap
+    }
+    if fee.GasFeeCap.Cmp(fee.GasTipCap) < 0 {
+      fee.GasFeeCap = new(big.Int).Set(fee.GasTipCap)
+    }
+    return
+  }
+  if fee.GasPrice.Cmp(minCap) < 0 {
+    fee.GasPrice = minCap
+  }
+}
+
+// bumpedPrice price * 110% rounded up
+func bumpedPrice(price *big.Int) *big.Int {
+  bumped := new(big.Int).Mul(price, big.NewInt(ethereumReplacementBump))
+  bumped.Add(bumped, big.NewInt(99))
+  return bumped.Div(bumped, big.NewInt(100))
+}
+
+// validReplacement replacement tx must be sent from address of the replaced one
+func (p *EthereumPendingTx) validReplacement(from string) error {
+  if !strings.EqualFold(p.From, common.HexToAddress(from).Hex()) {
+    return fmt.Errorf("%s is sent from %s rather than %s", p.Hash, p.From, from)
+  }
+  return nil
+}
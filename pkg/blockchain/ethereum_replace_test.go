@@ -0,0 +1,36 @@
+package blockchain
+
+import (
+  "testing"
+  "math/big"
+  "github.com/ybbus/jsonrpc"
+)
+
+func TestPaidFee(t *testing.T) {
+  txid := "0xf31c785a6f2c15efed24acd47ef335ac1eb52bc5929dc3595cff7954756b0c87"
+  // London receipt carries effective gas price
+  chain := EthereumChain{RPC: testRPC{responses: map[string]*jsonrpc.RPCResponse{
+    "eth_getTransactionReceipt": {Result: map[string]interface{}{"gasUsed": "0x5208", "effectiveGasPrice": "0x77359400"}},
+  }}}
+  fee, err := chain.PaidFee(txid)
+  if err != nil {
+    t.Fatal(err)
+  }
+  if fee.Cmp(big.NewInt(21000 * 2000000000)) != 0 {
+    t.Fatalf("paid fee %s", fee)
+  }
+
+  // gas price of tx mined before London
+  chain.RPC = testRPC{responses: map[string]*jsonrpc.RPCResponse{
+    "eth_getTransactionReceipt": {Result: map[string]interface{}{"gasUsed": "0x5208"}},
+    "eth_getTransactionByHash":  {Result: map[string]interface{}{"hash": txid, "gasPrice": "0x3b9aca00"}},
+  }}
+  if fee, err = chain.PaidFee(txid); err != nil || fee.Cmp(big.NewInt(21000 * 1000000000)) != 0 {
+    t.Fatalf("legacy paid fee %s %v", fee, err)
+  }
+
+  chain.RPC = testRPC{responses: map[string]*jsonrpc.RPCResponse{"eth_getTransactionReceipt": {}}}
+  if _, err = chain.PaidFee(txid); err == nil {
+    t.Fatal("fee of pending tx")
+  }
+}
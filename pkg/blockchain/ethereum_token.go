@@ -0,0 +1,132 @@
+package blockchain
+
+import (
+  "fmt"
+  "sort"
+  "sync"
+  "strings"
+  "math/big"
+  "wallet-go/pkg/configure"
+  "github.com/shopspring/decimal"
+  "github.com/ethereum/go-ethereum/accounts/abi"
+  "github.com/ethereum/go-ethereum/accounts/abi/bind"
+  "github.com/ethereum/go-ethereum/common"
+)
+
+// etherDecimals wei per ether is 10^18
+const etherDecimals = 18
+
+// erc20MetadataABI optional ERC20 metadata methods, EthTokenABI binding lacks them
+const erc20MetadataABI = `[{"constant":true,"inputs":[],"name":"decimals","outputs":[{"name":"","type":"uint8"}],"payable":false,"stateMutability":"view","type":"function"},{"constant":true,"inputs":[],"name":"symbol","outputs":[{"name":"","type":"string"}],"payable":false,"stateMutability":"view","type":"function"}]`
+
+// EthereumToken metadata of ether or ERC20 asset, Address is empty for ether
+type EthereumToken struct {
+  Asset    string
+  Address  common.Address
+  Symbol   string
+  Decimals int32
+}
+
+// ethereumTokens token metadata queried from contracts, by asset
+var ethereumTokens = struct {
+  sync.Mutex
+  tokens map[string]*EthereumToken
+}{tokens: make(map[string]*EthereumToken)}
+
+// Token metadata of ethereum asset, configured decimals take precedence over the contract,
+// which is queried once when client is available
+func (c EthereumChain) Token(asset string) (*EthereumToken, error) {
+  asset = strings.ToLower(asset)
+  info := configure.ChainsInfo[Ethereum]
+  if asset == strings.ToLower(info.Coin) {
+    return &EthereumToken{Asset: asset, Symbol: info.Coin, Decimals: etherDecimals}, nil
+  }
+  contract := info.Tokens[asset]
+  if contract == "" || !common.IsHexAddress(contract) {
+    return nil, fmt.Errorf("Token not implement yet: %s", asset)
+  }
+  if decimals, ok := info.TokenDecimals[asset]; ok {
+    return &EthereumToken{Asset: asset, Address: common.HexToAddress(contract), Symbol: strings.ToUpper(asset), Decimals: decimals}, nil
+  }
+
+  ethereumTokens.Lock()
+  defer ethereumTokens.Unlock()
+  if token, ok := ethereumTokens.tokens[asset]; ok {
+    return token, nil
+  }
+  if c.Client == nil {
+    return nil, fmt.Errorf("decimals of %s isn't configured, it can't be queried without node client", asset)
+  }
+  parsed, err := abi.JSON(strings.NewReader(erc20MetadataABI))
+  if err != nil {
+    return nil, err
+  }
+  token := &EthereumToken{Asset: asset, Address: common.HexToAddress(contract)}
+  metadata := bind.NewBoundContract(token.Address, parsed, c.Client, nil, nil)
+  var decimals uint8
+  if err = metadata.Call(&bind.CallOpts{}, &decimals, "decimals"); err != nil {
+    return nil, fmt.Errorf("Query decimals of %s %s, configure it when the token lacks decimals()", asset, err)
+  }
+  token.Decimals = int32(decimals)
+  // symbol is optional, some tokens return bytes32
+  if err = metadata.Call(&bind.CallOpts{}, &token.Symbol, "symbol"); err != nil {
+    token.Symbol = strings.ToUpper(asset)
+  }
+  ethereumTokens.tokens[asset] = token
+  return token, nil
+}
+
+// EthereumTokensWithoutDecimals token assets whose decimals aren't configured, wallet_core can't query them from contracts
+func EthereumTokensWithoutDecimals() []string {
+  info := configure.ChainsInfo[Ethereum]
+  var assets []string
+  for asset := range info.Tokens {
+    if _, ok := info.TokenDecimals[asset]; !ok {
+      assets = append(assets, asset)
+    }
+  }
+  sort.Strings(assets)
+  return assets
+}
+
+// EthereumTokenAsset asset of ERC20 contract address, empty when it isn't configured
+func EthereumTokenAsset(contract common.Address) string {
+  for asset, address := range configure.ChainsInfo[Ethereum].Tokens {
+    if common.IsHexAddress(address) && common.HexToAddress(address) == contract {
+      return strings.ToLower(asset)
+    }
+  }
+  return ""
+}
+
+// ToBaseUnits amount of token in its smallest unit, amount must be positive, amount with more fractional digits than decimals is refused
+func (t *EthereumToken) ToBaseUnits(amount string) (*big.Int, error) {
+  return t.toBaseUnits(amount, false)
+}
+
+// toBaseUnits amount of token in its smallest unit, zero is only allowed for cancel
+func (t *EthereumToken) toBaseUnits(amount string, cancel bool) (*big.Int, error) {
+  amountDecimal, err := decimal.NewFromString(amount)
+  if err != nil {
+    return nil, err
+  }
+  if amountDecimal.Sign() < 0 || (amountDecimal.Sign() == 0 && !cancel) {
+    return nil, fmt.Errorf("%s %s must be positive", amount, t.Asset)
+  }
+  units := amountDecimal.Shift(t.Decimals)
+  value, ok := new(big.Int).SetString(units.String(), 10)
+  if !ok {
+    return nil, fmt.Errorf("%s %s has more than %d decimals", amount, t.Asset, t.Decimals)
+  }
+  return value, nil
+}
+
+// isCancel whether transfer of the token from, to is cancel of pending tx, which pays 0 ether to sender itself
+func (t *EthereumToken) isCancel(from, to string) bool {
+  return t.Address == (common.Address{}) && strings.EqualFold(from, to)
+}
+
+// FromBaseUnits amount of token in smallest unit to decimal string
+func (t *EthereumToken) FromBaseUnits(units *big.Int) string {
+  return decimal.NewFromBigInt(units, -t.Decimals).String()
+}
@@ -0,0 +1,114 @@
+package blockchain
+
+import (
+  "fmt"
+  "errors"
+  "strconv"
+  "strings"
+  "wallet-go/pkg/configure"
+  "github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// ErrTraceUnavailable node doesn't serve debug_traceBlockByNumber, debug api isn't enabled
+var ErrTraceUnavailable = errors.New("Ethereum call tracing is unavailable")
+
+// callFrame callTracer frame, Error is set when the call and its subcalls are reverted
+type callFrame struct {
+  Type  string       `json:"type"`
+  From  string       `json:"from"`
+  To    string       `json:"to"`
+  Value *hexutil.Big `json:"value"`
+  Error string       `json:"error"`
+  Calls []callFrame  `json:"calls"`
+}
+
+// InternalTransfers ether paid by internal calls of txs in block of head, traced by callTracer.
+// top level calls are left to EtherTransfers, reverted calls and txs are skipped.
+// LogIndex is transaction index and TraceAddress the call path like 0,1. ErrTraceUnavailable is returned only when
+// the method isn't served, other errors of node, e.g. timeout or missing state, fail the block
+func (c EthereumChain) InternalTransfers(head *EthereumBlockHead) ([]EthereumTransfer, error) {
+  rpcClient := c.rpcClient()
+  response, err := rpcClient.Call("debug_traceBlockByNumber", hexutil.EncodeUint64(head.Height), map[string]string{"tracer": "callTracer"})
+  if err != nil {
+    return nil, fmt.Errorf("Trace ethereum block %d %s", head.Height, err)
+  }
+  if isMethodNotFound(response.Error) {
+    configure.Sugar.Warn("debug_traceBlockByNumber ", head.Height, " ", response.Error.Error())
+    return nil, ErrTraceUnavailable
+  }
+  if response.Error != nil {
+    return nil, fmt.Errorf("Trace ethereum block %d %s", head.Height, response.Error)
+  }
+  var traces []struct {
+    TxHash string     `json:"txHash"`
+    Result *callFrame `json:"result"`
+    Error  string     `json:"error"`
+  }
+  if err = response.GetObject(&traces); err != nil {
+    return nil, fmt.Errorf("Trace ethereum block %d %s", head.Height, err)
+  }
+  // trace is by number, the block mustn't be replaced meanwhile
+  current, err := c.BlockHead(head.Height)
+  if err != nil {
+    return nil, err
+  }
+  if current == nil || current.Hash != head.Hash {
+    return nil, fmt.Errorf("Ethereum block %d isn't %s any more", head.Height, head.Hash)
+  }
+
+  // older nodes don't report txHash, traces are in block order
+  txs, err := c.blockTxs(head)
+  if err != nil {
+    return nil, err
+  }
+  if len(txs) != len(traces) {
+    return nil, fmt.Errorf("Ethereum block %s has %d txs but %d traces", head.Hash, len(txs), len(traces))
+  }
+  ether, err := c.Token(configure.ChainsInfo[Ethereum].Coin)
+  if err != nil {
+    return nil, err
+  }
+
+  var transfers []EthereumTransfer
+  for i, trace := range traces {
+    if trace.Error != "" {
+      return nil, fmt.Errorf("Trace %s %s", txs[i].Hash, trace.Error)
+    }
+    if trace.Result == nil || trace.Result.Error != "" {
+      continue
+    }
+    walkCallFrame(trace.Result, "", func(frame *callFrame, traceAddress string) {
+      transfers = append(transfers, EthereumTransfer{
+        Asset: ether.Asset,
+        From: strings.ToLower(frame.From),
+        To: strings.ToLower(frame.To),
+        Amount: ether.FromBaseUnits(frame.Value.ToInt()),
+        Txid: strings.ToLower(txs[i].Hash),
+        LogIndex: uint(txs[i].TransactionIndex),
+        TraceAddress: traceAddress,
+        BlockHash: head.Hash,
+        Height: head.Height,
+      })
+    })
+  }
+  return transfers, nil
+}
+
+// walkCallFrame visit subcalls of frame which move ether to another account, reverted subtrees are skipped.
+// DELEGATECALL and CALLCODE run in the caller so their value doesn't move
+func walkCallFrame(frame *callFrame, traceAddress string, visit func(*callFrame, string)) {
+  for i := range frame.Calls {
+    call := &frame.Calls[i]
+    if call.Error != "" {
+      continue
+    }
+    address := strings.TrimPrefix(traceAddress + "," + strconv.Itoa(i), ",")
+    switch strings.ToUpper(call.Type) {
+    case "CALL", "SELFDESTRUCT":
+      if call.To != "" && call.Value != nil && call.Value.ToInt().Sign() > 0 {
+        visit(call, address)
+      }
+    }
+    walkCallFrame(call, address, visit)
+  }
+}
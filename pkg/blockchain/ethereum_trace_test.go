@@ -0,0 +1,116 @@
+package blockchain
+
+import (
+  "strings"
+  "testing"
+  "encoding/json"
+  "wallet-go/pkg/configure"
+  "github.com/ybbus/jsonrpc"
+)
+
+func TestInternalTransfersUnavailable(t *testing.T) {
+  head := &EthereumBlockHead{Height: 100, Hash: "0x01"}
+  // node without debug api doesn't know the method
+  chain := EthereumChain{RPC: testRPC{}}
+  if _, err := chain.InternalTransfers(head); err != ErrTraceUnavailable {
+    t.Fatalf("method not found %v", err)
+  }
+  // missing state of pruned node or timeout is retried, not fallen back
+  chain.RPC = testRPC{responses: map[string]*jsonrpc.RPCResponse{"debug_traceBlockByNumber": {Error: &jsonrpc.RPCError{Code: -32000, Message: "required historical state unavailable"}}}}
+  if _, err := chain.InternalTransfers(head); err == nil || err == ErrTraceUnavailable {
+    t.Fatalf("node error %v", err)
+  }
+}
+
+// testCallFrame callTracer frame of json
+func testCallFrame(t *testing.T, frame string) *callFrame {
+  var result callFrame
+  if err := json.Unmarshal([]byte(frame), &result); err != nil {
+    t.Fatal(err)
+  }
+  return &result
+}
+
+func TestWalkCallFrame(t *testing.T) {
+  cases := []struct {
+    name  string
+    frame string
+    want  []string
+  }{
+    {"nested calls", `{"type": "CALL", "calls": [
+      {"type": "CALL", "to": "0xa", "value": "0x1"},
+      {"type": "CALL", "to": "0xb", "value": "0x0", "calls": [{"type": "CALL", "to": "0xc", "value": "0x2"}]}
+    ]}`, []string{"0:0xa:1", "1,0:0xc:2"}},
+    // reverted subcall and everything below it don't move ether
+    {"reverted subtree", `{"type": "CALL", "calls": [
+      {"type": "CALL", "to": "0xa", "value": "0x1", "error": "execution reverted", "calls": [{"type": "CALL", "to": "0xb", "value": "0x2"}]},
+      {"type": "CALL", "to": "0xc", "value": "0x3"}
+    ]}`, []string{"1:0xc:3"}},
+    // value of delegatecall belongs to the caller, its own subcalls still move ether
+    {"delegatecall", `{"type": "CALL", "calls": [
+      {"type": "DELEGATECALL", "to": "0xa", "value": "0x1", "calls": [{"type": "CALL", "to": "0xb", "value": "0x2"}]},
+      {"type": "CALLCODE", "to": "0xc", "value": "0x3"},
+      {"type": "STATICCALL", "to": "0xd"}
+    ]}`, []string{"0,0:0xb:2"}},
+    {"selfdestruct and create", `{"type": "CALL", "calls": [
+      {"type": "SELFDESTRUCT", "to": "0xa", "value": "0x4"},
+      {"type": "CREATE", "to": "0xb", "value": "0x5"}
+    ]}`, []string{"0:0xa:4"}},
+  }
+  for _, c := range cases {
+    var got []string
+    walkCallFrame(testCallFrame(t, c.frame), "", func(frame *callFrame, traceAddress string) {
+      got = append(got, traceAddress + ":" + frame.To + ":" + frame.Value.ToInt().String())
+    })
+    if strings.Join(got, " ") != strings.Join(c.want, " ") {
+      t.Fatalf("%s: %v", c.name, got)
+    }
+  }
+}
+
+func TestInternalTransfers(t *testing.T) {
+  testChainInfo(t, Ethereum, configure.ChainInfo{Coin: "eth"})
+  head := &EthereumBlockHead{Height: 100, Hash: "0x01"}
+  txs := []interface{}{
+    map[string]interface{}{"hash": "0xAA", "transactionIndex": "0x0"},
+    map[string]interface{}{"hash": "0xbb", "transactionIndex": "0x1"},
+  }
+  traces := []interface{}{
+    map[string]interface{}{"result": map[string]interface{}{"type": "CALL", "from": "0x1", "to": "0x2", "value": "0x5", "calls": []interface{}{
+      map[string]interface{}{"type": "CALL", "from": "0x2", "to": "0x3", "value": "0xde0b6b3a7640000"},
+    }}},
+    // subcalls of reverted tx are reverted
+    map[string]interface{}{"result": map[string]interface{}{"type": "CALL", "from": "0x1", "to": "0x2", "error": "execution reverted", "calls": []interface{}{
+      map[string]interface{}{"type": "CALL", "from": "0x2", "to": "0x4", "value": "0x1"},
+    }}},
+  }
+  responses := map[string]*jsonrpc.RPCResponse{
+    "debug_traceBlockByNumber": {Result: traces},
+    "eth_getBlockByNumber":     {Result: map[string]interface{}{"number": "0x64", "hash": "0x01", "parentHash": "0x00"}},
+    "eth_getBlockByHash":       {Result: map[string]interface{}{"transactions": txs}},
+  }
+  chain := EthereumChain{RPC: testRPC{responses: responses}}
+  transfers, err := chain.InternalTransfers(head)
+  if err != nil {
+    t.Fatal(err)
+  }
+  // top level value is left to EtherTransfers
+  if len(transfers) != 1 {
+    t.Fatalf("transfers %+v", transfers)
+  }
+  got := transfers[0]
+  if got.Asset != "eth" || got.From != "0x2" || got.To != "0x3" || got.Amount != "1" || got.Txid != "0xaa" || got.LogIndex != 0 || got.TraceAddress != "0" || got.BlockHash != "0x01" {
+    t.Fatalf("transfer %+v", got)
+  }
+
+  // block replaced between tracing and head query
+  responses["eth_getBlockByNumber"] = &jsonrpc.RPCResponse{Result: map[string]interface{}{"number": "0x64", "hash": "0x02", "parentHash": "0x00"}}
+  if _, err = chain.InternalTransfers(head); err == nil {
+    t.Fatal("trace of replaced block")
+  }
+  responses["eth_getBlockByNumber"] = &jsonrpc.RPCResponse{Result: map[string]interface{}{"number": "0x64", "hash": "0x01", "parentHash": "0x00"}}
+  responses["eth_getBlockByHash"] = &jsonrpc.RPCResponse{Result: map[string]interface{}{"transactions": txs[:1]}}
+  if _, err = chain.InternalTransfers(head); err == nil {
+    t.Fatal("traces don't match txs")
+  }
+}
@@ -3,20 +3,43 @@ package blockchain
 import (
   "fmt"
   "strings"
+  "sync"
   "context"
-  "reflect"
   "math/big"
   "github.com/ybbus/jsonrpc"
   "wallet-go/pkg/util"
   "wallet-go/pkg/configure"
   "github.com/shopspring/decimal"
   "github.com/ethereum/go-ethereum"
+  "github.com/ethereum/go-ethereum/rpc"
   "github.com/ethereum/go-ethereum/common"
-  "github.com/ethereum/go-ethereum/crypto"
   "github.com/ethereum/go-ethereum/core/types"
-  "github.com/ethereum/go-ethereum/crypto/sha3"
 )
 
+// jsonrpcMethodNotFound JSON-RPC 2.0 error code of method the node doesn't serve
+const jsonrpcMethodNotFound = -32601
+
+var (
+  ethereumRPC     jsonrpc.RPCClient
+  ethereumRPCOnce sync.Once
+)
+
+// rpcClient json-rpc client of the chain, RPC or the one shared client of EthRPC
+func (c EthereumChain) rpcClient() jsonrpc.RPCClient {
+  if c.RPC != nil {
+    return c.RPC
+  }
+  ethereumRPCOnce.Do(func() {
+    ethereumRPC = jsonrpc.NewClient(configure.Config.EthRPC)
+  })
+  return ethereumRPC
+}
+
+// isMethodNotFound whether node doesn't serve the method, other errors aren't fall back to legacy calls
+func isMethodNotFound(err *jsonrpc.RPCError) bool {
+  return err != nil && err.Code == jsonrpcMethodNotFound
+}
+
 // RawTx ethereum raw tx
 func (c EthereumChain) RawTx(ctx context.Context, from, to, amount, memo, asset string) (string, error) {
   if configure.ChainAssets[asset] != Ethereum {
@@ -28,27 +51,23 @@ func (c EthereumChain) RawTx(ctx context.Context, from, to, amount, memo, asset
   if !common.IsHexAddress(to) {
     return "", fmt.Errorf("Invalid address: %s", to)
   }
+  if c.Replaces != nil {
+    if err := c.Replaces.validReplacement(from); err != nil {
+      return "", err
+    }
+  }
 
-  // const
-  var (
-    data []byte
-    txPoolInspect *TxPoolInspect
-    txPoolMaxCount uint64
-  )
-  gasLimit := uint64(21000) // in units
-  token := configure.ChainsInfo[Ethereum].Tokens[strings.ToLower(asset)]
-  etherToWei := decimal.NewFromBigInt(big.NewInt(1000000000000000000), 0)
-
-  // transfer amount
-  transferAmount, err := decimal.NewFromString(amount)
+  // transfer amount in wei or smallest unit of token
+  meta, err := c.Token(asset)
   if err != nil {
     return "", err
   }
-  transferAmountDecimal := transferAmount.Mul(etherToWei)
-  value, ok := new(big.Int).SetString(transferAmountDecimal.String(), 10)
-  if !ok {
-    return "", fmt.Errorf("Set amount error")
+  // cancel replaces pending tx with 0 ether to from itself
+  value, err := meta.toBaseUnits(amount, c.Replaces != nil && meta.isCancel(from, to))
+  if err != nil {
+    return "", err
   }
+  transferAmountDecimal := decimal.NewFromBigInt(value, 0)
 
   // account balance
   bal, err := c.Balance(ctx, from, asset, "")
@@ -57,53 +76,25 @@ func (c EthereumChain) RawTx(ctx context.Context, from, to, amount, memo, asset
   }
   balanceDecimal, _ := decimal.NewFromString(bal)
 
-  // if transferAmount >= balanceAmount, return (May be ETH or token's balance)
-  if balanceDecimal.LessThanOrEqual(transferAmountDecimal) {
-    return "", fmt.Errorf("insufficient balance: less than or equal")
+  // whole balance may be transferred (May be ETH or token's balance), ETH fee is checked below
+  if balanceDecimal.LessThan(transferAmountDecimal) {
+    return "", fmt.Errorf("insufficient balance: less than %s", amount)
   }
 
   // token transfer meta: gasLimit, tx input data, value
-  if token != "" && strings.ToLower(asset) != strings.ToLower(configure.ChainsInfo[Ethereum].Coin){
-    tokenAddress := common.HexToAddress(token)
-
-    transferFunSignature := []byte("transfer(address,uint256)")
-    hash := sha3.NewKeccak256()
-    hash.Write(transferFunSignature)
-    methodID := hash.Sum(nil)[:4]
-    paddedAddress := common.LeftPadBytes(common.HexToAddress(to).Bytes(), 32)
-    tokenAmount, ok := new(big.Int).SetString(transferAmountDecimal.String(), 10)
-    if !ok {
-      return "", fmt.Errorf("Set amount error")
-    }
-    paddedAmount := common.LeftPadBytes(tokenAmount.Bytes(), 32)
-
-    data = append(data, methodID...)
-    data = append(data, paddedAddress...)
-    data = append(data, paddedAmount...)
-
-    gasLimit, err = c.Client.EstimateGas(ctx, ethereum.CallMsg{
-      To: &tokenAddress,
-      Data: data,
-    })
-    if err != nil {
-      return "", fmt.Errorf("EstimateGas %s", err)
-    }
-    value = big.NewInt(0)
-    to = token
+  to, value, data, gasLimit, err := c.transferCall(ctx, from, to, meta, value)
+  if err != nil {
+    return "", err
   }
 
-  // gas price
-  gasPrice, err := c.Client.SuggestGasPrice(ctx)
+  // EIP-1559 fee caps, legacy gas price when node isn't London enabled
+  fee, err := c.gasFee(ctx, gasLimit)
   if err != nil {
     return "", err
   }
+  feeDecimal := decimal.NewFromBigInt(fee.MaxFee, 0)
 
-  // tx fee
-  txFee := new(big.Int)
-  txFee = txFee.Mul(gasPrice, big.NewInt(int64(gasLimit)))
-  feeDecimal, _ := decimal.NewFromString(txFee.String())
-
-  if token == "" {
+  if meta.Address == (common.Address{}) {
     // ETH transfer
     // if totalCost > balance then return
     totalCost := transferAmountDecimal.Add(feeDecimal)
@@ -126,58 +117,131 @@ func (c EthereumChain) RawTx(ctx context.Context, from, to, amount, memo, asset
     }
   }
 
-  // pendingNonceAt account
-  pendingNonaceAt, err := c.Client.PendingNonceAt(ctx, common.HexToAddress(from))
-  if err != nil {
-    return "", err
+  // nonce allocated by manager is released when the raw tx can't be built, replacement reuses nonce of the replaced tx
+  var pendingNonce uint64
+  allocated := c.Nonces != nil && c.Replaces == nil
+  if c.Replaces != nil {
+    pendingNonce = c.Replaces.Nonce
+  }else {
+    if pendingNonce, err = c.Client.PendingNonceAt(ctx, common.HexToAddress(from)); err != nil {
+      return "", err
+    }
+  }
+  if allocated {
+    if pendingNonce, err = c.Nonces.AllocateNonce(from, pendingNonce); err != nil {
+      return "", fmt.Errorf("Allocate nonce %s", err)
+    }
   }
 
-  // get real nonce in mempool
-  rpcClient := jsonrpc.NewClient(configure.Config.EthRPC)
-  response, err := rpcClient.Call("txpool_inspect")
+  var rawTxHex string
+  if fee.Type == DynamicFeeTxType {
+    var chainID *big.Int
+    if chainID, err = c.Client.NetworkID(ctx); err != nil {
+      if allocated {
+        c.Nonces.ReleaseNonce(from, pendingNonce)
+      }
+      return "", err
+    }
+    toAddress := common.HexToAddress(to)
+    tx := &DynamicFeeTx{ChainID: chainID, Nonce: pendingNonce, GasTipCap: fee.GasTipCap, GasFeeCap: fee.GasFeeCap, Gas: fee.Gas, To: &toAddress, Value: value, Data: data}
+    rawTxHex, err = EncodeDynamicFeeTx(tx)
+  }else {
+    tx := types.NewTransaction(pendingNonce, common.HexToAddress(to), value, fee.Gas, fee.GasPrice, data)
+    rawTxHex, err = EncodeETHTx(tx)
+  }
   if err != nil {
-    return "", err
+    if allocated {
+      c.Nonces.ReleaseNonce(from, pendingNonce)
+    }
+    return "", fmt.Errorf("Encode raw tx %s", err)
   }
-  if response.Error != nil {
-    return "", response.Error
+  if c.Fee != nil {
+    *c.Fee = *fee
   }
+  return rawTxHex, nil
+}
 
-  if err = response.GetObject(&txPoolInspect); err != nil {
-    return "", err
+// TransferFee fee of the tx RawTx builds to transfer amount of asset from address, without allocating nonce
+func (c EthereumChain) TransferFee(ctx context.Context, from, to, amount, asset string) (*EthereumFee, error) {
+  meta, err := c.Token(asset)
+  if err != nil {
+    return nil, err
   }
-  pending := reflect.ValueOf(txPoolInspect.Pending)
-  if pending.Kind() == reflect.Map {
-    for _, key := range pending.MapKeys() {
-      address := key.Interface().(string)
-      tx := reflect.ValueOf(pending.MapIndex(key).Interface())
-      if tx.Kind() == reflect.Map && strings.ToLower(from) == strings.ToLower(address){
-        for _, key := range tx.MapKeys() {
-          count := key.Interface().(uint64)
-          if count > txPoolMaxCount {
-            txPoolMaxCount = count
-          }
-        }
-      }
-    }
+  value, err := meta.ToBaseUnits(amount)
+  if err != nil {
+    return nil, err
   }
-  pendingNonce := pendingNonaceAt
-  if pendingNonaceAt !=0 && txPoolMaxCount + 1 > pendingNonaceAt {
-    pendingNonce = txPoolMaxCount + 1
+  _, _, _, gasLimit, err := c.transferCall(ctx, from, to, meta, value)
+  if err != nil {
+    return nil, err
   }
+  return c.gasFee(ctx, gasLimit)
+}
 
-  tx := types.NewTransaction(pendingNonce, common.HexToAddress(to), value, gasLimit, gasPrice, data)
-  rawTxHex, err := EncodeETHTx(tx)
+// transferCall recipient, value, calldata and gas limit of tx transferring value of token to address,
+// ERC20 transfer(address,uint256) is estimated from the sender since it reverts without balance
+func (c EthereumChain) transferCall(ctx context.Context, from, to string, token *EthereumToken, value *big.Int) (string, *big.Int, []byte, uint64, error) {
+  if token.Address == (common.Address{}) {
+    return to, value, nil, 21000, nil
+  }
+  var data []byte
+  data = append(data, erc20TransferMethodID()...)
+  data = append(data, common.LeftPadBytes(common.HexToAddress(to).Bytes(), 32)...)
+  data = append(data, common.LeftPadBytes(value.Bytes(), 32)...)
+  gasLimit, err := c.Client.EstimateGas(ctx, ethereum.CallMsg{
+    From: common.HexToAddress(from),
+    To: &token.Address,
+    Data: data,
+  })
   if err != nil {
-    return "", fmt.Errorf("Encode raw tx %s", err)
+    return "", nil, nil, 0, fmt.Errorf("EstimateGas %s", err)
   }
-  return rawTxHex, nil
+  return token.Address.Hex(), big.NewInt(0), data, gasLimit, nil
 }
 
-// SignedTx ethereum tx signature
-func (c EthereumChain) SignedTx(rawTxHex, wif string, options *ChainsOptions) (string, error) {
-  ecPriv, err := crypto.HexToECDSA(wif)
+// gasFee EIP-1559 fee caps, legacy gas price when node isn't London enabled, bumped over the replaced tx, or Quote when it's set.
+// MaxFee is the upper bound of fee of tx using gas limit
+func (c EthereumChain) gasFee(ctx context.Context, gasLimit uint64) (*EthereumFee, error) {
+  if c.Quote != nil {
+    quote := *c.Quote
+    // quote of a funded tx keeps its gas limit, so MaxFee stays within the funded ether
+    if quote.Gas != 0 {
+      gasLimit = quote.Gas
+    }
+    return c.maxFee(&quote, gasLimit), nil
+  }
+  fee, err := c.DynamicFee(c.Priority)
   if err != nil {
-    return "", err
+    return nil, err
+  }
+  if fee == nil {
+    gasPrice, err := c.Client.SuggestGasPrice(ctx)
+    if err != nil {
+      return nil, err
+    }
+    fee = &EthereumFee{GasPrice: gasPrice}
+  }
+  if c.Replaces != nil {
+    bumpEthereumFee(fee, c.Replaces.Fee)
+  }
+  return c.maxFee(fee, gasLimit), nil
+}
+
+// maxFee set gas limit of fee and its MaxFee, upper bound of fee of tx using gas limit
+func (c EthereumChain) maxFee(fee *EthereumFee, gasLimit uint64) *EthereumFee {
+  fee.Gas = gasLimit
+  maxGasPrice := fee.GasPrice
+  if fee.Type == DynamicFeeTxType {
+    maxGasPrice = fee.GasFeeCap
+  }
+  fee.MaxFee = new(big.Int).Mul(maxGasPrice, new(big.Int).SetUint64(gasLimit))
+  return fee
+}
+
+// SignedTx ethereum tx signature, EIP155 for legacy tx and London for dynamic fee tx
+func (c EthereumChain) SignedTx(rawTxHex string, options *ChainsOptions) (string, error) {
+  if IsDynamicFeeTx(rawTxHex) {
+    return c.signedDynamicFeeTx(rawTxHex, options)
   }
   tx, err := DecodeETHTx(rawTxHex)
   if err != nil {
@@ -185,10 +249,19 @@ func (c EthereumChain) SignedTx(rawTxHex, wif string, options *ChainsOptions) (s
   }
 
   chainID, _ := new(big.Int).SetString(options.ChainID, 10)
-  signtx, err := types.SignTx(tx, types.NewEIP155Signer(chainID), ecPriv)
+  signer := types.NewEIP155Signer(chainID)
+  sig, err := c.Keys.Sign(options.From, signer.Hash(tx).Bytes())
+  if err != nil {
+    return "", fmt.Errorf("Ethereum transaction signatrue %s", err)
+  }
+  signtx, err := tx.WithSignature(signer, sig)
   if err != nil {
     return "", fmt.Errorf("Ethereum transaction signatrue %s", err)
   }
+  sender, err := types.Sender(signer, signtx)
+  if err != nil || !strings.EqualFold(sender.Hex(), options.From) {
+    return "", fmt.Errorf("Private key doesn't match address %s", options.From)
+  }
   txHex, err := EncodeETHTx(signtx)
   if err != nil {
     return "", err
@@ -196,13 +269,86 @@ func (c EthereumChain) SignedTx(rawTxHex, wif string, options *ChainsOptions) (s
   return txHex, nil
 }
 
-// BroadcastTx ethereum tx broadcast
+func (c EthereumChain) signedDynamicFeeTx(rawTxHex string, options *ChainsOptions) (string, error) {
+  tx, err := DecodeDynamicFeeTx(rawTxHex)
+  if err != nil {
+    return "", err
+  }
+  if tx.ChainID == nil || tx.ChainID.String() != options.ChainID {
+    return "", fmt.Errorf("Chain id of tx isn't %s", options.ChainID)
+  }
+  hash, err := tx.SigHash()
+  if err != nil {
+    return "", err
+  }
+  sig, err := c.Keys.Sign(options.From, hash.Bytes())
+  if err != nil {
+    return "", fmt.Errorf("Ethereum transaction signatrue %s", err)
+  }
+  if err = tx.WithSignature(sig); err != nil {
+    return "", fmt.Errorf("Ethereum transaction signatrue %s", err)
+  }
+  sender, err := tx.Sender()
+  if err != nil || !strings.EqualFold(sender.Hex(), options.From) {
+    return "", fmt.Errorf("Private key doesn't match address %s", options.From)
+  }
+  return EncodeDynamicFeeTx(tx)
+}
+
+// ethereumNonceUsedErrors node errors of tx whose nonce is taken by a tx in mempool or chain, maybe the same tx
+var ethereumNonceUsedErrors = []string{"already known", "known transaction", "nonce too low", "replacement transaction underpriced"}
+
+// EthereumRejectedError node rejects broadcast tx, e.g. insufficient funds, its nonce isn't used and can be released
+type EthereumRejectedError struct {
+  Message string
+}
+
+func (e *EthereumRejectedError) Error() string {
+  return "Ethereum tx is rejected " + e.Message
+}
+
+// ethereumBroadcastError error of node answer to broadcast tx, EthereumRejectedError unless the nonce is taken
+func ethereumBroadcastError(message string) error {
+  lower := strings.ToLower(message)
+  for _, used := range ethereumNonceUsedErrors {
+    if strings.Contains(lower, used) {
+      return fmt.Errorf("Ethereum SendRawTransaction %s", message)
+    }
+  }
+  return &EthereumRejectedError{Message: message}
+}
+
+// BroadcastTx ethereum tx broadcast, dynamic fee tx is sent raw since ethclient can't encode it.
+// EthereumRejectedError is returned when node rejects the tx, other errors leave it unknown whether tx is sent
 func (c EthereumChain) BroadcastTx(ctx context.Context, signedTxHex string) (string, error) {
+  if IsDynamicFeeTx(signedTxHex) {
+    tx, err := DecodeDynamicFeeTx(signedTxHex)
+    if err != nil {
+      return "", fmt.Errorf("Decode signed tx %s", err)
+    }
+    txHash, err := tx.Hash()
+    if err != nil {
+      return "", err
+    }
+    rpcClient := c.rpcClient()
+    response, err := rpcClient.Call("eth_sendRawTransaction", signedTxHex)
+    if err != nil {
+      return "", fmt.Errorf("Ethereum SendRawTransaction %s", err)
+    }
+    if response.Error != nil {
+      return "", ethereumBroadcastError(response.Error.Error())
+    }
+    return txHash.String(), nil
+  }
   tx, err := DecodeETHTx(signedTxHex)
   if err != nil {
     return "", fmt.Errorf("Decode signed tx %s", err)
   }
   if err := c.Client.SendTransaction(ctx, tx); err != nil {
+    // node answers json-rpc error, others are transport errors and the tx may be sent
+    if _, ok := err.(rpc.Error); ok {
+      return "", ethereumBroadcastError(err.Error())
+    }
     return "", fmt.Errorf("Ethereum SendTransactionsigned %s", err)
   }
   return tx.Hash().String(), nil
@@ -0,0 +1,210 @@
+package blockchain
+
+import (
+  "fmt"
+  "sync"
+  "errors"
+  "strings"
+  "strconv"
+  "encoding/hex"
+  "encoding/binary"
+  "wallet-go/pkg/db"
+  "wallet-go/pkg/util"
+  "github.com/btcsuite/btcutil"
+  "github.com/btcsuite/btcd/chaincfg"
+  "github.com/btcsuite/btcutil/hdkeychain"
+  "github.com/tyler-smith/go-bip39"
+)
+
+const (
+  // BIP44CoinTypeBitcoin https://github.com/satoshilabs/slips/blob/master/slip-0044.md
+  BIP44CoinTypeBitcoin  uint32 = 0
+  // BIP44CoinTypeEthereum ethereum coin type
+  BIP44CoinTypeEthereum uint32 = 60
+  // BIP44CoinTypeEOSIO eos coin type
+  BIP44CoinTypeEOSIO    uint32 = 194
+
+  bip44Purpose uint32 = 44
+  // bip49Purpose P2SH-P2WPKH keys, BIP49
+  bip49Purpose uint32 = 49
+  // bip84Purpose P2WPKH keys, BIP84
+  bip84Purpose uint32 = 84
+  mnemonicKey  string = "mnemonic"
+)
+
+var errHDWalletLocked = errors.New("HD wallet is locked, unlock master seed when wallet_core start")
+
+// HDWallet BIP39 mnemonic master seed, derive keys along path m/purpose'/coin_type'/0'/0/index,
+// purpose is 44 except bitcoin segwit addresses which follow BIP49 and BIP84
+type HDWallet struct {
+  master  *hdkeychain.ExtendedKey
+  ldb     *db.LDB
+  mu      sync.Mutex
+}
+
+// NewMnemonic generate 24 words BIP39 mnemonic
+func NewMnemonic() (string, error) {
+  entropy, err := bip39.NewEntropy(256)
+  if err != nil {
+    return "", fmt.Errorf("NewEntropy %s", err)
+  }
+  return bip39.NewMnemonic(entropy)
+}
+
+// InitHDWallet save passphrase encrypted mnemonic as master seed
+func InitHDWallet(mnemonic, passphrase string) error {
+  mnemonic = strings.Join(strings.Fields(mnemonic), " ")
+  if !bip39.IsMnemonicValid(mnemonic) {
+    return errors.New("Invalid BIP39 mnemonic")
+  }
+  ldb, err := db.NewLDB(db.HDLD)
+  if err != nil {
+    return err
+  }
+  defer ldb.Close()
+
+  if _, err = ldb.Get([]byte(mnemonicKey), nil); err == nil {
+    return errors.New("Master seed already exists")
+  }else if !strings.Contains(err.Error(), "leveldb: not found") {
+    return fmt.Errorf("Query master seed %s", err)
+  }
+
+  encrypted, err := util.EncryptWithPassphrase([]byte(mnemonic), passphrase)
+  if err != nil {
+    return fmt.Errorf("Encrypt mnemonic %s", err)
+  }
+  if err = ldb.Put([]byte(mnemonicKey), encrypted, nil); err != nil {
+    return fmt.Errorf("Save mnemonic to leveldb %s", err)
+  }
+  return nil
+}
+
+// UnlockHDWallet decrypt master seed, hold the seed leveldb until Close
+func UnlockHDWallet(passphrase string) (*HDWallet, error) {
+  ldb, err := db.NewLDB(db.HDLD)
+  if err != nil {
+    return nil, err
+  }
+  encrypted, err := ldb.Get([]byte(mnemonicKey), nil)
+  if err != nil {
+    ldb.Close()
+    return nil, fmt.Errorf("Master seed not found, init it by wallet_tools seed %s", err)
+  }
+  mnemonic, err := util.DecryptWithPassphrase(encrypted, passphrase)
+  if err != nil {
+    ldb.Close()
+    return nil, fmt.Errorf("Decrypt master seed %s", err)
+  }
+  seed, err := bip39.NewSeedWithErrorChecking(string(mnemonic), "")
+  if err != nil {
+    ldb.Close()
+    return nil, fmt.Errorf("Mnemonic to seed %s", err)
+  }
+  // network params only affect extended key serialization, not derivation
+  master, err := hdkeychain.NewMaster(seed, &chaincfg.MainNetParams)
+  if err != nil {
+    ldb.Close()
+    return nil, fmt.Errorf("NewMaster %s", err)
+  }
+  return &HDWallet{master: master, ldb: ldb}, nil
+}
+
+// BitcoinPurpose derivation purpose of bitcoin address type
+func BitcoinPurpose(addressType string) uint32 {
+  switch addressType {
+  case BitcoinAddressNestedSegwit:
+    return bip49Purpose
+  case BitcoinAddressBech32:
+    return bip84Purpose
+  default:
+    return bip44Purpose
+  }
+}
+
+// NextKey derive key of next index for the purpose and coin type, index is persisted only when save succeed
+func (w *HDWallet) NextKey(purpose, coinType uint32, save func(key *hdkeychain.ExtendedKey) error) (string, error) {
+  if w == nil {
+    return "", errHDWalletLocked
+  }
+  w.mu.Lock()
+  defer w.mu.Unlock()
+
+  // BIP44 indexes keep the key they had before other purposes were supported
+  indexKey := []byte(fmt.Sprintf("index/%d", coinType))
+  if purpose != bip44Purpose {
+    indexKey = []byte(fmt.Sprintf("index/%d/%d", purpose, coinType))
+  }
+  var index uint32
+  indexBytes, err := w.ldb.Get(indexKey, nil)
+  if err == nil {
+    index = binary.BigEndian.Uint32(indexBytes)
+  }else if !strings.Contains(err.Error(), "leveldb: not found") {
+    return "", fmt.Errorf("Query %s %s", indexKey, err)
+  }
+
+  key, err := w.derive(purpose + hdkeychain.HardenedKeyStart, coinType + hdkeychain.HardenedKeyStart, hdkeychain.HardenedKeyStart, 0, index)
+  if err != nil {
+    return "", err
+  }
+  if err = save(key); err != nil {
+    return "", err
+  }
+
+  next := make([]byte, 4)
+  binary.BigEndian.PutUint32(next, index + 1)
+  if err = w.ldb.Put(indexKey, next, nil); err != nil {
+    return "", fmt.Errorf("Save %s %s", indexKey, err)
+  }
+  return fmt.Sprintf("m/%d'/%d'/0'/0/%d", purpose, coinType, index), nil
+}
+
+// Fingerprint hex BIP32 fingerprint of the master key, first 4 bytes of hash160 of its public key
+func (w *HDWallet) Fingerprint() (string, error) {
+  if w == nil {
+    return "", errHDWalletLocked
+  }
+  pubKey, err := w.master.ECPubKey()
+  if err != nil {
+    return "", err
+  }
+  return hex.EncodeToString(btcutil.Hash160(pubKey.SerializeCompressed())[:4]), nil
+}
+
+// ParseDerivationPath child indexes of path m/purpose'/coin_type'/0'/0/index, ' marks hardened index
+func ParseDerivationPath(path string) ([]uint32, error) {
+  segments := strings.Split(path, "/")
+  if len(segments) == 0 || segments[0] != "m" {
+    return nil, fmt.Errorf("Invalid derivation path %s", path)
+  }
+  var indexes []uint32
+  for _, segment := range segments[1:] {
+    offset := uint32(0)
+    if strings.HasSuffix(segment, "'") {
+      offset = hdkeychain.HardenedKeyStart
+      segment = strings.TrimSuffix(segment, "'")
+    }
+    index, err := strconv.ParseUint(segment, 10, 31)
+    if err != nil {
+      return nil, fmt.Errorf("Invalid derivation path %s %s", path, err)
+    }
+    indexes = append(indexes, uint32(index) + offset)
+  }
+  return indexes, nil
+}
+
+// Close close seed leveldb
+func (w *HDWallet) Close() error {
+  return w.ldb.Close()
+}
+
+func (w *HDWallet) derive(path ...uint32) (*hdkeychain.ExtendedKey, error) {
+  key := w.master
+  for _, i := range path {
+    child, err := key.Child(i)
+    if err != nil {
+      return nil, fmt.Errorf("Derive child %d %s", i, err)
+    }
+    key = child
+  }
+  return key, nil
+}
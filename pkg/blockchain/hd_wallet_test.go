@@ -0,0 +1,106 @@
+package blockchain
+
+import (
+  "testing"
+  "encoding/hex"
+  "wallet-go/pkg/db"
+  "github.com/btcsuite/btcd/chaincfg"
+  "github.com/btcsuite/btcutil/hdkeychain"
+  "github.com/ethereum/go-ethereum/crypto"
+  "github.com/syndtr/goleveldb/leveldb"
+  "github.com/tyler-smith/go-bip39"
+)
+
+// testMnemonic BIP39 test mnemonic shared by BIP44/49/84 reference vectors
+const testMnemonic = "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about"
+
+func testHDWallet(t *testing.T) *HDWallet {
+  seed, err := bip39.NewSeedWithErrorChecking(testMnemonic, "")
+  if err != nil {
+    t.Fatal(err)
+  }
+  master, err := hdkeychain.NewMaster(seed, &chaincfg.MainNetParams)
+  if err != nil {
+    t.Fatal(err)
+  }
+  ldb, err := leveldb.OpenFile(t.TempDir(), nil)
+  if err != nil {
+    t.Fatal(err)
+  }
+  w := &HDWallet{master: master, ldb: &db.LDB{DB: ldb}}
+  t.Cleanup(func() { w.Close() })
+  return w
+}
+
+func TestBIP39Seed(t *testing.T) {
+  seed, err := bip39.NewSeedWithErrorChecking(testMnemonic, "TREZOR")
+  if err != nil {
+    t.Fatal(err)
+  }
+  want := "c55257c360c07c72029aebc1b53c05ed0362ada38ead3e3e9efa3708e53495531f09a6987599d18264c1e1c92f2cf141630c7a3c4ab7c81b2f001698e7463b04"
+  if got := hex.EncodeToString(seed); got != want {
+    t.Fatalf("seed %s, want %s", got, want)
+  }
+}
+
+func TestNextKeyBitcoinPurpose(t *testing.T) {
+  w := testHDWallet(t)
+  cases := []struct {
+    addressType string
+    path        string
+    address     string
+  }{
+    {BitcoinAddressLegacy, "m/44'/0'/0'/0/0", "1LqBGSKuX5yYUonjxT5qGfpUsXKYYWeabA"},
+    {BitcoinAddressNestedSegwit, "m/49'/0'/0'/0/0", "37VucYSaXLCAsxYyAPfbSi9eh4iEcbShgf"},
+    {BitcoinAddressBech32, "m/84'/0'/0'/0/0", "bc1qcr8te4kr609gcawutmrza0j4xv80jy8z306fyu"},
+    // every purpose counts its own index
+    {BitcoinAddressBech32, "m/84'/0'/0'/0/1", "bc1qnjg0jd8228aq7egyzacy8cys3knf9xvrerkf9g"},
+  }
+  for _, c := range cases {
+    var address string
+    path, err := w.NextKey(BitcoinPurpose(c.addressType), BIP44CoinTypeBitcoin, func(key *hdkeychain.ExtendedKey) error {
+      priv, err := key.ECPrivKey()
+      if err != nil {
+        return err
+      }
+      add, err := BitcoinPubKeyAddress(priv.PubKey(), c.addressType, &chaincfg.MainNetParams)
+      if err != nil {
+        return err
+      }
+      address = add.EncodeAddress()
+      return nil
+    })
+    if err != nil {
+      t.Fatal(err)
+    }
+    if path != c.path || address != c.address {
+      t.Fatalf("%s derived %s %s, want %s %s", c.addressType, path, address, c.path, c.address)
+    }
+  }
+}
+
+func TestNextKeyEthereum(t *testing.T) {
+  w := testHDWallet(t)
+  var address string
+  path, err := w.NextKey(bip44Purpose, BIP44CoinTypeEthereum, func(key *hdkeychain.ExtendedKey) error {
+    priv, err := key.ECPrivKey()
+    if err != nil {
+      return err
+    }
+    address = crypto.PubkeyToAddress(priv.ToECDSA().PublicKey).Hex()
+    return nil
+  })
+  if err != nil {
+    t.Fatal(err)
+  }
+  if path != "m/44'/60'/0'/0/0" || address != "0x9858EfFD232B4033E47d90003D41EC34EcaEda94" {
+    t.Fatalf("derived %s %s", path, address)
+  }
+  indexes, err := ParseDerivationPath(path)
+  if err != nil {
+    t.Fatal(err)
+  }
+  if len(indexes) != 5 || indexes[0] != bip44Purpose + hdkeychain.HardenedKeyStart || indexes[1] != BIP44CoinTypeEthereum + hdkeychain.HardenedKeyStart || indexes[4] != 0 {
+    t.Fatalf("ParseDerivationPath %s %v", path, indexes)
+  }
+}
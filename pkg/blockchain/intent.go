@@ -0,0 +1,417 @@
+package blockchain
+
+import (
+  "fmt"
+  "bytes"
+  "errors"
+  "strings"
+  "strconv"
+  "math/big"
+  "encoding/hex"
+  "encoding/json"
+  "encoding/binary"
+  "wallet-go/pkg/configure"
+  "github.com/btcsuite/btcutil"
+  "github.com/btcsuite/btcd/wire"
+  "github.com/btcsuite/btcd/txscript"
+  "github.com/ethereum/go-ethereum/common"
+  "github.com/ethereum/go-ethereum/crypto/sha3"
+  "github.com/eoscanada/eos-go"
+  "github.com/eoscanada/eos-go/token"
+)
+
+// bitcoinDustLimit omni reference output only carries dust
+const bitcoinDustLimit int64 = 546
+
+var errIntentRequired = errors.New("Transaction intent to, amount and asset are required")
+
+// VerifyTx bitcoin raw tx must pay amount of asset to every intent recipient, other outputs are change to wallet owned address.
+// inputs must spend From, or any wallet address when the only recipient is a wallet address
+func (c BitcoinCoreChain) VerifyTx(rawTxHex string, options *ChainsOptions) error {
+  recipients := options.Recipients
+  if len(recipients) == 0 {
+    recipients = []Recipient{{To: options.To, Amount: options.Amount}}
+  }
+  if options.Asset == "" {
+    return errIntentRequired
+  }
+  asset := strings.ToLower(options.Asset)
+  if configure.ChainAssets[asset] != Bitcoin {
+    return fmt.Errorf("Unsupport %s in bitcoincore", options.Asset)
+  }
+  tx, err := DecodeBtcTxHex(rawTxHex)
+  if err != nil {
+    return fmt.Errorf("Fail to decode raw tx %s", err)
+  }
+  if err = verifyBitcoinFee(tx.MsgTx(), options.VinAmounts); err != nil {
+    return err
+  }
+
+  // satoshi intended to each recipient script, recipients may repeat
+  var (
+    scripts  []string
+    amounts  = make(map[string]int64)
+    tos      = make(map[string]string)
+  )
+  for _, recipient := range recipients {
+    if recipient.To == "" || recipient.Amount == "" {
+      return errIntentRequired
+    }
+    toPkScript, err := BitcoincoreAddressP2AS(recipient.To, c.Mode)
+    if err != nil {
+      return fmt.Errorf("Intent recipient %s", err)
+    }
+    amountF, err := strconv.ParseFloat(recipient.Amount, 64)
+    if err != nil {
+      return fmt.Errorf("Intent amount %s", err)
+    }
+    amount, err := btcutil.NewAmount(amountF)
+    if err != nil {
+      return fmt.Errorf("Intent amount %s", err)
+    }
+    script := string(toPkScript)
+    if _, ok := amounts[script]; !ok {
+      scripts = append(scripts, script)
+      tos[script] = recipient.To
+    }
+    amounts[script] += int64(amount)
+  }
+
+  // inputs must spend From, unless tx only pays wallet addresses, whose owners are authorized one by one
+  owners, err := c.InputOwners(rawTxHex, options)
+  if err != nil {
+    return err
+  }
+  for _, owner := range owners {
+    if owner.Address == options.From {
+      continue
+    }
+    internal, err := c.payWallet(tos)
+    if err != nil {
+      return err
+    }
+    if !internal {
+      return fmt.Errorf("Input spends %s, which isn't %s", owner.Address, options.From)
+    }
+    if len(scripts) > 1 {
+      return errors.New("Tx spending multiple addresses pays one wallet address only")
+    }
+    break
+  }
+
+  propertyID := configure.ChainsInfo[Bitcoin].Tokens[asset]
+  isToken := propertyID != "" && asset != strings.ToLower(configure.ChainsInfo[Bitcoin].Coin)
+  if isToken && len(recipients) > 1 {
+    return errors.New("Omni simple send supports one recipient only")
+  }
+  if isToken && len(owners) > 1 {
+    return errors.New("Omni simple send spends one address only")
+  }
+
+  var (
+    paid = make(map[string]int64)
+    omniPaid bool
+  )
+  for i, txOut := range tx.MsgTx().TxOut {
+    if _, ok := amounts[string(txOut.PkScript)]; ok {
+      paid[string(txOut.PkScript)] += txOut.Value
+      continue
+    }
+    if txscript.GetScriptClass(txOut.PkScript) == txscript.NullDataTy {
+      if !isToken || omniPaid {
+        return fmt.Errorf("Unexpected OP_RETURN output %d", i)
+      }
+      property, tokenAmount, err := decodeOmniSimpleSend(txOut.PkScript)
+      if err != nil {
+        return fmt.Errorf("Output %d %s", i, err)
+      }
+      if strconv.FormatUint(uint64(property), 10) != propertyID || tokenAmount != uint64(amounts[scripts[0]]) || txOut.Value != 0 {
+        return fmt.Errorf("Omni payload doesn't match intent: property %d amount %d", property, tokenAmount)
+      }
+      omniPaid = true
+      continue
+    }
+
+    // change output
+    _, addresses, _, err := txscript.ExtractPkScriptAddrs(txOut.PkScript, c.Mode)
+    if err != nil || len(addresses) != 1 {
+      return fmt.Errorf("Output %d pays to unknown script", i)
+    }
+    owned, err := c.Keys.Has(addresses[0].EncodeAddress())
+    if err != nil {
+      return err
+    }
+    if !owned {
+      return fmt.Errorf("Output %d pays to %s, which is neither recipient nor wallet address", i, addresses[0].EncodeAddress())
+    }
+  }
+
+  if isToken {
+    if !omniPaid {
+      return errors.New("Omni simple send payload not found")
+    }
+    if paid[scripts[0]] > bitcoinDustLimit {
+      return fmt.Errorf("Omni reference output pays %d satoshi more than dust", paid[scripts[0]])
+    }
+    return nil
+  }
+  for _, script := range scripts {
+    if paid[script] != amounts[script] {
+      return fmt.Errorf("Pay %d satoshi to %s, intent is %d", paid[script], tos[script], amounts[script])
+    }
+  }
+  return nil
+}
+
+// InputOwners key store addresses spent by tx inputs in order of first spending input, with their input satoshi.
+// previous output scripts are options.VinPkScripts, inputs spend options.From when they aren't given
+func (c BitcoinCoreChain) InputOwners(rawTxHex string, options *ChainsOptions) ([]BitcoinInputOwner, error) {
+  tx, err := DecodeBtcTxHex(rawTxHex)
+  if err != nil {
+    return nil, fmt.Errorf("Fail to decode raw tx %s", err)
+  }
+  txIns := tx.MsgTx().TxIn
+  if len(options.VinPkScripts) > 0 && len(options.VinPkScripts) != len(txIns) {
+    return nil, fmt.Errorf("Previous output script of each vin is required: %d : %d", len(options.VinPkScripts), len(txIns))
+  }
+  var owners []BitcoinInputOwner
+  index := make(map[string]int)
+  for i := range txIns {
+    address := options.From
+    if len(options.VinPkScripts) > 0 {
+      _, addresses, _, err := txscript.ExtractPkScriptAddrs(options.VinPkScripts[i], c.Mode)
+      if err != nil || len(addresses) != 1 {
+        return nil, fmt.Errorf("Input %d spends unknown script", i)
+      }
+      address = addresses[0].EncodeAddress()
+    }
+    j, ok := index[address]
+    if !ok {
+      owned, err := c.Keys.Has(address)
+      if err != nil {
+        return nil, err
+      }
+      if !owned {
+        return nil, fmt.Errorf("Input %d spends %s, which isn't wallet address", i, address)
+      }
+      j = len(owners)
+      index[address] = j
+      owners = append(owners, BitcoinInputOwner{Address: address})
+    }
+    if i < len(options.VinAmounts) {
+      owners[j].Amount += options.VinAmounts[i]
+    }
+    owners[j].Outpoints = append(owners[j].Outpoints, txIns[i].PreviousOutPoint.String())
+  }
+  return owners, nil
+}
+
+// payWallet whether every recipient address is in key store
+func (c BitcoinCoreChain) payWallet(tos map[string]string) (bool, error) {
+  for _, to := range tos {
+    owned, err := c.Keys.Has(to)
+    if err != nil || !owned {
+      return false, err
+    }
+  }
+  return true, nil
+}
+
+// verifyBitcoinFee inputs minus outputs must not exceed max_fee of bitcoin when it's configured
+func verifyBitcoinFee(msgTx *wire.MsgTx, vinAmounts []int64) error {
+  maxFee := configure.ChainsInfo[Bitcoin].MaxFee
+  if maxFee == "" {
+    return nil
+  }
+  maxFeeF, err := strconv.ParseFloat(maxFee, 64)
+  if err != nil {
+    return fmt.Errorf("Bitcoin max_fee %s", err)
+  }
+  limit, err := btcutil.NewAmount(maxFeeF)
+  if err != nil {
+    return fmt.Errorf("Bitcoin max_fee %s", err)
+  }
+  if len(vinAmounts) != len(msgTx.TxIn) {
+    return fmt.Errorf("Fee check requires amount of each vin: %d : %d", len(vinAmounts), len(msgTx.TxIn))
+  }
+  var fee int64
+  for i, amount := range vinAmounts {
+    if amount <= 0 {
+      return fmt.Errorf("Invalid amount %d of vin %d", amount, i)
+    }
+    fee += amount
+  }
+  for _, txOut := range msgTx.TxOut {
+    fee -= txOut.Value
+  }
+  if fee < 0 {
+    return fmt.Errorf("Outputs spend %d satoshi more than inputs", -fee)
+  }
+  if fee > int64(limit) {
+    return fmt.Errorf("Fee %d satoshi exceeds max_fee %d", fee, int64(limit))
+  }
+  return nil
+}
+
+// decodeOmniSimpleSend property id and amount of OP_RETURN omni simple send payload
+func decodeOmniSimpleSend(pkScript []byte) (uint32, uint64, error) {
+  pushes, err := txscript.PushedData(pkScript)
+  if err != nil {
+    return 0, 0, err
+  }
+  // "omni" | version (2) | tx type (2) | property id (4) | amount (8)
+  payload := bytes.Join(pushes, nil)
+  if len(payload) != 20 || string(payload[:4]) != "omni" {
+    return 0, 0, errors.New("Not omni payload")
+  }
+  if binary.BigEndian.Uint16(payload[4:6]) != 0 || binary.BigEndian.Uint16(payload[6:8]) != 0 {
+    return 0, 0, errors.New("Only omni simple send is supported")
+  }
+  return binary.BigEndian.Uint32(payload[8:12]), binary.BigEndian.Uint64(payload[12:20]), nil
+}
+
+// VerifyTx ethereum raw tx must transfer amount of ether or ERC20 token to intent recipient
+func (c EthereumChain) VerifyTx(rawTxHex string, options *ChainsOptions) error {
+  if options.To == "" || options.Amount == "" || options.Asset == "" {
+    return errIntentRequired
+  }
+  asset := strings.ToLower(options.Asset)
+  if configure.ChainAssets[asset] != Ethereum {
+    return fmt.Errorf("Unsupport %s in Ethereum", options.Asset)
+  }
+  if !common.IsHexAddress(options.To) {
+    return fmt.Errorf("Invalid intent recipient %s", options.To)
+  }
+  chainID, ok := new(big.Int).SetString(options.ChainID, 10)
+  if !ok || chainID.Sign() <= 0 {
+    return fmt.Errorf("Invalid chain id %s", options.ChainID)
+  }
+  if configured := configure.ChainsInfo[Ethereum].ChainID; configured != "" && configured != chainID.String() {
+    return fmt.Errorf("Chain id %s isn't configured chain id %s", chainID.String(), configured)
+  }
+  fields, err := decodeEthereumTxFields(rawTxHex)
+  if err != nil {
+    return err
+  }
+  if fields.To == nil {
+    return errors.New("Contract creation is not allowed")
+  }
+  // legacy tx is signed by EIP155 signer of request chain id
+  if fields.ChainID != nil && fields.ChainID.Cmp(chainID) != 0 {
+    return fmt.Errorf("Chain id %s of tx isn't %s", fields.ChainID.String(), chainID.String())
+  }
+  if err = verifyEthereumFee(fields.MaxFee); err != nil {
+    return err
+  }
+  // wallet_core has no node client, token decimals must be configured
+  meta, err := c.Token(asset)
+  if err != nil {
+    return err
+  }
+  amount, err := meta.toBaseUnits(options.Amount, meta.isCancel(options.From, options.To))
+  if err != nil {
+    return fmt.Errorf("Intent amount %s", err)
+  }
+  to := common.HexToAddress(options.To)
+
+  token := configure.ChainsInfo[Ethereum].Tokens[asset]
+  if token == "" || asset == strings.ToLower(configure.ChainsInfo[Ethereum].Coin) {
+    if *fields.To != to || fields.Value.Cmp(amount) != 0 || len(fields.Data) != 0 {
+      return fmt.Errorf("Ether transfer doesn't match intent: to %s value %s", fields.To.Hex(), fields.Value.String())
+    }
+    return nil
+  }
+
+  // ERC20 transfer(address,uint256)
+  data := fields.Data
+  if *fields.To != common.HexToAddress(token) || fields.Value.Sign() != 0 {
+    return fmt.Errorf("Token transfer must call %s without ether", token)
+  }
+  if len(data) != 4 + 32 + 32 || !bytes.Equal(data[:4], erc20TransferMethodID()) {
+    return errors.New("Token transfer calldata isn't transfer(address,uint256)")
+  }
+  if common.BytesToAddress(data[4:36]) != to || new(big.Int).SetBytes(data[36:]).Cmp(amount) != 0 {
+    return fmt.Errorf("Token transfer doesn't match intent: to %s amount %s", common.BytesToAddress(data[4:36]).Hex(), new(big.Int).SetBytes(data[36:]).String())
+  }
+  return nil
+}
+
+// verifyEthereumFee max fee of tx in wei must not exceed max_fee of ethereum when it's configured
+func verifyEthereumFee(maxFee *big.Int) error {
+  info := configure.ChainsInfo[Ethereum]
+  if info.MaxFee == "" {
+    return nil
+  }
+  limit, err := (&EthereumToken{Asset: info.Coin, Decimals: etherDecimals}).ToBaseUnits(info.MaxFee)
+  if err != nil {
+    return fmt.Errorf("Ethereum max_fee %s", err)
+  }
+  if maxFee.Cmp(limit) > 0 {
+    return fmt.Errorf("Max fee %s wei exceeds max_fee %s wei", maxFee.String(), limit.String())
+  }
+  return nil
+}
+
+func erc20TransferMethodID() []byte {
+  hash := sha3.NewKeccak256()
+  hash.Write([]byte("transfer(address,uint256)"))
+  return hash.Sum(nil)[:4]
+}
+
+// VerifyTx eos raw tx must be a single token transfer of intent from the configured account of signing key
+func (c EOSChain) VerifyTx(rawTxHex string, options *ChainsOptions) error {
+  if options.To == "" || options.Amount == "" || options.Asset == "" {
+    return errIntentRequired
+  }
+  asset := strings.ToLower(options.Asset)
+  if configure.ChainAssets[asset] != EOSIO {
+    return fmt.Errorf("Unsupport %s in EOSIO", options.Asset)
+  }
+  txB, err := hex.DecodeString(rawTxHex)
+  if err != nil {
+    return err
+  }
+  var tx eos.Transaction
+  if err = json.Unmarshal(txB, &tx); err != nil {
+    return err
+  }
+  if len(tx.ContextFreeActions) != 0 || len(tx.Actions) != 1 {
+    return fmt.Errorf("Only single transfer action is allowed, got %d actions", len(tx.ContextFreeActions) + len(tx.Actions))
+  }
+
+  action := tx.Actions[0]
+  contract := configure.ChainsInfo[EOSIO].Tokens[asset]
+  if contract == "" {
+    contract = "eosio.token"
+  }
+  if string(action.Account) != contract || action.Name != eos.ActionName("transfer") {
+    return fmt.Errorf("Action %s::%s isn't %s::transfer", action.Account, action.Name, contract)
+  }
+
+  // registered action is decoded as *token.Transfer, others as map
+  dataB, err := json.Marshal(action.ActionData.Data)
+  if err != nil {
+    return err
+  }
+  var transfer token.Transfer
+  if err = json.Unmarshal(dataB, &transfer); err != nil {
+    return fmt.Errorf("Decode transfer action %s", err)
+  }
+
+  quantity, err := eos.NewAsset(options.Amount)
+  if err != nil {
+    return fmt.Errorf("Intent amount %s", err)
+  }
+  if string(transfer.To) != options.To || transfer.Quantity.Amount != quantity.Amount || transfer.Quantity.Symbol != quantity.Symbol {
+    return fmt.Errorf("Transfer doesn't match intent: to %s quantity %s", transfer.To, transfer.Quantity.String())
+  }
+  if configure.ChainsInfo[EOSIO].Accounts[string(transfer.From)] != options.From {
+    return fmt.Errorf("Account %s isn't controlled by %s", transfer.From, options.From)
+  }
+  for _, auth := range action.Authorization {
+    if auth.Actor != transfer.From {
+      return fmt.Errorf("Unexpected authorization %s", auth.Actor)
+    }
+  }
+  return nil
+}
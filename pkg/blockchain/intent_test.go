@@ -0,0 +1,218 @@
+package blockchain
+
+import (
+  "bytes"
+  "strings"
+  "testing"
+  "math/big"
+  "encoding/hex"
+  "wallet-go/pkg/keystore"
+  "wallet-go/pkg/configure"
+  "github.com/btcsuite/btcd/wire"
+  "github.com/btcsuite/btcd/chaincfg"
+  "github.com/btcsuite/btcd/chaincfg/chainhash"
+  "github.com/ethereum/go-ethereum/common"
+  "github.com/ethereum/go-ethereum/core/types"
+)
+
+// testChainInfo replace chain info of one chain and its coin asset until test ends
+func testChainInfo(t *testing.T, chain string, info configure.ChainInfo) {
+  chainsInfo, chainAssets := configure.ChainsInfo, configure.ChainAssets
+  configure.ChainsInfo = map[string]configure.ChainInfo{chain: info}
+  configure.ChainAssets = map[string]string{strings.ToLower(info.Coin): chain}
+  t.Cleanup(func() {
+    configure.ChainsInfo, configure.ChainAssets = chainsInfo, chainAssets
+  })
+}
+
+// testKeys key store owning addresses, other methods are not used by verification
+type testKeys struct {
+  keystore.KeyStore
+  addresses map[string]bool
+}
+
+func (k testKeys) Has(address string) (bool, error) {
+  return k.addresses[address], nil
+}
+
+// testBitcoinTx hex of tx spending one input to the outputs
+func testBitcoinTx(t *testing.T, outputs map[string]int64) string {
+  msgTx := wire.NewMsgTx(wire.TxVersion)
+  msgTx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{1}, 0), nil, nil))
+  for address, value := range outputs {
+    pkScript, err := BitcoincoreAddressP2AS(address, &chaincfg.MainNetParams)
+    if err != nil {
+      t.Fatal(err)
+    }
+    msgTx.AddTxOut(wire.NewTxOut(value, pkScript))
+  }
+  var buf bytes.Buffer
+  if err := msgTx.Serialize(&buf); err != nil {
+    t.Fatal(err)
+  }
+  return hex.EncodeToString(buf.Bytes())
+}
+
+func TestBitcoinVerifyTxFee(t *testing.T) {
+  testChainInfo(t, Bitcoin, configure.ChainInfo{Coin: "btc", MaxFee: "0.001"})
+  const (
+    from = "1EHNa6Q4Jz2uvNExL497mE43ikXhwF6kZm"
+    to   = "1BoatSLRHtKNngkdXEeobR76b53LETtpyT"
+  )
+  rawTxHex := testBitcoinTx(t, map[string]int64{to: 100000000})
+  chain := BitcoinCoreChain{Mode: &chaincfg.MainNetParams, Keys: testKeys{addresses: map[string]bool{from: true}}}
+
+  cases := []struct {
+    vinAmounts []int64
+    ok         bool
+  }{
+    {[]int64{100000000 + 100000}, true},
+    {[]int64{100000000 + 100001}, false},
+    // outputs spend more than inputs
+    {[]int64{99999999}, false},
+    // input amounts are required by max_fee
+    {nil, false},
+  }
+  for _, c := range cases {
+    options := NewChainsOptions(ChainFrom(from), ChainVinAmounts(c.vinAmounts), ChainIntent(to, "1", "btc"))
+    if err := chain.VerifyTx(rawTxHex, options); (err == nil) != c.ok {
+      t.Fatalf("vin amounts %v: %v", c.vinAmounts, err)
+    }
+  }
+
+  testChainInfo(t, Bitcoin, configure.ChainInfo{Coin: "btc"})
+  if err := chain.VerifyTx(rawTxHex, NewChainsOptions(ChainFrom(from), ChainIntent(to, "1", "btc"))); err != nil {
+    t.Fatalf("fee isn't capped without max_fee: %v", err)
+  }
+}
+
+func TestBitcoinVerifyTxInputOwner(t *testing.T) {
+  testChainInfo(t, Bitcoin, configure.ChainInfo{Coin: "btc"})
+  const (
+    from  = "1EHNa6Q4Jz2uvNExL497mE43ikXhwF6kZm"
+    other = "1LoVGDgRs9hTfTNJNuXKSpywcbdvwRXpmK"
+    to    = "1BoatSLRHtKNngkdXEeobR76b53LETtpyT"
+  )
+  pkScript := func(address string) []byte {
+    script, err := BitcoincoreAddressP2AS(address, &chaincfg.MainNetParams)
+    if err != nil {
+      t.Fatal(err)
+    }
+    return script
+  }
+  chain := BitcoinCoreChain{Mode: &chaincfg.MainNetParams, Keys: testKeys{addresses: map[string]bool{from: true, other: true}}}
+  verify := func(to string, vinPkScript []byte) error {
+    rawTxHex := testBitcoinTx(t, map[string]int64{to: 100000000})
+    options := NewChainsOptions(ChainFrom(from), ChainVinAmounts([]int64{100000000}), ChainVinPkScripts([][]byte{vinPkScript}), ChainIntent(to, "1", "btc"))
+    return chain.VerifyTx(rawTxHex, options)
+  }
+
+  if err := verify(to, pkScript(from)); err != nil {
+    t.Fatal(err)
+  }
+  // another wallet address pays withdrawal authorized for From
+  if err := verify(to, pkScript(other)); err == nil {
+    t.Fatal("input of another wallet address is signed")
+  }
+  if err := verify(to, pkScript(to)); err == nil {
+    t.Fatal("input of foreign address is signed")
+  }
+  // wallet addresses may be swept to wallet address
+  if err := verify(from, pkScript(other)); err != nil {
+    t.Fatal(err)
+  }
+
+  owners, err := chain.InputOwners(testBitcoinTx(t, map[string]int64{to: 1}), NewChainsOptions(ChainVinAmounts([]int64{7}), ChainVinPkScripts([][]byte{pkScript(other)})))
+  if err != nil {
+    t.Fatal(err)
+  }
+  if len(owners) != 1 || owners[0].Address != other || owners[0].Amount != 7 || owners[0].Outpoints[0] != (&chainhash.Hash{1}).String() + ":0" {
+    t.Fatalf("input owners %+v", owners)
+  }
+}
+
+func TestEthereumVerifyTxLegacy(t *testing.T) {
+  testChainInfo(t, Ethereum, configure.ChainInfo{Coin: "eth", MaxFee: "0.01", ChainID: "1"})
+  to := common.HexToAddress("0x7E5F4552091A69125d5DfCb7b8C2659029395Bdf")
+  value := new(big.Int).Exp(big.NewInt(10), big.NewInt(18), nil)
+  legacyTx := func(gasPrice int64) string {
+    txHex, err := EncodeETHTx(types.NewTransaction(0, to, value, 21000, big.NewInt(gasPrice), nil))
+    if err != nil {
+      t.Fatal(err)
+    }
+    return txHex
+  }
+  chain := EthereumChain{}
+  cases := []struct {
+    rawTxHex string
+    chainID  string
+    ok       bool
+  }{
+    // 21000 gas * 476 gwei is under 0.01 ether
+    {legacyTx(476000000000), "1", true},
+    {legacyTx(477000000000), "1", false},
+    {legacyTx(1000000000), "", false},
+    {legacyTx(1000000000), "0", false},
+    {legacyTx(1000000000), "3", false},
+  }
+  for i, c := range cases {
+    options := NewChainsOptions(ChainID(c.chainID), ChainIntent(to.Hex(), "1", "eth"))
+    if err := chain.VerifyTx(c.rawTxHex, options); (err == nil) != c.ok {
+      t.Fatalf("case %d: %v", i, err)
+    }
+  }
+}
+
+func TestEthereumVerifyTxDynamicFee(t *testing.T) {
+  testChainInfo(t, Ethereum, configure.ChainInfo{Coin: "eth", MaxFee: "0.01"})
+  to := common.HexToAddress("0x7E5F4552091A69125d5DfCb7b8C2659029395Bdf")
+  dynamicTx := func(chainID, feeCap int64) string {
+    txHex, err := EncodeDynamicFeeTx(&DynamicFeeTx{ChainID: big.NewInt(chainID), GasTipCap: big.NewInt(1), GasFeeCap: big.NewInt(feeCap), Gas: 21000, To: &to, Value: big.NewInt(1000)})
+    if err != nil {
+      t.Fatal(err)
+    }
+    return txHex
+  }
+  chain := EthereumChain{}
+  options := NewChainsOptions(ChainID("1"), ChainIntent(to.Hex(), "0.000000000000001", "eth"))
+  if err := chain.VerifyTx(dynamicTx(1, 476000000000), options); err != nil {
+    t.Fatal(err)
+  }
+  if err := chain.VerifyTx(dynamicTx(1, 477000000000), options); err == nil {
+    t.Fatal("fee cap above max_fee is signed")
+  }
+  if err := chain.VerifyTx(dynamicTx(5, 1000000000), options); err == nil {
+    t.Fatal("tx of another chain id is signed")
+  }
+}
+
+func TestEthereumVerifyTxAmount(t *testing.T) {
+  testChainInfo(t, Ethereum, configure.ChainInfo{Coin: "eth"})
+  from := "0x2c7536E3605D9C16a7a3D7b1898e529396a65c23"
+  to := common.HexToAddress("0x7E5F4552091A69125d5DfCb7b8C2659029395Bdf")
+  zeroTx := func(to common.Address) string {
+    txHex, err := EncodeETHTx(types.NewTransaction(0, to, big.NewInt(0), 21000, big.NewInt(1), nil))
+    if err != nil {
+      t.Fatal(err)
+    }
+    return txHex
+  }
+  chain := EthereumChain{}
+  // cancel pays 0 ether to sender itself
+  if err := chain.VerifyTx(zeroTx(common.HexToAddress(from)), NewChainsOptions(ChainID("1"), ChainFrom(from), ChainIntent(strings.ToLower(from), "0", "eth"))); err != nil {
+    t.Fatal(err)
+  }
+  if err := chain.VerifyTx(zeroTx(to), NewChainsOptions(ChainID("1"), ChainFrom(from), ChainIntent(to.Hex(), "0", "eth"))); err == nil {
+    t.Fatal("0 ether to other address is signed")
+  }
+
+  token := &EthereumToken{Asset: "usdt", Decimals: 6}
+  for _, amount := range []string{"0", "-1", "0.0000001"} {
+    if _, err := token.ToBaseUnits(amount); err == nil {
+      t.Fatalf("amount %s is converted", amount)
+    }
+  }
+  if units, err := token.ToBaseUnits("1.5"); err != nil || units.Int64() != 1500000 {
+    t.Fatalf("1.5 usdt %s %v", units, err)
+  }
+}
@@ -3,18 +3,22 @@ package blockchain
 import (
   "context"
   "wallet-go/pkg/common"
+  "github.com/btcsuite/btcutil"
+  "github.com/btcsuite/btcutil/coinset"
 )
 
-// TxOperator transaction operator
+// TxOperator transaction operator, SignedTx signs by key of options From in the chain key store,
+// VerifyTx checks raw tx against the intent in options before signing
 type TxOperator interface {
   RawTx(ctx context.Context, from, to, amount, memo, asset string) (string, error)
-  SignedTx(rawTxHex, wif string, options *ChainsOptions) (string, error)
+  VerifyTx(rawTxHex string, options *ChainsOptions) error
+  SignedTx(rawTxHex string, options *ChainsOptions) (string, error)
   BroadcastTx(ctx context.Context, signedTxHex string) (string, error)
 }
 
-// ChainWallet chain wallet
+// ChainWallet chain wallet, Create returns address and its derivation path
 type ChainWallet interface {
-  Create() (string, error)
+  Create() (string, string, error)
 }
 
 // ChainQuery blockchain client query
@@ -23,3 +27,16 @@ type ChainQuery interface {
   Balance(ctx context.Context, account, symbol, code string) (string, error)
   Block(height int64) (<-chan common.QueryBlockResult)
 }
+
+// CoinSelector select coins whose effective value covers target, target is output value plus fee of the tx without inputs
+type CoinSelector interface {
+  Name() string
+  Select(target btcutil.Amount, coins []coinset.Coin, params CoinSelectParams) (*CoinSelection, error)
+}
+
+// NonceManager allocates nonce of ethereum address not less than pending nonce of the chain,
+// nonce is released when its tx isn't broadcast
+type NonceManager interface {
+  AllocateNonce(address string, pendingNonce uint64) (uint64, error)
+  ReleaseNonce(address string, nonce uint64) error
+}
@@ -15,10 +15,34 @@ func ChainFrom(from string) ChainsOption {
   }
 }
 
-// ChainVinAmount vin amount option
-func ChainVinAmount(amount int64) ChainsOption {
+// ChainVinPkScripts previous output script of each vin option, in the same order as tx inputs
+func ChainVinPkScripts(pkScripts [][]byte) ChainsOption {
   return func(args *ChainsOptions)  {
-    args.VinAmount = amount
+    args.VinPkScripts = pkScripts
+  }
+}
+
+// ChainVinAmounts amount of each vin option, in the same order as tx inputs
+func ChainVinAmounts(amounts []int64) ChainsOption {
+  return func(args *ChainsOptions)  {
+    args.VinAmounts = amounts
+  }
+}
+
+// ChainIntent intended recipient, amount and asset option
+func ChainIntent(to, amount, asset string) ChainsOption {
+  return func(args *ChainsOptions)  {
+    args.To = to
+    args.Amount = amount
+    args.Asset = asset
+  }
+}
+
+// ChainRecipients intended recipients of batch tx and asset option
+func ChainRecipients(recipients []Recipient, asset string) ChainsOption {
+  return func(args *ChainsOptions)  {
+    args.Recipients = recipients
+    args.Asset = asset
   }
 }
 
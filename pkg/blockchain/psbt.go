@@ -0,0 +1,481 @@
+package blockchain
+
+import (
+  "io"
+  "fmt"
+  "bytes"
+  "errors"
+  "encoding/hex"
+  "encoding/base64"
+  "encoding/binary"
+  "github.com/btcsuite/btcd/wire"
+  "github.com/btcsuite/btcd/btcec"
+  "github.com/btcsuite/btcd/txscript"
+)
+
+// BIP174 key types
+const (
+  psbtGlobalUnsignedTx       byte = 0x00
+
+  psbtInNonWitnessUtxo       byte = 0x00
+  psbtInWitnessUtxo          byte = 0x01
+  psbtInPartialSig           byte = 0x02
+  psbtInSighashType          byte = 0x03
+  psbtInRedeemScript         byte = 0x04
+  psbtInWitnessScript        byte = 0x05
+  psbtInBip32Derivation      byte = 0x06
+  psbtInFinalScriptSig       byte = 0x07
+  psbtInFinalScriptWitness   byte = 0x08
+
+  psbtOutRedeemScript        byte = 0x00
+  psbtOutWitnessScript       byte = 0x01
+  psbtOutBip32Derivation     byte = 0x02
+
+  // psbtMaxSize upper bound of a key or value
+  psbtMaxSize uint32 = 4000000
+)
+
+var psbtMagic = []byte{0x70, 0x73, 0x62, 0x74, 0xff}
+
+// NewPSBT PSBT of unsigned tx, inputs must not carry signature script or witness
+func NewPSBT(tx *wire.MsgTx) (*PSBT, error) {
+  for i, txIn := range tx.TxIn {
+    if len(txIn.SignatureScript) != 0 || len(txIn.Witness) != 0 {
+      return nil, fmt.Errorf("Input %d of PSBT unsigned tx is signed", i)
+    }
+  }
+  return &PSBT{
+    UnsignedTx: tx,
+    Inputs:     make([]PSBTInput, len(tx.TxIn)),
+    Outputs:    make([]PSBTOutput, len(tx.TxOut)),
+  }, nil
+}
+
+// DecodePSBT decode base64 PSBT
+func DecodePSBT(b64 string) (*PSBT, error) {
+  raw, err := base64.StdEncoding.DecodeString(b64)
+  if err != nil {
+    return nil, fmt.Errorf("PSBT base64 %s", err)
+  }
+  r := bytes.NewReader(raw)
+  magic := make([]byte, len(psbtMagic))
+  if _, err = io.ReadFull(r, magic); err != nil || !bytes.Equal(magic, psbtMagic) {
+    return nil, errors.New("Not PSBT, magic bytes mismatch")
+  }
+
+  var packet PSBT
+  err = readPSBTMap(r, func(key, value []byte) error {
+    switch key[0] {
+    case psbtGlobalUnsignedTx:
+      if len(key) != 1 || packet.UnsignedTx != nil {
+        return errors.New("Invalid PSBT unsigned tx key")
+      }
+      tx := wire.NewMsgTx(wire.TxVersion)
+      if err := tx.DeserializeNoWitness(bytes.NewReader(value)); err != nil {
+        return fmt.Errorf("PSBT unsigned tx %s", err)
+      }
+      packet.UnsignedTx = tx
+    default:
+      packet.Unknowns = append(packet.Unknowns, PSBTUnknown{Key: key, Value: value})
+    }
+    return nil
+  })
+  if err != nil {
+    return nil, err
+  }
+  if packet.UnsignedTx == nil {
+    return nil, errors.New("PSBT unsigned tx is missing")
+  }
+  unsigned, err := NewPSBT(packet.UnsignedTx)
+  if err != nil {
+    return nil, err
+  }
+  packet.Inputs, packet.Outputs = unsigned.Inputs, unsigned.Outputs
+
+  for i := range packet.Inputs {
+    if err = readPSBTMap(r, packet.Inputs[i].decode); err != nil {
+      return nil, fmt.Errorf("PSBT input %d %s", i, err)
+    }
+  }
+  for i := range packet.Outputs {
+    if err = readPSBTMap(r, packet.Outputs[i].decode); err != nil {
+      return nil, fmt.Errorf("PSBT output %d %s", i, err)
+    }
+  }
+  if r.Len() != 0 {
+    return nil, errors.New("Trailing bytes after PSBT")
+  }
+  return &packet, nil
+}
+
+// B64Encode serialize PSBT as base64
+func (p *PSBT) B64Encode() (string, error) {
+  var buf bytes.Buffer
+  buf.Write(psbtMagic)
+
+  var tx bytes.Buffer
+  if err := p.UnsignedTx.SerializeNoWitness(&tx); err != nil {
+    return "", err
+  }
+  writePSBTPair(&buf, []byte{psbtGlobalUnsignedTx}, tx.Bytes())
+  writePSBTUnknowns(&buf, p.Unknowns)
+  buf.WriteByte(0x00)
+
+  for _, in := range p.Inputs {
+    if err := in.encode(&buf); err != nil {
+      return "", err
+    }
+    buf.WriteByte(0x00)
+  }
+  for _, out := range p.Outputs {
+    out.encode(&buf)
+    buf.WriteByte(0x00)
+  }
+  return base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+// UnsignedTxHex hex of PSBT unsigned tx
+func (p *PSBT) UnsignedTxHex() (string, error) {
+  buf := bytes.NewBuffer(make([]byte, 0, p.UnsignedTx.SerializeSize()))
+  if err := p.UnsignedTx.Serialize(buf); err != nil {
+    return "", err
+  }
+  return hex.EncodeToString(buf.Bytes()), nil
+}
+
+// InputUtxo previous output spent by input i, non witness utxo must match the outpoint
+func (p *PSBT) InputUtxo(i int) (*wire.TxOut, error) {
+  if i >= len(p.Inputs) {
+    return nil, fmt.Errorf("PSBT input %d out of range", i)
+  }
+  in, outPoint := p.Inputs[i], p.UnsignedTx.TxIn[i].PreviousOutPoint
+  if in.NonWitnessUtxo != nil {
+    if in.NonWitnessUtxo.TxHash() != outPoint.Hash || int(outPoint.Index) >= len(in.NonWitnessUtxo.TxOut) {
+      return nil, fmt.Errorf("PSBT input %d non witness utxo doesn't match %s", i, outPoint.String())
+    }
+    txOut := in.NonWitnessUtxo.TxOut[outPoint.Index]
+    if in.WitnessUtxo != nil && (in.WitnessUtxo.Value != txOut.Value || !bytes.Equal(in.WitnessUtxo.PkScript, txOut.PkScript)) {
+      return nil, fmt.Errorf("PSBT input %d witness utxo conflicts with non witness utxo", i)
+    }
+    return txOut, nil
+  }
+  if in.WitnessUtxo != nil {
+    return in.WitnessUtxo, nil
+  }
+  return nil, fmt.Errorf("PSBT input %d carries no utxo", i)
+}
+
+// FinalizePSBT build final script sig and witness of single key inputs from partial signatures
+func FinalizePSBT(p *PSBT) error {
+  for i := range p.Inputs {
+    in := &p.Inputs[i]
+    if in.FinalScriptSig != nil || in.FinalScriptWitness != nil {
+      continue
+    }
+    utxo, err := p.InputUtxo(i)
+    if err != nil {
+      return err
+    }
+    if len(in.PartialSigs) != 1 {
+      return fmt.Errorf("PSBT input %d requires 1 partial signature, got %d", i, len(in.PartialSigs))
+    }
+    sig := in.PartialSigs[0]
+
+    switch txscript.GetScriptClass(utxo.PkScript) {
+    case txscript.PubKeyHashTy:
+      if in.FinalScriptSig, err = txscript.NewScriptBuilder().AddData(sig.Signature).AddData(sig.PubKey).Script(); err != nil {
+        return err
+      }
+    case txscript.WitnessV0PubKeyHashTy:
+      in.FinalScriptWitness = wire.TxWitness{sig.Signature, sig.PubKey}
+    case txscript.ScriptHashTy:
+      if txscript.GetScriptClass(in.RedeemScript) != txscript.WitnessV0PubKeyHashTy {
+        return fmt.Errorf("PSBT input %d only nested P2WPKH redeem script is supported", i)
+      }
+      if in.FinalScriptSig, err = txscript.NewScriptBuilder().AddData(in.RedeemScript).Script(); err != nil {
+        return err
+      }
+      in.FinalScriptWitness = wire.TxWitness{sig.Signature, sig.PubKey}
+    default:
+      return fmt.Errorf("PSBT input %d unsupported script %x", i, utxo.PkScript)
+    }
+    in.PartialSigs, in.SighashType, in.RedeemScript, in.WitnessScript, in.Bip32Derivation = nil, 0, nil, nil, nil
+  }
+  return nil
+}
+
+// ExtractPSBT signed tx of finalized PSBT, every input script is executed before return
+func ExtractPSBT(p *PSBT) (*wire.MsgTx, error) {
+  tx := p.UnsignedTx.Copy()
+  prevOuts := make([]*wire.TxOut, len(tx.TxIn))
+  for i, txIn := range tx.TxIn {
+    in := p.Inputs[i]
+    if in.FinalScriptSig == nil && in.FinalScriptWitness == nil {
+      return nil, fmt.Errorf("PSBT input %d isn't finalized", i)
+    }
+    utxo, err := p.InputUtxo(i)
+    if err != nil {
+      return nil, err
+    }
+    txIn.SignatureScript, txIn.Witness = in.FinalScriptSig, in.FinalScriptWitness
+    prevOuts[i] = utxo
+  }
+
+  sigHashes := txscript.NewTxSigHashes(tx)
+  for i := range tx.TxIn {
+    vm, err := txscript.NewEngine(prevOuts[i].PkScript, tx, i, txscript.StandardVerifyFlags, nil, sigHashes, prevOuts[i].Value)
+    if err != nil {
+      return nil, fmt.Errorf("Txscript.NewEngine %s", err)
+    }
+    if err = vm.Execute(); err != nil {
+      return nil, fmt.Errorf("PSBT input %d signature is invalid %s", i, err)
+    }
+  }
+  return tx, nil
+}
+
+// FinalizePSBTHex finalize and extract signed PSBT, return hex of the signed tx
+func FinalizePSBTHex(b64 string) (string, error) {
+  packet, err := DecodePSBT(b64)
+  if err != nil {
+    return "", err
+  }
+  if err = FinalizePSBT(packet); err != nil {
+    return "", err
+  }
+  tx, err := ExtractPSBT(packet)
+  if err != nil {
+    return "", err
+  }
+  buf := bytes.NewBuffer(make([]byte, 0, tx.SerializeSize()))
+  if err = tx.Serialize(buf); err != nil {
+    return "", err
+  }
+  return hex.EncodeToString(buf.Bytes()), nil
+}
+
+func (in *PSBTInput) decode(key, value []byte) error {
+  // key of every input type but partial signature and derivation is the type byte only
+  if len(key) != 1 && key[0] <= psbtInFinalScriptWitness && key[0] != psbtInPartialSig && key[0] != psbtInBip32Derivation {
+    return fmt.Errorf("Invalid PSBT input key %x", key)
+  }
+  switch key[0] {
+  case psbtInNonWitnessUtxo:
+    tx := wire.NewMsgTx(wire.TxVersion)
+    if err := tx.Deserialize(bytes.NewReader(value)); err != nil {
+      return fmt.Errorf("non witness utxo %s", err)
+    }
+    in.NonWitnessUtxo = tx
+  case psbtInWitnessUtxo:
+    txOut, err := readTxOut(value)
+    if err != nil {
+      return fmt.Errorf("witness utxo %s", err)
+    }
+    in.WitnessUtxo = txOut
+  case psbtInPartialSig:
+    if _, err := btcec.ParsePubKey(key[1:], btcec.S256()); err != nil {
+      return fmt.Errorf("partial signature public key %s", err)
+    }
+    in.PartialSigs = append(in.PartialSigs, PSBTPartialSig{PubKey: key[1:], Signature: value})
+  case psbtInSighashType:
+    if len(value) != 4 {
+      return errors.New("sighash type must be 4 bytes")
+    }
+    in.SighashType = txscript.SigHashType(binary.LittleEndian.Uint32(value))
+  case psbtInRedeemScript:
+    in.RedeemScript = value
+  case psbtInWitnessScript:
+    in.WitnessScript = value
+  case psbtInBip32Derivation:
+    derivation, err := readDerivation(key[1:], value)
+    if err != nil {
+      return err
+    }
+    in.Bip32Derivation = append(in.Bip32Derivation, *derivation)
+  case psbtInFinalScriptSig:
+    in.FinalScriptSig = value
+  case psbtInFinalScriptWitness:
+    witness, err := readWitness(value)
+    if err != nil {
+      return err
+    }
+    in.FinalScriptWitness = witness
+  default:
+    in.Unknowns = append(in.Unknowns, PSBTUnknown{Key: key, Value: value})
+  }
+  return nil
+}
+
+func (in *PSBTInput) encode(w *bytes.Buffer) error {
+  if in.NonWitnessUtxo != nil {
+    var tx bytes.Buffer
+    if err := in.NonWitnessUtxo.Serialize(&tx); err != nil {
+      return err
+    }
+    writePSBTPair(w, []byte{psbtInNonWitnessUtxo}, tx.Bytes())
+  }
+  if in.WitnessUtxo != nil {
+    var txOut bytes.Buffer
+    binary.Write(&txOut, binary.LittleEndian, in.WitnessUtxo.Value)
+    wire.WriteVarBytes(&txOut, 0, in.WitnessUtxo.PkScript)
+    writePSBTPair(w, []byte{psbtInWitnessUtxo}, txOut.Bytes())
+  }
+  for _, sig := range in.PartialSigs {
+    writePSBTPair(w, append([]byte{psbtInPartialSig}, sig.PubKey...), sig.Signature)
+  }
+  if in.SighashType != 0 {
+    value := make([]byte, 4)
+    binary.LittleEndian.PutUint32(value, uint32(in.SighashType))
+    writePSBTPair(w, []byte{psbtInSighashType}, value)
+  }
+  if in.RedeemScript != nil {
+    writePSBTPair(w, []byte{psbtInRedeemScript}, in.RedeemScript)
+  }
+  if in.WitnessScript != nil {
+    writePSBTPair(w, []byte{psbtInWitnessScript}, in.WitnessScript)
+  }
+  writeDerivations(w, psbtInBip32Derivation, in.Bip32Derivation)
+  if in.FinalScriptSig != nil {
+    writePSBTPair(w, []byte{psbtInFinalScriptSig}, in.FinalScriptSig)
+  }
+  if in.FinalScriptWitness != nil {
+    var witness bytes.Buffer
+    wire.WriteVarInt(&witness, 0, uint64(len(in.FinalScriptWitness)))
+    for _, item := range in.FinalScriptWitness {
+      wire.WriteVarBytes(&witness, 0, item)
+    }
+    writePSBTPair(w, []byte{psbtInFinalScriptWitness}, witness.Bytes())
+  }
+  writePSBTUnknowns(w, in.Unknowns)
+  return nil
+}
+
+func (out *PSBTOutput) decode(key, value []byte) error {
+  if len(key) != 1 && key[0] <= psbtOutWitnessScript {
+    return fmt.Errorf("Invalid PSBT output key %x", key)
+  }
+  switch key[0] {
+  case psbtOutRedeemScript:
+    out.RedeemScript = value
+  case psbtOutWitnessScript:
+    out.WitnessScript = value
+  case psbtOutBip32Derivation:
+    derivation, err := readDerivation(key[1:], value)
+    if err != nil {
+      return err
+    }
+    out.Bip32Derivation = append(out.Bip32Derivation, *derivation)
+  default:
+    out.Unknowns = append(out.Unknowns, PSBTUnknown{Key: key, Value: value})
+  }
+  return nil
+}
+
+func (out *PSBTOutput) encode(w *bytes.Buffer) {
+  if out.RedeemScript != nil {
+    writePSBTPair(w, []byte{psbtOutRedeemScript}, out.RedeemScript)
+  }
+  if out.WitnessScript != nil {
+    writePSBTPair(w, []byte{psbtOutWitnessScript}, out.WitnessScript)
+  }
+  writeDerivations(w, psbtOutBip32Derivation, out.Bip32Derivation)
+  writePSBTUnknowns(w, out.Unknowns)
+}
+
+// readPSBTMap read key-value pairs until the 0x00 separator, keys must be unique in a map
+func readPSBTMap(r *bytes.Reader, handle func(key, value []byte) error) error {
+  seen := make(map[string]bool)
+  for {
+    key, err := wire.ReadVarBytes(r, 0, psbtMaxSize, "psbt key")
+    if err != nil {
+      return err
+    }
+    if len(key) == 0 {
+      return nil
+    }
+    if seen[string(key)] {
+      return fmt.Errorf("Duplicated PSBT key %x", key)
+    }
+    seen[string(key)] = true
+    value, err := wire.ReadVarBytes(r, 0, psbtMaxSize, "psbt value")
+    if err != nil {
+      return err
+    }
+    if err = handle(key, value); err != nil {
+      return err
+    }
+  }
+}
+
+func writePSBTPair(w *bytes.Buffer, key, value []byte) {
+  wire.WriteVarBytes(w, 0, key)
+  wire.WriteVarBytes(w, 0, value)
+}
+
+func writePSBTUnknowns(w *bytes.Buffer, unknowns []PSBTUnknown) {
+  for _, unknown := range unknowns {
+    writePSBTPair(w, unknown.Key, unknown.Value)
+  }
+}
+
+func writeDerivations(w *bytes.Buffer, keyType byte, derivations []PSBTDerivation) {
+  for _, derivation := range derivations {
+    value := make([]byte, 0, 4 + 4 * len(derivation.Path))
+    value = append(value, derivation.Fingerprint...)
+    for _, index := range derivation.Path {
+      child := make([]byte, 4)
+      binary.LittleEndian.PutUint32(child, index)
+      value = append(value, child...)
+    }
+    writePSBTPair(w, append([]byte{keyType}, derivation.PubKey...), value)
+  }
+}
+
+// readDerivation fingerprint (4) | little endian uint32 child index...
+func readDerivation(pubKey, value []byte) (*PSBTDerivation, error) {
+  if _, err := btcec.ParsePubKey(pubKey, btcec.S256()); err != nil {
+    return nil, fmt.Errorf("derivation public key %s", err)
+  }
+  if len(value) < 4 || len(value) % 4 != 0 {
+    return nil, errors.New("Invalid BIP32 derivation value")
+  }
+  derivation := &PSBTDerivation{PubKey: pubKey, Fingerprint: value[:4]}
+  for i := 4; i < len(value); i += 4 {
+    derivation.Path = append(derivation.Path, binary.LittleEndian.Uint32(value[i:i + 4]))
+  }
+  return derivation, nil
+}
+
+// readTxOut amount (8) | varbytes pkScript
+func readTxOut(value []byte) (*wire.TxOut, error) {
+  r := bytes.NewReader(value)
+  var amount int64
+  if err := binary.Read(r, binary.LittleEndian, &amount); err != nil {
+    return nil, err
+  }
+  pkScript, err := wire.ReadVarBytes(r, 0, psbtMaxSize, "pkScript")
+  if err != nil {
+    return nil, err
+  }
+  return wire.NewTxOut(amount, pkScript), nil
+}
+
+func readWitness(value []byte) (wire.TxWitness, error) {
+  r := bytes.NewReader(value)
+  count, err := wire.ReadVarInt(r, 0)
+  if err != nil {
+    return nil, err
+  }
+  if count > uint64(len(value)) {
+    return nil, errors.New("Invalid final script witness")
+  }
+  witness := make(wire.TxWitness, 0, count)
+  for i := uint64(0); i < count; i++ {
+    item, err := wire.ReadVarBytes(r, 0, psbtMaxSize, "witness item")
+    if err != nil {
+      return nil, err
+    }
+    witness = append(witness, item)
+  }
+  return witness, nil
+}
@@ -2,10 +2,16 @@ package blockchain
 
 import (
   "wallet-go/pkg/db"
+  "wallet-go/pkg/keystore"
   "github.com/btcsuite/btcutil"
+  "github.com/btcsuite/btcd/wire"
+  "github.com/btcsuite/btcd/mempool"
+  "github.com/btcsuite/btcutil/coinset"
+  "github.com/btcsuite/btcd/txscript"
   "github.com/btcsuite/btcd/chaincfg/chainhash"
   "github.com/btcsuite/btcd/chaincfg"
   "github.com/btcsuite/btcd/rpcclient"
+  "github.com/ybbus/jsonrpc"
   "github.com/ethereum/go-ethereum/ethclient"
   "github.com/eoscanada/eos-go"
 )
@@ -28,21 +34,51 @@ const (
   EOSIO    string = "eosio"
 )
 
+const (
+  // BitcoinAddressLegacy P2PKH address
+  BitcoinAddressLegacy        string = "legacy"
+  // BitcoinAddressNestedSegwit P2SH-P2WPKH address
+  BitcoinAddressNestedSegwit  string = "p2sh-segwit"
+  // BitcoinAddressBech32 native segwit P2WPKH address
+  BitcoinAddressBech32        string = "bech32"
+)
+
 // BitcoinCoreChain bitcoin-core chain type
 type BitcoinCoreChain struct {
-  Mode    *chaincfg.Params
-  Wallet  *WalletInfo
-  Client  *rpcclient.Client
+  Mode        *chaincfg.Params
+  AddressType string
+  HD          *HDWallet
+  Keys        keystore.KeyStore
+  Wallet      *WalletInfo
+  Client      *rpcclient.Client
+  // CoinSelection coin selection strategy of RawTx, empty uses configured strategy
+  CoinSelection string
 }
 
 // EthereumChain ethereum chain type
 type EthereumChain struct {
   ChainID int
+  HD      *HDWallet
+  Keys    keystore.KeyStore
   Client  *ethclient.Client
+  // RPC json-rpc client of calls ethclient lacks, one client of EthRPC is shared when nil
+  RPC     jsonrpc.RPCClient
+  // Priority slow, normal or fast tip of EIP-1559 tx, empty is normal
+  Priority string
+  // Fee gas pricing of the raw tx, set by RawTx when not nil
+  Fee     *EthereumFee
+  // Quote gas pricing RawTx uses instead of querying node, e.g. the fee an amount is computed from
+  Quote   *EthereumFee
+  // Nonces allocator of raw tx nonce, pending nonce of the node is used when nil
+  Nonces  NonceManager
+  // Replaces pending tx replaced by the raw tx, its nonce is reused and fee is bumped over it
+  Replaces *EthereumPendingTx
 }
 
 // EOSChain EOS chain type
 type EOSChain struct {
+  HD      *HDWallet
+  Keys    keystore.KeyStore
   Client  *eos.API
 }
 
@@ -50,6 +86,10 @@ type EOSChain struct {
 type WalletInfo struct {
   Address *db.SubAddress
   SelectedUTXO []db.UTXO
+  // Owners sub addresses of selected utxos by id, when tx spends utxos of other addresses than Address
+  Owners       map[uint]*db.SubAddress
+  Selection    *CoinSelection
+  Fee          *BitcoinFee
 }
 
 // Blockchain chain info
@@ -87,18 +127,160 @@ type SimpleCoin struct {
 	TxNumConfs int64
 }
 
-// TxPoolInspect ethereum transaction pool datatype
-type TxPoolInspect struct {
-  Pending map[string]map[uint64]string  `json:"pending"`
-  Queued  map[string]map[uint64]string  `json:"queued"`
+// CoinSelectParams fee parameters of coin selection, effective value of a coin is its value minus fee of spending it
+type CoinSelectParams struct {
+  FeeRate          mempool.SatoshiPerByte
+  // LongTermFeeRate expected fee rate of spending change or unselected coins later
+  LongTermFeeRate  mempool.SatoshiPerByte
+  InputVSize       int
+  // ChangeFee fee of adding change output now
+  ChangeFee        btcutil.Amount
+  // ChangeCost fee of change output now plus fee of spending it later
+  ChangeCost       btcutil.Amount
+  MinChange        btcutil.Amount
+  MaxInputs        int
+}
+
+// CoinSelection selected coins and waste metric, lower waste is cheaper in the long term
+type CoinSelection struct {
+  Strategy  string
+  Coins     coinset.Coins
+  Value     btcutil.Amount
+  // Excess effective value above target
+  Excess    btcutil.Amount
+  // Change value of change output, 0 when changeless, excess goes to fee
+  Change    btcutil.Amount
+  // Waste satoshi: inputs fee above long term fee, plus change cost or dropped excess
+  Waste     int64
+}
+
+// BitcoinFee fee breakdown of bitcoin tx, size is of the signed tx
+type BitcoinFee struct {
+  FeeRate     mempool.SatoshiPerByte
+  Weight      int
+  VSize       int
+  InputValue  btcutil.Amount
+  OutputValue btcutil.Amount
+  Change      btcutil.Amount
+  // Fee input value minus output value
+  Fee         btcutil.Amount
+  // RequiredFee fee rate times vsize
+  RequiredFee btcutil.Amount
+  // AncestorVSize, AncestorFee unconfirmed parent package paid for by CPFP child
+  AncestorVSize int
+  AncestorFee   btcutil.Amount
+}
+
+// bitcoinMempoolEntry getmempoolentry fields of ancestor package, rpcclient result lacks fees object of bitcoin-core 0.17+
+type bitcoinMempoolEntry struct {
+  Size         int64   `json:"size"`
+  VSize        int64   `json:"vsize"`
+  Fee          float64 `json:"fee"`
+  AncestorSize int64   `json:"ancestorsize"`
+  // AncestorFees satoshi, deprecated by fees.ancestor in BTC
+  AncestorFees float64 `json:"ancestorfees"`
+  Fees         *struct {
+    Base     float64 `json:"base"`
+    Ancestor float64 `json:"ancestor"`
+  } `json:"fees"`
+}
+
+// BnBSelector branch and bound search of changeless input set with least waste
+type BnBSelector struct {
+  MaxTries int
+}
+
+// LargestFirstSelector spend largest coins first, fewest inputs
+type LargestFirstSelector struct {}
+
+// SmallestFirstSelector spend smallest coins first, consolidate more small coins while fee rate is below long term
+type SmallestFirstSelector struct {}
+
+// PrivacySelector avoid change output and merging coins: changeless set, then single coin, then fewest inputs
+type PrivacySelector struct {}
+
+// CheapestSelector run every strategy and pick the selection with least waste
+type CheapestSelector struct {
+  Selectors []CoinSelector
 }
 
 // ChainsOptions chain info
 type ChainsOptions struct {
-	ChainID   string
-  From      string
-  VinAmount int64
+	ChainID    string
+  From       string
+  VinAmounts []int64
+  // VinPkScripts previous output script of each vin, in the same order as tx inputs
+  VinPkScripts [][]byte
+  // transaction intent, which signed tx must match
+  To         string
+  Amount     string
+  Asset      string
+  // Recipients intent of batch tx, overrides To and Amount
+  Recipients []Recipient
+}
+
+// Recipient to address and amount of batch tx
+type Recipient struct {
+  To     string
+  Amount string
+}
+
+// BitcoinInputOwner key store address spent by tx inputs, Amount is satoshi of its inputs
+type BitcoinInputOwner struct {
+  Address   string
+  Amount    int64
+  // Outpoints txid:vout of its inputs
+  Outpoints []string
 }
 
 // ChainsOption options for tx
 type ChainsOption func(*ChainsOptions)
+
+// PSBT BIP174 partially signed bitcoin transaction
+type PSBT struct {
+  UnsignedTx  *wire.MsgTx
+  Inputs      []PSBTInput
+  Outputs     []PSBTOutput
+  Unknowns    []PSBTUnknown
+}
+
+// PSBTInput input map of PSBT
+type PSBTInput struct {
+  NonWitnessUtxo      *wire.MsgTx
+  WitnessUtxo         *wire.TxOut
+  PartialSigs         []PSBTPartialSig
+  SighashType         txscript.SigHashType
+  RedeemScript        []byte
+  WitnessScript       []byte
+  Bip32Derivation     []PSBTDerivation
+  FinalScriptSig      []byte
+  FinalScriptWitness  wire.TxWitness
+  Unknowns            []PSBTUnknown
+}
+
+// PSBTOutput output map of PSBT
+type PSBTOutput struct {
+  RedeemScript     []byte
+  WitnessScript    []byte
+  Bip32Derivation  []PSBTDerivation
+  Unknowns         []PSBTUnknown
+}
+
+// PSBTPartialSig DER signature with sighash type of the public key
+type PSBTPartialSig struct {
+  PubKey     []byte
+  Signature  []byte
+}
+
+// PSBTDerivation BIP32 origin of the public key, master key fingerprint and path
+type PSBTDerivation struct {
+  PubKey       []byte
+  Fingerprint  []byte
+  Path         []uint32
+}
+
+// PSBTUnknown key-value pair which is kept as is
+type PSBTUnknown struct {
+  Key    []byte
+  Value  []byte
+}
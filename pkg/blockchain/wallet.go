@@ -3,118 +3,109 @@ package blockchain
 import (
   "fmt"
   "strings"
-  "wallet-go/pkg/db"
   "github.com/btcsuite/btcutil"
+  "github.com/btcsuite/btcd/chaincfg"
   "github.com/btcsuite/btcutil/hdkeychain"
   "github.com/ethereum/go-ethereum/crypto"
   "github.com/eoscanada/eos-go/ecc"
 )
 
 // Create generate bitcoin wallet
-func (b BitcoinCoreChain) Create() (string, error) {
-	ldb, err := db.NewLDB(db.BitcoinCoreLD)
+func (b BitcoinCoreChain) Create() (string, string, error) {
+  addressType, err := BitcoinAddressType(b.AddressType)
   if err != nil {
-    return "", err
+    return "", "", err
   }
 
-  seed, err := hdkeychain.GenerateSeed(hdkeychain.RecommendedSeedLen)
-  if err != nil {
-    return "", fmt.Errorf("GenerateSeed %s", err)
-  }
-
-  key, err := hdkeychain.NewMaster(seed, b.Mode)
-  if err != nil {
-    return "", fmt.Errorf("NewMaster %s", err)
-  }
-
-	acct0, err := key.Child(hdkeychain.HardenedKeyStart + 0)
-	if err != nil {
-    return "", fmt.Errorf("Child 0 %s", err)
-  }
-
-	acct0Ext, err := acct0.Child(0)
-	if err != nil {
-    return "", fmt.Errorf("Acct0Ext %s", err)
-	}
-
-	acct0Ext10, err := acct0Ext.Child(10)
-	if err != nil {
-    return "", fmt.Errorf("Acct0Ext10 %s", err)
-	}
-
-	add, err := acct0Ext10.Address(b.Mode)
-	if err != nil {
-    return "", fmt.Errorf("Acct0Ext %s", err)
-	}
+  var address string
+  path, err := b.HD.NextKey(BitcoinPurpose(addressType), BIP44CoinTypeBitcoin, func(key *hdkeychain.ExtendedKey) error {
+    priv, err := key.ECPrivKey()
+    if err != nil {
+      return fmt.Errorf("Extended key to ec privite key %s", err)
+    }
 
-  _, err = ldb.Get([]byte(add.EncodeAddress()), nil)
-  if err != nil && strings.Contains(err.Error(), "leveldb: not found") && key.IsPrivate(){
-		priv, err := acct0Ext10.ECPrivKey()
+    add, err := BitcoinPubKeyAddress(priv.PubKey(), addressType, b.Mode)
     if err != nil {
-      return "", fmt.Errorf("Acct0Ext10 key to ec privite key %s", err)
+      return fmt.Errorf("Derive address %s", err)
     }
+    address = add.EncodeAddress()
 
-    wif, err := btcutil.NewWIF(priv, b.Mode, true)
+    exists, err := b.Keys.Has(address)
     if err != nil {
-      return "", fmt.Errorf("BTCec priv to wif %s", err)
+      return fmt.Errorf("Fail to add address %s : %s", address, err)
     }
-    if err := ldb.Put([]byte(add.EncodeAddress()), []byte(wif.String()), nil); err != nil {
-      return "", fmt.Errorf("Save privite key to leveldb %s", err)
+    if !exists {
+      if err := b.Keys.Put(address, priv.Serialize()); err != nil {
+        return fmt.Errorf("Save privite key to key store %s", err)
+      }
     }
-  }else if err != nil {
-    return "", fmt.Errorf("Fail to add address %s : %s", add.EncodeAddress(), err)
+    return nil
+  })
+  if err != nil {
+    return "", "", err
   }
-  defer ldb.Close()
-  return add.String(), nil
+  return address, path, nil
 }
 
 // Create generate ethereum wallet
-func (c EthereumChain) Create() (string, error) {
-  ldb, err := db.NewLDB(db.EthereumLD)
-  if err != nil {
-    return "", err
-  }
-  privateKey, err := crypto.GenerateKey()
-  if err != nil {
-    return "", fmt.Errorf("Fail to generate ethereum key %s", err)
-  }
-  privateKeyBytes := crypto.FromECDSA(privateKey)
-  address := strings.ToLower(crypto.PubkeyToAddress(privateKey.PublicKey).Hex())
+func (c EthereumChain) Create() (string, string, error) {
+  var address string
+  path, err := c.HD.NextKey(bip44Purpose, BIP44CoinTypeEthereum, func(key *hdkeychain.ExtendedKey) error {
+    priv, err := key.ECPrivKey()
+    if err != nil {
+      return fmt.Errorf("Extended key to ec privite key %s", err)
+    }
+    address = strings.ToLower(crypto.PubkeyToAddress(priv.ToECDSA().PublicKey).Hex())
 
-  _, err = ldb.Get([]byte(address), nil)
-  if err != nil && strings.Contains(err.Error(), "leveldb: not found") {
-    if err = ldb.Put([]byte(address), privateKeyBytes, nil); err != nil {
-      return "", fmt.Errorf("Save privite key to leveldb %s", err)
+    exists, err := c.Keys.Has(address)
+    if err != nil {
+      return fmt.Errorf("Fail to add address %s : %s", address, err)
+    }
+    if !exists {
+      if err = c.Keys.Put(address, priv.Serialize()); err != nil {
+        return fmt.Errorf("Save privite key to key store %s", err)
+      }
     }
-  }else if err != nil {
-    return "", fmt.Errorf("Fail to add address %s : %s", address, err)
+    return nil
+  })
+  if err != nil {
+    return "", "", err
   }
-  defer ldb.Close()
-  return address, nil
+  return address, path, nil
 }
 
 // Create generate eos key pair
-func (c EOSChain) Create() (string, error) {
-  ldb, err := db.NewLDB(db.EOSLD)
-  if err != nil {
-    return "", err
-  }
-  privateKey, err := ecc.NewRandomPrivateKey()
-  if err != nil {
-    return "", fmt.Errorf("Fail to generate eos key %s", err)
-  }
+func (c EOSChain) Create() (string, string, error) {
+  var pubKey string
+  path, err := c.HD.NextKey(bip44Purpose, BIP44CoinTypeEOSIO, func(key *hdkeychain.ExtendedKey) error {
+    priv, err := key.ECPrivKey()
+    if err != nil {
+      return fmt.Errorf("Extended key to ec privite key %s", err)
+    }
+    // EOS private key is the uncompressed bitcoin mainnet wif
+    btcWIF, err := btcutil.NewWIF(priv, &chaincfg.MainNetParams, false)
+    if err != nil {
+      return fmt.Errorf("BTCec priv to wif %s", err)
+    }
+    privateKey, err := ecc.NewPrivateKey(btcWIF.String())
+    if err != nil {
+      return fmt.Errorf("Fail to generate eos key %s", err)
+    }
 
-  wif := privateKey.String()
-  pub := privateKey.PublicKey()
-  _, err = ldb.Get([]byte(pub.String()), nil)
-  if err != nil && strings.Contains(err.Error(), "leveldb: not found") {
-    if err = ldb.Put([]byte(pub.String()), []byte(wif), nil); err != nil {
-      return "", fmt.Errorf("Save privite key to leveldb %s", err)
+    pubKey = privateKey.PublicKey().String()
+    exists, err := c.Keys.Has(pubKey)
+    if err != nil {
+      return fmt.Errorf("Fail to add address %s : %s", pubKey, err)
+    }
+    if !exists {
+      if err = c.Keys.Put(pubKey, priv.Serialize()); err != nil {
+        return fmt.Errorf("Save privite key to key store %s", err)
+      }
     }
-  }else if err != nil {
-    return "", fmt.Errorf("Fail to add address %s : %s", pub.String(), err)
+    return nil
+  })
+  if err != nil {
+    return "", "", err
   }
-
-  defer ldb.Close()
-  return pub.String(), nil
+  return pubKey, path, nil
 }
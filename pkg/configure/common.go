@@ -1,6 +1,7 @@
 package configure
 
 import (
+  "fmt"
   "strings"
   homedir "github.com/mitchellh/go-homedir"
 )
@@ -31,10 +32,64 @@ func (c *Configure) ChainConfigInfo() (map[string]ChainInfo, map[string]string)
 			case "coin":
 				chaininfo.Coin = strings.ToLower(vv.(string))
 				chainAssets[strings.ToLower(vv.(string))] = k
+			case "address_type":
+				chaininfo.AddressType = strings.ToLower(vv.(string))
+			case "coin_selection":
+				chaininfo.CoinSelection = strings.ToLower(vv.(string))
+			case "long_term_fee_rate":
+				chaininfo.LongTermFeeRate = int64(vv.(int))
+			case "fallback_fee_rate":
+				chaininfo.FallbackFeeRate = int64(vv.(int))
+			case "batch_window":
+				chaininfo.BatchWindow = vv.(int)
+			case "batch_size":
+				chaininfo.BatchSize = vv.(int)
+			case "consolidate_address":
+				chaininfo.ConsolidateAddress = vv.(string)
+			case "consolidate_fee_rate":
+				chaininfo.ConsolidateFeeRate = int64(vv.(int))
+			case "consolidate_max_amount":
+				switch amount := vv.(type) {
+				case int:
+					chaininfo.ConsolidateMaxAmount = float64(amount)
+				case float64:
+					chaininfo.ConsolidateMaxAmount = amount
+				}
+			case "consolidate_max_inputs":
+				chaininfo.ConsolidateMaxInputs = vv.(int)
+			case "consolidate_interval":
+				chaininfo.ConsolidateInterval = vv.(int)
+			case "max_fee":
+				chaininfo.MaxFee = fmt.Sprint(vv)
+			case "chain_id":
+				chaininfo.ChainID = fmt.Sprint(vv)
+			case "trace_internal":
+				chaininfo.TraceInternal = vv.(bool)
+			case "sweep_address":
+				chaininfo.SweepAddress = strings.ToLower(vv.(string))
+			case "sweep_thresholds":
+				chaininfo.SweepThresholds = make(map[string]string)
+				for ka, va := range vv.(map[string]interface{}) {
+					chaininfo.SweepThresholds[strings.ToLower(ka)] = fmt.Sprint(va)
+				}
+			case "sweep_interval":
+				chaininfo.SweepInterval = vv.(int)
 			case "tokens":
 				chaininfo.Tokens = make(map[string]string)
+				chaininfo.TokenDecimals = make(map[string]int32)
 				for kt, vt := range vv.(map[string]interface{}) {
-					chaininfo.Tokens[kt] = vt.(string)
+					// token is either its contract or {address, decimals}
+					switch token := vt.(type) {
+					case string:
+						chaininfo.Tokens[kt] = token
+					case map[string]interface{}:
+						if address, ok := token["address"].(string); ok {
+							chaininfo.Tokens[kt] = address
+						}
+						if decimals, ok := token["decimals"].(int); ok {
+							chaininfo.TokenDecimals[kt] = int32(decimals)
+						}
+					}
 					chainAssets[strings.ToLower(kt)] = k
 				}
       case "accounts":
@@ -48,3 +103,79 @@ func (c *Configure) ChainConfigInfo() (map[string]ChainInfo, map[string]string)
 	}
 	return chainsInfo, chainAssets
 }
+
+// KeyStoreConfigInfo key store info
+func KeyStoreConfigInfo(settings map[string]interface{}) KeyStoreInfo {
+	var info KeyStoreInfo
+	for k, v := range settings {
+		switch k {
+		case "backend":
+			info.Backend = strings.ToLower(v.(string))
+		case "dir":
+			info.Dir = v.(string)
+		case "pkcs11_module":
+			info.PKCS11Module = v.(string)
+		case "pkcs11_token":
+			info.PKCS11Token = v.(string)
+		case "pkcs11_pin":
+			info.PKCS11Pin = v.(string)
+		}
+	}
+	return info
+}
+
+// TLSConfigInfo wallet_core mutual TLS info
+func TLSConfigInfo(settings map[string]interface{}) TLSInfo {
+	var info TLSInfo
+	for k, v := range settings {
+		switch k {
+		case "ca_cert":
+			info.CACert = v.(string)
+		case "cert":
+			info.Cert = v.(string)
+		case "key":
+			info.Key = v.(string)
+		case "server_name":
+			info.ServerName = v.(string)
+		case "allowed_clients":
+			for _, name := range v.([]interface{}) {
+				info.AllowedClients = append(info.AllowedClients, name.(string))
+			}
+		case "signers":
+			for _, name := range v.([]interface{}) {
+				info.Signers = append(info.Signers, name.(string))
+			}
+		}
+	}
+	return info
+}
+
+// PolicyConfigInfo signing policies by asset
+func PolicyConfigInfo(settings map[string]interface{}) map[string]PolicyInfo {
+	policies := make(map[string]PolicyInfo)
+	for asset, v := range settings {
+		var info PolicyInfo
+		for k, vv := range v.(map[string]interface{}) {
+			switch k {
+			case "max_amount":
+				info.MaxAmount = fmt.Sprint(vv)
+			case "daily_limit":
+				info.DailyLimit = fmt.Sprint(vv)
+			case "address_daily_limit":
+				info.AddressDailyLimit = fmt.Sprint(vv)
+			case "allow":
+				for _, address := range vv.([]interface{}) {
+					info.Allow = append(info.Allow, address.(string))
+				}
+			case "deny":
+				for _, address := range vv.([]interface{}) {
+					info.Deny = append(info.Deny, address.(string))
+				}
+			case "window":
+				info.Window = vv.(string)
+			}
+		}
+		policies[strings.ToLower(asset)] = info
+	}
+	return policies
+}
@@ -101,8 +101,14 @@ func InitConfig() *Configure {
 			conf.KSPass = value.(string)
 		case "wallet_core_rpc_url":
 			conf.WalletCoreRPCURL = value.(string)
+		case "wallet_core_tls":
+			conf.WalletCoreTLS = TLSConfigInfo(viper.Sub("wallet_core_tls").AllSettings())
 		case "chains":
 			conf.Chains = viper.Sub("chains").AllSettings()
+		case "key_store":
+			conf.KeyStore = KeyStoreConfigInfo(viper.Sub("key_store").AllSettings())
+		case "policies":
+			conf.Policies = PolicyConfigInfo(viper.Sub("policies").AllSettings())
 		case "mq":
 			conf.MQ = value.(string)
 		}
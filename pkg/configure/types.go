@@ -55,8 +55,11 @@ type Configure struct {
 	KSPass                  string
 
 	WalletCoreRPCURL        string
+	WalletCoreTLS           TLSInfo
 
 	Chains                  map[string]interface{}
+	KeyStore                KeyStoreInfo
+	Policies                map[string]PolicyInfo
 
 	MQ                       string
 }
@@ -66,6 +69,69 @@ type ChainInfo struct {
 	Confirmations int
 	Chain         string
 	Coin          string
+	AddressType   string
+	// CoinSelection default coin selection strategy of bitcoin tx
+	CoinSelection string
+	// LongTermFeeRate satoshi per byte expected to spend change later
+	LongTermFeeRate int64
+	// FallbackFeeRate satoshi per byte used when node can't estimate fee rate, 0 refuses to build tx
+	FallbackFeeRate int64
+	// BatchWindow seconds queued withdrawals wait for batching, BatchSize queued count which flushes batch at once
+	BatchWindow   int
+	BatchSize     int
+	// ConsolidateAddress hot wallet sub address small utxos are swept into when fee rate isn't above ConsolidateFeeRate
+	ConsolidateAddress    string
+	ConsolidateFeeRate    int64
+	// ConsolidateMaxAmount BTC value of utxo worth consolidating, ConsolidateMaxInputs inputs of one consolidation tx
+	ConsolidateMaxAmount  float64
+	ConsolidateMaxInputs  int
+	// ConsolidateInterval seconds between scheduled consolidation, 0 disables it
+	ConsolidateInterval   int
+	// MaxFee coin amount a signed tx may pay as fee, wallet_core refuses txs above it, empty doesn't cap
+	MaxFee        string
+	// ChainID ethereum chain id wallet_core signs for, empty accepts the chain id of signature request
+	ChainID       string
 	Tokens        map[string]string
+	// TraceInternal ethereum deposits include internal value transfers found by callTracer, node needs debug api
+	TraceInternal bool
+	// TokenDecimals decimals of ethereum token asset, token without configured decimals is queried from its contract
+	TokenDecimals map[string]int32
+	// SweepAddress hot wallet sub address ethereum sub address balances above SweepThresholds are swept into
+	SweepAddress    string
+	SweepThresholds map[string]string
+	// SweepInterval seconds between scheduled sweeping, 0 disables it
+	SweepInterval   int
 	Accounts      map[string]string
 }
+
+// KeyStoreInfo private key store backend info
+type KeyStoreInfo struct {
+	Backend       string
+	Dir           string
+	PKCS11Module  string
+	PKCS11Token   string
+	PKCS11Pin     string
+}
+
+// PolicyInfo signing policy of an asset, empty limit means unlimited
+type PolicyInfo struct {
+	MaxAmount          string
+	DailyLimit         string
+	AddressDailyLimit  string
+	Allow              []string
+	Deny               []string
+	Window             string
+}
+
+// TLSInfo wallet_core gRPC mutual TLS info, cert and key are of the local side
+type TLSInfo struct {
+	CACert          string
+	Cert            string
+	Key             string
+	// ServerName wallet_core certificate name verified by client
+	ServerName      string
+	// AllowedClients client certificate common names allowed to call wallet_core
+	AllowedClients  []string
+	// Signers client certificate common names allowed to call Signature* methods
+	Signers         []string
+}
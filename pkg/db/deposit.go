@@ -0,0 +1,150 @@
+package db
+
+import (
+  "fmt"
+)
+
+// LatestEthereumBlock highest scanned ethereum block on the best chain, nil when nothing is scanned
+func (db *GormDB) LatestEthereumBlock() (*EthereumBlock, error) {
+  var block EthereumBlock
+  if err := db.Where("re_org = ?", false).Order("height desc").First(&block).Error; err != nil && err.Error() == "record not found" {
+    return nil, nil
+  }else if err != nil {
+    return nil, err
+  }
+  return &block, nil
+}
+
+// EthereumBlockAt scanned block at height on the best chain, nil when the height isn't scanned
+func (db *GormDB) EthereumBlockAt(height uint64) (*EthereumBlock, error) {
+  var block EthereumBlock
+  if err := db.Where("height = ? AND re_org = ?", height, false).First(&block).Error; err != nil && err.Error() == "record not found" {
+    return nil, nil
+  }else if err != nil {
+    return nil, err
+  }
+  return &block, nil
+}
+
+// SubAddressIDs id of addresses which are sub addresses of chain
+func (db *GormDB) SubAddressIDs(addresses []string, chain string) (map[string]uint, error) {
+  ids := make(map[string]uint)
+  if len(addresses) == 0 {
+    return ids, nil
+  }
+  var subAddresses []SubAddress
+  if err := db.Where("address IN (?) AND asset = ?", addresses, chain).Find(&subAddresses).Error; err != nil {
+    return nil, fmt.Errorf("Query sub address err: %s", err)
+  }
+  for _, address := range subAddresses {
+    ids[address.Address] = address.ID
+  }
+  return ids, nil
+}
+
+// EthereumSweepTxids txids among txids of chain which are sweeps or gas top-ups recorded in EthereumSweep,
+// or replacements of them sharing nonce
+func (db *GormDB) EthereumSweepTxids(txids []string, chain string) (map[string]bool, error) {
+  sweepTxids := make(map[string]bool)
+  if len(txids) == 0 {
+    return sweepTxids, nil
+  }
+  var withdrawals []Withdrawal
+  if err := db.Where("txid IN (?) AND chain = ?", txids, chain).Find(&withdrawals).Error; err != nil {
+    return nil, fmt.Errorf("Query withdrawals err: %s", err)
+  }
+  for _, withdrawal := range withdrawals {
+    var family []string
+    if err := db.Model(&Withdrawal{}).Where("chain = ? AND from_address = ? AND nonce = ?", chain, withdrawal.FromAddress, withdrawal.Nonce).Pluck("txid", &family).Error; err != nil {
+      return nil, fmt.Errorf("Query replacements of %s err: %s", withdrawal.Txid, err)
+    }
+    var count int
+    if err := db.Model(&EthereumSweep{}).Where("txid IN (?) OR fund_txid IN (?)", family, family).Count(&count).Error; err != nil {
+      return nil, fmt.Errorf("Query sweep of %s err: %s", withdrawal.Txid, err)
+    }
+    if count > 0 {
+      sweepTxids[withdrawal.Txid] = true
+    }
+  }
+  return sweepTxids, nil
+}
+
+// SaveEthereumBlock record scanned block and transfers paying to sub addresses of chain, others are dropped.
+// returns the recorded deposits, saving the same block again doesn't duplicate them
+func (db *GormDB) SaveEthereumBlock(block *EthereumBlock, transfers []EthereumDeposit, chain string) ([]EthereumDeposit, error) {
+  var tos []string
+  for _, transfer := range transfers {
+    tos = append(tos, transfer.ToAddress)
+  }
+  subAddresses, err := db.SubAddressIDs(tos, chain)
+  if err != nil {
+    return nil, err
+  }
+
+  ts := db.Begin()
+  if err := ts.Where(EthereumBlock{Hash: block.Hash}).Assign(map[string]interface{}{"height": block.Height, "re_org": false}).FirstOrCreate(block).Error; err != nil {
+    ts.Rollback()
+    return nil, fmt.Errorf("create block error: %s", err)
+  }
+  var deposits []EthereumDeposit
+  for _, transfer := range transfers {
+    id, ok := subAddresses[transfer.ToAddress]
+    if !ok {
+      continue
+    }
+    deposit := transfer
+    deposit.SubAddressID = id
+    if err := ts.Where("block_hash = ? AND token = ? AND log_index = ? AND trace_address = ?", transfer.BlockHash, transfer.Token, transfer.LogIndex, transfer.TraceAddress).Assign(map[string]interface{}{"re_org": false}).FirstOrCreate(&deposit).Error; err != nil {
+      ts.Rollback()
+      return nil, fmt.Errorf("create deposit %s:%d error: %s", transfer.Txid, transfer.LogIndex, err)
+    }
+    deposits = append(deposits, deposit)
+  }
+  if err := ts.Commit().Error; err != nil {
+    return nil, fmt.Errorf("database transaction err: %s", err)
+  }
+  return deposits, nil
+}
+
+// ReorgEthereumBlock mark block and its deposits as left the best chain
+func (db *GormDB) ReorgEthereumBlock(block *EthereumBlock) error {
+  ts := db.Begin()
+  if err := ts.Model(block).Update("re_org", true).Error; err != nil {
+    ts.Rollback()
+    return err
+  }
+  if err := ts.Model(&EthereumDeposit{}).Where("block_hash = ?", block.Hash).Update("re_org", true).Error; err != nil {
+    ts.Rollback()
+    return err
+  }
+  return ts.Commit().Error
+}
+
+// ConfirmEthereumDeposits update confirmations of unconfirmed deposits on the best chain at best height,
+// returns deposits reaching confirmations
+func (db *GormDB) ConfirmEthereumDeposits(bestHeight, confirmations uint64) ([]EthereumDeposit, error) {
+  var deposits []EthereumDeposit
+  if err := db.Where("confirmed = ? AND re_org = ? AND height <= ?", false, false, bestHeight).Find(&deposits).Error; err != nil {
+    return nil, err
+  }
+  var confirmed []EthereumDeposit
+  for _, deposit := range deposits {
+    depth := bestHeight - deposit.Height + 1
+    if err := db.Model(&deposit).Updates(map[string]interface{}{"confirmations": depth, "confirmed": depth >= confirmations}).Error; err != nil {
+      return nil, err
+    }
+    if depth >= confirmations {
+      confirmed = append(confirmed, deposit)
+    }
+  }
+  return confirmed, nil
+}
+
+// EthereumDepositAddresses sub addresses which received confirmed deposits on the best chain
+func (db *GormDB) EthereumDepositAddresses() ([]string, error) {
+  var addresses []string
+  if err := db.Model(&EthereumDeposit{}).Where("confirmed = ? AND re_org = ?", true, false).Pluck("DISTINCT to_address", &addresses).Error; err != nil {
+    return nil, fmt.Errorf("Query deposit addresses err: %s", err)
+  }
+  return addresses, nil
+}
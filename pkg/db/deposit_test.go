@@ -0,0 +1,147 @@
+package db
+
+import (
+  "testing"
+  "github.com/jinzhu/gorm"
+)
+
+// testGormDB in memory sqlite database with ethereum deposit tables
+func testGormDB(t *testing.T) *GormDB {
+  gdb, err := gorm.Open("sqlite3", ":memory:")
+  if err != nil {
+    t.Fatal(err)
+  }
+  // every connection of :memory: is a new database
+  gdb.DB().SetMaxOpenConns(1)
+  t.Cleanup(func() {
+    gdb.Close()
+  })
+  if err = gdb.AutoMigrate(&SubAddress{}, &Withdrawal{}, &EthereumBlock{}, &EthereumDeposit{}, &EthereumSweep{}).Error; err != nil {
+    t.Fatal(err)
+  }
+  return &GormDB{gdb}
+}
+
+func TestSaveEthereumBlock(t *testing.T) {
+  db := testGormDB(t)
+  const sub = "0x3535353535353535353535353535353535353535"
+  if err := db.Create(&SubAddress{Address: sub, Asset: "ethereum"}).Error; err != nil {
+    t.Fatal(err)
+  }
+  block := &EthereumBlock{Hash: "0x01", Height: 100}
+  transfers := []EthereumDeposit{
+    {Txid: "0xaa", BlockHash: "0x01", LogIndex: 0, Height: 100, Asset: "eth", FromAddress: "0x1", ToAddress: sub, Amount: "1"},
+    {Txid: "0xaa", BlockHash: "0x01", LogIndex: 0, TraceAddress: "0,1", Height: 100, Asset: "eth", FromAddress: "0x2", ToAddress: sub, Amount: "2"},
+    {Txid: "0xbb", BlockHash: "0x01", LogIndex: 3, Height: 100, Asset: "usdt", Token: "0xdac17f958d2ee523a2206206994597c13d831ec7", FromAddress: "0x1", ToAddress: sub, Amount: "5"},
+    // not a sub address
+    {Txid: "0xcc", BlockHash: "0x01", LogIndex: 4, Height: 100, Asset: "eth", FromAddress: "0x1", ToAddress: "0x4", Amount: "1"},
+  }
+  deposits, err := db.SaveEthereumBlock(block, transfers, "ethereum")
+  if err != nil {
+    t.Fatal(err)
+  }
+  if len(deposits) != 3 || deposits[0].SubAddressID == 0 {
+    t.Fatalf("deposits %+v", deposits)
+  }
+
+  // rescanning the block after restart doesn't duplicate deposits
+  again, err := db.SaveEthereumBlock(&EthereumBlock{Hash: "0x01", Height: 100}, transfers, "ethereum")
+  if err != nil {
+    t.Fatal(err)
+  }
+  var blocks, count int
+  db.Model(&EthereumBlock{}).Count(&blocks)
+  db.Model(&EthereumDeposit{}).Count(&count)
+  if blocks != 1 || count != 3 || len(again) != 3 || again[0].ID != deposits[0].ID {
+    t.Fatalf("blocks %d deposits %d %+v", blocks, count, again)
+  }
+
+  // block left the best chain, then came back
+  if err = db.ReorgEthereumBlock(block); err != nil {
+    t.Fatal(err)
+  }
+  if latest, err := db.LatestEthereumBlock(); err != nil || latest != nil {
+    t.Fatalf("latest block of reorganized chain %+v %v", latest, err)
+  }
+  if confirmed, err := db.ConfirmEthereumDeposits(200, 1); err != nil || len(confirmed) != 0 {
+    t.Fatalf("reorganized deposits are confirmed %+v %v", confirmed, err)
+  }
+  if _, err = db.SaveEthereumBlock(&EthereumBlock{Hash: "0x01", Height: 100}, transfers, "ethereum"); err != nil {
+    t.Fatal(err)
+  }
+  if at, err := db.EthereumBlockAt(100); err != nil || at == nil || at.Hash != "0x01" {
+    t.Fatalf("block at 100 %+v %v", at, err)
+  }
+  if confirmed, err := db.ConfirmEthereumDeposits(200, 1); err != nil || len(confirmed) != 3 {
+    t.Fatalf("restored deposits %+v %v", confirmed, err)
+  }
+}
+
+func TestConfirmEthereumDeposits(t *testing.T) {
+  db := testGormDB(t)
+  for _, deposit := range []EthereumDeposit{
+    {Txid: "0xaa", BlockHash: "0x01", Height: 100, Asset: "eth", FromAddress: "0x1", ToAddress: "0x2", Amount: "1"},
+    {Txid: "0xbb", BlockHash: "0x02", Height: 105, Asset: "eth", FromAddress: "0x1", ToAddress: "0x3", Amount: "1"},
+  } {
+    if err := db.Create(&deposit).Error; err != nil {
+      t.Fatal(err)
+    }
+  }
+
+  cases := []struct {
+    best      uint64
+    confirmed []string
+  }{
+    // deposit above best height is left alone
+    {99, nil},
+    {105, nil},
+    {111, []string{"0xaa"}},
+    // confirmed deposit isn't reported again
+    {120, []string{"0xbb"}},
+  }
+  for _, c := range cases {
+    confirmed, err := db.ConfirmEthereumDeposits(c.best, 12)
+    if err != nil {
+      t.Fatal(err)
+    }
+    var txids []string
+    for _, deposit := range confirmed {
+      txids = append(txids, deposit.Txid)
+    }
+    if len(txids) != len(c.confirmed) || (len(txids) == 1 && txids[0] != c.confirmed[0]) {
+      t.Fatalf("best %d confirmed %v", c.best, txids)
+    }
+  }
+  var deposit EthereumDeposit
+  if err := db.First(&deposit, "txid = ?", "0xbb").Error; err != nil || deposit.Confirmations != 16 || !deposit.Confirmed {
+    t.Fatalf("deposit %+v %v", deposit, err)
+  }
+  if addresses, err := db.EthereumDepositAddresses(); err != nil || len(addresses) != 2 {
+    t.Fatalf("deposit addresses %v %v", addresses, err)
+  }
+}
+
+func TestEthereumSweepTxids(t *testing.T) {
+  db := testGormDB(t)
+  for _, withdrawal := range []Withdrawal{
+    {Txid: "0xfund", Chain: "ethereum", FromAddress: "0xhot", Nonce: 7},
+    // speed up of the top-up
+    {Txid: "0xfund2", Chain: "ethereum", FromAddress: "0xhot", Nonce: 7, Replaces: "0xfund"},
+    // withdrawal from sweep_address to a sub address
+    {Txid: "0xpay", Chain: "ethereum", FromAddress: "0xhot", Nonce: 8},
+  } {
+    if err := db.Create(&withdrawal).Error; err != nil {
+      t.Fatal(err)
+    }
+  }
+  if err := db.Create(&EthereumSweep{Address: "0xsub", Asset: "usdt", Amount: "5", State: "funding", FundTxid: "0xfund"}).Error; err != nil {
+    t.Fatal(err)
+  }
+  txids, err := db.EthereumSweepTxids([]string{"0xfund2", "0xpay", "0xother"}, "ethereum")
+  if err != nil {
+    t.Fatal(err)
+  }
+  if len(txids) != 1 || !txids["0xfund2"] {
+    t.Fatalf("sweep txids %v", txids)
+  }
+}
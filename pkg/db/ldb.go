@@ -18,6 +18,14 @@ const (
   EthereumLD    string = "eth"
 	// EOSLD eos private key folder name
 	EOSLD         string = "eos"
+	// HDLD hd wallet master seed folder name
+	HDLD          string = "hd"
+	// KEKLD key encryption key params folder name
+	KEKLD         string = "kek"
+	// PolicyLD signing volume of policy engine folder name
+	PolicyLD      string = "policy"
+	// AuditLD wallet_core audit log folder name
+	AuditLD       string = "audit"
 )
 
 // NewLDB new leveldb
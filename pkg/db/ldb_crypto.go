@@ -0,0 +1,204 @@
+package db
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"wallet-go/pkg/util"
+	"github.com/syndtr/goleveldb/leveldb"
+	ldbutil "github.com/syndtr/goleveldb/leveldb/util"
+)
+
+const (
+	kekSaltKey   = "salt"
+	kekCheckKey  = "check"
+	kekCheckText = "wallet-go key encryption key"
+	kekSaltLen   = 16
+	dekLen       = 32
+)
+
+// envelopeMagic prefix of encrypted key: magic | KEK sealed DEK | DEK sealed private key
+var envelopeMagic = []byte("wgk1")
+
+var (
+	// ErrKEKNotInitialized key store passphrase hasn't been set by wallet_tools seed or encrypt
+	ErrKEKNotInitialized = errors.New("Key store isn't initialized, init it by wallet_tools seed or wallet_tools encrypt")
+	// ErrKEKExists key store passphrase is set already
+	ErrKEKExists = errors.New("Key store passphrase already exists")
+)
+
+// InitKEK create salt and check value of key encryption key, passphrase must have been confirmed by caller
+func InitKEK(passphrase string) (*KEK, error) {
+	ldb, err := NewLDB(KEKLD)
+	if err != nil {
+		return nil, err
+	}
+	defer ldb.Close()
+
+	if _, err = ldb.Get([]byte(kekSaltKey), nil); err == nil {
+		return nil, ErrKEKExists
+	}else if err != leveldb.ErrNotFound {
+		return nil, fmt.Errorf("Query KEK salt %s", err)
+	}
+	salt, err := util.RandomBytes(kekSaltLen)
+	if err != nil {
+		return nil, fmt.Errorf("KEK salt %s", err)
+	}
+	key, err := util.DeriveKey(passphrase, salt)
+	if err != nil {
+		return nil, fmt.Errorf("Derive KEK %s", err)
+	}
+	check, err := util.SealAESGCM([]byte(kekCheckText), key, nil)
+	if err != nil {
+		return nil, fmt.Errorf("KEK check value %s", err)
+	}
+	batch := new(leveldb.Batch)
+	batch.Put([]byte(kekSaltKey), salt)
+	batch.Put([]byte(kekCheckKey), check)
+	if err = ldb.Write(batch, nil); err != nil {
+		return nil, fmt.Errorf("Save KEK params %s", err)
+	}
+	return &KEK{key: key}, nil
+}
+
+// UnlockKEK derive key encryption key from passphrase, ErrKEKNotInitialized before InitKEK
+func UnlockKEK(passphrase string) (*KEK, error) {
+	ldb, err := NewLDB(KEKLD)
+	if err != nil {
+		return nil, err
+	}
+	defer ldb.Close()
+
+	salt, err := ldb.Get([]byte(kekSaltKey), nil)
+	if err == leveldb.ErrNotFound {
+		return nil, ErrKEKNotInitialized
+	}else if err != nil {
+		return nil, fmt.Errorf("Query KEK salt %s", err)
+	}
+
+	key, err := util.DeriveKey(passphrase, salt)
+	if err != nil {
+		return nil, fmt.Errorf("Derive KEK %s", err)
+	}
+	check, err := ldb.Get([]byte(kekCheckKey), nil)
+	if err != nil {
+		return nil, fmt.Errorf("Query KEK check value %s", err)
+	}
+	if plain, err := util.OpenAESGCM(check, key, nil); err != nil || string(plain) != kekCheckText {
+		return nil, errors.New("Wrong key store passphrase")
+	}
+	return &KEK{key: key}, nil
+}
+
+// NewEncryptedLDB leveldb which saves private key in AES-GCM envelope
+func NewEncryptedLDB(asset string, kek *KEK) (*EncryptedLDB, error) {
+	if kek == nil {
+		return nil, errors.New("Key store is locked, unlock it when wallet_core start")
+	}
+	ldb, err := NewLDB(asset)
+	if err != nil {
+		return nil, err
+	}
+	return &EncryptedLDB{LDB: ldb, kek: kek}, nil
+}
+
+// PutKey encrypt private key with a random DEK, DEK is sealed by KEK, address is bound as additional data
+func (db *EncryptedLDB) PutKey(address string, priv []byte) error {
+	envelope, err := db.seal(address, priv)
+	if err != nil {
+		return err
+	}
+	return db.Put([]byte(address), envelope, nil)
+}
+
+// GetKey decrypt private key of address
+func (db *EncryptedLDB) GetKey(address string) ([]byte, error) {
+	envelope, err := db.Get([]byte(address), nil)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.HasPrefix(envelope, envelopeMagic) {
+		return nil, fmt.Errorf("Private key of %s is plaintext, encrypt key store by wallet_tools encrypt", address)
+	}
+	return db.open(address, envelope)
+}
+
+// HasKey whether address key exists
+func (db *EncryptedLDB) HasKey(address string) (bool, error) {
+	_, err := db.Get([]byte(address), nil)
+	if err != nil && strings.Contains(err.Error(), "leveldb: not found") {
+		return false, nil
+	}else if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// EncryptPlaintext re-encrypt plaintext private keys in place, compact leveldb to drop plaintext from disk
+func (db *EncryptedLDB) EncryptPlaintext() (int, error) {
+	batch := new(leveldb.Batch)
+	iter := db.NewIterator(nil, nil)
+	for iter.Next() {
+		if bytes.HasPrefix(iter.Value(), envelopeMagic) {
+			continue
+		}
+		address := string(iter.Key())
+		envelope, err := db.seal(address, iter.Value())
+		if err != nil {
+			iter.Release()
+			return 0, fmt.Errorf("Encrypt %s %s", address, err)
+		}
+		batch.Put([]byte(address), envelope)
+	}
+	iter.Release()
+	if err := iter.Error(); err != nil {
+		return 0, err
+	}
+	if batch.Len() == 0 {
+		return 0, nil
+	}
+	if err := db.Write(batch, nil); err != nil {
+		return 0, fmt.Errorf("Save encrypted keys %s", err)
+	}
+	if err := db.CompactRange(ldbutil.Range{}); err != nil {
+		return 0, fmt.Errorf("Compact leveldb %s", err)
+	}
+	return batch.Len(), nil
+}
+
+func (db *EncryptedLDB) seal(address string, priv []byte) ([]byte, error) {
+	dek, err := util.RandomBytes(dekLen)
+	if err != nil {
+		return nil, err
+	}
+	sealedDEK, err := util.SealAESGCM(dek, db.kek.key, []byte(address))
+	if err != nil {
+		return nil, err
+	}
+	sealedKey, err := util.SealAESGCM(priv, dek, []byte(address))
+	if err != nil {
+		return nil, err
+	}
+	envelope := append([]byte{}, envelopeMagic...)
+	envelope = append(envelope, byte(len(sealedDEK)))
+	envelope = append(envelope, sealedDEK...)
+	return append(envelope, sealedKey...), nil
+}
+
+func (db *EncryptedLDB) open(address string, envelope []byte) ([]byte, error) {
+	body := envelope[len(envelopeMagic):]
+	if len(body) < 1 || len(body) < 1 + int(body[0]) {
+		return nil, fmt.Errorf("Corrupted private key envelope of %s", address)
+	}
+	sealedDEK, sealedKey := body[1:1 + int(body[0])], body[1 + int(body[0]):]
+	dek, err := util.OpenAESGCM(sealedDEK, db.kek.key, []byte(address))
+	if err != nil {
+		return nil, fmt.Errorf("Decrypt DEK of %s %s", address, err)
+	}
+	priv, err := util.OpenAESGCM(sealedKey, dek, []byte(address))
+	if err != nil {
+		return nil, fmt.Errorf("Decrypt private key of %s %s", address, err)
+	}
+	return priv, nil
+}
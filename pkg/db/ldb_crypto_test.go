@@ -0,0 +1,115 @@
+package db
+
+import (
+	"bytes"
+	"testing"
+	"wallet-go/pkg/configure"
+	"wallet-go/pkg/util"
+	"github.com/mitchellh/go-homedir"
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+func testEncryptedLDB(t *testing.T, kek *KEK) *EncryptedLDB {
+	ldb, err := leveldb.OpenFile(t.TempDir(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ldb.Close() })
+	return &EncryptedLDB{LDB: &LDB{DB: ldb}, kek: kek}
+}
+
+func testKEK(t *testing.T) *KEK {
+	key, err := util.RandomBytes(32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &KEK{key: key}
+}
+
+func TestKeyEnvelope(t *testing.T) {
+	kek := testKEK(t)
+	store := testEncryptedLDB(t, kek)
+	priv := bytes.Repeat([]byte{0x11}, 32)
+	if err := store.PutKey("addr1", priv); err != nil {
+		t.Fatal(err)
+	}
+	raw, err := store.Get([]byte("addr1"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(raw, envelopeMagic) || bytes.Contains(raw, priv) {
+		t.Fatalf("private key isn't sealed: %x", raw)
+	}
+	got, err := store.GetKey("addr1")
+	if err != nil || !bytes.Equal(got, priv) {
+		t.Fatalf("GetKey %x %v", got, err)
+	}
+
+	// envelope is bound to its address
+	if err = store.Put([]byte("addr2"), raw, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = store.GetKey("addr2"); err == nil {
+		t.Fatal("envelope of addr1 opened as addr2")
+	}
+	// another KEK can't open it
+	other := &EncryptedLDB{LDB: store.LDB, kek: testKEK(t)}
+	if _, err = other.GetKey("addr1"); err == nil {
+		t.Fatal("envelope opened by another KEK")
+	}
+	// tampered key is rejected
+	tampered := append([]byte{}, raw...)
+	tampered[len(tampered) - 1] ^= 0x01
+	if err = store.Put([]byte("addr1"), tampered, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = store.GetKey("addr1"); err == nil {
+		t.Fatal("tampered envelope opened")
+	}
+}
+
+func TestEncryptPlaintext(t *testing.T) {
+	store := testEncryptedLDB(t, testKEK(t))
+	priv := bytes.Repeat([]byte{0x22}, 32)
+	if err := store.Put([]byte("addr"), priv, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.GetKey("addr"); err == nil {
+		t.Fatal("plaintext key returned")
+	}
+	count, err := store.EncryptPlaintext()
+	if err != nil || count != 1 {
+		t.Fatalf("EncryptPlaintext %d %v", count, err)
+	}
+	if count, err = store.EncryptPlaintext(); err != nil || count != 0 {
+		t.Fatalf("EncryptPlaintext again %d %v", count, err)
+	}
+	got, err := store.GetKey("addr")
+	if err != nil || !bytes.Equal(got, priv) {
+		t.Fatalf("GetKey %x %v", got, err)
+	}
+}
+
+func TestKEKBootstrap(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	// home dir is cached by go-homedir
+	homedir.Reset()
+	t.Cleanup(homedir.Reset)
+	configure.Config = &configure.Configure{DBWalletPath: "wallet"}
+
+	if _, err := UnlockKEK("passphrase"); err != ErrKEKNotInitialized {
+		t.Fatalf("UnlockKEK before init %v", err)
+	}
+	if _, err := InitKEK("passphrase"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := InitKEK("another"); err != ErrKEKExists {
+		t.Fatalf("InitKEK again %v", err)
+	}
+	if _, err := UnlockKEK("typo"); err == nil {
+		t.Fatal("wrong passphrase unlocked KEK")
+	}
+	if _, err := UnlockKEK("passphrase"); err != nil {
+		t.Fatal(err)
+	}
+}
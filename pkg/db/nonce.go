@@ -0,0 +1,180 @@
+package db
+
+import (
+  "fmt"
+  "strings"
+  "github.com/jinzhu/gorm"
+)
+
+// lockNonce EthereumNonce row of address locked until ts ends, created at pending nonce when missing
+func lockNonce(ts *gorm.DB, address string, pendingNonce uint64) (*EthereumNonce, error) {
+  var row EthereumNonce
+  err := ts.Where(EthereumNonce{Address: address}).Attrs(EthereumNonce{Next: pendingNonce}).FirstOrCreate(&row).Error
+  if err != nil && isDuplicateKey(err) {
+    // concurrent first allocation of address created the row, locking read waits for it and sees it once committed
+    row = EthereumNonce{}
+    err = ts.Set("gorm:query_option", "FOR UPDATE").Where("address = ?", address).First(&row).Error
+  }
+  if err != nil {
+    return nil, fmt.Errorf("Nonce of %s %s", address, err)
+  }
+  if err := ts.Set("gorm:query_option", "FOR UPDATE").First(&row, row.ID).Error; err != nil {
+    return nil, fmt.Errorf("Lock nonce of %s %s", address, err)
+  }
+  return &row, nil
+}
+
+// isDuplicateKey whether insert violates unique index, mysql error 1062 or sqlite constraint
+func isDuplicateKey(err error) bool {
+  return strings.Contains(err.Error(), "Error 1062") || strings.Contains(err.Error(), "UNIQUE constraint failed")
+}
+
+// AllocateNonce next nonce of ethereum address, released nonce is reused first so gaps are filled.
+// nonce isn't less than pending nonce of the chain, concurrent allocations of the same address are serialized by row lock
+func (db *GormDB) AllocateNonce(address string, pendingNonce uint64) (uint64, error) {
+  address = strings.ToLower(address)
+  ts := db.Begin()
+  row, err := lockNonce(ts, address, pendingNonce)
+  if err != nil {
+    ts.Rollback()
+    return 0, err
+  }
+  // released nonces below pending are taken by txs sent out of the wallet
+  if err = ts.Unscoped().Where("address = ? AND state = ? AND nonce < ?", address, "released", pendingNonce).Delete(&NonceAllocation{}).Error; err != nil {
+    ts.Rollback()
+    return 0, err
+  }
+
+  var released NonceAllocation
+  if err = ts.Where("address = ? AND state = ?", address, "released").Order("nonce").First(&released).Error; err == nil {
+    if err = ts.Model(&released).Update("state", "allocated").Error; err != nil {
+      ts.Rollback()
+      return 0, err
+    }
+    return released.Nonce, ts.Commit().Error
+  }else if err.Error() != "record not found" {
+    ts.Rollback()
+    return 0, err
+  }
+
+  nonce := row.Next
+  if nonce < pendingNonce {
+    nonce = pendingNonce
+  }
+  if err = ts.Create(&NonceAllocation{Address: address, Nonce: nonce, State: "allocated"}).Error; err != nil {
+    ts.Rollback()
+    return 0, fmt.Errorf("Allocate nonce %d of %s %s", nonce, address, err)
+  }
+  if err = ts.Model(row).Update("next", nonce + 1).Error; err != nil {
+    ts.Rollback()
+    return 0, err
+  }
+  return nonce, ts.Commit().Error
+}
+
+// ReleaseNonce give back nonce whose tx fails to be signed or broadcast, the last nonce is rolled back,
+// others are released for the next allocation
+func (db *GormDB) ReleaseNonce(address string, nonce uint64) error {
+  address = strings.ToLower(address)
+  ts := db.Begin()
+  row, err := lockNonce(ts, address, nonce)
+  if err != nil {
+    ts.Rollback()
+    return err
+  }
+  var allocation NonceAllocation
+  if err = ts.Where("address = ? AND nonce = ? AND state = ?", address, nonce, "allocated").First(&allocation).Error; err != nil && err.Error() == "record not found" {
+    ts.Rollback()
+    return nil
+  }else if err != nil {
+    ts.Rollback()
+    return err
+  }
+  if nonce + 1 == row.Next {
+    err = ts.Unscoped().Delete(&allocation).Error
+    if err == nil {
+      err = ts.Model(row).Update("next", nonce).Error
+    }
+  }else {
+    err = ts.Model(&allocation).Update("state", "released").Error
+  }
+  if err != nil {
+    ts.Rollback()
+    return err
+  }
+  return ts.Commit().Error
+}
+
+// BroadcastNonce nonce is used by broadcast tx
+func (db *GormDB) BroadcastNonce(address string, nonce uint64, txid string) error {
+  return db.Model(&NonceAllocation{}).Where("address = ? AND nonce = ?", strings.ToLower(address), nonce).Updates(map[string]interface{}{"state": "broadcast", "txid": txid}).Error
+}
+
+// NonceAddresses ethereum addresses having allocated nonce
+func (db *GormDB) NonceAddresses() ([]string, error) {
+  var addresses []string
+  err := db.Model(&EthereumNonce{}).Pluck("address", &addresses).Error
+  return addresses, err
+}
+
+// ReconcileNonce align allocations of address with the chain, latest is nonce of mined txs and pending includes mempool.
+// allocations below latest are removed, allocated but not broadcast ones are stale and released.
+// returns gaps, nonces between pending and the last broadcast one without tx, which block later txs until reused
+func (db *GormDB) ReconcileNonce(address string, latestNonce, pendingNonce uint64) ([]uint64, error) {
+  address = strings.ToLower(address)
+  ts := db.Begin()
+  row, err := lockNonce(ts, address, pendingNonce)
+  if err != nil {
+    ts.Rollback()
+    return nil, err
+  }
+  if err = ts.Unscoped().Where("address = ? AND nonce < ?", address, latestNonce).Delete(&NonceAllocation{}).Error; err != nil {
+    ts.Rollback()
+    return nil, err
+  }
+  if err = ts.Model(&NonceAllocation{}).Where("address = ? AND state = ?", address, "allocated").Update("state", "released").Error; err != nil {
+    ts.Rollback()
+    return nil, err
+  }
+  if err = ts.Unscoped().Where("address = ? AND state = ? AND nonce < ?", address, "released", pendingNonce).Delete(&NonceAllocation{}).Error; err != nil {
+    ts.Rollback()
+    return nil, err
+  }
+
+  var broadcast []NonceAllocation
+  if err = ts.Where("address = ? AND state = ? AND nonce >= ?", address, "broadcast", pendingNonce).Order("nonce").Find(&broadcast).Error; err != nil {
+    ts.Rollback()
+    return nil, err
+  }
+  next := pendingNonce
+  if len(broadcast) > 0 {
+    next = broadcast[len(broadcast) - 1].Nonce + 1
+  }
+  // released nonces from next on are rolled back
+  if err = ts.Unscoped().Where("address = ? AND state = ? AND nonce >= ?", address, "released", next).Delete(&NonceAllocation{}).Error; err != nil {
+    ts.Rollback()
+    return nil, err
+  }
+
+  var gaps []uint64
+  used := make(map[uint64]bool)
+  for _, allocation := range broadcast {
+    used[allocation.Nonce] = true
+  }
+  for nonce := pendingNonce; nonce < next; nonce++ {
+    if used[nonce] {
+      continue
+    }
+    gaps = append(gaps, nonce)
+    gap := NonceAllocation{Address: address, Nonce: nonce}
+    if err = ts.Where(gap).Assign(NonceAllocation{State: "released"}).FirstOrCreate(&gap).Error; err != nil {
+      ts.Rollback()
+      return nil, err
+    }
+  }
+  if err = ts.Model(row).Update("next", next).Error; err != nil {
+    ts.Rollback()
+    return nil, err
+  }
+  return gaps, ts.Commit().Error
+}
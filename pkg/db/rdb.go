@@ -27,7 +27,7 @@ func NewMySQL() (*GormDB, error) {
     return nil, errors.New(strings.Join([]string{"failed to connect database:", err.Error()}, ""))
   }
   configure.Sugar.Info("database connecting...")
-  db.AutoMigrate(&SubAddress{}, &SimpleBitcoinBlock{}, &UTXO{}, &transition.StateChangeLog{})
+  db.AutoMigrate(&SubAddress{}, &SimpleBitcoinBlock{}, &UTXO{}, &Withdrawal{}, &WithdrawalRequest{}, &EthereumNonce{}, &NonceAllocation{}, &EthereumBlock{}, &EthereumDeposit{}, &EthereumSweep{}, &transition.StateChangeLog{})
   db.DB().SetMaxIdleConns(100)
   return &GormDB{db}, nil
 }
@@ -74,6 +74,11 @@ func (db *GormDB) CreateBitcoinBlockWithUTXOs(queryBlockResultCh <- chan common.
             createBlockCh <- common.CreateBlockResult{Error: fmt.Errorf("Query sub address err: %s", err)}
             return
           }
+          // output spent by CPFP child before confirmation is recorded with height 0
+          if err := ts.Where("txid = ? AND vout_index = ? AND height = ?", tx.Txid, vout.N, 0).First(&utxo).Error; err == nil {
+            ts.Model(&utxo).Update("height", rawBlock.Height)
+            continue
+          }
           ts.FirstOrCreate(&utxo, UTXO{Txid: tx.Txid,
             Amount: vout.Value,
             Height: rawBlock.Height,
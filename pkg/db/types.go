@@ -11,6 +11,17 @@ type LDB struct {
 	*leveldb.DB
 }
 
+// KEK key encryption key derived from wallet passphrase
+type KEK struct {
+	key []byte
+}
+
+// EncryptedLDB private key leveldb, every key is saved in AES-GCM envelope
+type EncryptedLDB struct {
+	*LDB
+	kek *KEK
+}
+
 // GormDB relation database
 type GormDB struct {
 	*gorm.DB
@@ -25,6 +36,8 @@ type UTXO struct {
   VoutIndex             uint32    `gorm:"not null"`
   ReOrg                 bool      `gorm:"not null;default:false"`
   UsedBy                string
+  // UsedByReplaced txids which spent the utxo before being replaced by fee bumping, comma separated, oldest first
+  UsedByReplaced        string    `gorm:"type:text"`
   Chain                 string
   SubAddress            SubAddress
   SubAddressID          uint
@@ -38,9 +51,124 @@ type SubAddress struct {
 	gorm.Model
 	Address string `gorm:"type:varchar(100);not null;unique_index"`
   Asset   string `gorm:"type:varchar(42);not null"`
+  // key origin reported by wallet_core, empty for imported keys
+  DerivationPath     string `gorm:"type:varchar(64)"`
+  PublicKey          string `gorm:"type:varchar(66)"`
+  MasterFingerprint  string `gorm:"type:varchar(8)"`
   UTXOs   []UTXO
 }
 
+// Withdrawal withdrawal tx broadcast by wallet_gateway, fee bumping links the replacement chain
+type Withdrawal struct {
+  gorm.Model
+  Txid          string  `gorm:"type:varchar(66);not null;unique_index"`
+  Chain         string  `gorm:"type:varchar(42);not null"`
+  Asset         string  `gorm:"type:varchar(42);not null"`
+  FromAddress   string  `gorm:"type:varchar(100);not null"`
+  ToAddress     string  `gorm:"type:varchar(100);not null"`
+  Amount        string  `gorm:"not null"`
+  // FeeRate satoshi per vbyte
+  FeeRate       float64
+  // Fee paid tx fee, ethereum withdrawal records it once mined
+  Fee           float64
+  // MaxFee upper bound of ethereum tx fee in ether, gas limit times gas price or fee cap
+  MaxFee        float64
+  VSize         int
+  // Nonce ethereum tx nonce, replacements of the tx share it
+  Nonce         uint64
+  // Replaces txid of the withdrawal tx this one replaced
+  Replaces      string  `gorm:"type:varchar(66)"`
+  // ReplacedBy txid of the replacement, empty while this tx is the latest
+  ReplacedBy    string  `gorm:"type:varchar(66);index"`
+}
+
+// WithdrawalRequest withdrawal queued for batch tx, txid is shared by requests of the same batch
+type WithdrawalRequest struct {
+  gorm.Model
+  Chain         string  `gorm:"type:varchar(42);not null"`
+  Asset         string  `gorm:"type:varchar(42);not null"`
+  FromAddress   string  `gorm:"type:varchar(100);not null;index"`
+  ToAddress     string  `gorm:"type:varchar(100);not null"`
+  Amount        string  `gorm:"not null"`
+  // State queued, signing, broadcast or failed. signing requests are claimed by a batch and never paid by another one
+  State         string  `gorm:"type:varchar(16);not null;index"`
+  // Batch claim token of the batch paying the request
+  Batch         string  `gorm:"type:varchar(32);index"`
+  Txid          string  `gorm:"type:varchar(66);index"`
+  Error         string  `gorm:"type:text"`
+}
+
+// EthereumBlock ethereum block scanned for deposits, ReOrg is set when it leaves the best chain
+type EthereumBlock struct {
+  gorm.Model
+  Hash          string  `gorm:"type:varchar(66);not null;unique_index"`
+  Height        uint64  `gorm:"not null;index"`
+  ReOrg         bool    `gorm:"not null;default:false"`
+}
+
+// EthereumDeposit ether or token transfer to sub address, identified by block hash, token, log index and trace address,
+// deposits of reorganized block are kept with ReOrg set
+type EthereumDeposit struct {
+  gorm.Model
+  Txid          string  `gorm:"type:varchar(66);not null;index"`
+  BlockHash     string  `gorm:"type:varchar(66);not null;unique_index:idx_block_log"`
+  // LogIndex log index of token transfer, transaction index of ether transfer
+  LogIndex      uint    `gorm:"not null;unique_index:idx_block_log"`
+  // TraceAddress call path of internal ether transfer in its tx, empty for top level tx and token transfer
+  TraceAddress  string  `gorm:"type:varchar(128);not null;default:'';unique_index:idx_block_log"`
+  Height        uint64  `gorm:"not null;index"`
+  Asset         string  `gorm:"type:varchar(42);not null"`
+  // Token contract address, empty for ether
+  Token         string  `gorm:"type:varchar(42);unique_index:idx_block_log"`
+  FromAddress   string  `gorm:"type:varchar(42);not null"`
+  ToAddress     string  `gorm:"type:varchar(42);not null;index"`
+  Amount        string  `gorm:"not null"`
+  // Confirmations blocks on top of the deposit block including itself, Confirmed once it reaches chain confirmations
+  Confirmations uint64  `gorm:"not null;default:0"`
+  Confirmed     bool    `gorm:"not null;default:false;index"`
+  ReOrg         bool    `gorm:"not null;default:false"`
+  SubAddressID  uint
+}
+
+// EthereumSweep collection of sub address balance into sweep_address. token sweep of address short of gas
+// is funded with ether from sweep_address first, State funding, sweeping, done or failed
+type EthereumSweep struct {
+  gorm.Model
+  Address       string  `gorm:"type:varchar(42);not null;index"`
+  Asset         string  `gorm:"type:varchar(42);not null"`
+  Amount        string  `gorm:"not null"`
+  State         string  `gorm:"type:varchar(16);not null;index"`
+  // FundTxid ether top-up paying gas of token sweep, empty when the address holds enough ether
+  FundTxid      string  `gorm:"type:varchar(66)"`
+  FundAmount    string
+  // FeeType, Gas, GasPrice, GasTipCap and GasFeeCap fee quote of token transfer the top-up funds, the transfer is sent with it
+  FeeType       int
+  Gas           uint64
+  GasPrice      string
+  GasTipCap     string
+  GasFeeCap     string
+  Txid          string  `gorm:"type:varchar(66);index"`
+  Error         string  `gorm:"type:text"`
+}
+
+// EthereumNonce next nonce allocated to ethereum address, the row is locked while allocating
+type EthereumNonce struct {
+  gorm.Model
+  Address       string  `gorm:"type:varchar(42);not null;unique_index"`
+  Next          uint64  `gorm:"not null"`
+}
+
+// NonceAllocation nonce allocated to tx of ethereum address, rows below confirmed nonce are removed on reconciliation
+type NonceAllocation struct {
+  gorm.Model
+  Address       string  `gorm:"type:varchar(42);not null;unique_index:idx_address_nonce"`
+  Nonce         uint64  `gorm:"not null;unique_index:idx_address_nonce"`
+  // State allocated, broadcast or released, released nonce is allocated again before Next.
+  // broadcast nonce becomes mined when Txid is mined, or dropped when nonce is taken by tx out of the wallet
+  State         string  `gorm:"type:varchar(16);not null"`
+  Txid          string  `gorm:"type:varchar(66)"`
+}
+
 // SimpleBitcoinBlock notify block info
 type SimpleBitcoinBlock struct {
   gorm.Model
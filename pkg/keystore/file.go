@@ -0,0 +1,154 @@
+package keystore
+
+import (
+  "os"
+  "fmt"
+  "errors"
+  "strings"
+  "io/ioutil"
+  "path/filepath"
+  "github.com/btcsuite/btcd/btcec"
+  "github.com/ethereum/go-ethereum/crypto"
+  "github.com/ethereum/go-ethereum/accounts/keystore"
+  "github.com/pborman/uuid"
+)
+
+const keyFileExt = ".json"
+
+// NewFileStore Ethereum V3 keystore files under dir/asset, every file is encrypted by passphrase
+func NewFileStore(dir, asset, passphrase string) (*FileStore, error) {
+  if dir == "" {
+    return nil, errors.New("key_store dir is required by keystore backend")
+  }
+  if passphrase == "" {
+    return nil, ErrLocked
+  }
+  dir = filepath.Join(dir, asset)
+  if err := os.MkdirAll(dir, 0700); err != nil {
+    return nil, fmt.Errorf("NewFileStore %s", err)
+  }
+  return &FileStore{dir: dir, passphrase: passphrase}, nil
+}
+
+// Put save private key of address to V3 keystore file
+func (s *FileStore) Put(address string, priv []byte) error {
+  path, err := s.keyFile(address)
+  if err != nil {
+    return err
+  }
+  ecPriv, err := crypto.ToECDSA(priv)
+  if err != nil {
+    return fmt.Errorf("Invalid private key %s", err)
+  }
+  key := &keystore.Key{
+    Id:         uuid.NewRandom(),
+    Address:    crypto.PubkeyToAddress(ecPriv.PublicKey),
+    PrivateKey: ecPriv,
+  }
+  keyJSON, err := keystore.EncryptKey(key, s.passphrase, keystore.StandardScryptN, keystore.StandardScryptP)
+  if err != nil {
+    return fmt.Errorf("Encrypt keystore file %s", err)
+  }
+
+  // write to temp file then rename, never leave a partial key file
+  tmp, err := ioutil.TempFile(s.dir, "." + filepath.Base(path) + ".tmp")
+  if err != nil {
+    return fmt.Errorf("Create keystore file %s", err)
+  }
+  if _, err = tmp.Write(keyJSON); err != nil {
+    tmp.Close()
+    os.Remove(tmp.Name())
+    return fmt.Errorf("Write keystore file %s", err)
+  }
+  tmp.Close()
+  if err = os.Rename(tmp.Name(), path); err != nil {
+    os.Remove(tmp.Name())
+    return fmt.Errorf("Save keystore file %s", err)
+  }
+  return nil
+}
+
+// Get decrypt private key of address
+func (s *FileStore) Get(address string) ([]byte, error) {
+  path, err := s.keyFile(address)
+  if err != nil {
+    return nil, err
+  }
+  keyJSON, err := ioutil.ReadFile(path)
+  if os.IsNotExist(err) {
+    return nil, ErrKeyNotFound
+  }else if err != nil {
+    return nil, fmt.Errorf("Read keystore file %s", err)
+  }
+  key, err := keystore.DecryptKey(keyJSON, s.passphrase)
+  if err != nil {
+    return nil, fmt.Errorf("Decrypt keystore file of %s %s", address, err)
+  }
+  return crypto.FromECDSA(key.PrivateKey), nil
+}
+
+// Has whether keystore file of address exists
+func (s *FileStore) Has(address string) (bool, error) {
+  path, err := s.keyFile(address)
+  if err != nil {
+    return false, err
+  }
+  if _, err = os.Stat(path); os.IsNotExist(err) {
+    return false, nil
+  }else if err != nil {
+    return false, err
+  }
+  return true, nil
+}
+
+// List addresses of keystore files
+func (s *FileStore) List() ([]string, error) {
+  files, err := ioutil.ReadDir(s.dir)
+  if err != nil {
+    return nil, fmt.Errorf("Read keystore dir %s", err)
+  }
+  var addresses []string
+  for _, file := range files {
+    name := file.Name()
+    if file.IsDir() || strings.HasPrefix(name, ".") || !strings.HasSuffix(name, keyFileExt) {
+      continue
+    }
+    addresses = append(addresses, strings.TrimSuffix(name, keyFileExt))
+  }
+  return addresses, nil
+}
+
+// PublicKey public key of address
+func (s *FileStore) PublicKey(address string) (*btcec.PublicKey, error) {
+  priv, err := s.Get(address)
+  if err != nil {
+    return nil, err
+  }
+  _, pubKey := btcec.PrivKeyFromBytes(btcec.S256(), priv)
+  return pubKey, nil
+}
+
+// Sign sign digest by key of address
+func (s *FileStore) Sign(address string, hash []byte) ([]byte, error) {
+  priv, err := s.Get(address)
+  if err != nil {
+    return nil, err
+  }
+  if len(priv) != btcec.PrivKeyBytesLen {
+    return nil, fmt.Errorf("Invalid private key length of %s", address)
+  }
+  return signPrivateKey(priv, hash)
+}
+
+// Close nothing to release
+func (s *FileStore) Close() error {
+  return nil
+}
+
+// keyFile keystore file named by address, bitcoin/ethereum address and eos public key are file name safe
+func (s *FileStore) keyFile(address string) (string, error) {
+  if address == "" || strings.ContainsAny(address, `/\.`) {
+    return "", fmt.Errorf("Invalid address %s", address)
+  }
+  return filepath.Join(s.dir, address + keyFileExt), nil
+}
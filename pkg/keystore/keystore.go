@@ -0,0 +1,108 @@
+package keystore
+
+import (
+  "fmt"
+  "errors"
+  "math/big"
+  "crypto/rand"
+  "crypto/ecdsa"
+  "wallet-go/pkg/configure"
+  "github.com/btcsuite/btcd/btcec"
+  "github.com/btcsuite/btcutil"
+)
+
+// maxSignAttempts canonical signature is about 1/4 of the signatures
+const maxSignAttempts = 64
+
+var (
+  // ErrKeyNotFound address key doesn't exist in key store
+  ErrKeyNotFound    = errors.New("Private key not found")
+  // ErrNotExtractable private key can't be exported from the backend
+  ErrNotExtractable = errors.New("Private key is not extractable from the key store")
+  // ErrLocked key store secret is not unlocked
+  ErrLocked         = errors.New("Key store is locked, unlock it when wallet_core start")
+)
+
+// New open key store of asset, backend is selected by key_store of configure
+func New(asset string, secret *Secret) (KeyStore, error) {
+  if secret == nil {
+    return nil, ErrLocked
+  }
+  info := configure.Config.KeyStore
+  switch info.Backend {
+  case "", LevelDBBackend:
+    return NewLevelDBStore(asset, secret.KEK)
+  case FileBackend:
+    return NewFileStore(info.Dir, asset, secret.Passphrase)
+  case PKCS11Backend:
+    return NewPKCS11Store(info.PKCS11Module, info.PKCS11Token, info.PKCS11Pin, asset)
+  default:
+    return nil, fmt.Errorf("key_store backend only supports %s, %s or %s", LevelDBBackend, FileBackend, PKCS11Backend)
+  }
+}
+
+// ParsePrivateKey raw 32 bytes secp256k1 scalar from raw key or WIF, which is saved by early wallet version
+func ParsePrivateKey(data []byte) ([]byte, error) {
+  if len(data) == btcec.PrivKeyBytesLen {
+    return data, nil
+  }
+  wif, err := btcutil.DecodeWIF(string(data))
+  if err != nil {
+    return nil, fmt.Errorf("Unknown private key format %s", err)
+  }
+  return paddedScalar(wif.PrivKey.D), nil
+}
+
+// signPrivateKey software signature of the raw private key
+func signPrivateKey(priv, hash []byte) ([]byte, error) {
+  key, pubKey := btcec.PrivKeyFromBytes(btcec.S256(), priv)
+  return signCanonical(pubKey, hash, func() (*big.Int, *big.Int, error) {
+    return ecdsa.Sign(rand.Reader, key.ToECDSA(), hash)
+  })
+}
+
+// signCanonical sign until the signature is canonical, normalize S to low-S and attach recovery id of the public key
+func signCanonical(pubKey *btcec.PublicKey, hash []byte, sign func() (*big.Int, *big.Int, error)) ([]byte, error) {
+  if len(hash) != 32 {
+    return nil, fmt.Errorf("Signature digest must be 32 bytes, got %d", len(hash))
+  }
+  curve := btcec.S256()
+  halfOrder := new(big.Int).Rsh(curve.N, 1)
+  for i := 0; i < maxSignAttempts; i++ {
+    r, s, err := sign()
+    if err != nil {
+      return nil, err
+    }
+    if s.Cmp(halfOrder) > 0 {
+      s = new(big.Int).Sub(curve.N, s)
+    }
+    sig := make([]byte, 65)
+    copy(sig[:32], paddedScalar(r))
+    copy(sig[32:64], paddedScalar(s))
+    if !isCanonical(sig) {
+      continue
+    }
+    for v := byte(0); v < 2; v++ {
+      compact := append([]byte{27 + 4 + v}, sig[:64]...)
+      recovered, _, err := btcec.RecoverCompact(curve, compact, hash)
+      if err == nil && recovered.IsEqual(pubKey) {
+        sig[64] = v
+        return sig, nil
+      }
+    }
+  }
+  return nil, errors.New("Fail to produce canonical signature")
+}
+
+// isCanonical EOSIO canonical signature rule, such signature is valid for bitcoin and ethereum as well
+func isCanonical(sig []byte) bool {
+  return sig[0] & 0x80 == 0 && !(sig[0] == 0 && sig[1] & 0x80 == 0) &&
+    sig[32] & 0x80 == 0 && !(sig[32] == 0 && sig[33] & 0x80 == 0)
+}
+
+func paddedScalar(n *big.Int) []byte {
+  b := make([]byte, 32)
+  nb := n.Bytes()
+  copy(b[32 - len(nb):], nb)
+  return b
+}
@@ -0,0 +1,154 @@
+package keystore
+
+import (
+  "os"
+  "bytes"
+  "testing"
+  "crypto/sha256"
+  "encoding/hex"
+  "wallet-go/pkg/db"
+  "wallet-go/pkg/util"
+  "wallet-go/pkg/configure"
+  "github.com/btcsuite/btcd/btcec"
+  "github.com/ethereum/go-ethereum/crypto"
+  "github.com/mitchellh/go-homedir"
+)
+
+// testPrivateKey secp256k1 scalar 1, its public key is the curve generator
+var testPrivateKey = append(bytes.Repeat([]byte{0}, 31), 1)
+
+// testKeyStore exercise backend through KeyStore interface, address is only a label of the key
+func testKeyStore(t *testing.T, store KeyStore, extractable bool) {
+  const address = "0x7E5F4552091A69125d5DfCb7b8C2659029395Bdf"
+  if exists, err := store.Has(address); err != nil || exists {
+    t.Fatalf("Has before Put %v %v", exists, err)
+  }
+  if _, err := store.Sign(address, make([]byte, 32)); err != ErrKeyNotFound {
+    t.Fatalf("Sign missing key %v", err)
+  }
+  if err := store.Put(address, testPrivateKey); err != nil {
+    t.Fatal(err)
+  }
+  if exists, err := store.Has(address); err != nil || !exists {
+    t.Fatalf("Has after Put %v %v", exists, err)
+  }
+  addresses, err := store.List()
+  if err != nil || len(addresses) != 1 || addresses[0] != address {
+    t.Fatalf("List %v %v", addresses, err)
+  }
+  priv, err := store.Get(address)
+  if extractable && (err != nil || !bytes.Equal(priv, testPrivateKey)) {
+    t.Fatalf("Get %x %v", priv, err)
+  }else if !extractable && err != ErrNotExtractable {
+    t.Fatalf("Get non extractable key %v", err)
+  }
+
+  pubKey, err := store.PublicKey(address)
+  if err != nil {
+    t.Fatal(err)
+  }
+  if pubKey.X.Cmp(btcec.S256().Gx) != 0 || pubKey.Y.Cmp(btcec.S256().Gy) != 0 {
+    t.Fatalf("PublicKey %x", pubKey.SerializeCompressed())
+  }
+  if got := crypto.PubkeyToAddress(*pubKey.ToECDSA()).Hex(); got != address {
+    t.Fatalf("ethereum address %s", got)
+  }
+
+  hash := sha256.Sum256([]byte("wallet-go"))
+  sig, err := store.Sign(address, hash[:])
+  if err != nil {
+    t.Fatal(err)
+  }
+  if len(sig) != 65 || !isCanonical(sig) || sig[64] > 1 {
+    t.Fatalf("signature %x isn't canonical", sig)
+  }
+  recovered, err := crypto.SigToPub(hash[:], sig)
+  if err != nil || !bytes.Equal(crypto.FromECDSAPub(recovered), pubKey.SerializeUncompressed()) {
+    t.Fatalf("recover signer %v", err)
+  }
+  if _, err = store.Sign(address, hash[:31]); err == nil {
+    t.Fatal("signed digest shorter than 32 bytes")
+  }
+}
+
+func TestLevelDBStore(t *testing.T) {
+  // home dir is cached once configure is loaded
+  t.Setenv("HOME", t.TempDir())
+  homedir.Reset()
+  t.Cleanup(homedir.Reset)
+  configure.Config = &configure.Configure{DBWalletPath: "wallet"}
+  key, err := util.RandomBytes(32)
+  if err != nil {
+    t.Fatal(err)
+  }
+  kek, err := db.InitKEK(string(key))
+  if err != nil {
+    t.Fatal(err)
+  }
+  store, err := NewLevelDBStore("eth", kek)
+  if err != nil {
+    t.Fatal(err)
+  }
+  defer store.Close()
+  testKeyStore(t, store, true)
+}
+
+func TestFileStore(t *testing.T) {
+  if _, err := NewFileStore(t.TempDir(), "eth", ""); err != ErrLocked {
+    t.Fatalf("NewFileStore without passphrase %v", err)
+  }
+  store, err := NewFileStore(t.TempDir(), "eth", "passphrase")
+  if err != nil {
+    t.Fatal(err)
+  }
+  defer store.Close()
+  testKeyStore(t, store, true)
+  if err = store.Put("../eth", testPrivateKey); err == nil {
+    t.Fatal("key file escaped key store dir")
+  }
+  other, err := NewFileStore(store.dir, "", "another")
+  if err != nil {
+    t.Fatal(err)
+  }
+  if _, err = other.Get("0x7E5F4552091A69125d5DfCb7b8C2659029395Bdf"); err == nil {
+    t.Fatal("keystore file decrypted by another passphrase")
+  }
+}
+
+// TestPKCS11Store runs against an empty initialized token, e.g. SoftHSM:
+//   softhsm2-util --init-token --free --label wallet-go-test --so-pin 0000 --pin 1234
+//   PKCS11_MODULE=/usr/lib/softhsm/libsofthsm2.so PKCS11_TOKEN=wallet-go-test PKCS11_PIN=1234 go test ./pkg/keystore
+func TestPKCS11Store(t *testing.T) {
+  modulePath := os.Getenv("PKCS11_MODULE")
+  if modulePath == "" {
+    t.Skip("PKCS11_MODULE isn't set")
+  }
+  if _, err := NewPKCS11Store(modulePath, os.Getenv("PKCS11_TOKEN"), "wrong pin", "eth"); err == nil {
+    t.Fatal("logged in by wrong pin")
+  }
+  // every run uses its own asset label, objects of earlier runs stay on the token
+  asset, err := util.RandomBytes(8)
+  if err != nil {
+    t.Fatal(err)
+  }
+  store, err := NewPKCS11Store(modulePath, os.Getenv("PKCS11_TOKEN"), os.Getenv("PKCS11_PIN"), hex.EncodeToString(asset))
+  if err != nil {
+    t.Fatal(err)
+  }
+  defer store.Close()
+  testKeyStore(t, store, false)
+}
+
+func TestParsePrivateKey(t *testing.T) {
+  // WIF of scalar 1, compressed mainnet
+  priv, err := ParsePrivateKey([]byte("KwDiBf89QgGbjEhKnhXJuH7LrciVrZi3qYjgd9M7rFU73sVHnoWn"))
+  if err != nil || !bytes.Equal(priv, testPrivateKey) {
+    t.Fatalf("ParsePrivateKey WIF %x %v", priv, err)
+  }
+  if priv, err = ParsePrivateKey(testPrivateKey); err != nil || !bytes.Equal(priv, testPrivateKey) {
+    t.Fatalf("ParsePrivateKey raw %x %v", priv, err)
+  }
+  if _, err = ParsePrivateKey([]byte("not a key")); err == nil {
+    t.Fatal("parsed invalid key")
+  }
+}
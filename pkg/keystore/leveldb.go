@@ -0,0 +1,72 @@
+package keystore
+
+import (
+  "strings"
+  "wallet-go/pkg/db"
+  "github.com/btcsuite/btcd/btcec"
+)
+
+// NewLevelDBStore KEK encrypted leveldb key store of asset folder
+func NewLevelDBStore(asset string, kek *db.KEK) (*LevelDBStore, error) {
+  ldb, err := db.NewEncryptedLDB(asset, kek)
+  if err != nil {
+    return nil, err
+  }
+  return &LevelDBStore{ldb: ldb}, nil
+}
+
+// Put save private key of address
+func (s *LevelDBStore) Put(address string, priv []byte) error {
+  return s.ldb.PutKey(address, priv)
+}
+
+// Get private key of address
+func (s *LevelDBStore) Get(address string) ([]byte, error) {
+  data, err := s.ldb.GetKey(address)
+  if err != nil && strings.Contains(err.Error(), "leveldb: not found") {
+    return nil, ErrKeyNotFound
+  }else if err != nil {
+    return nil, err
+  }
+  return ParsePrivateKey(data)
+}
+
+// Has whether key of address exists
+func (s *LevelDBStore) Has(address string) (bool, error) {
+  return s.ldb.HasKey(address)
+}
+
+// List addresses in key store
+func (s *LevelDBStore) List() ([]string, error) {
+  var addresses []string
+  iter := s.ldb.NewIterator(nil, nil)
+  for iter.Next() {
+    addresses = append(addresses, string(iter.Key()))
+  }
+  iter.Release()
+  return addresses, iter.Error()
+}
+
+// PublicKey public key of address
+func (s *LevelDBStore) PublicKey(address string) (*btcec.PublicKey, error) {
+  priv, err := s.Get(address)
+  if err != nil {
+    return nil, err
+  }
+  _, pubKey := btcec.PrivKeyFromBytes(btcec.S256(), priv)
+  return pubKey, nil
+}
+
+// Sign sign digest by key of address
+func (s *LevelDBStore) Sign(address string, hash []byte) ([]byte, error) {
+  priv, err := s.Get(address)
+  if err != nil {
+    return nil, err
+  }
+  return signPrivateKey(priv, hash)
+}
+
+// Close close leveldb
+func (s *LevelDBStore) Close() error {
+  return s.ldb.Close()
+}
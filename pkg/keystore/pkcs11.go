@@ -0,0 +1,284 @@
+package keystore
+
+import (
+  "fmt"
+  "errors"
+  "strings"
+  "math/big"
+  "github.com/btcsuite/btcd/btcec"
+  "github.com/miekg/pkcs11"
+)
+
+// secp256k1OID DER encoded object identifier 1.3.132.0.10
+var secp256k1OID = []byte{0x06, 0x05, 0x2b, 0x81, 0x04, 0x00, 0x0a}
+
+var module pkcs11Module
+
+// NewPKCS11Store open a logged in session of the token, keys of asset are labeled asset/address
+func NewPKCS11Store(modulePath, tokenLabel, pin, asset string) (*PKCS11Store, error) {
+  ctx, err := module.load(modulePath)
+  if err != nil {
+    return nil, err
+  }
+  slot, err := findSlot(ctx, tokenLabel)
+  if err != nil {
+    return nil, err
+  }
+  session, err := ctx.OpenSession(slot, pkcs11.CKF_SERIAL_SESSION | pkcs11.CKF_RW_SESSION)
+  if err != nil {
+    return nil, fmt.Errorf("PKCS#11 open session %s", err)
+  }
+  // login state is shared by all sessions of the application
+  if err = ctx.Login(session, pkcs11.CKU_USER, pin); err != nil && !isPKCS11Error(err, pkcs11.CKR_USER_ALREADY_LOGGED_IN) {
+    ctx.CloseSession(session)
+    return nil, fmt.Errorf("PKCS#11 login %s", err)
+  }
+  return &PKCS11Store{ctx: ctx, session: session, asset: asset}, nil
+}
+
+// Put import private key to token as sensitive, non extractable object, with its public key
+func (s *PKCS11Store) Put(address string, priv []byte) error {
+  if len(priv) != btcec.PrivKeyBytesLen {
+    return fmt.Errorf("Invalid private key length %d", len(priv))
+  }
+  _, pubKey := btcec.PrivKeyFromBytes(btcec.S256(), priv)
+  ecPoint, err := asn1OctetString(pubKey.SerializeUncompressed())
+  if err != nil {
+    return err
+  }
+  label := s.label(address)
+
+  privTemplate := []*pkcs11.Attribute{
+    pkcs11.NewAttribute(pkcs11.CKA_CLASS, pkcs11.CKO_PRIVATE_KEY),
+    pkcs11.NewAttribute(pkcs11.CKA_KEY_TYPE, pkcs11.CKK_EC),
+    pkcs11.NewAttribute(pkcs11.CKA_TOKEN, true),
+    pkcs11.NewAttribute(pkcs11.CKA_PRIVATE, true),
+    pkcs11.NewAttribute(pkcs11.CKA_SENSITIVE, true),
+    pkcs11.NewAttribute(pkcs11.CKA_EXTRACTABLE, false),
+    pkcs11.NewAttribute(pkcs11.CKA_SIGN, true),
+    pkcs11.NewAttribute(pkcs11.CKA_LABEL, label),
+    pkcs11.NewAttribute(pkcs11.CKA_ID, []byte(label)),
+    pkcs11.NewAttribute(pkcs11.CKA_EC_PARAMS, secp256k1OID),
+    pkcs11.NewAttribute(pkcs11.CKA_VALUE, priv),
+  }
+  pubTemplate := []*pkcs11.Attribute{
+    pkcs11.NewAttribute(pkcs11.CKA_CLASS, pkcs11.CKO_PUBLIC_KEY),
+    pkcs11.NewAttribute(pkcs11.CKA_KEY_TYPE, pkcs11.CKK_EC),
+    pkcs11.NewAttribute(pkcs11.CKA_TOKEN, true),
+    pkcs11.NewAttribute(pkcs11.CKA_VERIFY, true),
+    pkcs11.NewAttribute(pkcs11.CKA_LABEL, label),
+    pkcs11.NewAttribute(pkcs11.CKA_ID, []byte(label)),
+    pkcs11.NewAttribute(pkcs11.CKA_EC_PARAMS, secp256k1OID),
+    pkcs11.NewAttribute(pkcs11.CKA_EC_POINT, ecPoint),
+  }
+  s.mu.Lock()
+  defer s.mu.Unlock()
+  privHandle, err := s.ctx.CreateObject(s.session, privTemplate)
+  if err != nil {
+    return fmt.Errorf("PKCS#11 import private key %s", err)
+  }
+  if _, err = s.ctx.CreateObject(s.session, pubTemplate); err != nil {
+    s.ctx.DestroyObject(s.session, privHandle)
+    return fmt.Errorf("PKCS#11 import public key %s", err)
+  }
+  return nil
+}
+
+// Get private key never leaves the token
+func (s *PKCS11Store) Get(address string) ([]byte, error) {
+  exists, err := s.Has(address)
+  if err != nil {
+    return nil, err
+  }
+  if !exists {
+    return nil, ErrKeyNotFound
+  }
+  return nil, ErrNotExtractable
+}
+
+// Has whether private key object of address exists
+func (s *PKCS11Store) Has(address string) (bool, error) {
+  handles, err := s.findObjects(pkcs11.CKO_PRIVATE_KEY, s.label(address), 1)
+  if err != nil {
+    return false, err
+  }
+  return len(handles) > 0, nil
+}
+
+// List addresses of the asset private key objects
+func (s *PKCS11Store) List() ([]string, error) {
+  handles, err := s.findObjects(pkcs11.CKO_PRIVATE_KEY, "", 0)
+  if err != nil {
+    return nil, err
+  }
+  prefix := s.label("")
+  s.mu.Lock()
+  defer s.mu.Unlock()
+  var addresses []string
+  for _, handle := range handles {
+    attrs, err := s.ctx.GetAttributeValue(s.session, handle, []*pkcs11.Attribute{pkcs11.NewAttribute(pkcs11.CKA_LABEL, nil)})
+    if err != nil {
+      return nil, fmt.Errorf("PKCS#11 query label %s", err)
+    }
+    if label := string(attrs[0].Value); strings.HasPrefix(label, prefix) {
+      addresses = append(addresses, strings.TrimPrefix(label, prefix))
+    }
+  }
+  return addresses, nil
+}
+
+// PublicKey public key object of address
+func (s *PKCS11Store) PublicKey(address string) (*btcec.PublicKey, error) {
+  handles, err := s.findObjects(pkcs11.CKO_PUBLIC_KEY, s.label(address), 1)
+  if err != nil {
+    return nil, err
+  }
+  if len(handles) == 0 {
+    return nil, ErrKeyNotFound
+  }
+  return s.ecPoint(handles[0])
+}
+
+// Sign CKM_ECDSA sign digest inside the token
+func (s *PKCS11Store) Sign(address string, hash []byte) ([]byte, error) {
+  label := s.label(address)
+  privHandles, err := s.findObjects(pkcs11.CKO_PRIVATE_KEY, label, 1)
+  if err != nil {
+    return nil, err
+  }
+  pubHandles, err := s.findObjects(pkcs11.CKO_PUBLIC_KEY, label, 1)
+  if err != nil {
+    return nil, err
+  }
+  if len(privHandles) == 0 || len(pubHandles) == 0 {
+    return nil, ErrKeyNotFound
+  }
+  pubKey, err := s.ecPoint(pubHandles[0])
+  if err != nil {
+    return nil, err
+  }
+
+  return signCanonical(pubKey, hash, func() (*big.Int, *big.Int, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    if err := s.ctx.SignInit(s.session, []*pkcs11.Mechanism{pkcs11.NewMechanism(pkcs11.CKM_ECDSA, nil)}, privHandles[0]); err != nil {
+      return nil, nil, fmt.Errorf("PKCS#11 sign init %s", err)
+    }
+    sig, err := s.ctx.Sign(s.session, hash)
+    if err != nil {
+      return nil, nil, fmt.Errorf("PKCS#11 sign %s", err)
+    }
+    if len(sig) != 64 {
+      return nil, nil, fmt.Errorf("PKCS#11 unexpected signature length %d", len(sig))
+    }
+    return new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:]), nil
+  })
+}
+
+// Close close session, module stays initialized for other sessions
+func (s *PKCS11Store) Close() error {
+  s.mu.Lock()
+  defer s.mu.Unlock()
+  return s.ctx.CloseSession(s.session)
+}
+
+func (s *PKCS11Store) label(address string) string {
+  return s.asset + "/" + address
+}
+
+func (s *PKCS11Store) findObjects(class uint, label string, max int) ([]pkcs11.ObjectHandle, error) {
+  template := []*pkcs11.Attribute{
+    pkcs11.NewAttribute(pkcs11.CKA_CLASS, class),
+    pkcs11.NewAttribute(pkcs11.CKA_KEY_TYPE, pkcs11.CKK_EC),
+  }
+  if label != "" {
+    template = append(template, pkcs11.NewAttribute(pkcs11.CKA_LABEL, label))
+  }
+  s.mu.Lock()
+  defer s.mu.Unlock()
+  if err := s.ctx.FindObjectsInit(s.session, template); err != nil {
+    return nil, fmt.Errorf("PKCS#11 find objects %s", err)
+  }
+  defer s.ctx.FindObjectsFinal(s.session)
+
+  var handles []pkcs11.ObjectHandle
+  for {
+    batch, _, err := s.ctx.FindObjects(s.session, 100)
+    if err != nil {
+      return nil, fmt.Errorf("PKCS#11 find objects %s", err)
+    }
+    handles = append(handles, batch...)
+    if len(batch) == 0 || (max > 0 && len(handles) >= max) {
+      return handles, nil
+    }
+  }
+}
+
+func (s *PKCS11Store) ecPoint(handle pkcs11.ObjectHandle) (*btcec.PublicKey, error) {
+  s.mu.Lock()
+  defer s.mu.Unlock()
+  attrs, err := s.ctx.GetAttributeValue(s.session, handle, []*pkcs11.Attribute{pkcs11.NewAttribute(pkcs11.CKA_EC_POINT, nil)})
+  if err != nil {
+    return nil, fmt.Errorf("PKCS#11 query public key %s", err)
+  }
+  point := attrs[0].Value
+  // CKA_EC_POINT is DER OCTET STRING of the uncompressed point, some tokens return the raw point
+  if len(point) == 67 && point[0] == 0x04 && point[1] == 65 {
+    point = point[2:]
+  }
+  return btcec.ParsePubKey(point, btcec.S256())
+}
+
+func (m *pkcs11Module) load(path string) (*pkcs11.Ctx, error) {
+  m.mu.Lock()
+  defer m.mu.Unlock()
+  if m.ctx != nil {
+    if m.path != path {
+      return nil, fmt.Errorf("PKCS#11 module %s already loaded", m.path)
+    }
+    return m.ctx, nil
+  }
+  if path == "" {
+    return nil, errors.New("key_store pkcs11_module is required by pkcs11 backend")
+  }
+  ctx := pkcs11.New(path)
+  if ctx == nil {
+    return nil, fmt.Errorf("Fail to load PKCS#11 module %s", path)
+  }
+  if err := ctx.Initialize(); err != nil && !isPKCS11Error(err, pkcs11.CKR_CRYPTOKI_ALREADY_INITIALIZED) {
+    ctx.Destroy()
+    return nil, fmt.Errorf("PKCS#11 initialize %s", err)
+  }
+  m.ctx, m.path = ctx, path
+  return ctx, nil
+}
+
+func findSlot(ctx *pkcs11.Ctx, tokenLabel string) (uint, error) {
+  slots, err := ctx.GetSlotList(true)
+  if err != nil {
+    return 0, fmt.Errorf("PKCS#11 slot list %s", err)
+  }
+  for _, slot := range slots {
+    info, err := ctx.GetTokenInfo(slot)
+    if err != nil {
+      return 0, fmt.Errorf("PKCS#11 token info %s", err)
+    }
+    if strings.TrimSpace(info.Label) == tokenLabel {
+      return slot, nil
+    }
+  }
+  return 0, fmt.Errorf("PKCS#11 token %s not found", tokenLabel)
+}
+
+func isPKCS11Error(err error, code uint) bool {
+  e, ok := err.(pkcs11.Error)
+  return ok && uint(e) == code
+}
+
+// asn1OctetString DER OCTET STRING, content is shorter than 128 bytes
+func asn1OctetString(content []byte) ([]byte, error) {
+  if len(content) > 127 {
+    return nil, errors.New("OCTET STRING content too long")
+  }
+  return append([]byte{0x04, byte(len(content))}, content...), nil
+}
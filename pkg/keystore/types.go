@@ -0,0 +1,64 @@
+package keystore
+
+import (
+  "sync"
+  "wallet-go/pkg/db"
+  "github.com/btcsuite/btcd/btcec"
+  "github.com/miekg/pkcs11"
+)
+
+const (
+  // LevelDBBackend KEK encrypted leveldb key store, default backend
+  LevelDBBackend  string = "leveldb"
+  // FileBackend Ethereum V3 keystore files directory
+  FileBackend     string = "keystore"
+  // PKCS11Backend hardware security module through PKCS#11, e.g. SoftHSM
+  PKCS11Backend   string = "pkcs11"
+)
+
+// KeyStore private key storage, keys are raw 32 bytes secp256k1 scalar indexed by chain address
+type KeyStore interface {
+  Put(address string, priv []byte) error
+  Get(address string) ([]byte, error)
+  Has(address string) (bool, error)
+  List() ([]string, error)
+  PublicKey(address string) (*btcec.PublicKey, error)
+  // Sign sign 32 bytes digest, returns 65 bytes [R || S || V] low-S canonical signature, V is recovery id 0 or 1
+  Sign(address string, hash []byte) ([]byte, error)
+  Close() error
+}
+
+// Secret secrets to unlock key store backends
+type Secret struct {
+  // KEK leveldb backend key encryption key
+  KEK         *db.KEK
+  // Passphrase keystore backend files passphrase
+  Passphrase  string
+}
+
+// LevelDBStore KEK encrypted leveldb backend
+type LevelDBStore struct {
+  ldb *db.EncryptedLDB
+}
+
+// FileStore Ethereum V3 keystore files backend
+type FileStore struct {
+  dir         string
+  passphrase  string
+}
+
+// PKCS11Store PKCS#11 token backend, private keys are not extractable.
+// Session is not safe for concurrent use, operations are serialized by mu
+type PKCS11Store struct {
+  mu      sync.Mutex
+  ctx     *pkcs11.Ctx
+  session pkcs11.SessionHandle
+  asset   string
+}
+
+// pkcs11Module module is initialized once per process, shared by sessions
+type pkcs11Module struct {
+  mu    sync.Mutex
+  ctx   *pkcs11.Ctx
+  path  string
+}
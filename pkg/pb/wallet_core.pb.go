@@ -63,9 +63,13 @@ func (m *AddressResp) GetAddress() string {
 }
 
 type SignatureEOSIOReq struct {
-	Pubkey               string   `protobuf:"bytes,1,opt,name=pubkey,proto3" json:"pubkey,omitempty"`
-	RawTxHex             string   `protobuf:"bytes,2,opt,name=rawTxHex,proto3" json:"rawTxHex,omitempty"`
-	ChainID              string   `protobuf:"bytes,3,opt,name=chainID,proto3" json:"chainID,omitempty"`
+	Pubkey   string `protobuf:"bytes,1,opt,name=pubkey,proto3" json:"pubkey,omitempty"`
+	RawTxHex string `protobuf:"bytes,2,opt,name=rawTxHex,proto3" json:"rawTxHex,omitempty"`
+	ChainID  string `protobuf:"bytes,3,opt,name=chainID,proto3" json:"chainID,omitempty"`
+	// intent, raw tx must transfer amount of asset to the recipient
+	To                   string   `protobuf:"bytes,4,opt,name=to,proto3" json:"to,omitempty"`
+	Amount               string   `protobuf:"bytes,5,opt,name=amount,proto3" json:"amount,omitempty"`
+	Asset                string   `protobuf:"bytes,6,opt,name=asset,proto3" json:"asset,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
 	XXX_unrecognized     []byte   `json:"-"`
 	XXX_sizecache        int32    `json:"-"`
@@ -117,10 +121,35 @@ func (m *SignatureEOSIOReq) GetChainID() string {
 	return ""
 }
 
+func (m *SignatureEOSIOReq) GetTo() string {
+	if m != nil {
+		return m.To
+	}
+	return ""
+}
+
+func (m *SignatureEOSIOReq) GetAmount() string {
+	if m != nil {
+		return m.Amount
+	}
+	return ""
+}
+
+func (m *SignatureEOSIOReq) GetAsset() string {
+	if m != nil {
+		return m.Asset
+	}
+	return ""
+}
+
 type SignatureEthereumReq struct {
-	Account              string   `protobuf:"bytes,1,opt,name=account,proto3" json:"account,omitempty"`
-	RawTxHex             string   `protobuf:"bytes,2,opt,name=rawTxHex,proto3" json:"rawTxHex,omitempty"`
-	ChainID              string   `protobuf:"bytes,3,opt,name=chainID,proto3" json:"chainID,omitempty"`
+	Account  string `protobuf:"bytes,1,opt,name=account,proto3" json:"account,omitempty"`
+	RawTxHex string `protobuf:"bytes,2,opt,name=rawTxHex,proto3" json:"rawTxHex,omitempty"`
+	ChainID  string `protobuf:"bytes,3,opt,name=chainID,proto3" json:"chainID,omitempty"`
+	// intent, raw tx must transfer amount of asset to the recipient
+	To                   string   `protobuf:"bytes,4,opt,name=to,proto3" json:"to,omitempty"`
+	Amount               string   `protobuf:"bytes,5,opt,name=amount,proto3" json:"amount,omitempty"`
+	Asset                string   `protobuf:"bytes,6,opt,name=asset,proto3" json:"asset,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
 	XXX_unrecognized     []byte   `json:"-"`
 	XXX_sizecache        int32    `json:"-"`
@@ -172,11 +201,39 @@ func (m *SignatureEthereumReq) GetChainID() string {
 	return ""
 }
 
+func (m *SignatureEthereumReq) GetTo() string {
+	if m != nil {
+		return m.To
+	}
+	return ""
+}
+
+func (m *SignatureEthereumReq) GetAmount() string {
+	if m != nil {
+		return m.Amount
+	}
+	return ""
+}
+
+func (m *SignatureEthereumReq) GetAsset() string {
+	if m != nil {
+		return m.Asset
+	}
+	return ""
+}
+
 type SignatureBitcoincoreReq struct {
-	From                 string   `protobuf:"bytes,1,opt,name=from,proto3" json:"from,omitempty"`
-	RawTxHex             string   `protobuf:"bytes,2,opt,name=rawTxHex,proto3" json:"rawTxHex,omitempty"`
-	VinAmount            int64    `protobuf:"varint,4,opt,name=vinAmount,proto3" json:"vinAmount,omitempty"`
-	Mode                 string   `protobuf:"bytes,3,opt,name=mode,proto3" json:"mode,omitempty"`
+	From     string `protobuf:"bytes,1,opt,name=from,proto3" json:"from,omitempty"`
+	RawTxHex string `protobuf:"bytes,2,opt,name=rawTxHex,proto3" json:"rawTxHex,omitempty"`
+	Mode     string `protobuf:"bytes,3,opt,name=mode,proto3" json:"mode,omitempty"`
+	// amount in satoshi of each input, in the same order as tx inputs
+	VinAmounts []int64 `protobuf:"varint,5,rep,packed,name=vinAmounts,proto3" json:"vinAmounts,omitempty"`
+	// intent, raw tx must transfer amount of asset to the recipient
+	To     string `protobuf:"bytes,6,opt,name=to,proto3" json:"to,omitempty"`
+	Amount string `protobuf:"bytes,7,opt,name=amount,proto3" json:"amount,omitempty"`
+	Asset  string `protobuf:"bytes,8,opt,name=asset,proto3" json:"asset,omitempty"`
+	// previous output script of each input, in the same order as tx inputs, inputs spend from when empty
+	VinPkScripts         [][]byte `protobuf:"bytes,9,rep,name=vinPkScripts,proto3" json:"vinPkScripts,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
 	XXX_unrecognized     []byte   `json:"-"`
 	XXX_sizecache        int32    `json:"-"`
@@ -221,20 +278,225 @@ func (m *SignatureBitcoincoreReq) GetRawTxHex() string {
 	return ""
 }
 
-func (m *SignatureBitcoincoreReq) GetVinAmount() int64 {
+func (m *SignatureBitcoincoreReq) GetMode() string {
 	if m != nil {
-		return m.VinAmount
+		return m.Mode
 	}
-	return 0
+	return ""
 }
 
-func (m *SignatureBitcoincoreReq) GetMode() string {
+func (m *SignatureBitcoincoreReq) GetVinAmounts() []int64 {
+	if m != nil {
+		return m.VinAmounts
+	}
+	return nil
+}
+
+func (m *SignatureBitcoincoreReq) GetTo() string {
+	if m != nil {
+		return m.To
+	}
+	return ""
+}
+
+func (m *SignatureBitcoincoreReq) GetAmount() string {
+	if m != nil {
+		return m.Amount
+	}
+	return ""
+}
+
+func (m *SignatureBitcoincoreReq) GetAsset() string {
+	if m != nil {
+		return m.Asset
+	}
+	return ""
+}
+
+func (m *SignatureBitcoincoreReq) GetVinPkScripts() [][]byte {
+	if m != nil {
+		return m.VinPkScripts
+	}
+	return nil
+}
+
+type SignatureBitcoincorePSBTReq struct {
+	// base64 BIP174 PSBT, every input carries its previous output
+	Psbt string `protobuf:"bytes,1,opt,name=psbt,proto3" json:"psbt,omitempty"`
+	Mode string `protobuf:"bytes,2,opt,name=mode,proto3" json:"mode,omitempty"`
+	From string `protobuf:"bytes,3,opt,name=from,proto3" json:"from,omitempty"`
+	// intent, unsigned tx must transfer amount of asset to the recipient
+	To     string `protobuf:"bytes,4,opt,name=to,proto3" json:"to,omitempty"`
+	Amount string `protobuf:"bytes,5,opt,name=amount,proto3" json:"amount,omitempty"`
+	Asset  string `protobuf:"bytes,6,opt,name=asset,proto3" json:"asset,omitempty"`
+	// intent of batch tx, overrides to and amount
+	Recipients           []*Recipient `protobuf:"bytes,7,rep,name=recipients,proto3" json:"recipients,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}     `json:"-"`
+	XXX_unrecognized     []byte       `json:"-"`
+	XXX_sizecache        int32        `json:"-"`
+}
+
+func (m *SignatureBitcoincorePSBTReq) Reset()         { *m = SignatureBitcoincorePSBTReq{} }
+func (m *SignatureBitcoincorePSBTReq) String() string { return proto.CompactTextString(m) }
+func (*SignatureBitcoincorePSBTReq) ProtoMessage()    {}
+func (*SignatureBitcoincorePSBTReq) Descriptor() ([]byte, []int) {
+	return fileDescriptor_5e25c9835eecce9f, []int{4}
+}
+
+func (m *SignatureBitcoincorePSBTReq) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_SignatureBitcoincorePSBTReq.Unmarshal(m, b)
+}
+func (m *SignatureBitcoincorePSBTReq) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_SignatureBitcoincorePSBTReq.Marshal(b, m, deterministic)
+}
+func (m *SignatureBitcoincorePSBTReq) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_SignatureBitcoincorePSBTReq.Merge(m, src)
+}
+func (m *SignatureBitcoincorePSBTReq) XXX_Size() int {
+	return xxx_messageInfo_SignatureBitcoincorePSBTReq.Size(m)
+}
+func (m *SignatureBitcoincorePSBTReq) XXX_DiscardUnknown() {
+	xxx_messageInfo_SignatureBitcoincorePSBTReq.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_SignatureBitcoincorePSBTReq proto.InternalMessageInfo
+
+func (m *SignatureBitcoincorePSBTReq) GetPsbt() string {
+	if m != nil {
+		return m.Psbt
+	}
+	return ""
+}
+
+func (m *SignatureBitcoincorePSBTReq) GetMode() string {
 	if m != nil {
 		return m.Mode
 	}
 	return ""
 }
 
+func (m *SignatureBitcoincorePSBTReq) GetFrom() string {
+	if m != nil {
+		return m.From
+	}
+	return ""
+}
+
+func (m *SignatureBitcoincorePSBTReq) GetTo() string {
+	if m != nil {
+		return m.To
+	}
+	return ""
+}
+
+func (m *SignatureBitcoincorePSBTReq) GetAmount() string {
+	if m != nil {
+		return m.Amount
+	}
+	return ""
+}
+
+func (m *SignatureBitcoincorePSBTReq) GetAsset() string {
+	if m != nil {
+		return m.Asset
+	}
+	return ""
+}
+
+func (m *SignatureBitcoincorePSBTReq) GetRecipients() []*Recipient {
+	if m != nil {
+		return m.Recipients
+	}
+	return nil
+}
+
+type Recipient struct {
+	To                   string   `protobuf:"bytes,1,opt,name=to,proto3" json:"to,omitempty"`
+	Amount               string   `protobuf:"bytes,2,opt,name=amount,proto3" json:"amount,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *Recipient) Reset()         { *m = Recipient{} }
+func (m *Recipient) String() string { return proto.CompactTextString(m) }
+func (*Recipient) ProtoMessage()    {}
+func (*Recipient) Descriptor() ([]byte, []int) {
+	return fileDescriptor_5e25c9835eecce9f, []int{5}
+}
+
+func (m *Recipient) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Recipient.Unmarshal(m, b)
+}
+func (m *Recipient) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Recipient.Marshal(b, m, deterministic)
+}
+func (m *Recipient) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Recipient.Merge(m, src)
+}
+func (m *Recipient) XXX_Size() int {
+	return xxx_messageInfo_Recipient.Size(m)
+}
+func (m *Recipient) XXX_DiscardUnknown() {
+	xxx_messageInfo_Recipient.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Recipient proto.InternalMessageInfo
+
+func (m *Recipient) GetTo() string {
+	if m != nil {
+		return m.To
+	}
+	return ""
+}
+
+func (m *Recipient) GetAmount() string {
+	if m != nil {
+		return m.Amount
+	}
+	return ""
+}
+
+type SignPSBTResp struct {
+	// base64 PSBT with partial signature of every input
+	Psbt                 string   `protobuf:"bytes,1,opt,name=psbt,proto3" json:"psbt,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *SignPSBTResp) Reset()         { *m = SignPSBTResp{} }
+func (m *SignPSBTResp) String() string { return proto.CompactTextString(m) }
+func (*SignPSBTResp) ProtoMessage()    {}
+func (*SignPSBTResp) Descriptor() ([]byte, []int) {
+	return fileDescriptor_5e25c9835eecce9f, []int{6}
+}
+
+func (m *SignPSBTResp) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_SignPSBTResp.Unmarshal(m, b)
+}
+func (m *SignPSBTResp) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_SignPSBTResp.Marshal(b, m, deterministic)
+}
+func (m *SignPSBTResp) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_SignPSBTResp.Merge(m, src)
+}
+func (m *SignPSBTResp) XXX_Size() int {
+	return xxx_messageInfo_SignPSBTResp.Size(m)
+}
+func (m *SignPSBTResp) XXX_DiscardUnknown() {
+	xxx_messageInfo_SignPSBTResp.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_SignPSBTResp proto.InternalMessageInfo
+
+func (m *SignPSBTResp) GetPsbt() string {
+	if m != nil {
+		return m.Psbt
+	}
+	return ""
+}
+
 type SignTxResp struct {
 	Result               bool     `protobuf:"varint,1,opt,name=result,proto3" json:"result,omitempty"`
 	HexSignedTx          string   `protobuf:"bytes,2,opt,name=hexSignedTx,proto3" json:"hexSignedTx,omitempty"`
@@ -247,7 +509,7 @@ func (m *SignTxResp) Reset()         { *m = SignTxResp{} }
 func (m *SignTxResp) String() string { return proto.CompactTextString(m) }
 func (*SignTxResp) ProtoMessage()    {}
 func (*SignTxResp) Descriptor() ([]byte, []int) {
-	return fileDescriptor_5e25c9835eecce9f, []int{4}
+	return fileDescriptor_5e25c9835eecce9f, []int{7}
 }
 
 func (m *SignTxResp) XXX_Unmarshal(b []byte) error {
@@ -293,7 +555,7 @@ func (m *BitcoinWalletReq) Reset()         { *m = BitcoinWalletReq{} }
 func (m *BitcoinWalletReq) String() string { return proto.CompactTextString(m) }
 func (*BitcoinWalletReq) ProtoMessage()    {}
 func (*BitcoinWalletReq) Descriptor() ([]byte, []int) {
-	return fileDescriptor_5e25c9835eecce9f, []int{5}
+	return fileDescriptor_5e25c9835eecce9f, []int{8}
 }
 
 func (m *BitcoinWalletReq) XXX_Unmarshal(b []byte) error {
@@ -322,7 +584,13 @@ func (m *BitcoinWalletReq) GetMode() string {
 }
 
 type WalletResponse struct {
-	Address              string   `protobuf:"bytes,1,opt,name=address,proto3" json:"address,omitempty"`
+	Address string `protobuf:"bytes,1,opt,name=address,proto3" json:"address,omitempty"`
+	// BIP44 path of the address key, m/purpose'/coin_type'/0'/0/index, purpose 49 or 84 for bitcoin segwit address
+	DerivationPath string `protobuf:"bytes,2,opt,name=derivationPath,proto3" json:"derivationPath,omitempty"`
+	// hex compressed public key of the address key
+	PublicKey string `protobuf:"bytes,3,opt,name=publicKey,proto3" json:"publicKey,omitempty"`
+	// hex BIP32 fingerprint of the master key
+	MasterFingerprint    string   `protobuf:"bytes,4,opt,name=masterFingerprint,proto3" json:"masterFingerprint,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
 	XXX_unrecognized     []byte   `json:"-"`
 	XXX_sizecache        int32    `json:"-"`
@@ -332,7 +600,7 @@ func (m *WalletResponse) Reset()         { *m = WalletResponse{} }
 func (m *WalletResponse) String() string { return proto.CompactTextString(m) }
 func (*WalletResponse) ProtoMessage()    {}
 func (*WalletResponse) Descriptor() ([]byte, []int) {
-	return fileDescriptor_5e25c9835eecce9f, []int{6}
+	return fileDescriptor_5e25c9835eecce9f, []int{9}
 }
 
 func (m *WalletResponse) XXX_Unmarshal(b []byte) error {
@@ -360,11 +628,35 @@ func (m *WalletResponse) GetAddress() string {
 	return ""
 }
 
+func (m *WalletResponse) GetDerivationPath() string {
+	if m != nil {
+		return m.DerivationPath
+	}
+	return ""
+}
+
+func (m *WalletResponse) GetPublicKey() string {
+	if m != nil {
+		return m.PublicKey
+	}
+	return ""
+}
+
+func (m *WalletResponse) GetMasterFingerprint() string {
+	if m != nil {
+		return m.MasterFingerprint
+	}
+	return ""
+}
+
 func init() {
 	proto.RegisterType((*AddressResp)(nil), "proto.AddressResp")
 	proto.RegisterType((*SignatureEOSIOReq)(nil), "proto.SignatureEOSIOReq")
 	proto.RegisterType((*SignatureEthereumReq)(nil), "proto.SignatureEthereumReq")
 	proto.RegisterType((*SignatureBitcoincoreReq)(nil), "proto.SignatureBitcoincoreReq")
+	proto.RegisterType((*SignatureBitcoincorePSBTReq)(nil), "proto.SignatureBitcoincorePSBTReq")
+	proto.RegisterType((*Recipient)(nil), "proto.Recipient")
+	proto.RegisterType((*SignPSBTResp)(nil), "proto.SignPSBTResp")
 	proto.RegisterType((*SignTxResp)(nil), "proto.SignTxResp")
 	proto.RegisterType((*BitcoinWalletReq)(nil), "proto.BitcoinWalletReq")
 	proto.RegisterType((*WalletResponse)(nil), "proto.WalletResponse")
@@ -373,34 +665,48 @@ func init() {
 func init() { proto.RegisterFile("wallet_core.proto", fileDescriptor_5e25c9835eecce9f) }
 
 var fileDescriptor_5e25c9835eecce9f = []byte{
-	// 418 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x9c, 0x92, 0x4f, 0xaf, 0xd2, 0x40,
-	0x14, 0xc5, 0x53, 0x41, 0x84, 0x4b, 0x24, 0x32, 0x51, 0x68, 0x8a, 0x31, 0xa4, 0x0b, 0x25, 0x2e,
-	0x4a, 0xa2, 0x5b, 0x0d, 0x41, 0xc4, 0xc8, 0x8a, 0xa4, 0x90, 0xb8, 0x34, 0xa5, 0xbd, 0x40, 0x63,
-	0xdb, 0xa9, 0xd3, 0x56, 0x4a, 0xfc, 0x28, 0xef, 0xcb, 0xbe, 0xcc, 0x9f, 0x42, 0xf9, 0xf7, 0x16,
-	0xac, 0x3a, 0x67, 0xe6, 0xf6, 0xfc, 0xee, 0xcc, 0x3d, 0xd0, 0xde, 0x39, 0x41, 0x80, 0xe9, 0x6f,
-	0x97, 0x32, 0xb4, 0x62, 0x46, 0x53, 0x4a, 0x9e, 0x8b, 0x8f, 0xd1, 0xdb, 0x50, 0xba, 0x09, 0x70,
-	0x28, 0xd4, 0x2a, 0x5b, 0x0f, 0x31, 0x8c, 0xd3, 0xbd, 0xac, 0x31, 0x3f, 0x40, 0x73, 0xec, 0x79,
-	0x0c, 0x93, 0xc4, 0xc6, 0x24, 0x26, 0x3a, 0xbc, 0x70, 0xa4, 0xd4, 0xb5, 0xbe, 0x36, 0x68, 0xd8,
-	0x85, 0x34, 0x1d, 0x68, 0x2f, 0xfc, 0x4d, 0xe4, 0xa4, 0x19, 0xc3, 0xe9, 0x7c, 0x31, 0x9b, 0xdb,
-	0xf8, 0x97, 0x74, 0xa0, 0x16, 0x67, 0xab, 0x3f, 0xb8, 0x57, 0xd5, 0x4a, 0x11, 0x03, 0xea, 0xcc,
-	0xd9, 0x2d, 0xf3, 0x9f, 0x98, 0xeb, 0xcf, 0xc4, 0xc9, 0x41, 0x73, 0x84, 0xbb, 0x75, 0xfc, 0x68,
-	0xf6, 0x5d, 0xaf, 0x48, 0x84, 0x92, 0xe6, 0x1a, 0x5e, 0x1f, 0x11, 0xe9, 0x16, 0x19, 0x66, 0x21,
-	0xa7, 0xf0, 0xa6, 0x5c, 0x97, 0x66, 0x51, 0x7a, 0x68, 0x4a, 0xca, 0x3b, 0x39, 0xff, 0xa1, 0x7b,
-	0xe0, 0x7c, 0xf3, 0x53, 0x97, 0xfa, 0x11, 0x7f, 0x35, 0x8e, 0x22, 0x50, 0x5d, 0x33, 0x1a, 0x2a,
-	0x8e, 0x58, 0x3f, 0x09, 0x79, 0x0b, 0x8d, 0x7f, 0x7e, 0x34, 0x0e, 0x45, 0x73, 0xd5, 0xbe, 0x36,
-	0xa8, 0xd8, 0xc7, 0x0d, 0xee, 0x16, 0x52, 0x0f, 0x15, 0x5f, 0xac, 0xcd, 0x1f, 0x00, 0x1c, 0xbe,
-	0xcc, 0xc5, 0x7b, 0x77, 0xa0, 0xc6, 0x30, 0xc9, 0x02, 0x79, 0xb3, 0xba, 0xad, 0x14, 0xe9, 0x43,
-	0x73, 0x8b, 0x39, 0x2f, 0x44, 0x6f, 0x59, 0x60, 0xcb, 0x5b, 0xe6, 0x7b, 0x78, 0xa5, 0x7a, 0xff,
-	0x25, 0x06, 0xaf, 0xba, 0x17, 0x3c, 0xad, 0xc4, 0xfb, 0x08, 0xad, 0xa2, 0x20, 0x89, 0x69, 0x94,
-	0xe0, 0xed, 0x19, 0x7f, 0x7a, 0xa8, 0x00, 0xc8, 0xe2, 0x09, 0x65, 0x48, 0x46, 0xf0, 0xf2, 0x04,
-	0x41, 0xba, 0x32, 0x34, 0xd6, 0x39, 0xd8, 0x78, 0xa3, 0x0e, 0xce, 0x48, 0x23, 0x68, 0x15, 0x73,
-	0x54, 0x0e, 0x1d, 0x4b, 0x86, 0xd1, 0x2a, 0xc2, 0x68, 0x4d, 0x79, 0x18, 0x6f, 0x19, 0x7c, 0x81,
-	0xa6, 0xc8, 0xda, 0x7d, 0x7f, 0x7f, 0x85, 0xd6, 0x69, 0x64, 0x89, 0xae, 0x0a, 0x2f, 0x92, 0x6c,
-	0xb4, 0x4b, 0x27, 0x6a, 0x36, 0x93, 0x72, 0xe2, 0xd5, 0x35, 0x48, 0xef, 0xc2, 0xe1, 0x18, 0xd4,
-	0x6b, 0x26, 0xb3, 0x52, 0xa6, 0x4b, 0x59, 0x23, 0xef, 0xce, 0x7d, 0x4e, 0x83, 0x78, 0xc5, 0x6a,
-	0x55, 0x13, 0x3b, 0x9f, 0x1f, 0x03, 0x00, 0x00, 0xff, 0xff, 0x3b, 0x84, 0xea, 0x0a, 0xea, 0x03,
-	0x00, 0x00,
+	// 651 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xc4, 0x54, 0xcd, 0x4e, 0xdb, 0x40,
+	0x10, 0x96, 0xe3, 0x24, 0x24, 0x13, 0x1a, 0x91, 0x2d, 0x05, 0x2b, 0x54, 0x28, 0xf2, 0x81, 0xe6,
+	0x50, 0x85, 0x0a, 0xae, 0xad, 0x10, 0x50, 0x50, 0x69, 0x0f, 0x20, 0x27, 0x52, 0x8f, 0x95, 0xe3,
+	0x0c, 0xc9, 0x8a, 0xd8, 0xeb, 0xee, 0xae, 0x21, 0xbc, 0x4c, 0x7b, 0xe9, 0xcb, 0xf4, 0x41, 0x7a,
+	0xef, 0x23, 0x54, 0x5e, 0xaf, 0x93, 0x4d, 0x30, 0x1c, 0xda, 0x43, 0x4f, 0xd9, 0xf9, 0xc9, 0xcc,
+	0xf7, 0xcd, 0x78, 0x3e, 0x68, 0xdd, 0xf9, 0xd3, 0x29, 0xca, 0x2f, 0x01, 0xe3, 0xd8, 0x8b, 0x39,
+	0x93, 0x8c, 0x54, 0xd4, 0x4f, 0x7b, 0x67, 0xcc, 0xd8, 0x78, 0x8a, 0xfb, 0xca, 0x1a, 0x26, 0xd7,
+	0xfb, 0x18, 0xc6, 0xf2, 0x3e, 0xcb, 0x71, 0x5f, 0x41, 0xe3, 0x78, 0x34, 0xe2, 0x28, 0x84, 0x87,
+	0x22, 0x26, 0x0e, 0xac, 0xf9, 0x99, 0xe9, 0x58, 0x1d, 0xab, 0x5b, 0xf7, 0x72, 0xd3, 0xfd, 0x6e,
+	0x41, 0xab, 0x4f, 0xc7, 0x91, 0x2f, 0x13, 0x8e, 0x67, 0x97, 0xfd, 0x8b, 0x4b, 0x0f, 0xbf, 0x92,
+	0x2d, 0xa8, 0xc6, 0xc9, 0xf0, 0x06, 0xef, 0x75, 0xba, 0xb6, 0x48, 0x1b, 0x6a, 0xdc, 0xbf, 0x1b,
+	0xcc, 0x3e, 0xe0, 0xcc, 0x29, 0xa9, 0xc8, 0xdc, 0x4e, 0x7b, 0x04, 0x13, 0x9f, 0x46, 0x17, 0xef,
+	0x1d, 0x3b, 0xeb, 0xa1, 0x4d, 0xd2, 0x84, 0x92, 0x64, 0x4e, 0x59, 0x39, 0x4b, 0x92, 0xa5, 0xd5,
+	0xfd, 0x90, 0x25, 0x91, 0x74, 0x2a, 0x59, 0xf5, 0xcc, 0x22, 0x9b, 0x50, 0xf1, 0x85, 0x40, 0xe9,
+	0x54, 0x95, 0x3b, 0x33, 0xdc, 0x1f, 0x16, 0x6c, 0x2e, 0x10, 0xca, 0x09, 0x72, 0x4c, 0xc2, 0x14,
+	0x64, 0x4a, 0x2a, 0x08, 0x54, 0x9d, 0x9c, 0x54, 0x66, 0xfe, 0x17, 0x98, 0xbf, 0x2c, 0xd8, 0x9e,
+	0xc3, 0x3c, 0xa1, 0x32, 0x60, 0x34, 0x4a, 0x97, 0x96, 0x22, 0x25, 0x50, 0xbe, 0xe6, 0x2c, 0xd4,
+	0x30, 0xd5, 0xfb, 0x49, 0x8c, 0x04, 0xca, 0x21, 0x1b, 0xa1, 0x06, 0xa8, 0xde, 0x64, 0x17, 0xe0,
+	0x96, 0x46, 0xc7, 0x0a, 0x82, 0x70, 0x2a, 0x1d, 0xbb, 0x6b, 0x7b, 0x86, 0x47, 0xa3, 0xaf, 0x16,
+	0xa0, 0x5f, 0x2b, 0x46, 0x5f, 0x33, 0xd0, 0x13, 0x17, 0xd6, 0x6f, 0x69, 0x74, 0x75, 0xd3, 0x0f,
+	0x38, 0x8d, 0xa5, 0x70, 0xea, 0x1d, 0xbb, 0xbb, 0xee, 0x2d, 0xf9, 0x3e, 0x96, 0x6b, 0xe5, 0x8d,
+	0x8a, 0xfb, 0xd3, 0x82, 0x9d, 0x22, 0x9e, 0x57, 0xfd, 0x93, 0x81, 0xe6, 0x1a, 0x8b, 0x61, 0xbe,
+	0x12, 0xf5, 0x9e, 0xf3, 0x29, 0x19, 0x7c, 0xf2, 0x99, 0xd8, 0xc6, 0x4c, 0xfe, 0x69, 0x03, 0xe4,
+	0x0d, 0x00, 0xc7, 0x80, 0xc6, 0x14, 0xd3, 0x09, 0xad, 0x75, 0xec, 0x6e, 0xe3, 0x60, 0x23, 0xbb,
+	0x87, 0x9e, 0x97, 0x07, 0x3c, 0x23, 0xc7, 0x3d, 0x84, 0xfa, 0x3c, 0xa0, 0x9b, 0x5b, 0x05, 0xcd,
+	0x4b, 0x66, 0x73, 0xd7, 0x85, 0xf5, 0x94, 0x7f, 0xc6, 0x57, 0xc4, 0x45, 0x84, 0xdd, 0x73, 0x80,
+	0x34, 0x67, 0x30, 0x53, 0x19, 0x5b, 0x50, 0xe5, 0x28, 0x92, 0x69, 0x96, 0x53, 0xf3, 0xb4, 0x45,
+	0x3a, 0xd0, 0x98, 0xe0, 0x2c, 0x4d, 0xc4, 0xd1, 0x20, 0xff, 0x0a, 0x4c, 0x97, 0xbb, 0x07, 0x1b,
+	0x7a, 0xc4, 0x9f, 0x95, 0x0c, 0xe8, 0x01, 0xab, 0x61, 0x5a, 0x8b, 0x61, 0xba, 0xdf, 0x2c, 0x68,
+	0xe6, 0x19, 0x22, 0x66, 0x91, 0xc0, 0xc7, 0x4f, 0x9e, 0xec, 0x41, 0x73, 0x84, 0x9c, 0xde, 0xfa,
+	0x92, 0xb2, 0xe8, 0xca, 0x97, 0x13, 0xdd, 0x79, 0xc5, 0x4b, 0x5e, 0x42, 0x3d, 0x4e, 0x86, 0x53,
+	0x1a, 0x7c, 0xc2, 0x7b, 0xbd, 0xa6, 0x85, 0x83, 0xbc, 0x86, 0x56, 0xe8, 0x0b, 0x89, 0xfc, 0x9c,
+	0x46, 0x63, 0xe4, 0x31, 0xa7, 0x91, 0xd4, 0xab, 0x7b, 0x18, 0x38, 0xf8, 0x6d, 0x03, 0x64, 0x00,
+	0x4f, 0x19, 0x47, 0x72, 0x04, 0xcf, 0x96, 0x78, 0x91, 0x6d, 0xbd, 0xa7, 0x55, 0xb6, 0xed, 0x17,
+	0x3a, 0xb0, 0xc2, 0xee, 0x08, 0x9a, 0xb9, 0x14, 0xe8, 0x0a, 0x5b, 0xbd, 0x4c, 0x0f, 0x7b, 0xb9,
+	0x1e, 0xf6, 0xce, 0x52, 0x3d, 0x7c, 0xac, 0xc0, 0x5b, 0x68, 0x28, 0xb5, 0xfb, 0xbb, 0x7f, 0xbf,
+	0x83, 0xe6, 0xb2, 0x68, 0x12, 0x47, 0x27, 0x3e, 0xd0, 0xd2, 0x76, 0xcb, 0x88, 0xe8, 0x0f, 0xe2,
+	0xd4, 0xd4, 0x5c, 0x4d, 0x83, 0xec, 0x3c, 0xa8, 0xb0, 0xd0, 0xba, 0xa2, 0x22, 0x17, 0x86, 0x2c,
+	0x1a, 0x77, 0x48, 0x76, 0x57, 0xeb, 0x2c, 0x8b, 0x51, 0x51, 0xa9, 0x3e, 0x38, 0x8f, 0x9d, 0x34,
+	0x71, 0x9f, 0x28, 0xa7, 0x6f, 0xbe, 0xfd, 0xdc, 0xc8, 0xc9, 0xef, 0x62, 0x58, 0x55, 0xbe, 0xc3,
+	0x3f, 0x03, 0x00, 0xcd, 0x88, 0x25, 0x7c, 0xc2, 0x06, 0x00, 0x00,
 }
 
 // Reference imports to suppress errors if they are not otherwise used.
@@ -420,7 +726,9 @@ type WalletCoreClient interface {
 	EOSIOWallet(ctx context.Context, in *empty.Empty, opts ...grpc.CallOption) (*WalletResponse, error)
 	SignatureEOSIO(ctx context.Context, in *SignatureEOSIOReq, opts ...grpc.CallOption) (*SignTxResp, error)
 	SignatureEthereum(ctx context.Context, in *SignatureEthereumReq, opts ...grpc.CallOption) (*SignTxResp, error)
+	// SignatureBitcoincore sign raw tx given amount and script of every input, e.g. CPFP child; withdrawals use SignatureBitcoincorePSBT
 	SignatureBitcoincore(ctx context.Context, in *SignatureBitcoincoreReq, opts ...grpc.CallOption) (*SignTxResp, error)
+	SignatureBitcoincorePSBT(ctx context.Context, in *SignatureBitcoincorePSBTReq, opts ...grpc.CallOption) (*SignPSBTResp, error)
 }
 
 type walletCoreClient struct {
@@ -485,6 +793,15 @@ func (c *walletCoreClient) SignatureBitcoincore(ctx context.Context, in *Signatu
 	return out, nil
 }
 
+func (c *walletCoreClient) SignatureBitcoincorePSBT(ctx context.Context, in *SignatureBitcoincorePSBTReq, opts ...grpc.CallOption) (*SignPSBTResp, error) {
+	out := new(SignPSBTResp)
+	err := c.cc.Invoke(ctx, "/proto.WalletCore/SignatureBitcoincorePSBT", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // WalletCoreServer is the server API for WalletCore service.
 type WalletCoreServer interface {
 	BitcoinWallet(context.Context, *BitcoinWalletReq) (*WalletResponse, error)
@@ -492,7 +809,9 @@ type WalletCoreServer interface {
 	EOSIOWallet(context.Context, *empty.Empty) (*WalletResponse, error)
 	SignatureEOSIO(context.Context, *SignatureEOSIOReq) (*SignTxResp, error)
 	SignatureEthereum(context.Context, *SignatureEthereumReq) (*SignTxResp, error)
+	// SignatureBitcoincore sign raw tx given amount and script of every input, e.g. CPFP child; withdrawals use SignatureBitcoincorePSBT
 	SignatureBitcoincore(context.Context, *SignatureBitcoincoreReq) (*SignTxResp, error)
+	SignatureBitcoincorePSBT(context.Context, *SignatureBitcoincorePSBTReq) (*SignPSBTResp, error)
 }
 
 func RegisterWalletCoreServer(s *grpc.Server, srv WalletCoreServer) {
@@ -607,6 +926,24 @@ func _WalletCore_SignatureBitcoincore_Handler(srv interface{}, ctx context.Conte
 	return interceptor(ctx, in, info, handler)
 }
 
+func _WalletCore_SignatureBitcoincorePSBT_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SignatureBitcoincorePSBTReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(WalletCoreServer).SignatureBitcoincorePSBT(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.WalletCore/SignatureBitcoincorePSBT",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(WalletCoreServer).SignatureBitcoincorePSBT(ctx, req.(*SignatureBitcoincorePSBTReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 var _WalletCore_serviceDesc = grpc.ServiceDesc{
 	ServiceName: "proto.WalletCore",
 	HandlerType: (*WalletCoreServer)(nil),
@@ -635,6 +972,10 @@ var _WalletCore_serviceDesc = grpc.ServiceDesc{
 			MethodName: "SignatureBitcoincore",
 			Handler:    _WalletCore_SignatureBitcoincore_Handler,
 		},
+		{
+			MethodName: "SignatureBitcoincorePSBT",
+			Handler:    _WalletCore_SignatureBitcoincorePSBT_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "wallet_core.proto",
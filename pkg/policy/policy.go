@@ -0,0 +1,343 @@
+package policy
+
+import (
+  "fmt"
+  "bytes"
+  "time"
+  "strings"
+  "encoding/binary"
+  "wallet-go/pkg/db"
+  "wallet-go/pkg/configure"
+  "github.com/shopspring/decimal"
+  "github.com/syndtr/goleveldb/leveldb"
+  ldbutil "github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// rollingWindow velocity limits are evaluated over the last 24 hours
+const rollingWindow = 24 * time.Hour
+
+// NewEngine parse policies of configure, open signed volume leveldb
+func NewEngine(policies map[string]configure.PolicyInfo) (*Engine, error) {
+  rules := make(map[string]*Rule)
+  for asset, info := range policies {
+    rule, err := parseRule(info)
+    if err != nil {
+      return nil, fmt.Errorf("Policy of %s %s", asset, err)
+    }
+    rules[strings.ToLower(asset)] = rule
+  }
+  ldb, err := db.NewLDB(db.PolicyLD)
+  if err != nil {
+    return nil, err
+  }
+  return &Engine{rules: rules, ldb: ldb, now: time.Now}, nil
+}
+
+// Authorize evaluate request against policy of its asset, record the amount in rolling volume when allowed.
+// a replacement of signed requests is counted once, as the larger of its amount and the amounts it replaces.
+// internal transfer is checked against signing window only, it's neither limited nor recorded
+func (e *Engine) Authorize(req Request) (*Reservation, error) {
+  asset := strings.ToLower(req.Asset)
+  amount, err := parseAmount(req.Amount)
+  if err != nil {
+    return nil, err
+  }
+
+  e.mu.Lock()
+  defer e.mu.Unlock()
+  now := e.now().UTC()
+  rule := e.rules[asset]
+  if req.Internal {
+    if amount.Sign() < 0 {
+      return nil, fmt.Errorf("Amount can't be negative %s", req.Amount)
+    }
+    if rule != nil {
+      return nil, rule.checkWindow(now)
+    }
+    return nil, nil
+  }
+  if amount.Sign() <= 0 {
+    return nil, fmt.Errorf("Amount must be positive %s", req.Amount)
+  }
+  replaced, err := e.replaced(asset, req)
+  if err != nil {
+    return nil, err
+  }
+  volume := amount
+  replacedVolume := decimal.Zero
+  for _, value := range replaced {
+    replacedAmount, err := decimal.NewFromString(string(value))
+    if err != nil {
+      return nil, fmt.Errorf("Corrupted signing volume %s", err)
+    }
+    replacedVolume = replacedVolume.Add(replacedAmount)
+  }
+  if replacedVolume.GreaterThan(volume) {
+    volume = replacedVolume
+  }
+
+  if rule != nil {
+    if err = rule.check(req, amount, now); err != nil {
+      return nil, err
+    }
+    if rule.DailyLimit != nil || rule.AddressDailyLimit != nil {
+      assetVolume, addressVolume, err := e.volume(asset, req.From, now, replaced)
+      if err != nil {
+        return nil, err
+      }
+      if rule.DailyLimit != nil && assetVolume.Add(volume).GreaterThan(*rule.DailyLimit) {
+        return nil, fmt.Errorf("%s 24h volume %s exceeds daily limit %s", asset, assetVolume.Add(volume).String(), rule.DailyLimit.String())
+      }
+      if rule.AddressDailyLimit != nil && addressVolume.Add(volume).GreaterThan(*rule.AddressDailyLimit) {
+        return nil, fmt.Errorf("%s 24h volume of %s %s exceeds address daily limit %s", asset, req.From, addressVolume.Add(volume).String(), rule.AddressDailyLimit.String())
+      }
+    }
+  }
+
+  reservation := &Reservation{key: volumeKey(asset, now, req.From), replaced: replaced, conflicts: make(map[string][]byte)}
+  batch := new(leveldb.Batch)
+  for key := range replaced {
+    batch.Delete([]byte(key))
+  }
+  batch.Put(reservation.key, []byte(volume.String()))
+  for _, id := range req.Conflicts {
+    key := conflictKey(asset, req.To, id)
+    previous, err := e.ldb.Get(key, nil)
+    if err != nil && err != leveldb.ErrNotFound {
+      return nil, fmt.Errorf("Read conflict of signing volume %s", err)
+    }
+    reservation.conflicts[string(key)] = previous
+    batch.Put(key, reservation.key)
+  }
+  if err = e.ldb.Write(batch, nil); err != nil {
+    return nil, fmt.Errorf("Record signing volume %s", err)
+  }
+  e.prune(asset, now)
+  return reservation, nil
+}
+
+// Cancel remove volume of the reservation and restore volume it replaced, signature was not produced
+func (e *Engine) Cancel(r *Reservation) error {
+  if r == nil {
+    return nil
+  }
+  e.mu.Lock()
+  defer e.mu.Unlock()
+  batch := new(leveldb.Batch)
+  batch.Delete(r.key)
+  for key, value := range r.replaced {
+    batch.Put([]byte(key), value)
+  }
+  for key, previous := range r.conflicts {
+    if previous == nil {
+      batch.Delete([]byte(key))
+    }else {
+      batch.Put([]byte(key), previous)
+    }
+  }
+  return e.ldb.Write(batch, nil)
+}
+
+// replaced volume records of signed requests to the same destination sharing a conflict with req, keyed by volume key
+func (e *Engine) replaced(asset string, req Request) (map[string][]byte, error) {
+  replaced := make(map[string][]byte)
+  for _, id := range req.Conflicts {
+    key, err := e.ldb.Get(conflictKey(asset, req.To, id), nil)
+    if err == leveldb.ErrNotFound {
+      continue
+    }
+    if err != nil {
+      return nil, fmt.Errorf("Read conflict of signing volume %s", err)
+    }
+    if _, ok := replaced[string(key)]; ok {
+      continue
+    }
+    value, err := e.ldb.Get(key, nil)
+    if err == leveldb.ErrNotFound {
+      // volume was pruned or replaced
+      continue
+    }
+    if err != nil {
+      return nil, fmt.Errorf("Read signing volume %s", err)
+    }
+    replaced[string(key)] = value
+  }
+  return replaced, nil
+}
+
+// Close close volume leveldb
+func (e *Engine) Close() error {
+  return e.ldb.Close()
+}
+
+func (r *Rule) check(req Request, amount decimal.Decimal, now time.Time) error {
+  if r.MaxAmount != nil && amount.GreaterThan(*r.MaxAmount) {
+    return fmt.Errorf("Amount %s exceeds max single withdrawal %s", amount.String(), r.MaxAmount.String())
+  }
+  for _, address := range r.Deny {
+    if strings.EqualFold(address, req.To) {
+      return fmt.Errorf("Destination %s is denied", req.To)
+    }
+  }
+  if len(r.Allow) > 0 {
+    allowed := false
+    for _, address := range r.Allow {
+      if strings.EqualFold(address, req.To) {
+        allowed = true
+        break
+      }
+    }
+    if !allowed {
+      return fmt.Errorf("Destination %s isn't in allow list", req.To)
+    }
+  }
+  return r.checkWindow(now)
+}
+
+// checkWindow signing is allowed in window of UTC minutes
+func (r *Rule) checkWindow(now time.Time) error {
+  if r.WindowStart == r.WindowEnd {
+    return nil
+  }
+  minute := now.Hour() * 60 + now.Minute()
+  inWindow := minute >= r.WindowStart && minute < r.WindowEnd
+  if r.WindowStart > r.WindowEnd {
+    // window across midnight
+    inWindow = minute >= r.WindowStart || minute < r.WindowEnd
+  }
+  if !inWindow {
+    return fmt.Errorf("Signing is not allowed at %s UTC", now.Format("15:04"))
+  }
+  return nil
+}
+
+// volume signed volume of the asset and of the source address in rolling window, except excluded records
+func (e *Engine) volume(asset, from string, now time.Time, exclude map[string][]byte) (decimal.Decimal, decimal.Decimal, error) {
+  assetVolume, addressVolume := decimal.Zero, decimal.Zero
+  iter := e.ldb.NewIterator(&ldbutil.Range{Start: volumeKey(asset, now.Add(-rollingWindow), ""), Limit: volumeKey(asset, now.Add(time.Hour), "")}, nil)
+  defer iter.Release()
+  prefixLen := len(asset) + 1 + 8
+  for iter.Next() {
+    if _, ok := exclude[string(iter.Key())]; ok {
+      continue
+    }
+    amount, err := decimal.NewFromString(string(iter.Value()))
+    if err != nil {
+      return assetVolume, addressVolume, fmt.Errorf("Corrupted signing volume %s", err)
+    }
+    assetVolume = assetVolume.Add(amount)
+    if len(iter.Key()) >= prefixLen && string(iter.Key()[prefixLen:]) == from {
+      addressVolume = addressVolume.Add(amount)
+    }
+  }
+  return assetVolume, addressVolume, iter.Error()
+}
+
+// prune delete volume out of rolling window, and conflicts pointing to it
+func (e *Engine) prune(asset string, now time.Time) {
+  expired := volumeKey(asset, now.Add(-rollingWindow), "")
+  iter := e.ldb.NewIterator(&ldbutil.Range{Start: volumeKey(asset, time.Unix(0, 0), ""), Limit: expired}, nil)
+  defer iter.Release()
+  for iter.Next() {
+    if err := e.ldb.Delete(iter.Key(), nil); err != nil {
+      configure.Sugar.Warn("prune signing volume error: ", err.Error())
+      return
+    }
+  }
+
+  conflicts := e.ldb.NewIterator(ldbutil.BytesPrefix(conflictKey(asset, "", "")[:len(asset) + 2]), nil)
+  defer conflicts.Release()
+  for conflicts.Next() {
+    if bytes.Compare(conflicts.Value(), expired) >= 0 {
+      continue
+    }
+    if err := e.ldb.Delete(conflicts.Key(), nil); err != nil {
+      configure.Sugar.Warn("prune signing volume conflict error: ", err.Error())
+      return
+    }
+  }
+}
+
+// volumeKey asset | 0x00 | unix nano big endian | from, sorted by time within asset
+func volumeKey(asset string, t time.Time, from string) []byte {
+  key := make([]byte, 0, len(asset) + 1 + 8 + len(from))
+  key = append(key, asset...)
+  key = append(key, 0)
+  ts := make([]byte, 8)
+  binary.BigEndian.PutUint64(ts, uint64(t.UnixNano()))
+  key = append(key, ts...)
+  return append(key, from...)
+}
+
+// conflictKey 0x01 | asset | 0x00 | lower case to | 0x00 | conflict id, 0x01 never starts an asset of volume keys
+func conflictKey(asset, to, id string) []byte {
+  key := make([]byte, 0, 1 + len(asset) + 1 + len(to) + 1 + len(id))
+  key = append(key, 1)
+  key = append(key, asset...)
+  key = append(key, 0)
+  key = append(key, strings.ToLower(to)...)
+  key = append(key, 0)
+  return append(key, id...)
+}
+
+func parseRule(info configure.PolicyInfo) (*Rule, error) {
+  var (
+    rule Rule
+    err error
+  )
+  if rule.MaxAmount, err = parseLimit(info.MaxAmount); err != nil {
+    return nil, fmt.Errorf("max_amount %s", err)
+  }
+  if rule.DailyLimit, err = parseLimit(info.DailyLimit); err != nil {
+    return nil, fmt.Errorf("daily_limit %s", err)
+  }
+  if rule.AddressDailyLimit, err = parseLimit(info.AddressDailyLimit); err != nil {
+    return nil, fmt.Errorf("address_daily_limit %s", err)
+  }
+  rule.Allow, rule.Deny = info.Allow, info.Deny
+  if info.Window != "" {
+    bounds := strings.Split(info.Window, "-")
+    if len(bounds) != 2 {
+      return nil, fmt.Errorf("window must be HH:MM-HH:MM, got %s", info.Window)
+    }
+    if rule.WindowStart, err = parseMinute(bounds[0]); err != nil {
+      return nil, err
+    }
+    if rule.WindowEnd, err = parseMinute(bounds[1]); err != nil {
+      return nil, err
+    }
+  }
+  return &rule, nil
+}
+
+func parseLimit(limit string) (*decimal.Decimal, error) {
+  if limit == "" {
+    return nil, nil
+  }
+  d, err := decimal.NewFromString(limit)
+  if err != nil {
+    return nil, err
+  }
+  return &d, nil
+}
+
+func parseMinute(hhmm string) (int, error) {
+  t, err := time.Parse("15:04", strings.TrimSpace(hhmm))
+  if err != nil {
+    return 0, fmt.Errorf("window time %s", err)
+  }
+  return t.Hour() * 60 + t.Minute(), nil
+}
+
+// parseAmount decimal amount, eos quantity "1.0000 EOS" carries symbol after the amount
+func parseAmount(amount string) (decimal.Decimal, error) {
+  fields := strings.Fields(amount)
+  if len(fields) == 0 {
+    return decimal.Zero, fmt.Errorf("Empty amount")
+  }
+  d, err := decimal.NewFromString(fields[0])
+  if err != nil {
+    return decimal.Zero, fmt.Errorf("Invalid amount %s", amount)
+  }
+  return d, nil
+}
@@ -0,0 +1,190 @@
+package policy
+
+import (
+  "time"
+  "testing"
+  "wallet-go/pkg/db"
+  "wallet-go/pkg/configure"
+  "github.com/syndtr/goleveldb/leveldb"
+)
+
+// testEngine engine of btc policy whose clock is moved by the returned setter
+func testEngine(t *testing.T, info configure.PolicyInfo) (*Engine, func(time.Time)) {
+  rule, err := parseRule(info)
+  if err != nil {
+    t.Fatal(err)
+  }
+  ldb, err := leveldb.OpenFile(t.TempDir(), nil)
+  if err != nil {
+    t.Fatal(err)
+  }
+  now := time.Date(2019, 1, 15, 12, 0, 0, 0, time.UTC)
+  e := &Engine{rules: map[string]*Rule{"btc": rule}, ldb: &db.LDB{DB: ldb}, now: func() time.Time { return now }}
+  t.Cleanup(func() { e.Close() })
+  return e, func(at time.Time) { now = at }
+}
+
+func TestAuthorizeRule(t *testing.T) {
+  e, _ := testEngine(t, configure.PolicyInfo{MaxAmount: "2", Deny: []string{"1BoatSLRHtKNngkdXEeobR76b53LETtpyT"}})
+  cases := []struct {
+    req Request
+    ok  bool
+  }{
+    {Request{Asset: "BTC", From: "a", To: "b", Amount: "2"}, true},
+    {Request{Asset: "btc", From: "a", To: "b", Amount: "2.00000001"}, false},
+    {Request{Asset: "btc", From: "a", To: "1boatslrhtknngkdxeeobr76b53lettpyt", Amount: "1"}, false},
+    {Request{Asset: "btc", From: "a", To: "b", Amount: "0"}, false},
+    {Request{Asset: "btc", From: "a", To: "b", Amount: "-1"}, false},
+    // asset without policy is unlimited
+    {Request{Asset: "eth", From: "a", To: "b", Amount: "1000000"}, true},
+    // transfer between wallet addresses isn't limited, cancel pays 0
+    {Request{Asset: "btc", From: "a", To: "1BoatSLRHtKNngkdXEeobR76b53LETtpyT", Amount: "3", Internal: true}, true},
+    {Request{Asset: "btc", From: "a", To: "a", Amount: "0", Internal: true}, true},
+    {Request{Asset: "btc", From: "a", To: "a", Amount: "-1", Internal: true}, false},
+  }
+  for _, c := range cases {
+    if _, err := e.Authorize(c.req); (err == nil) != c.ok {
+      t.Fatalf("%+v: %v", c.req, err)
+    }
+  }
+
+  e, _ = testEngine(t, configure.PolicyInfo{Allow: []string{"b"}})
+  if _, err := e.Authorize(Request{Asset: "btc", From: "a", To: "c", Amount: "1"}); err == nil {
+    t.Fatal("destination out of allow list is authorized")
+  }
+  if _, err := e.Authorize(Request{Asset: "btc", From: "a", To: "B", Amount: "1"}); err != nil {
+    t.Fatal(err)
+  }
+}
+
+func TestAuthorizeWindow(t *testing.T) {
+  e, setNow := testEngine(t, configure.PolicyInfo{Window: "22:00-02:00"})
+  req := Request{Asset: "btc", From: "a", To: "b", Amount: "1"}
+  cases := []struct {
+    hour, minute int
+    ok           bool
+  }{
+    {21, 59, false},
+    {22, 0, true},
+    {0, 30, true},
+    {1, 59, true},
+    {2, 0, false},
+    {12, 0, false},
+  }
+  for _, c := range cases {
+    setNow(time.Date(2019, 1, 15, c.hour, c.minute, 0, 0, time.UTC))
+    if _, err := e.Authorize(req); (err == nil) != c.ok {
+      t.Fatalf("%02d:%02d: %v", c.hour, c.minute, err)
+    }
+    if _, err := e.Authorize(Request{Asset: "btc", From: "a", To: "a", Amount: "1", Internal: true}); (err == nil) != c.ok {
+      t.Fatalf("internal %02d:%02d: %v", c.hour, c.minute, err)
+    }
+  }
+}
+
+func TestAuthorizeRollingWindow(t *testing.T) {
+  e, setNow := testEngine(t, configure.PolicyInfo{DailyLimit: "10", AddressDailyLimit: "6"})
+  start := time.Date(2019, 1, 15, 12, 0, 0, 0, time.UTC)
+  authorize := func(at time.Duration, from, amount string) error {
+    setNow(start.Add(at))
+    _, err := e.Authorize(Request{Asset: "btc", From: from, To: "c", Amount: amount})
+    return err
+  }
+
+  if err := authorize(0, "a", "6"); err != nil {
+    t.Fatal(err)
+  }
+  if err := authorize(time.Hour, "a", "0.1"); err == nil {
+    t.Fatal("address daily limit exceeded")
+  }
+  if err := authorize(2 * time.Hour, "b", "4"); err != nil {
+    t.Fatal(err)
+  }
+  if err := authorize(3 * time.Hour, "b", "0.1"); err == nil {
+    t.Fatal("asset daily limit exceeded")
+  }
+  // volume of "a" is still inside the window one nanosecond before it expires
+  if err := authorize(rollingWindow - time.Nanosecond, "c", "0.1"); err == nil {
+    t.Fatal("volume left the window early")
+  }
+  // volume of "a" left the window, "b" is still counted
+  if err := authorize(rollingWindow + time.Second, "a", "6"); err != nil {
+    t.Fatal(err)
+  }
+  if err := authorize(rollingWindow + 2 * time.Second, "c", "0.1"); err == nil {
+    t.Fatal("volume of b left the window early")
+  }
+
+  // internal transfer isn't counted
+  if _, err := e.Authorize(Request{Asset: "btc", From: "a", To: "b", Amount: "6", Internal: true}); err != nil {
+    t.Fatal(err)
+  }
+
+  // expired volume is pruned
+  count := 0
+  iter := e.ldb.NewIterator(nil, nil)
+  for iter.Next() {
+    count++
+  }
+  iter.Release()
+  if count != 2 {
+    t.Fatalf("%d volume records, want 2", count)
+  }
+}
+
+func TestCancelReservation(t *testing.T) {
+  e, _ := testEngine(t, configure.PolicyInfo{DailyLimit: "1"})
+  req := Request{Asset: "btc", From: "a", To: "b", Amount: "1"}
+  reservation, err := e.Authorize(req)
+  if err != nil {
+    t.Fatal(err)
+  }
+  if _, err = e.Authorize(req); err == nil {
+    t.Fatal("daily limit exceeded")
+  }
+  if err = e.Cancel(reservation); err != nil {
+    t.Fatal(err)
+  }
+  if _, err = e.Authorize(req); err != nil {
+    t.Fatalf("cancelled volume is counted %v", err)
+  }
+}
+
+func TestAuthorizeReplacement(t *testing.T) {
+  e, _ := testEngine(t, configure.PolicyInfo{DailyLimit: "1"})
+  original := Request{Asset: "btc", From: "a", To: "b", Amount: "0.8", Conflicts: []string{"01:0", "02:1"}}
+  if _, err := e.Authorize(original); err != nil {
+    t.Fatal(err)
+  }
+  // fee bumping replacement spends the same outpoint, it replaces volume of original
+  replacement := Request{Asset: "btc", From: "a", To: "b", Amount: "0.8", Conflicts: []string{"02:1", "03:0"}}
+  if _, err := e.Authorize(replacement); err != nil {
+    t.Fatal(err)
+  }
+  // another destination doesn't replace
+  if _, err := e.Authorize(Request{Asset: "btc", From: "a", To: "c", Amount: "0.8", Conflicts: []string{"01:0"}}); err == nil {
+    t.Fatal("conflict to another destination replaced volume")
+  }
+  if _, err := e.Authorize(Request{Asset: "btc", From: "a", To: "c", Amount: "0.3"}); err == nil {
+    t.Fatal("replaced volume is lost")
+  }
+
+  larger := Request{Asset: "btc", From: "a", To: "b", Amount: "0.9", Conflicts: []string{"03:0"}}
+  reservation, err := e.Authorize(larger)
+  if err != nil {
+    t.Fatal(err)
+  }
+  if _, err = e.Authorize(Request{Asset: "btc", From: "a", To: "c", Amount: "0.2"}); err == nil {
+    t.Fatal("larger replacement isn't counted")
+  }
+  // cancelled replacement restores 0.8 of the one it replaced
+  if err = e.Cancel(reservation); err != nil {
+    t.Fatal(err)
+  }
+  if _, err = e.Authorize(Request{Asset: "btc", From: "a", To: "c", Amount: "0.3"}); err == nil {
+    t.Fatal("replaced volume isn't restored")
+  }
+  if _, err = e.Authorize(Request{Asset: "btc", From: "a", To: "c", Amount: "0.2"}); err != nil {
+    t.Fatal(err)
+  }
+}
@@ -0,0 +1,50 @@
+package policy
+
+import (
+  "sync"
+  "time"
+  "wallet-go/pkg/db"
+  "github.com/shopspring/decimal"
+)
+
+// Engine evaluate signing policies, signed volume is persisted in leveldb for the rolling window
+type Engine struct {
+  rules map[string]*Rule
+  ldb   *db.LDB
+  mu    sync.Mutex
+  now   func() time.Time
+}
+
+// Rule parsed policy of an asset, nil limit means unlimited
+type Rule struct {
+  MaxAmount         *decimal.Decimal
+  DailyLimit        *decimal.Decimal
+  AddressDailyLimit *decimal.Decimal
+  Allow             []string
+  Deny              []string
+  // minutes of day in UTC, window is disabled when start equals end
+  WindowStart       int
+  WindowEnd         int
+}
+
+// Request signing request to evaluate
+type Request struct {
+  Asset   string
+  From    string
+  To      string
+  Amount  string
+  // Internal destination is a key store address, funds don't leave the wallet
+  Internal bool
+  // Conflicts what the tx spends, bitcoin outpoints or ethereum account nonce.
+  // signed request to the same destination sharing any of them is replaced, only one of them can be mined
+  Conflicts []string
+}
+
+// Reservation volume recorded by Authorize, cancel it when signing fails
+type Reservation struct {
+  key []byte
+  // replaced volume records of replaced requests, restored on cancel
+  replaced map[string][]byte
+  // conflicts conflict records pointing to key, with their previous value, nil when they were absent
+  conflicts map[string][]byte
+}
@@ -0,0 +1,107 @@
+package rpc
+
+import (
+  "fmt"
+  "strings"
+  "context"
+  "crypto/sha256"
+  "encoding/hex"
+  "google.golang.org/grpc"
+  "google.golang.org/grpc/codes"
+  "google.golang.org/grpc/status"
+  "wallet-go/pkg/pb"
+  "wallet-go/pkg/blockchain"
+  "wallet-go/pkg/configure"
+  protobuf "github.com/golang/protobuf/proto"
+)
+
+// AuditInterceptor append every call to the audit log, response is withheld when it can't be recorded
+func (s *WalletCoreServerRPC) AuditInterceptor() grpc.UnaryServerInterceptor {
+  return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+    caller, err := clientName(ctx)
+    if err != nil {
+      caller = "unauthenticated"
+    }
+    var request []byte
+    if msg, ok := req.(protobuf.Message); ok {
+      if request, err = protobuf.Marshal(msg); err != nil {
+        return nil, status.Errorf(codes.Internal, "Audit request %s", err)
+      }
+    }
+
+    resp, callErr := handler(ctx, req)
+    var result, errMsg string
+    if callErr != nil {
+      errMsg = callErr.Error()
+    } else {
+      result = auditResult(info.FullMethod, resp)
+    }
+    entry, err := s.audit.Append(info.FullMethod, caller, request, result, errMsg)
+    if err != nil {
+      configure.Sugar.Error("audit log error: ", err.Error(), " method: ", info.FullMethod)
+      return nil, status.Errorf(codes.Internal, "Audit log %s", err)
+    }
+    configure.Sugar.Info("audit seq: ", entry.Seq, " method: ", info.FullMethod, " caller: ", caller)
+    return resp, callErr
+  }
+}
+
+// ChainUnaryInterceptors run interceptors in order, the first one is the outermost
+func ChainUnaryInterceptors(interceptors ...grpc.UnaryServerInterceptor) grpc.UnaryServerInterceptor {
+  return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+    chained := handler
+    for i := len(interceptors) - 1; i >= 0; i-- {
+      interceptor, next := interceptors[i], chained
+      chained = func(ctx context.Context, req interface{}) (interface{}, error) {
+        return interceptor(ctx, req, info, next)
+      }
+    }
+    return chained(ctx, req)
+  }
+}
+
+// auditResult created address, or txid and sha256 of signed tx or PSBT as "txid:<txid> sha256:<hash>",
+// txid of PSBT is its unsigned tx id, which is final txid when every input is segwit
+func auditResult(method string, resp interface{}) string {
+  switch r := resp.(type) {
+  case *proto.WalletResponse:
+    return r.Address
+  case *proto.SignTxResp:
+    signedTx, err := hex.DecodeString(strings.TrimPrefix(r.HexSignedTx, "0x"))
+    if err != nil {
+      signedTx = []byte(r.HexSignedTx)
+    }
+    hash := sha256.Sum256(signedTx)
+    return fmt.Sprintf("txid:%s sha256:%s", signedTxID(method, r.HexSignedTx), hex.EncodeToString(hash[:]))
+  case *proto.SignPSBTResp:
+    var txid string
+    if packet, err := blockchain.DecodePSBT(r.Psbt); err == nil {
+      txid = packet.UnsignedTx.TxHash().String()
+    }
+    hash := sha256.Sum256([]byte(r.Psbt))
+    return fmt.Sprintf("txid:%s sha256:%s", txid, hex.EncodeToString(hash[:]))
+  default:
+    return ""
+  }
+}
+
+// signedTxID txid of bitcoin or ethereum signed tx, empty when it can't be decoded
+func signedTxID(method, signedTxHex string) string {
+  switch {
+  case strings.HasSuffix(method, "/SignatureBitcoincore"):
+    if tx, err := blockchain.DecodeBtcTxHex(signedTxHex); err == nil {
+      return tx.Hash().String()
+    }
+  case strings.HasSuffix(method, "/SignatureEthereum") && blockchain.IsDynamicFeeTx(signedTxHex):
+    if tx, err := blockchain.DecodeDynamicFeeTx(signedTxHex); err == nil {
+      if hash, err := tx.Hash(); err == nil {
+        return hash.Hex()
+      }
+    }
+  case strings.HasSuffix(method, "/SignatureEthereum"):
+    if tx, err := blockchain.DecodeETHTx(signedTxHex); err == nil {
+      return tx.Hash().Hex()
+    }
+  }
+  return ""
+}
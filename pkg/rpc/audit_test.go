@@ -0,0 +1,50 @@
+package rpc
+
+import (
+  "bytes"
+  "testing"
+  "math/big"
+  "crypto/sha256"
+  "encoding/hex"
+  "wallet-go/pkg/pb"
+  "wallet-go/pkg/blockchain"
+  "github.com/btcsuite/btcd/wire"
+  "github.com/btcsuite/btcd/chaincfg/chainhash"
+  "github.com/ethereum/go-ethereum/common"
+  "github.com/ethereum/go-ethereum/crypto"
+  "github.com/ethereum/go-ethereum/core/types"
+)
+
+func TestAuditResultTxid(t *testing.T) {
+  key, err := crypto.GenerateKey()
+  if err != nil {
+    t.Fatal(err)
+  }
+  tx, err := types.SignTx(types.NewTransaction(1, common.HexToAddress("0x01"), big.NewInt(1), 21000, big.NewInt(1), nil), types.NewEIP155Signer(big.NewInt(1)), key)
+  if err != nil {
+    t.Fatal(err)
+  }
+  txHex, err := blockchain.EncodeETHTx(tx)
+  if err != nil {
+    t.Fatal(err)
+  }
+  raw, _ := hex.DecodeString(txHex[2:])
+  hash := sha256.Sum256(raw)
+  want := "txid:" + tx.Hash().Hex() + " sha256:" + hex.EncodeToString(hash[:])
+  if got := auditResult("/proto.WalletCore/SignatureEthereum", &proto.SignTxResp{Result: true, HexSignedTx: txHex}); got != want {
+    t.Fatalf("ethereum audit result %s, want %s", got, want)
+  }
+
+  msgTx := wire.NewMsgTx(wire.TxVersion)
+  msgTx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{1}, 0), []byte{0x51}, nil))
+  msgTx.AddTxOut(wire.NewTxOut(1000, []byte{0x51}))
+  var buf bytes.Buffer
+  if err = msgTx.Serialize(&buf); err != nil {
+    t.Fatal(err)
+  }
+  hash = sha256.Sum256(buf.Bytes())
+  want = "txid:" + msgTx.TxHash().String() + " sha256:" + hex.EncodeToString(hash[:])
+  if got := auditResult("/proto.WalletCore/SignatureBitcoincore", &proto.SignTxResp{Result: true, HexSignedTx: hex.EncodeToString(buf.Bytes())}); got != want {
+    t.Fatalf("bitcoin audit result %s, want %s", got, want)
+  }
+}
@@ -0,0 +1,62 @@
+package rpc
+
+import (
+  "strings"
+  "context"
+  "google.golang.org/grpc"
+  "google.golang.org/grpc/codes"
+  "google.golang.org/grpc/peer"
+  "google.golang.org/grpc/status"
+  "google.golang.org/grpc/credentials"
+  "wallet-go/pkg/configure"
+)
+
+// signatureMethodPrefix full method prefix of Signature* rpc
+const signatureMethodPrefix = "/proto.WalletCore/Signature"
+
+// AuthInterceptor authorize caller by common name of verified client certificate,
+// allowed clients may call wallet_core, Signature* methods are restricted to signers
+func AuthInterceptor(info configure.TLSInfo) grpc.UnaryServerInterceptor {
+  allowed := nameSet(info.AllowedClients)
+  signers := nameSet(info.Signers)
+  return func(ctx context.Context, req interface{}, serverInfo *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+    name, err := clientName(ctx)
+    if err != nil {
+      return nil, err
+    }
+    if !allowed[name] && !signers[name] {
+      configure.Sugar.Warn("reject wallet core client: ", name, " method: ", serverInfo.FullMethod)
+      return nil, status.Errorf(codes.PermissionDenied, "Client %s isn't allowed", name)
+    }
+    if strings.HasPrefix(serverInfo.FullMethod, signatureMethodPrefix) && !signers[name] {
+      configure.Sugar.Warn("reject signature client: ", name, " method: ", serverInfo.FullMethod)
+      return nil, status.Errorf(codes.PermissionDenied, "Client %s isn't allowed to sign", name)
+    }
+    return handler(ctx, req)
+  }
+}
+
+// clientName common name of verified client certificate
+func clientName(ctx context.Context) (string, error) {
+  p, ok := peer.FromContext(ctx)
+  if !ok {
+    return "", status.Error(codes.Unauthenticated, "No peer info")
+  }
+  tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo)
+  if !ok {
+    return "", status.Error(codes.Unauthenticated, "Mutual TLS is required")
+  }
+  chains := tlsInfo.State.VerifiedChains
+  if len(chains) == 0 || len(chains[0]) == 0 {
+    return "", status.Error(codes.Unauthenticated, "Client certificate isn't verified")
+  }
+  return chains[0][0].Subject.CommonName, nil
+}
+
+func nameSet(names []string) map[string]bool {
+  set := make(map[string]bool)
+  for _, name := range names {
+    set[name] = true
+  }
+  return set
+}
@@ -0,0 +1,82 @@
+package rpc
+
+import (
+  "fmt"
+  "wallet-go/pkg/db"
+  "wallet-go/pkg/audit"
+  "wallet-go/pkg/policy"
+  "wallet-go/pkg/configure"
+  "wallet-go/pkg/keystore"
+  "wallet-go/pkg/blockchain"
+  "google.golang.org/grpc/codes"
+  "google.golang.org/grpc/status"
+)
+
+// NewWalletCoreServerRPC open key store of every chain once, the handles are shared by concurrent rpc calls until Close
+func NewWalletCoreServerRPC(hd *blockchain.HDWallet, secret *keystore.Secret) (*WalletCoreServerRPC, error) {
+  s := &WalletCoreServerRPC{HD: hd, keys: make(map[string]keystore.KeyStore)}
+  for _, asset := range []string{db.BitcoinCoreLD, db.EthereumLD, db.EOSLD} {
+    keys, err := keystore.New(asset, secret)
+    if err != nil {
+      s.Close()
+      return nil, fmt.Errorf("Open %s key store %s", asset, err)
+    }
+    s.keys[asset] = keys
+  }
+  engine, err := policy.NewEngine(configure.Config.Policies)
+  if err != nil {
+    s.Close()
+    return nil, fmt.Errorf("Load signing policies %s", err)
+  }
+  s.policy = engine
+  if s.audit, err = audit.Open(); err != nil {
+    s.Close()
+    return nil, fmt.Errorf("Open audit log %s", err)
+  }
+  return s, nil
+}
+
+// Close close key stores and master seed, only the first call takes effect
+func (s *WalletCoreServerRPC) Close() error {
+  var closeErr error
+  s.once.Do(func() {
+    for asset, keys := range s.keys {
+      if err := keys.Close(); err != nil {
+        closeErr = fmt.Errorf("Close %s key store %s", asset, err)
+      }
+    }
+    if s.policy != nil {
+      if err := s.policy.Close(); err != nil {
+        closeErr = fmt.Errorf("Close policy engine %s", err)
+      }
+    }
+    if s.audit != nil {
+      if err := s.audit.Close(); err != nil {
+        closeErr = fmt.Errorf("Close audit log %s", err)
+      }
+    }
+    if s.HD != nil {
+      if err := s.HD.Close(); err != nil {
+        closeErr = fmt.Errorf("Close hd wallet %s", err)
+      }
+    }
+  })
+  return closeErr
+}
+
+// authorize evaluate signing policy, violation is returned as PermissionDenied status
+func (s *WalletCoreServerRPC) authorize(req policy.Request) (*policy.Reservation, error) {
+  reservation, err := s.policy.Authorize(req)
+  if err != nil {
+    return nil, status.Errorf(codes.PermissionDenied, "Signing policy %s", err)
+  }
+  return reservation, nil
+}
+
+func (s *WalletCoreServerRPC) keyStore(asset string) (keystore.KeyStore, error) {
+  keys, ok := s.keys[asset]
+  if !ok {
+    return nil, keystore.ErrLocked
+  }
+  return keys, nil
+}
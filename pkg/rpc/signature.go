@@ -2,32 +2,47 @@ package rpc
 
 import (
   "fmt"
+  "strconv"
   "strings"
   "context"
-  "encoding/hex"
   "wallet-go/pkg/pb"
   "wallet-go/pkg/db"
+  "wallet-go/pkg/policy"
+  "wallet-go/pkg/keystore"
   "wallet-go/pkg/blockchain"
+  "github.com/btcsuite/btcutil"
+  "google.golang.org/grpc/codes"
+  "google.golang.org/genproto/googleapis/rpc/errdetails"
+  "google.golang.org/grpc/status"
 )
 
 // SignatureEOSIO eosio transaction signature
 func (s *WalletCoreServerRPC) SignatureEOSIO(ctx context.Context, in *proto.SignatureEOSIOReq) (*proto.SignTxResp, error) {
-  ldb, err := db.NewLDB(db.EOSLD)
+  keys, err := s.keyStore(db.EOSLD)
   if err != nil {
     return nil, err
   }
-  defer ldb.Close()
 
   // query from address
-  priv, err := ldb.Get([]byte(in.Pubkey), nil)
-  if err != nil && strings.Contains(err.Error(), "leveldb: not found") {
-    return nil, fmt.Errorf("Address %s, not found %s", in.Pubkey, err)
+  if exists, err := keys.Has(in.Pubkey); err != nil {
+    return nil, err
+  }else if !exists {
+    return nil, fmt.Errorf("Address %s, not found %s", in.Pubkey, keystore.ErrKeyNotFound)
   }
 
-  eosChain := blockchain.EOSChain{}
+  eosChain := blockchain.EOSChain{Keys: keys}
   b := blockchain.NewBlockchain(nil, eosChain, nil)
-  signedTx, err := b.Operator.SignedTx(in.RawTxHex, string(priv[:]), blockchain.NewChainsOptions(blockchain.ChainID(in.ChainID)))
+  options := blockchain.NewChainsOptions(blockchain.ChainID(in.ChainID), blockchain.ChainFrom(in.Pubkey), blockchain.ChainIntent(in.To, in.Amount, in.Asset))
+  if err = b.Operator.VerifyTx(in.RawTxHex, options); err != nil {
+    return nil, status.Errorf(codes.InvalidArgument, "Refuse to sign %s", err)
+  }
+  reservation, err := s.authorize(policy.Request{Asset: in.Asset, From: options.From, To: in.To, Amount: in.Amount})
+  if err != nil {
+    return nil, err
+  }
+  signedTx, err := b.Operator.SignedTx(in.RawTxHex, options)
   if err != nil {
+    s.policy.Cancel(reservation)
     return nil, err
   }
 
@@ -36,40 +51,65 @@ func (s *WalletCoreServerRPC) SignatureEOSIO(ctx context.Context, in *proto.Sign
 
 // SignatureEthereum ethereum transaction signature
 func (s *WalletCoreServerRPC) SignatureEthereum(ctx context.Context, in *proto.SignatureEthereumReq) (*proto.SignTxResp, error) {
-  ldb, err := db.NewLDB(db.EthereumLD)
+  keys, err := s.keyStore(db.EthereumLD)
   if err != nil {
     return nil, err
   }
-  defer ldb.Close()
 
   // query from address
-  priv, err := ldb.Get([]byte(in.Account), nil)
-  if err != nil && strings.Contains(err.Error(), "leveldb: not found") {
-    return nil, fmt.Errorf("Address %s, not found %s", in.Account, err)
+  if exists, err := keys.Has(in.Account); err != nil {
+    return nil, err
+  }else if !exists {
+    return nil, fmt.Errorf("Address %s, not found %s", in.Account, keystore.ErrKeyNotFound)
   }
 
-  chain := blockchain.EthereumChain{}
+  chain := blockchain.EthereumChain{Keys: keys}
   b := blockchain.NewBlockchain(nil, chain, nil)
-  signedTx, err := b.Operator.SignedTx(in.RawTxHex, hex.EncodeToString(priv), blockchain.NewChainsOptions(blockchain.ChainID(in.ChainID)))
+  options := blockchain.NewChainsOptions(blockchain.ChainID(in.ChainID), blockchain.ChainFrom(in.Account), blockchain.ChainIntent(in.To, in.Amount, in.Asset))
+  if err = b.Operator.VerifyTx(in.RawTxHex, options); err != nil {
+    return nil, status.Errorf(codes.InvalidArgument, "Refuse to sign %s", err)
+  }
+  nonce, err := blockchain.EthereumTxNonce(in.RawTxHex)
+  if err != nil {
+    return nil, status.Errorf(codes.InvalidArgument, "Refuse to sign %s", err)
+  }
+  // sweeps, gas top-ups and cancels pay wallet addresses, they aren't limited
+  internal, err := keys.Has(strings.ToLower(in.To))
+  if err != nil {
+    return nil, err
+  }
+  // speed up at the same nonce replaces the volume of the tx it replaces
+  reservation, err := s.authorize(policy.Request{Asset: in.Asset, From: options.From, To: in.To, Amount: in.Amount, Internal: internal, Conflicts: []string{ethereumConflict(options.From, nonce)}})
   if err != nil {
     return nil, err
   }
+  signedTx, err := b.Operator.SignedTx(in.RawTxHex, options)
+  if err != nil {
+    s.policy.Cancel(reservation)
+    return nil, err
+  }
 
   return &proto.SignTxResp{Result: true, HexSignedTx: signedTx}, nil
 }
 
-// SignatureBitcoincore bitcoincore transaction signature
+// ethereumConflict policy conflict of ethereum tx, txs of the same nonce replace each other
+func ethereumConflict(from string, nonce uint64) string {
+  return strings.ToLower(from) + "/" + strconv.FormatUint(nonce, 10)
+}
+
+// SignatureBitcoincore bitcoincore transaction signature, inputs may spend different key store addresses given their previous output scripts,
+// inputs must spend From unless the tx pays one wallet address
 func (s *WalletCoreServerRPC) SignatureBitcoincore(ctx context.Context, in *proto.SignatureBitcoincoreReq) (*proto.SignTxResp, error) {
-  ldb, err := db.NewLDB(db.BitcoinCoreLD)
+  keys, err := s.keyStore(db.BitcoinCoreLD)
   if err != nil {
     return nil, err
   }
-  defer ldb.Close()
 
   // query from address
-  priv, err := ldb.Get([]byte(in.From), nil)
-  if err != nil && strings.Contains(err.Error(), "leveldb: not found") {
-    return nil, fmt.Errorf("Address: %s not found %s", in.From, err)
+  if exists, err := keys.Has(in.From); err != nil {
+    return nil, err
+  }else if !exists {
+    return nil, fmt.Errorf("Address: %s not found %s", in.From, keystore.ErrKeyNotFound)
   }
 
   bitcoinnet, err := blockchain.BitcoinNet(in.Mode)
@@ -77,12 +117,141 @@ func (s *WalletCoreServerRPC) SignatureBitcoincore(ctx context.Context, in *prot
     return nil, fmt.Errorf("Bitcoin mode %s", err)
   }
 
-  chain := blockchain.BitcoinCoreChain{Mode: bitcoinnet}
+  chain := blockchain.BitcoinCoreChain{Mode: bitcoinnet, Keys: keys}
   b := blockchain.NewBlockchain(nil, chain, nil)
-  signedTx, err := b.Operator.SignedTx(in.RawTxHex, string(priv[:]), blockchain.NewChainsOptions(blockchain.ChainFrom(in.From), blockchain.ChainVinAmount(in.VinAmount)))
+  options := blockchain.NewChainsOptions(blockchain.ChainFrom(in.From), blockchain.ChainVinAmounts(in.VinAmounts), blockchain.ChainVinPkScripts(in.VinPkScripts), blockchain.ChainIntent(in.To, in.Amount, in.Asset))
+  if err = b.Operator.VerifyTx(in.RawTxHex, options); err != nil {
+    return nil, status.Errorf(codes.InvalidArgument, "Refuse to sign %s", err)
+  }
+  // previous output scripts choose signing keys, policy authorizes the owners VerifyTx bound them to
+  reservations, err := s.authorizeBitcoin(chain, in.RawTxHex, options)
+  if err != nil {
+    return nil, err
+  }
+  signedTx, err := b.Operator.SignedTx(in.RawTxHex, options)
   if err != nil {
+    s.cancel(reservations)
     return nil, err
   }
 
   return &proto.SignTxResp{Result: true, HexSignedTx: signedTx}, nil
 }
+
+// SignatureBitcoincorePSBT sign every input of bitcoin PSBT, previous output of each input must pay to From,
+// or to wallet addresses when the PSBT pays one wallet address
+func (s *WalletCoreServerRPC) SignatureBitcoincorePSBT(ctx context.Context, in *proto.SignatureBitcoincorePSBTReq) (*proto.SignPSBTResp, error) {
+  keys, err := s.keyStore(db.BitcoinCoreLD)
+  if err != nil {
+    return nil, err
+  }
+  bitcoinnet, err := blockchain.BitcoinNet(in.Mode)
+  if err != nil {
+    return nil, fmt.Errorf("Bitcoin mode %s", err)
+  }
+  packet, err := blockchain.DecodePSBT(in.Psbt)
+  if err != nil {
+    return nil, status.Errorf(codes.InvalidArgument, "Decode PSBT %s", err)
+  }
+  rawTxHex, err := packet.UnsignedTxHex()
+  if err != nil {
+    return nil, err
+  }
+  // previous outputs decide signing keys, they are bound to the intent by VerifyTx
+  vinAmounts := make([]int64, len(packet.Inputs))
+  vinPkScripts := make([][]byte, len(packet.Inputs))
+  for i := range packet.Inputs {
+    utxo, err := packet.InputUtxo(i)
+    if err != nil {
+      return nil, status.Errorf(codes.InvalidArgument, "Refuse to sign %s", err)
+    }
+    vinAmounts[i], vinPkScripts[i] = utxo.Value, utxo.PkScript
+  }
+
+  recipients := []blockchain.Recipient{{To: in.To, Amount: in.Amount}}
+  if len(in.Recipients) > 0 {
+    recipients = recipients[:0]
+    for _, recipient := range in.Recipients {
+      recipients = append(recipients, blockchain.Recipient{To: recipient.To, Amount: recipient.Amount})
+    }
+  }
+  chain := blockchain.BitcoinCoreChain{Mode: bitcoinnet, Keys: keys}
+  options := blockchain.NewChainsOptions(blockchain.ChainFrom(in.From), blockchain.ChainVinAmounts(vinAmounts), blockchain.ChainVinPkScripts(vinPkScripts), blockchain.ChainRecipients(recipients, in.Asset))
+  if err = chain.VerifyTx(rawTxHex, options); err != nil {
+    return nil, status.Errorf(codes.InvalidArgument, "Refuse to sign %s", err)
+  }
+  reservations, err := s.authorizeBitcoin(chain, rawTxHex, options)
+  if err != nil {
+    return nil, err
+  }
+  if err = chain.SignPSBT(packet); err != nil {
+    s.cancel(reservations)
+    return nil, status.Errorf(codes.InvalidArgument, "Sign PSBT %s", err)
+  }
+  signed, err := packet.B64Encode()
+  if err != nil {
+    s.cancel(reservations)
+    return nil, err
+  }
+  return &proto.SignPSBTResp{Psbt: signed}, nil
+}
+
+// authorizeBitcoin authorize every recipient as withdrawal of From, or every input owner as transfer of its input amount
+// to the only recipient when tx spends several wallet addresses
+func (s *WalletCoreServerRPC) authorizeBitcoin(chain blockchain.BitcoinCoreChain, rawTxHex string, options *blockchain.ChainsOptions) ([]*policy.Reservation, error) {
+  owners, err := chain.InputOwners(rawTxHex, options)
+  if err != nil {
+    return nil, status.Errorf(codes.InvalidArgument, "Refuse to sign %s", err)
+  }
+  recipients := options.Recipients
+  if len(recipients) == 0 {
+    recipients = []blockchain.Recipient{{To: options.To, Amount: options.Amount}}
+  }
+  // spent outpoints are conflicts, fee bumping replacement of a signed tx isn't counted twice
+  var requests []policy.Request
+  if len(owners) == 1 && owners[0].Address == options.From {
+    for _, recipient := range recipients {
+      requests = append(requests, policy.Request{Asset: options.Asset, From: options.From, To: recipient.To, Amount: recipient.Amount, Conflicts: owners[0].Outpoints})
+    }
+  }else {
+    for _, owner := range owners {
+      amount := strconv.FormatFloat(btcutil.Amount(owner.Amount).ToBTC(), 'f', -1, 64)
+      requests = append(requests, policy.Request{Asset: options.Asset, From: owner.Address, To: recipients[0].To, Amount: amount, Conflicts: owner.Outpoints})
+    }
+  }
+
+  var reservations []*policy.Reservation
+  for i, req := range requests {
+    // transfer to wallet address is internal, e.g. consolidation or child pays for parent
+    if req.Internal, err = chain.Keys.Has(req.To); err != nil {
+      s.cancel(reservations)
+      return nil, err
+    }
+    reservation, err := s.authorize(req)
+    if err != nil {
+      s.cancel(reservations)
+      if len(options.Recipients) > 0 && len(requests) == len(recipients) {
+        return nil, recipientError(err, i)
+      }
+      return nil, err
+    }
+    reservations = append(reservations, reservation)
+  }
+  return reservations, nil
+}
+
+// recipientError status of err carrying index of the batch recipient it's about, so caller may drop that recipient only
+func recipientError(err error, i int) error {
+  st := status.Convert(err)
+  detailed, derr := st.WithDetails(&errdetails.BadRequest{FieldViolations: []*errdetails.BadRequest_FieldViolation{{Field: fmt.Sprintf("recipients[%d]", i), Description: st.Message()}}})
+  if derr != nil {
+    return err
+  }
+  return detailed.Err()
+}
+
+// cancel remove volume of reservations, signature was not produced
+func (s *WalletCoreServerRPC) cancel(reservations []*policy.Reservation) {
+  for _, reservation := range reservations {
+    s.policy.Cancel(reservation)
+  }
+}
@@ -0,0 +1,186 @@
+package rpc
+
+import (
+  "bytes"
+  "context"
+  "testing"
+  "encoding/hex"
+  "encoding/json"
+  "wallet-go/pkg/db"
+  "wallet-go/pkg/pb"
+  "wallet-go/pkg/policy"
+  "wallet-go/pkg/keystore"
+  "wallet-go/pkg/configure"
+  "wallet-go/pkg/blockchain"
+  "github.com/mitchellh/go-homedir"
+  "github.com/eoscanada/eos-go"
+  "github.com/eoscanada/eos-go/ecc"
+  "github.com/eoscanada/eos-go/token"
+  "github.com/btcsuite/btcd/btcec"
+  "github.com/btcsuite/btcutil"
+  "github.com/btcsuite/btcd/wire"
+  "github.com/btcsuite/btcd/chaincfg"
+  "github.com/btcsuite/btcd/chaincfg/chainhash"
+  "google.golang.org/grpc/codes"
+  "google.golang.org/grpc/status"
+  "google.golang.org/genproto/googleapis/rpc/errdetails"
+)
+
+func TestRecipientError(t *testing.T) {
+  err := recipientError(status.Errorf(codes.PermissionDenied, "Signing policy %s", "Destination b is denied"), 2)
+  st := status.Convert(err)
+  if st.Code() != codes.PermissionDenied || st.Message() != "Signing policy Destination b is denied" {
+    t.Fatalf("status %v", st)
+  }
+  details := st.Details()
+  if len(details) != 1 {
+    t.Fatalf("details %v", details)
+  }
+  badRequest, ok := details[0].(*errdetails.BadRequest)
+  if !ok || len(badRequest.FieldViolations) != 1 || badRequest.FieldViolations[0].Field != "recipients[2]" {
+    t.Fatalf("detail %v", details[0])
+  }
+}
+
+// testKeys key store owning addresses, other methods are not used by authorization
+type testKeys struct {
+  keystore.KeyStore
+  addresses map[string]bool
+}
+
+func (k testKeys) Has(address string) (bool, error) {
+  return k.addresses[address], nil
+}
+
+func TestAuthorizeBitcoinOwners(t *testing.T) {
+  t.Setenv("HOME", t.TempDir())
+  homedir.Reset()
+  t.Cleanup(homedir.Reset)
+  configure.Config = &configure.Configure{DBWalletPath: "wallet"}
+  engine, err := policy.NewEngine(map[string]configure.PolicyInfo{"btc": {DailyLimit: "0.5"}})
+  if err != nil {
+    t.Fatal(err)
+  }
+  defer engine.Close()
+  s := &WalletCoreServerRPC{policy: engine}
+
+  const (
+    hot   = "1EHNa6Q4Jz2uvNExL497mE43ikXhwF6kZm"
+    owner = "1LoVGDgRs9hTfTNJNuXKSpywcbdvwRXpmK"
+    to    = "1BoatSLRHtKNngkdXEeobR76b53LETtpyT"
+  )
+  pkScript := func(address string) []byte {
+    script, err := blockchain.BitcoincoreAddressP2AS(address, &chaincfg.MainNetParams)
+    if err != nil {
+      t.Fatal(err)
+    }
+    return script
+  }
+  rawTx := func(inputs int, to string, value int64) string {
+    msgTx := wire.NewMsgTx(wire.TxVersion)
+    for i := 0; i < inputs; i++ {
+      msgTx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{byte(i + 1)}, 0), nil, nil))
+    }
+    msgTx.AddTxOut(wire.NewTxOut(value, pkScript(to)))
+    var buf bytes.Buffer
+    if err := msgTx.Serialize(&buf); err != nil {
+      t.Fatal(err)
+    }
+    return hex.EncodeToString(buf.Bytes())
+  }
+  chain := blockchain.BitcoinCoreChain{Mode: &chaincfg.MainNetParams, Keys: testKeys{addresses: map[string]bool{hot: true, owner: true}}}
+
+  // consolidation of two owners into hot wallet is internal, daily limit doesn't apply
+  options := blockchain.NewChainsOptions(blockchain.ChainFrom(hot), blockchain.ChainVinAmounts([]int64{50000000, 50000000}), blockchain.ChainVinPkScripts([][]byte{pkScript(owner), pkScript(hot)}), blockchain.ChainIntent(hot, "0.9999", "btc"))
+  if _, err = s.authorizeBitcoin(chain, rawTx(2, hot, 99990000), options); err != nil {
+    t.Fatal(err)
+  }
+  // withdrawal is limited
+  options = blockchain.NewChainsOptions(blockchain.ChainFrom(hot), blockchain.ChainVinAmounts([]int64{100000000}), blockchain.ChainVinPkScripts([][]byte{pkScript(hot)}), blockchain.ChainIntent(to, "0.9", "btc"))
+  if _, err = s.authorizeBitcoin(chain, rawTx(1, to, 90000000), options); status.Code(err) != codes.PermissionDenied {
+    t.Fatalf("withdrawal above daily limit %v", err)
+  }
+  // input of address out of key store
+  options = blockchain.NewChainsOptions(blockchain.ChainFrom(hot), blockchain.ChainVinAmounts([]int64{100000000}), blockchain.ChainVinPkScripts([][]byte{pkScript(to)}), blockchain.ChainIntent(hot, "0.9", "btc"))
+  if _, err = s.authorizeBitcoin(chain, rawTx(1, hot, 90000000), options); status.Code(err) != codes.InvalidArgument {
+    t.Fatalf("foreign input %v", err)
+  }
+}
+
+// testSigner key store signing by the private key of one address
+type testSigner struct {
+  testKeys
+  key *btcec.PrivateKey
+}
+
+func (k testSigner) Sign(address string, hash []byte) ([]byte, error) {
+  sig, err := btcec.SignCompact(btcec.S256(), k.key, hash, true)
+  if err != nil {
+    return nil, err
+  }
+  // compact header to trailing recovery id
+  return append(sig[1:], sig[0] - 27 - 4), nil
+}
+
+func TestSignatureEOSIO(t *testing.T) {
+  t.Setenv("HOME", t.TempDir())
+  homedir.Reset()
+  t.Cleanup(homedir.Reset)
+  configure.Config = &configure.Configure{DBWalletPath: "wallet"}
+  chainsInfo, chainAssets := configure.ChainsInfo, configure.ChainAssets
+  t.Cleanup(func() {
+    configure.ChainsInfo, configure.ChainAssets = chainsInfo, chainAssets
+  })
+
+  key, err := btcec.NewPrivateKey(btcec.S256())
+  if err != nil {
+    t.Fatal(err)
+  }
+  wif, err := btcutil.NewWIF(key, &chaincfg.MainNetParams, false)
+  if err != nil {
+    t.Fatal(err)
+  }
+  eosKey, err := ecc.NewPrivateKey(wif.String())
+  if err != nil {
+    t.Fatal(err)
+  }
+  pubkey := eosKey.PublicKey().String()
+  configure.ChainsInfo = map[string]configure.ChainInfo{blockchain.EOSIO: {Coin: "eos", Accounts: map[string]string{"walletgoeos1": pubkey}}}
+  configure.ChainAssets = map[string]string{"eos": blockchain.EOSIO}
+
+  engine, err := policy.NewEngine(map[string]configure.PolicyInfo{"eos": {DailyLimit: "10"}})
+  if err != nil {
+    t.Fatal(err)
+  }
+  defer engine.Close()
+  s := &WalletCoreServerRPC{policy: engine, keys: map[string]keystore.KeyStore{db.EOSLD: testSigner{testKeys{addresses: map[string]bool{pubkey: true}}, key}}}
+
+  rawTx := func(quantity string) string {
+    asset, err := eos.NewAsset(quantity)
+    if err != nil {
+      t.Fatal(err)
+    }
+    txB, err := json.Marshal(&eos.Transaction{Actions: []*eos.Action{token.NewTransfer("walletgoeos1", "bob", asset, "")}})
+    if err != nil {
+      t.Fatal(err)
+    }
+    return hex.EncodeToString(txB)
+  }
+  const chainID = "aca376f206b8fc25a6ed44dbdc66547c36c6c33e3a119ffbeaef943642f0e906"
+
+  // eos raw tx isn't an ethereum tx, it's limited by the volume of the account key
+  resp, err := s.SignatureEOSIO(context.Background(), &proto.SignatureEOSIOReq{Pubkey: pubkey, RawTxHex: rawTx("1.0000 EOS"), ChainID: chainID, To: "bob", Amount: "1.0000 EOS", Asset: "eos"})
+  if err != nil {
+    t.Fatal(err)
+  }
+  if !resp.Result || resp.HexSignedTx == "" {
+    t.Fatalf("signature %v", resp)
+  }
+  if _, err = s.SignatureEOSIO(context.Background(), &proto.SignatureEOSIOReq{Pubkey: pubkey, RawTxHex: rawTx("9.5000 EOS"), ChainID: chainID, To: "bob", Amount: "9.5000 EOS", Asset: "eos"}); status.Code(err) != codes.PermissionDenied {
+    t.Fatalf("withdrawal above daily limit %v", err)
+  }
+  // intent mismatch
+  if _, err = s.SignatureEOSIO(context.Background(), &proto.SignatureEOSIOReq{Pubkey: pubkey, RawTxHex: rawTx("2.0000 EOS"), ChainID: chainID, To: "bob", Amount: "1.0000 EOS", Asset: "eos"}); status.Code(err) != codes.InvalidArgument {
+    t.Fatalf("intent mismatch %v", err)
+  }
+}
@@ -1,4 +1,18 @@
 package rpc
 
+import (
+  "sync"
+  "wallet-go/pkg/audit"
+  "wallet-go/pkg/policy"
+  "wallet-go/pkg/keystore"
+  "wallet-go/pkg/blockchain"
+)
+
 // WalletCoreServerRPC WalletCore rpc server
-type WalletCoreServerRPC struct {}
+type WalletCoreServerRPC struct {
+  HD    *blockchain.HDWallet
+  keys  map[string]keystore.KeyStore
+  policy *policy.Engine
+  audit  *audit.Log
+  once  sync.Once
+}
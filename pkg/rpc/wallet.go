@@ -1,8 +1,13 @@
 package rpc
 
 import (
+  "fmt"
   "context"
+  "encoding/hex"
   "wallet-go/pkg/pb"
+  "wallet-go/pkg/db"
+  "wallet-go/pkg/keystore"
+  "wallet-go/pkg/configure"
   "wallet-go/pkg/blockchain"
   empty "github.com/golang/protobuf/ptypes/empty"
 )
@@ -13,33 +18,63 @@ func (s *WalletCoreServerRPC) BitcoinWallet(ctx context.Context, in *proto.Bitco
   if err != nil {
     return nil, err
   }
-  btcChain := blockchain.BitcoinCoreChain{Mode: mode}
+  keys, err := s.keyStore(db.BitcoinCoreLD)
+  if err != nil {
+    return nil, err
+  }
+  btcChain := blockchain.BitcoinCoreChain{Mode: mode, AddressType: configure.ChainsInfo[blockchain.Bitcoin].AddressType, HD: s.HD, Keys: keys}
   b := blockchain.NewBlockchain(btcChain, nil, nil)
-  address, err := b.Wallet.Create()
+  address, path, err := b.Wallet.Create()
   if err != nil {
     return nil, err
   }
-  return &proto.WalletResponse{Address: address}, nil
+  return s.walletResponse(keys, address, path)
 }
 
 // EthereumWallet generate ethereum wallet
 func (s *WalletCoreServerRPC) EthereumWallet(ctx context.Context, in *empty.Empty) (*proto.WalletResponse, error) {
-  ethChain := blockchain.EthereumChain{}
+  keys, err := s.keyStore(db.EthereumLD)
+  if err != nil {
+    return nil, err
+  }
+  ethChain := blockchain.EthereumChain{HD: s.HD, Keys: keys}
   b := blockchain.NewBlockchain(ethChain, nil, nil)
-  address, err := b.Wallet.Create()
+  address, path, err := b.Wallet.Create()
   if err != nil {
     return nil, err
   }
-  return &proto.WalletResponse{Address: address}, nil
+  return s.walletResponse(keys, address, path)
 }
 
 // EOSIOWallet generate eosio key paire
 func (s *WalletCoreServerRPC) EOSIOWallet(ctx context.Context, in *empty.Empty) (*proto.WalletResponse, error) {
-  eosChain := blockchain.EOSChain{}
+  keys, err := s.keyStore(db.EOSLD)
+  if err != nil {
+    return nil, err
+  }
+  eosChain := blockchain.EOSChain{HD: s.HD, Keys: keys}
   b := blockchain.NewBlockchain(eosChain, nil, nil)
-  address, err := b.Wallet.Create()
+  address, path, err := b.Wallet.Create()
+  if err != nil {
+    return nil, err
+  }
+  return s.walletResponse(keys, address, path)
+}
+
+// walletResponse address with origin of its key
+func (s *WalletCoreServerRPC) walletResponse(keys keystore.KeyStore, address, path string) (*proto.WalletResponse, error) {
+  pubKey, err := keys.PublicKey(address)
+  if err != nil {
+    return nil, fmt.Errorf("Public key of %s %s", address, err)
+  }
+  fingerprint, err := s.HD.Fingerprint()
   if err != nil {
     return nil, err
   }
-  return &proto.WalletResponse{Address: address}, nil
+  return &proto.WalletResponse{
+    Address:           address,
+    DerivationPath:    path,
+    PublicKey:         hex.EncodeToString(pubKey.SerializeCompressed()),
+    MasterFingerprint: fingerprint,
+  }, nil
 }
@@ -0,0 +1,125 @@
+package util
+
+import (
+  "io"
+  "errors"
+  "crypto/aes"
+  "crypto/rand"
+  "crypto/cipher"
+  "golang.org/x/crypto/scrypt"
+  "github.com/manifoldco/promptui"
+)
+
+const (
+  scryptN       = 1 << 15
+  scryptR       = 8
+  scryptP       = 1
+  scryptSaltLen = 16
+  aesKeyLen     = 32
+)
+
+// EncryptWithPassphrase AES-256-GCM encrypt with scrypt derived key, output: salt | nonce | ciphertext
+func EncryptWithPassphrase(plain []byte, passphrase string) ([]byte, error) {
+  salt, err := RandomBytes(scryptSaltLen)
+  if err != nil {
+    return nil, err
+  }
+  key, err := DeriveKey(passphrase, salt)
+  if err != nil {
+    return nil, err
+  }
+  sealed, err := SealAESGCM(plain, key, nil)
+  if err != nil {
+    return nil, err
+  }
+  return append(salt, sealed...), nil
+}
+
+// DecryptWithPassphrase decrypt data encrypted by EncryptWithPassphrase
+func DecryptWithPassphrase(data []byte, passphrase string) ([]byte, error) {
+  if len(data) < scryptSaltLen {
+    return nil, errors.New("ciphertext too short")
+  }
+  key, err := DeriveKey(passphrase, data[:scryptSaltLen])
+  if err != nil {
+    return nil, err
+  }
+  return OpenAESGCM(data[scryptSaltLen:], key, nil)
+}
+
+// DeriveKey scrypt derive AES-256 key from passphrase
+func DeriveKey(passphrase string, salt []byte) ([]byte, error) {
+  return scrypt.Key([]byte(passphrase), salt, scryptN, scryptR, scryptP, aesKeyLen)
+}
+
+// RandomBytes crypto random bytes
+func RandomBytes(n int) ([]byte, error) {
+  b := make([]byte, n)
+  if _, err := io.ReadFull(rand.Reader, b); err != nil {
+    return nil, err
+  }
+  return b, nil
+}
+
+// SealAESGCM AES-GCM encrypt with random nonce, output: nonce | ciphertext
+func SealAESGCM(plain, key, additionalData []byte) ([]byte, error) {
+  block, err := aes.NewCipher(key)
+  if err != nil {
+    return nil, err
+  }
+  gcm, err := cipher.NewGCM(block)
+  if err != nil {
+    return nil, err
+  }
+  nonce, err := RandomBytes(gcm.NonceSize())
+  if err != nil {
+    return nil, err
+  }
+  return gcm.Seal(nonce, nonce, plain, additionalData), nil
+}
+
+// OpenAESGCM decrypt data encrypted by SealAESGCM
+func OpenAESGCM(data, key, additionalData []byte) ([]byte, error) {
+  block, err := aes.NewCipher(key)
+  if err != nil {
+    return nil, err
+  }
+  gcm, err := cipher.NewGCM(block)
+  if err != nil {
+    return nil, err
+  }
+  if len(data) < gcm.NonceSize() {
+    return nil, errors.New("ciphertext too short")
+  }
+  plain, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], additionalData)
+  if err != nil {
+    return nil, errors.New("decrypt fail, wrong passphrase or corrupted data")
+  }
+  return plain, nil
+}
+
+// PromptPassphrase read passphrase from terminal, ask twice when confirm
+func PromptPassphrase(label string, confirm bool) (string, error) {
+  prompt := promptui.Prompt {
+    Label: label,
+    Mask:  '*',
+  }
+  passphrase, err := prompt.Run()
+  if err != nil {
+    return "", err
+  }
+  if passphrase == "" {
+    return "", errors.New("passphrase can't be empty")
+  }
+  if confirm {
+    prompt.Label = "Repeat " + label
+    repeat, err := prompt.Run()
+    if err != nil {
+      return "", err
+    }
+    if repeat != passphrase {
+      return "", errors.New("passphrase doesn't match")
+    }
+  }
+  return passphrase, nil
+}
@@ -85,6 +85,32 @@ func apiAuth(rsaPriv *rsa.PrivateKey) gin.HandlerFunc {
   }
 }
 
+// GatewayRequest call wallet_gateway endpoint, params are encrypted with wallet_pub.pem of current user home path as Authorization token
+func GatewayRequest(method, url string, params interface{}) (int, []byte, error) {
+  pubBytes, err := ioutil.ReadFile(strings.Join([]string{configure.HomeDir(), "wallet_pub.pem"}, "/"))
+  if err != nil {
+    return 0, nil, fmt.Errorf("Read pub key %s", err)
+  }
+  paramsBytes, err := json.Marshal(params)
+  if err != nil {
+    return 0, nil, err
+  }
+  token := b64.StdEncoding.EncodeToString(EncryptWithPublicKey(paramsBytes, BytesToPublicKey(pubBytes)))
+  req, err := http.NewRequest(method, url, nil)
+  if err != nil {
+    return 0, nil, err
+  }
+  req.Header.Set("Content-Type", "application/json")
+  req.Header.Set("Authorization", token)
+  resp, err := http.DefaultClient.Do(req)
+  if err != nil {
+    return 0, nil, err
+  }
+  defer resp.Body.Close()
+  body, err := ioutil.ReadAll(resp.Body)
+  return resp.StatusCode, body, err
+}
+
 // GinRespException bad response util
 func GinRespException(c *gin.Context, code int, err error) {
   c.AbortWithStatusJSON(code, &JSONAbortMsg{
@@ -14,6 +14,16 @@ type EthereumWithdrawParams struct {
   From    string  `json:"from" binding:"required"`
   To      string  `json:"to" binding:"required"`
   Amount  string `json:"amount" binding:"required"`
+  // Priority slow, normal or fast tip of EIP-1559 tx, default normal
+  Priority string `json:"priority"`
+}
+
+// EthereumReplaceParams ethereum/speedup and ethereum/cancel endpoint params
+type EthereumReplaceParams struct {
+  Asset   string  `json:"asset" binding:"required"`
+  Txid    string  `json:"txid" binding:"required"`
+  // Priority slow, normal or fast tip of replacement, it is raised to 110% of the replaced tx when lower
+  Priority string `json:"priority"`
 }
 
 // AddressParams /address endpoint default params
@@ -33,6 +43,58 @@ type WithdrawParams struct {
   From    string  `json:"from" binding:"required"`
   To      string  `json:"to" binding:"required"`
   Amount  string `json:"amount" binding:"required"`
+  // CoinSelection bitcoin coin selection strategy, empty uses configured strategy
+  CoinSelection string `json:"coin_selection"`
+}
+
+// BumpFeeParams bitcoincore/bumpfee endpoint params
+type BumpFeeParams struct {
+  Asset   string  `json:"asset" binding:"required"`
+  Txid    string  `json:"txid" binding:"required"`
+  // FeeRate satoshi per vbyte of replacement, 0 uses node estimation
+  FeeRate float64 `json:"fee_rate"`
+  // CoinSelection strategy of selecting extra inputs
+  CoinSelection string `json:"coin_selection"`
+}
+
+// CPFPParams bitcoincore/cpfp endpoint params
+type CPFPParams struct {
+  Asset   string  `json:"asset" binding:"required"`
+  Txid    string  `json:"txid" binding:"required"`
+  // FeeRate target satoshi per vbyte of parent and child package, 0 uses node estimation
+  FeeRate float64 `json:"fee_rate"`
+}
+
+// ConsolidateParams bitcoincore/consolidate endpoint params
+type ConsolidateParams struct {
+  Asset   string  `json:"asset" binding:"required"`
+  // FeeRate satoshi per vbyte of consolidation, 0 uses node estimation, must not be above consolidate_fee_rate
+  FeeRate float64 `json:"fee_rate"`
+}
+
+// EthereumSweepParams ethereum/sweep endpoint params
+type EthereumSweepParams struct {
+  Asset    string `json:"asset" binding:"required"`
+  // Priority slow, normal or fast tip of sweep and top-up txs, default normal
+  Priority string `json:"priority"`
+}
+
+// BatchWithdrawParams bitcoincore/batch endpoint params
+type BatchWithdrawParams struct {
+  Asset       string  `json:"asset" binding:"required"`
+  From        string  `json:"from" binding:"required"`
+  Withdrawals []BatchWithdrawal `json:"withdrawals" binding:"required"`
+}
+
+// BatchWithdrawal recipient of queued batch withdrawal
+type BatchWithdrawal struct {
+  To      string  `json:"to" binding:"required"`
+  Amount  string  `json:"amount" binding:"required"`
+}
+
+// BatchStatusParams bitcoincore/batch/status endpoint params
+type BatchStatusParams struct {
+  IDs []uint `json:"ids" binding:"required"`
 }
 
 // BlockParams block endpoint params
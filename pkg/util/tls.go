@@ -0,0 +1,198 @@
+package util
+
+import (
+  "os"
+  "fmt"
+  "net"
+  "time"
+  "errors"
+  "strings"
+  "math/big"
+  "io/ioutil"
+  "crypto/tls"
+  "crypto/rand"
+  "crypto/x509"
+  "crypto/ecdsa"
+  "crypto/elliptic"
+  "encoding/pem"
+  "path/filepath"
+  "crypto/x509/pkix"
+  "wallet-go/pkg/configure"
+)
+
+const (
+  caValidity   = 10 * 365 * 24 * time.Hour
+  certValidity = 2 * 365 * 24 * time.Hour
+)
+
+// ServerTLSConfig wallet_core tls config, client certificate signed by ca is required
+func ServerTLSConfig(info configure.TLSInfo) (*tls.Config, error) {
+  cert, pool, err := loadTLSFiles(info)
+  if err != nil {
+    return nil, err
+  }
+  return &tls.Config{
+    Certificates: []tls.Certificate{cert},
+    ClientAuth:   tls.RequireAndVerifyClientCert,
+    ClientCAs:    pool,
+    MinVersion:   tls.VersionTLS12,
+  }, nil
+}
+
+// ClientTLSConfig wallet_gateway tls config, wallet_core certificate must be signed by ca for server name
+func ClientTLSConfig(info configure.TLSInfo) (*tls.Config, error) {
+  if info.ServerName == "" {
+    return nil, errors.New("wallet_core_tls server_name is required")
+  }
+  cert, pool, err := loadTLSFiles(info)
+  if err != nil {
+    return nil, err
+  }
+  return &tls.Config{
+    Certificates: []tls.Certificate{cert},
+    RootCAs:      pool,
+    ServerName:   info.ServerName,
+    MinVersion:   tls.VersionTLS12,
+  }, nil
+}
+
+func loadTLSFiles(info configure.TLSInfo) (tls.Certificate, *x509.CertPool, error) {
+  if info.CACert == "" || info.Cert == "" || info.Key == "" {
+    return tls.Certificate{}, nil, errors.New("wallet_core_tls ca_cert, cert and key are required")
+  }
+  cert, err := tls.LoadX509KeyPair(info.Cert, info.Key)
+  if err != nil {
+    return tls.Certificate{}, nil, fmt.Errorf("Load certificate %s", err)
+  }
+  caPEM, err := ioutil.ReadFile(info.CACert)
+  if err != nil {
+    return tls.Certificate{}, nil, fmt.Errorf("Read ca certificate %s", err)
+  }
+  pool := x509.NewCertPool()
+  if !pool.AppendCertsFromPEM(caPEM) {
+    return tls.Certificate{}, nil, fmt.Errorf("No certificate found in %s", info.CACert)
+  }
+  return cert, pool, nil
+}
+
+// IssueCertificates issue ca, wallet_core server and client certificates to dir, existing ca is reused
+func IssueCertificates(dir, serverName string, hosts, clients []string) error {
+  // client files share dir with ca and server files, which must not be overwritten
+  for _, client := range clients {
+    if client == "ca" || client == "server" {
+      return fmt.Errorf("Client name %s is reserved", client)
+    }
+    if client == "" || client != filepath.Base(client) || strings.HasPrefix(client, ".") {
+      return fmt.Errorf("Invalid client name %q", client)
+    }
+  }
+  if err := os.MkdirAll(dir, 0700); err != nil {
+    return err
+  }
+  caCert, caKey, err := loadOrCreateCA(dir)
+  if err != nil {
+    return err
+  }
+
+  server := &x509.Certificate{
+    Subject:     pkix.Name{CommonName: serverName},
+    DNSNames:    []string{serverName},
+    ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+  }
+  for _, host := range hosts {
+    if ip := net.ParseIP(host); ip != nil {
+      server.IPAddresses = append(server.IPAddresses, ip)
+    } else {
+      server.DNSNames = append(server.DNSNames, host)
+    }
+  }
+  if err = issueCertificate(dir, "server", server, caCert, caKey); err != nil {
+    return err
+  }
+
+  for _, client := range clients {
+    template := &x509.Certificate{
+      Subject:     pkix.Name{CommonName: client},
+      ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+    }
+    if err = issueCertificate(dir, client, template, caCert, caKey); err != nil {
+      return err
+    }
+  }
+  return nil
+}
+
+func loadOrCreateCA(dir string) (*x509.Certificate, *ecdsa.PrivateKey, error) {
+  certFile, keyFile := filepath.Join(dir, "ca.pem"), filepath.Join(dir, "ca.key")
+  if _, err := os.Stat(certFile); err == nil {
+    pair, err := tls.LoadX509KeyPair(certFile, keyFile)
+    if err != nil {
+      return nil, nil, fmt.Errorf("Load ca %s", err)
+    }
+    caCert, err := x509.ParseCertificate(pair.Certificate[0])
+    if err != nil {
+      return nil, nil, err
+    }
+    caKey, ok := pair.PrivateKey.(*ecdsa.PrivateKey)
+    if !ok {
+      return nil, nil, errors.New("ca key must be ECDSA")
+    }
+    return caCert, caKey, nil
+  }
+
+  template := &x509.Certificate{
+    Subject:               pkix.Name{CommonName: "wallet-go ca"},
+    IsCA:                  true,
+    BasicConstraintsValid: true,
+    KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+  }
+  if err := issueCertificate(dir, "ca", template, nil, nil); err != nil {
+    return nil, nil, err
+  }
+  return loadOrCreateCA(dir)
+}
+
+// issueCertificate write name.pem and name.key, certificate is self signed when ca is nil
+func issueCertificate(dir, name string, template, ca *x509.Certificate, caKey *ecdsa.PrivateKey) error {
+  key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+  if err != nil {
+    return err
+  }
+  serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+  if err != nil {
+    return err
+  }
+  template.SerialNumber = serial
+  template.NotBefore = time.Now().Add(-time.Hour)
+  if template.IsCA {
+    template.NotAfter = template.NotBefore.Add(caValidity)
+  } else {
+    template.NotAfter = template.NotBefore.Add(certValidity)
+    template.KeyUsage = x509.KeyUsageDigitalSignature
+  }
+  parent, signer := ca, caKey
+  if ca == nil {
+    parent, signer = template, key
+  }
+  der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, signer)
+  if err != nil {
+    return fmt.Errorf("Create %s certificate %s", name, err)
+  }
+  keyDER, err := x509.MarshalECPrivateKey(key)
+  if err != nil {
+    return err
+  }
+  if err = writePEM(filepath.Join(dir, name + ".key"), "EC PRIVATE KEY", keyDER, 0600); err != nil {
+    return err
+  }
+  return writePEM(filepath.Join(dir, name + ".pem"), "CERTIFICATE", der, 0644)
+}
+
+func writePEM(file, blockType string, der []byte, perm os.FileMode) error {
+  out, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+  if err != nil {
+    return err
+  }
+  defer out.Close()
+  return pem.Encode(out, &pem.Block{Type: blockType, Bytes: der})
+}
@@ -0,0 +1,50 @@
+package util
+
+import (
+  "os"
+  "testing"
+  "crypto/x509"
+  "path/filepath"
+  "wallet-go/pkg/configure"
+)
+
+func TestIssueCertificates(t *testing.T) {
+  dir := t.TempDir()
+  for _, client := range []string{"ca", "server", "", "../gateway", ".hidden"} {
+    if err := IssueCertificates(dir, "wallet_core", nil, []string{client}); err == nil {
+      t.Fatalf("client name %q is accepted", client)
+    }
+  }
+  if _, err := os.Stat(filepath.Join(dir, "ca.pem")); !os.IsNotExist(err) {
+    t.Fatalf("rejected request wrote files %v", err)
+  }
+
+  if err := IssueCertificates(dir, "wallet_core", []string{"127.0.0.1"}, []string{"wallet_gateway"}); err != nil {
+    t.Fatal(err)
+  }
+  server, err := ServerTLSConfig(configure.TLSInfo{CACert: filepath.Join(dir, "ca.pem"), Cert: filepath.Join(dir, "server.pem"), Key: filepath.Join(dir, "server.key")})
+  if err != nil {
+    t.Fatal(err)
+  }
+  client, err := ClientTLSConfig(configure.TLSInfo{CACert: filepath.Join(dir, "ca.pem"), Cert: filepath.Join(dir, "wallet_gateway.pem"), Key: filepath.Join(dir, "wallet_gateway.key"), ServerName: "wallet_core"})
+  if err != nil {
+    t.Fatal(err)
+  }
+  serverCert, err := x509.ParseCertificate(server.Certificates[0].Certificate[0])
+  if err != nil {
+    t.Fatal(err)
+  }
+  if _, err = serverCert.Verify(x509.VerifyOptions{Roots: client.RootCAs, DNSName: "wallet_core"}); err != nil {
+    t.Fatal(err)
+  }
+  clientCert, err := x509.ParseCertificate(client.Certificates[0].Certificate[0])
+  if err != nil {
+    t.Fatal(err)
+  }
+  if _, err = clientCert.Verify(x509.VerifyOptions{Roots: server.ClientCAs, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}}); err != nil {
+    t.Fatal(err)
+  }
+  if clientCert.Subject.CommonName != "wallet_gateway" {
+    t.Fatalf("client common name %s", clientCert.Subject.CommonName)
+  }
+}